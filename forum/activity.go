@@ -0,0 +1,144 @@
+// forum/activity.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// activityExcerpt is how many characters of a post body the feed shows.
+const activityExcerpt = 200
+
+// Kinds of ActivityItem.
+const (
+	ActivityTopic = "topic"
+	ActivityPost  = "post"
+)
+
+// ActivityItem is a topic started or a post written by a member.
+type ActivityItem struct {
+	Kind       string
+	TopicID    string
+	TopicTitle string
+	// PostID and Excerpt are set for posts.
+	PostID  int64
+	Excerpt string
+	// State is the post's moderation state; topics are always visible.
+	State     string
+	CreatedAt time.Time
+}
+
+// ActivityViewData is the data structure for the activity page.
+type ActivityViewData struct {
+	User    *Viewer
+	Profile ProfileView
+	// Own is set when members look at their own activity, which includes
+	// posts waiting for or removed by moderation.
+	Own        bool
+	Items      []ActivityView
+	Pagination PaginationData
+}
+
+// showActivity serves GET /users/{handle}/activity.
+func (h *Handlers) showActivity(w http.ResponseWriter, r *http.Request) {
+	profile, err := h.db.WithContext(r.Context()).GetUserByHandle(r.PathValue("handle"))
+	if err != nil {
+		writeError(w, err, "user")
+		return
+	}
+	h.renderActivity(w, r, profile)
+}
+
+// showOwnActivity serves GET /activity, the signed-in member's own feed.
+func (h *Handlers) showOwnActivity(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	h.renderActivity(w, r, user)
+}
+
+func (h *Handlers) renderActivity(w http.ResponseWriter, r *http.Request, profile *User) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	user, _ := r.Context().Value(userContextKey).(*User)
+	own := user != nil && user.ID == profile.ID
+	db := h.db.WithContext(r.Context())
+	pageSize := pageSizeFor(user)
+	items, err := db.ListUserActivity(profile.ID, own, page, pageSize)
+	if err != nil {
+		log.Printf("Error listing activity: %v", err)
+		http.Error(w, "Failed to retrieve activity", http.StatusInternalServerError)
+		return
+	}
+	total, err := db.CountUserActivity(profile.ID, own)
+	if err != nil {
+		log.Printf("Error counting activity: %v", err)
+		http.Error(w, "Failed to retrieve activity", http.StatusInternalServerError)
+		return
+	}
+	link := pageLink("/users/"+profile.Handle+"/activity", nil)
+	if r.URL.Path == "/activity" {
+		link = pageLink("/activity", nil)
+	}
+	data := ActivityViewData{
+		User:       NewViewer(user),
+		Profile:    NewProfileView(profile),
+		Own:        own,
+		Items:      NewActivityViews(items),
+		Pagination: newPagination(page, total, pageSize, link),
+	}
+	if err := h.templates.ExecuteTemplate(w, "activity.html", data); err != nil {
+		log.Printf("Error executing activity template: %v", err)
+	}
+}
+
+// --- Activity Database Functions ---
+
+// activityQuery selects a member's live topics and posts as ActivityItem
+// columns. $1 is the user ID and $2 whether held and hidden posts count.
+var activityQuery = fmt.Sprintf(`SELECT '%s', t.id, t.title, 0::bigint, '', '%s', t.created_at
+              FROM topics t
+              WHERE t.author_id = $1 AND %s
+              UNION ALL
+              SELECT '%s', p.topic_id, t.title, p.id::bigint, left(p.body, %d), p.state, p.created_at
+              FROM posts p JOIN topics t ON t.id = p.topic_id
+              WHERE p.author_id = $1 AND %s AND %s AND ($2 OR p.state = '%s')`,
+	ActivityTopic, PostVisible, notDeleted("t"),
+	ActivityPost, activityExcerpt, notDeleted("p"), notDeleted("t"), PostVisible)
+
+// ListUserActivity returns a page of the topics and posts the user wrote,
+// newest first. Posts that aren't visible are included only if withHidden
+// is set.
+func (d *Database) ListUserActivity(userID string, withHidden bool, page, pageSize int) ([]ActivityItem, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := activityQuery + ` ORDER BY 7 DESC, 4 DESC LIMIT $3 OFFSET $4`
+	rows, err := d.readQuery(ctx, query, userID, withHidden, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ActivityItem
+	for rows.Next() {
+		var it ActivityItem
+		if err := rows.Scan(&it.Kind, &it.TopicID, &it.TopicTitle, &it.PostID, &it.Excerpt, &it.State, &it.CreatedAt); err != nil {
+			return nil, err
+		}
+		it.Excerpt = strings.TrimSpace(it.Excerpt)
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// CountUserActivity counts what ListUserActivity pages through.
+func (d *Database) CountUserActivity(userID string, withHidden bool) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var n int
+	err := d.readQueryRow(ctx, `SELECT COUNT(*) FROM (`+activityQuery+`) a`, userID, withHidden).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,159 @@
+// forum/admin.go
+package forum
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// AdminUserViewData is the data structure for the admin view of a single user.
+type AdminUserViewData struct {
+	User       *Viewer
+	Target     AccountView
+	Notes      []UserNote
+	Suspension *Suspension
+	LegalHold  *LegalHold
+}
+
+// handleAdmin dispatches the /admin/... routes, which RegisterRoutes limits
+// to admins.
+func (h *Handlers) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "audit" && r.Method == http.MethodGet:
+		h.showAuditLog(w, r)
+	case len(parts) == 1 && parts[0] == "auth" && r.Method == http.MethodGet:
+		h.showAuthEvents(w, r)
+	case len(parts) == 1 && parts[0] == "credentials" && r.Method == http.MethodGet:
+		h.showCredentials(w, r, nil)
+	case len(parts) == 2 && parts[0] == "credentials" && parts[1] == "revoke" && r.Method == http.MethodPost:
+		h.revokeCredentialsForm(w, r)
+	case len(parts) == 1 && parts[0] == "hooks" && r.Method == http.MethodGet:
+		h.showIncomingHooks(w, r, IncomingHooksViewData{})
+	case len(parts) == 1 && parts[0] == "hooks" && r.Method == http.MethodPost:
+		h.createIncomingHook(w, r)
+	case len(parts) == 3 && parts[0] == "hooks" && parts[2] == "delete" && r.Method == http.MethodPost:
+		h.deleteIncomingHook(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "invites" && r.Method == http.MethodGet:
+		h.showAdminInvites(w, r)
+	case len(parts) == 1 && parts[0] == "mail" && r.Method == http.MethodGet:
+		h.showMailTemplates(w, r)
+	case len(parts) == 3 && parts[0] == "mail" && r.Method == http.MethodGet:
+		h.previewMail(w, r, parts[1], parts[2])
+	case len(parts) == 1 && parts[0] == "queue" && r.Method == http.MethodGet:
+		h.showModQueue(w, r)
+	case len(parts) == 3 && parts[0] == "queue" && parts[2] == "resolve" && r.Method == http.MethodPost:
+		h.resolveQueueItem(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "queue" && parts[2] == "approve" && r.Method == http.MethodPost:
+		h.approveQueueItem(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "scheduled" && r.Method == http.MethodGet:
+		h.showScheduled(w, r, "")
+	case len(parts) == 1 && parts[0] == "scheduled" && r.Method == http.MethodPost:
+		h.scheduleAnnouncement(w, r)
+	case len(parts) == 3 && parts[0] == "scheduled" && parts[2] == "delete" && r.Method == http.MethodPost:
+		h.cancelScheduled(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "webhooks" && r.Method == http.MethodGet:
+		h.showWebhooks(w, r, "")
+	case len(parts) == 1 && parts[0] == "webhooks" && r.Method == http.MethodPost:
+		h.createWebhook(w, r)
+	case len(parts) == 3 && parts[0] == "webhooks" && parts[2] == "delete" && r.Method == http.MethodPost:
+		h.deleteWebhook(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "rules" && r.Method == http.MethodGet:
+		h.showRules(w, r, "")
+	case len(parts) == 1 && parts[0] == "rules" && r.Method == http.MethodPost:
+		h.saveRule(w, r)
+	case len(parts) == 3 && parts[0] == "rules" && parts[2] == "delete" && r.Method == http.MethodPost:
+		h.deleteRule(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "tags" && r.Method == http.MethodGet:
+		h.showTags(w, r, "")
+	case len(parts) == 2 && parts[0] == "tags" && parts[1] == "rename" && r.Method == http.MethodPost:
+		h.renameTag(w, r)
+	case len(parts) == 2 && parts[0] == "tags" && parts[1] == "merge" && r.Method == http.MethodPost:
+		h.mergeTags(w, r)
+	case len(parts) == 2 && parts[0] == "tags" && parts[1] == "delete" && r.Method == http.MethodPost:
+		h.deleteTag(w, r)
+	case len(parts) == 2 && parts[0] == "tags" && parts[1] == "describe" && r.Method == http.MethodPost:
+		h.describeTag(w, r)
+	case len(parts) == 2 && parts[0] == "tags" && parts[1] == "prune" && r.Method == http.MethodPost:
+		h.pruneTags(w, r)
+	case len(parts) == 2 && parts[0] == "tags" && parts[1] == "synonyms" && r.Method == http.MethodPost:
+		h.addTagSynonym(w, r)
+	case len(parts) == 3 && parts[0] == "tags" && parts[1] == "synonyms" && parts[2] == "delete" && r.Method == http.MethodPost:
+		h.removeTagSynonym(w, r)
+	case len(parts) == 1 && parts[0] == "users" && r.Method == http.MethodGet:
+		h.showAdminUsers(w, r)
+	case len(parts) == 2 && parts[0] == "users" && parts[1] == "import" && r.Method == http.MethodPost:
+		h.importUsers(w, r)
+	case len(parts) == 2 && parts[0] == "users" && r.Method == http.MethodGet:
+		h.showAdminUser(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "impersonate" && r.Method == http.MethodPost:
+		h.startImpersonation(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "suspend" && r.Method == http.MethodPost:
+		h.suspendUser(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "unsuspend" && r.Method == http.MethodPost:
+		h.liftSuspension(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "hold" && r.Method == http.MethodPost:
+		h.holdUserForm(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "release-hold" && r.Method == http.MethodPost:
+		h.releaseUserHoldForm(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "promote" && r.Method == http.MethodPost:
+		h.setUserAdmin(w, r, parts[1], true)
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "demote" && r.Method == http.MethodPost:
+		h.setUserAdmin(w, r, parts[1], false)
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "ban" && r.Method == http.MethodPost:
+		h.banUser(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "unban" && r.Method == http.MethodPost:
+		h.unbanUser(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "reset-password" && r.Method == http.MethodPost:
+		h.forcePasswordReset(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "revoke-sessions" && r.Method == http.MethodPost:
+		h.revokeSessions(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "revoke-key" && r.Method == http.MethodPost:
+		h.revokeAPIKey(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "delete" && r.Method == http.MethodPost:
+		h.deleteUser(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "notes" && r.Method == http.MethodPost:
+		h.addUserNote(w, r, parts[1])
+	case len(parts) == 5 && parts[0] == "users" && parts[2] == "notes" && parts[4] == "delete" && r.Method == http.MethodPost:
+		h.deleteUserNote(w, r, parts[1], parts[3])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// showAdminUser renders /admin/users/{id}.
+func (h *Handlers) showAdminUser(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target, err := h.db.GetUserByIDIncludeDeleted(userID)
+	if err != nil {
+		writeError(w, err, "user")
+		return
+	}
+
+	notes, err := h.db.GetUserNotes(target.ID)
+	if err != nil {
+		log.Printf("Error getting user notes: %v", err)
+		http.Error(w, "Failed to retrieve notes", http.StatusInternalServerError)
+		return
+	}
+
+	suspension, err := h.db.GetActiveSuspension(target.ID)
+	if err != nil {
+		log.Printf("Error getting suspension: %v", err)
+		http.Error(w, "Failed to retrieve suspension", http.StatusInternalServerError)
+		return
+	}
+
+	hold, err := h.db.GetLegalHold(HoldTargetUser, target.ID)
+	if err != nil {
+		log.Printf("Error getting legal hold: %v", err)
+		http.Error(w, "Failed to retrieve legal hold", http.StatusInternalServerError)
+		return
+	}
+
+	data := AdminUserViewData{User: NewViewer(staff), Target: NewAccountView(target), Notes: notes, Suspension: suspension, LegalHold: hold}
+	if err := h.templates.ExecuteTemplate(w, "admin_user.html", data); err != nil {
+		log.Printf("Error executing admin user template: %v", err)
+	}
+}
@@ -0,0 +1,587 @@
+// forum/admincontent.go
+package forum
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// TopicUpdate is the body of PATCH /api/admin/topics/{id}. Omitted fields are
+// left alone. Version, or an If-Match header, makes the edit conditional.
+type TopicUpdate struct {
+	Title   *string   `json:"title"`
+	Tags    *[]string `json:"tags"`
+	Version int       `json:"version"`
+}
+
+// RetagRequest is the body of POST /api/admin/topics/retag.
+type RetagRequest struct {
+	TopicIDs []string `json:"topic_ids"`
+	Add      []string `json:"add"`
+	Remove   []string `json:"remove"`
+}
+
+// PurgeResult reports what POST /api/admin/users/{id}/purge removed.
+type PurgeResult struct {
+	Topics int64 `json:"topics"`
+	Posts  int64 `json:"posts"`
+}
+
+// handleAdminAPI dispatches the /api/admin/... routes, the JSON counterpart of
+// handleAdmin for scripts and incident cleanup. Like handleAdmin it is only
+// reachable by admins.
+func (h *Handlers) handleAdminAPI(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "credentials" && r.Method == http.MethodGet:
+		h.credentialsAPI(w, r)
+	case len(parts) == 2 && parts[0] == "credentials" && parts[1] == "revoke" && r.Method == http.MethodPost:
+		h.revokeCredentialsAPI(w, r)
+	case len(parts) == 1 && parts[0] == "holds" && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+		h.legalHoldsAPI(w, r)
+	case len(parts) == 3 && parts[0] == "holds" && r.Method == http.MethodDelete:
+		h.releaseLegalHoldAPI(w, r, parts[1], parts[2])
+	case len(parts) == 1 && parts[0] == "fsck" && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+		h.fsckHandler(w, r)
+	case len(parts) == 2 && parts[0] == "topics" && parts[1] == "retag" && r.Method == http.MethodPost:
+		h.retagTopics(w, r)
+	case len(parts) == 2 && parts[0] == "topics" && r.Method == http.MethodGet:
+		if topic := h.adminTopic(w, r, parts[1]); topic != nil {
+			writeVersioned(w, topic, topic.Version)
+		}
+	case len(parts) == 2 && parts[0] == "topics" && r.Method == http.MethodPatch:
+		h.adminEditTopic(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "topics" && r.Method == http.MethodDelete:
+		h.adminDeleteTopic(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "topics" && parts[2] == "author" && r.Method == http.MethodPost:
+		h.reassignTopic(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "posts" && r.Method == http.MethodGet:
+		if post := h.adminPost(w, r, parts[1]); post != nil {
+			writeVersioned(w, post, post.Version)
+		}
+	case len(parts) == 2 && parts[0] == "posts" && r.Method == http.MethodPatch:
+		h.adminEditPost(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "posts" && r.Method == http.MethodDelete:
+		h.adminDeletePost(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "posts" && parts[2] == "author" && r.Method == http.MethodPost:
+		h.reassignPost(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "posts" && parts[2] == "revisions" && r.Method == http.MethodGet:
+		h.revisionDiffAPI(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "posts" && parts[2] == "restore" && r.Method == http.MethodPost:
+		h.adminRestorePost(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "purge" && r.Method == http.MethodPost:
+		h.purgeUserContent(w, r, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeVersioned writes v with its version as the ETag, for use in If-Match.
+func writeVersioned(w http.ResponseWriter, v any, version int) {
+	w.Header().Set("ETag", versionETag(version))
+	writeJSON(w, v)
+}
+
+// normalizeTags lowercases and trims tags, dropping empty ones, to match how
+// topic search compares them.
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// newAuthor reads {"user_id": ...} and loads that user.
+func (h *Handlers) newAuthor(w http.ResponseWriter, r *http.Request) *User {
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequestBody(w, err, "Invalid request body")
+		return nil
+	}
+	author, err := h.db.GetUserByID(req.UserID)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, invalid("user_id", "no such user"), "request")
+		return nil
+	}
+	if err != nil {
+		writeError(w, err, "user")
+		return nil
+	}
+	return author
+}
+
+// adminTopic loads the topic named in the path.
+func (h *Handlers) adminTopic(w http.ResponseWriter, r *http.Request, idStr string) *Topic {
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	topic, err := h.db.GetTopicIncludeDeleted(id)
+	if err != nil {
+		writeError(w, err, "topic")
+		return nil
+	}
+	return topic
+}
+
+// adminPost loads the post named in the path.
+func (h *Handlers) adminPost(w http.ResponseWriter, r *http.Request, idStr string) *Post {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	post, err := h.db.GetPostIncludeDeleted(id)
+	if err != nil {
+		writeError(w, err, "post")
+		return nil
+	}
+	return post
+}
+
+// adminEditTopic serves PATCH /api/admin/topics/{id}.
+func (h *Handlers) adminEditTopic(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	var req TopicUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequestBody(w, err, "Invalid request body")
+		return
+	}
+	version, err := expectedVersion(r, req.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topic := h.adminTopic(w, r, idStr)
+	if topic == nil {
+		return
+	}
+	oldTitle, oldTags := topic.Title, topic.Tags
+	details := map[string]string{}
+	if req.Title != nil {
+		if problem := h.titleProblem(*req.Title); problem != "" {
+			writeError(w, invalid("title", problem), "topic")
+			return
+		}
+		details["old_title"] = topic.Title
+		topic.Title = *req.Title
+	}
+	if req.Tags != nil {
+		details["old_tags"] = strings.Join(topic.Tags, ",")
+		topic.Tags = normalizeTags(*req.Tags)
+	}
+	if err := h.db.UpdateTopic(topic, version); err != nil {
+		if errors.Is(err, ErrConflict) {
+			writeConflict(w, "topic")
+			return
+		}
+		log.Printf("Error updating topic: %v", err)
+		http.Error(w, "Failed to update topic", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "topic.edit", "topic", topic.ID, details)
+	h.recordTopicEdit(staff, topic, oldTitle, oldTags)
+	writeVersioned(w, topic, topic.Version)
+}
+
+// adminDeleteTopic serves DELETE /api/admin/topics/{id}, hiding its posts too.
+func (h *Handlers) adminDeleteTopic(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	topic := h.adminTopic(w, r, idStr)
+	if topic == nil {
+		return
+	}
+	if err := h.db.DeleteTopic(topic.ID); err != nil {
+		log.Printf("Error deleting topic: %v", err)
+		http.Error(w, "Failed to delete topic", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "topic.delete", "topic", topic.ID, map[string]string{
+		"title":     topic.Title,
+		"author_id": topic.AuthorID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reassignTopic serves POST /api/admin/topics/{id}/author.
+func (h *Handlers) reassignTopic(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	author := h.newAuthor(w, r)
+	if author == nil {
+		return
+	}
+	topic := h.adminTopic(w, r, idStr)
+	if topic == nil {
+		return
+	}
+	if err := h.db.SetTopicAuthor(topic.ID, author.ID); err != nil {
+		log.Printf("Error reassigning topic: %v", err)
+		http.Error(w, "Failed to reassign topic", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "topic.reassign", "topic", topic.ID, map[string]string{"from": topic.AuthorID, "to": author.ID})
+	topic.AuthorID = author.ID
+	writeJSON(w, topic)
+}
+
+// retagTopics serves POST /api/admin/topics/retag, adding and removing tags
+// across many topics at once.
+func (h *Handlers) retagTopics(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	var req RetagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequestBody(w, err, "Invalid request body")
+		return
+	}
+	add, remove := normalizeTags(req.Add), normalizeTags(req.Remove)
+	if len(req.TopicIDs) == 0 || len(add)+len(remove) == 0 {
+		http.Error(w, "topic_ids and at least one tag to add or remove are required", http.StatusBadRequest)
+		return
+	}
+	for _, id := range req.TopicIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			http.Error(w, "topic_ids must be UUIDs", http.StatusBadRequest)
+			return
+		}
+	}
+	n, err := h.db.RetagTopics(req.TopicIDs, add, remove, staff)
+	if err != nil {
+		log.Printf("Error retagging topics: %v", err)
+		http.Error(w, "Failed to retag topics", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "topic.retag", "topic", "", map[string]string{
+		"topics":  strings.Join(req.TopicIDs, ","),
+		"add":     strings.Join(add, ","),
+		"remove":  strings.Join(remove, ","),
+		"updated": strconv.FormatInt(n, 10),
+	})
+	writeJSON(w, map[string]int64{"updated": n})
+}
+
+// adminEditPost serves PATCH /api/admin/posts/{id}. The edit is kept in the
+// post's revision history like any other.
+func (h *Handlers) adminEditPost(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	var req struct {
+		Body    string `json:"body"`
+		Version int    `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequestBody(w, err, "Invalid request body")
+		return
+	}
+	if problem := h.bodyProblem(req.Body); problem != "" {
+		writeError(w, invalid("body", problem), "post")
+		return
+	}
+	version, err := expectedVersion(r, req.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	post := h.adminPost(w, r, idStr)
+	if post == nil {
+		return
+	}
+	if err := h.db.UpdatePostBody(post, req.Body, staff, version); err != nil {
+		if errors.Is(err, ErrConflict) {
+			writeConflict(w, "post")
+			return
+		}
+		log.Printf("Error updating post: %v", err)
+		http.Error(w, "Failed to update post", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "post.edit", "post", idStr, map[string]string{"author_id": post.AuthorID})
+	writeVersioned(w, post, post.Version)
+}
+
+// adminDeletePost serves DELETE /api/admin/posts/{id}.
+func (h *Handlers) adminDeletePost(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	post := h.adminPost(w, r, idStr)
+	if post == nil {
+		return
+	}
+	if err := h.db.DeletePost(post.ID); err != nil {
+		log.Printf("Error deleting post: %v", err)
+		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "post.delete", "post", idStr, map[string]string{
+		"topic_id":  post.TopicID,
+		"author_id": post.AuthorID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminRestorePost serves POST /api/admin/posts/{id}/restore, undoing a
+// delete.
+func (h *Handlers) adminRestorePost(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	post := h.adminPost(w, r, idStr)
+	if post == nil {
+		return
+	}
+	if err := h.db.RestorePost(post.ID); err != nil {
+		log.Printf("Error restoring post: %v", err)
+		http.Error(w, "Failed to restore post", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "post.restore", "post", idStr, map[string]string{
+		"topic_id":  post.TopicID,
+		"author_id": post.AuthorID,
+	})
+	post.DeletedAt = nil
+	writeVersioned(w, post, post.Version)
+}
+
+// reassignPost serves POST /api/admin/posts/{id}/author.
+func (h *Handlers) reassignPost(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	author := h.newAuthor(w, r)
+	if author == nil {
+		return
+	}
+	post := h.adminPost(w, r, idStr)
+	if post == nil {
+		return
+	}
+	if err := h.db.SetPostAuthor(post.ID, author); err != nil {
+		log.Printf("Error reassigning post: %v", err)
+		http.Error(w, "Failed to reassign post", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "post.reassign", "post", idStr, map[string]string{"from": post.AuthorID, "to": author.ID})
+	post.AuthorID, post.Author = author.ID, author.Handle
+	writeJSON(w, post)
+}
+
+// purgeUserContent serves POST /api/admin/users/{id}/purge, deleting every
+// topic and post the user wrote. Replies by others in their topics go too.
+// It refuses if any of that content is under legal hold.
+func (h *Handlers) purgeUserContent(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if _, err := uuid.Parse(userID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	res, err := h.db.PurgeUserContent(userID)
+	if errors.Is(err, ErrLegalHold) {
+		http.Error(w, "Some of this content is under legal hold", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error purging user content: %v", err)
+		http.Error(w, "Failed to purge content", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "user.purge", "user", userID, map[string]string{
+		"topics": strconv.FormatInt(res.Topics, 10),
+		"posts":  strconv.FormatInt(res.Posts, 10),
+	})
+	writeJSON(w, res)
+}
+
+// --- Admin Content Database Functions ---
+
+// UpdateTopic saves a topic's title and tags. With a non-zero version the
+// write only happens if the topic is still at that version, and ErrConflict is
+// returned otherwise.
+func (d *Database) UpdateTopic(topic *Topic, version int) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `UPDATE topics SET title = $2, tags = $3, version = version + 1
+              WHERE id = $1 AND ($4 = 0 OR version = $4)
+              RETURNING version`
+	err := d.pool.QueryRow(ctx, query, topic.ID, topic.Title, topic.Tags, version).Scan(&topic.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	d.counts.invalidate()
+	return registerTags(ctx, d.pool, topic.Tags)
+}
+
+// DeleteTopic soft-deletes a topic, which hides its posts along with it.
+func (d *Database) DeleteTopic(id string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE topics SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err == nil {
+		d.counts.invalidate()
+	}
+	return err
+}
+
+func (d *Database) SetTopicAuthor(id, authorID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE topics SET author_id = $2, version = version + 1 WHERE id = $1`, id, authorID)
+	return err
+}
+
+// RetagTopics adds and removes tags on the given topics, keeping the existing
+// order and dropping duplicates, and records a retagged event on each topic
+// whose tags changed. It returns how many topics were updated.
+func (d *Database) RetagTopics(ids, add, remove []string, actor *User) (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	actorID, handle := actorParams(actor)
+	query := `WITH old AS (
+                  SELECT id, tags FROM topics WHERE id = ANY($1::uuid[]) FOR UPDATE
+              ), changed AS (
+                  UPDATE topics tp SET tags = ARRAY(
+                      SELECT tag FROM unnest(tp.tags || $2::text[]) WITH ORDINALITY AS t(tag, n)
+                      WHERE NOT tag = ANY($3::text[])
+                      GROUP BY tag ORDER BY MIN(n)
+                  ), version = tp.version + 1
+                  FROM old WHERE tp.id = old.id
+                  RETURNING tp.id, old.tags AS before, tp.tags AS after
+              ), events AS (` + retagEvents("$4", "$5", "FALSE") + `)
+              SELECT COUNT(*) FROM changed`
+	var n int64
+	if err := d.pool.QueryRow(ctx, query, ids, add, remove, actorID, handle).Scan(&n); err != nil {
+		return 0, err
+	}
+	d.counts.invalidate()
+	return n, registerTags(ctx, d.pool, add)
+}
+
+// DeletePost soft-deletes a post, taking it off its topic's reply_count and
+// last post if it was visible. A deleted solution is unmarked, and stays so
+// if the post is restored.
+func (d *Database) DeletePost(id int64) error {
+	query := `WITH deleted AS (
+                  UPDATE posts SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING topic_id, state
+              )
+              UPDATE topics t SET reply_count = reply_count - 1
+              FROM deleted
+              WHERE t.id = deleted.topic_id AND deleted.state = 'visible'`
+	return d.changePost(query, id)
+}
+
+// RestorePost undoes DeletePost, putting the post back in its topic's
+// reply_count and last post if it is visible.
+func (d *Database) RestorePost(id int64) error {
+	query := `WITH restored AS (
+                  UPDATE posts SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING topic_id, state
+              )
+              UPDATE topics t SET reply_count = reply_count + 1
+              FROM restored
+              WHERE t.id = restored.topic_id AND restored.state = 'visible'`
+	return d.changePost(query, id)
+}
+
+// changePost runs query, which changes post $1, and then brings its topic's
+// last post and solution up to date, in one transaction.
+func (d *Database) changePost(query string, id int64, args ...any) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, query, append([]any{id}, args...)...); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, lastPostRefresh+lastPostOfPost, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, dropHiddenSolution, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SetPostAuthor attributes a post to another user.
+func (d *Database) SetPostAuthor(id int64, author *User) error {
+	query := `UPDATE posts SET author_id = $2, author = $3, version = version + 1 WHERE id = $1`
+	return d.changePost(query, id, author.ID, author.Handle)
+}
+
+// PurgeUserContent deletes the user's topics, with every post in them, and
+// then their remaining posts elsewhere. Unlike DeleteTopic and DeletePost it
+// removes the rows for good, soft-deleted ones included, so it returns
+// ErrLegalHold without deleting anything if any of them are held.
+func (d *Database) PurgeUserContent(userID string) (PurgeResult, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var res PurgeResult
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Holds placed while the purge runs wait for it, rather than being missed.
+	if _, err := tx.Exec(ctx, `LOCK TABLE legal_holds IN SHARE MODE`); err != nil {
+		return res, err
+	}
+	var held bool
+	heldQuery := `SELECT EXISTS (
+                      SELECT 1 FROM topics t WHERE t.author_id = $1 AND (
+                          ` + topicHeld("t") + `
+                          OR EXISTS (SELECT 1 FROM posts p WHERE p.topic_id = t.id AND ` + postHeld("p") + `)
+                      )
+                  ) OR EXISTS (SELECT 1 FROM posts p WHERE p.author_id = $1 AND ` + postHeld("p") + `)`
+	if err := tx.QueryRow(ctx, heldQuery, userID).Scan(&held); err != nil {
+		return res, err
+	}
+	if held {
+		return res, ErrLegalHold
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM topics WHERE author_id = $1`, userID)
+	if err != nil {
+		return res, err
+	}
+	res.Topics = tag.RowsAffected()
+
+	query := `WITH deleted AS (
+                  DELETE FROM posts WHERE author_id = $1 RETURNING topic_id, state, deleted_at
+              ), counted AS (
+                  UPDATE topics t SET reply_count = reply_count - c.n
+                  FROM (
+                      SELECT topic_id, COUNT(*) AS n FROM deleted
+                      WHERE state = 'visible' AND deleted_at IS NULL
+                      GROUP BY topic_id
+                  ) c
+                  WHERE t.id = c.topic_id
+              )
+              SELECT COUNT(*), COALESCE(array_agg(DISTINCT topic_id), '{}') FROM deleted`
+	var topicIDs []string
+	if err := tx.QueryRow(ctx, query, userID).Scan(&res.Posts, &topicIDs); err != nil {
+		return res, err
+	}
+	if _, err := tx.Exec(ctx, lastPostRefresh+`t.id = ANY($1::uuid[])`, topicIDs); err != nil {
+		return res, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return res, err
+	}
+	d.counts.invalidate()
+	return res, nil
+}
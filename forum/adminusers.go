@@ -0,0 +1,443 @@
+// forum/adminusers.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filters for the admin user list.
+const (
+	UserFilterAll     = ""
+	UserFilterAdmin   = "admin"
+	UserFilterBanned  = "banned"
+	UserFilterDeleted = "deleted"
+	UserFilterPending = "pending"
+)
+
+// adminUsersPageSize is how many users the admin list shows per page.
+const adminUsersPageSize = 50
+
+// banDuration is how long a ban lasts when no end is given.
+const banDuration = 100 * 365 * 24 * time.Hour
+
+// UserFilter selects users for the admin list. Query matches email or handle.
+type UserFilter struct {
+	Query  string
+	Filter string
+}
+
+// UserSummary is a row in the admin user list.
+type UserSummary struct {
+	User           User
+	SuspendedUntil *time.Time
+}
+
+// AdminUsersViewData is the data structure for the admin user list.
+type AdminUsersViewData struct {
+	User        *Viewer
+	Users       []UserRow
+	Total       int
+	SearchQuery string
+	Filter      string
+	Pagination  PaginationData
+}
+
+// query is the search and filter as URL parameters, for pagination links.
+func (d AdminUsersViewData) query() url.Values {
+	v := url.Values{}
+	if d.SearchQuery != "" {
+		v.Set("q", d.SearchQuery)
+	}
+	if d.Filter != "" {
+		v.Set("filter", d.Filter)
+	}
+	return v
+}
+
+// showAdminUsers renders /admin/users?q=&filter=&page=.
+func (h *Handlers) showAdminUsers(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	filter := UserFilter{
+		Query:  strings.TrimSpace(r.URL.Query().Get("q")),
+		Filter: r.URL.Query().Get("filter"),
+	}
+	switch filter.Filter {
+	case UserFilterAdmin, UserFilterBanned, UserFilterDeleted, UserFilterPending:
+	default:
+		filter.Filter = UserFilterAll
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	db := h.db.WithContext(r.Context())
+	users, err := db.ListUsers(filter, page, adminUsersPageSize)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+	total, err := db.CountUsers(filter)
+	if err != nil {
+		log.Printf("Error counting users: %v", err)
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+
+	data := AdminUsersViewData{
+		User:        NewViewer(staff),
+		Users:       NewUserRows(users),
+		Total:       total,
+		SearchQuery: filter.Query,
+		Filter:      filter.Filter,
+	}
+	data.Pagination = newPagination(page, total, adminUsersPageSize, pageLink("/admin/users", data.query()))
+	if err := h.templates.ExecuteTemplate(w, "admin_users.html", data); err != nil {
+		log.Printf("Error executing admin users template: %v", err)
+	}
+}
+
+// targetUser loads the user an admin action applies to. It refuses actions
+// an admin takes against their own account, so they can't lock themselves out.
+func (h *Handlers) targetUser(w http.ResponseWriter, r *http.Request, userID string) *User {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target, err := h.db.GetUserByID(userID)
+	if err != nil {
+		writeError(w, err, "user")
+		return nil
+	}
+	if target.ID == staff.ID {
+		http.Error(w, "You can't do that to your own account", http.StatusBadRequest)
+		return nil
+	}
+	return target
+}
+
+// setUserAdmin serves POST /admin/users/{id}/promote and /demote.
+func (h *Handlers) setUserAdmin(w http.ResponseWriter, r *http.Request, userID string, admin bool) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target := h.targetUser(w, r, userID)
+	if target == nil {
+		return
+	}
+	if err := h.db.SetUserAdmin(target.ID, admin); err != nil {
+		log.Printf("Error changing admin flag: %v", err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	action := "user.demote"
+	if admin {
+		action = "user.promote"
+	}
+	h.audit(staff, action, "user", target.ID, nil)
+	http.Redirect(w, r, "/admin/users/"+target.ID, http.StatusSeeOther)
+}
+
+// banUser serves POST /admin/users/{id}/ban. A ban lasts the given number
+// of days, or indefinitely if none is given, and signs the user out
+// everywhere.
+func (h *Handlers) banUser(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+	length := banDuration
+	if v := r.FormValue("days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 {
+			http.Error(w, "Days must be a positive number", http.StatusBadRequest)
+			return
+		}
+		length = time.Duration(days) * 24 * time.Hour
+	}
+	target := h.targetUser(w, r, userID)
+	if target == nil {
+		return
+	}
+	if target.ID == staff.ID {
+		http.Error(w, "You can't ban yourself", http.StatusBadRequest)
+		return
+	}
+	until := time.Now().Add(length)
+	if err := h.db.BanUser(target.ID, until, reason); err != nil {
+		log.Printf("Error banning user: %v", err)
+		http.Error(w, "Failed to ban user", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.DeleteTokensForUser(target.ID); err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+	}
+	h.audit(staff, "user.ban", "user", target.ID, map[string]string{"reason": reason, "until": until.Format(time.RFC3339)})
+	http.Redirect(w, r, "/admin/users/"+target.ID, http.StatusSeeOther)
+}
+
+// unbanUser serves POST /admin/users/{id}/unban.
+func (h *Handlers) unbanUser(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target := h.targetUser(w, r, userID)
+	if target == nil {
+		return
+	}
+	if err := h.db.UnbanUser(target.ID); err != nil {
+		log.Printf("Error unbanning user: %v", err)
+		http.Error(w, "Failed to unban user", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "user.unban", "user", target.ID, nil)
+	http.Redirect(w, r, "/admin/users/"+target.ID, http.StatusSeeOther)
+}
+
+// banMessage tells a banned user why they can't use the forum.
+func banMessage(u *User) string {
+	msg := "Your account is banned"
+	if time.Until(*u.BannedUntil) < banDuration/2 {
+		msg += " until " + u.BannedUntil.Format(dateTimeLayout)
+	}
+	if u.BanReason != "" {
+		msg += ": " + u.BanReason
+	}
+	return msg + "."
+}
+
+// forcePasswordReset serves POST /admin/users/{id}/reset-password. The user
+// is signed out and must choose a new password when they next log in.
+func (h *Handlers) forcePasswordReset(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target := h.targetUser(w, r, userID)
+	if target == nil {
+		return
+	}
+	if err := h.db.SetPasswordResetRequired(target.ID, true); err != nil {
+		log.Printf("Error requiring password reset: %v", err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.DeleteTokensForUser(target.ID); err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+	}
+	h.audit(staff, "user.force_password_reset", "user", target.ID, nil)
+	http.Redirect(w, r, "/admin/users/"+target.ID, http.StatusSeeOther)
+}
+
+// revokeSessions serves POST /admin/users/{id}/revoke-sessions.
+func (h *Handlers) revokeSessions(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target := h.targetUser(w, r, userID)
+	if target == nil {
+		return
+	}
+	n, err := h.db.DeleteTokensForUser(target.ID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "user.revoke_sessions", "user", target.ID, map[string]string{"sessions": strconv.FormatInt(n, 10)})
+	http.Redirect(w, r, "/admin/users/"+target.ID, http.StatusSeeOther)
+}
+
+// revokeAPIKey serves POST /admin/users/{id}/revoke-key, replacing the user's
+// API key with a new one that nobody has seen.
+func (h *Handlers) revokeAPIKey(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target := h.targetUser(w, r, userID)
+	if target == nil {
+		return
+	}
+	key, err := generateAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if err := h.db.SetUserKey(target.ID, key); err != nil {
+		log.Printf("Error replacing API key: %v", err)
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "user.revoke_key", "user", target.ID, nil)
+	http.Redirect(w, r, "/admin/users/"+target.ID, http.StatusSeeOther)
+}
+
+// deleteUser serves POST /admin/users/{id}/delete. The account is
+// soft-deleted and its sessions removed; posts stay, still attributed to the
+// handle.
+func (h *Handlers) deleteUser(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target := h.targetUser(w, r, userID)
+	if target == nil {
+		return
+	}
+	if err := h.db.DeleteUser(target.ID); err != nil {
+		log.Printf("Error deleting user: %v", err)
+		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "user.delete", "user", target.ID, map[string]string{"email": target.Email, "handle": target.Handle})
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// --- Admin User Database Functions ---
+
+// userFilterWhere builds the WHERE clause for a UserFilter.
+func userFilterWhere(f UserFilter) (string, []any) {
+	var conds []string
+	var args []any
+	if f.Query != "" {
+		args = append(args, "%"+f.Query+"%")
+		conds = append(conds, fmt.Sprintf("(u.email ILIKE $%d OR u.handle ILIKE $%d)", len(args), len(args)))
+	}
+	// The reserved guest author isn't an account to manage.
+	args = append(args, GuestAuthorID)
+	conds = append(conds, fmt.Sprintf("u.id <> $%d", len(args)))
+	// Deleted accounts only appear under their own filter.
+	if f.Filter == UserFilterDeleted {
+		conds = append(conds, "u.deleted_at IS NOT NULL")
+	} else {
+		conds = append(conds, notDeleted("u"))
+	}
+	switch f.Filter {
+	case UserFilterAdmin:
+		conds = append(conds, "u.admin")
+	case UserFilterBanned:
+		conds = append(conds, "(u.banned_until > NOW() OR s.ends_at IS NOT NULL)")
+	case UserFilterPending:
+		conds = append(conds, "u.pending")
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// activeSuspensionJoin adds s.ends_at, the end of the user's longest active
+// suspension, to a query over users u.
+const activeSuspensionJoin = ` LEFT JOIN LATERAL (
+                  SELECT MAX(ends_at) AS ends_at FROM suspensions
+                  WHERE user_id = u.id AND lifted_at IS NULL AND ends_at > NOW()
+              ) s ON TRUE`
+
+// ListUsers returns a page of users matching f, newest first.
+func (d *Database) ListUsers(f UserFilter, page, pageSize int) ([]UserSummary, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	where, args := userFilterWhere(f)
+	query := `SELECT u.id, u.email, u.handle, u.admin, u.created_at, u.last_seen_at, u.password_reset_required, u.deleted_at, u.banned_until, u.pending, s.ends_at
+              FROM users u` + activeSuspensionJoin + where +
+		fmt.Sprintf(" ORDER BY u.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, pageSize, (page-1)*pageSize)
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []UserSummary
+	for rows.Next() {
+		var s UserSummary
+		u := &s.User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Handle, &u.Admin, &u.Created, &u.LastSeenAt, &u.PasswordResetRequired, &u.DeletedAt, &u.BannedUntil, &u.Pending, &s.SuspendedUntil); err != nil {
+			return nil, err
+		}
+		users = append(users, s)
+	}
+	return users, rows.Err()
+}
+
+// CountUsers counts the users matching f.
+func (d *Database) CountUsers(f UserFilter) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	where, args := userFilterWhere(f)
+	var count int
+	err := d.pool.QueryRow(ctx, `SELECT COUNT(*) FROM users u`+activeSuspensionJoin+where, args...).Scan(&count)
+	return count, err
+}
+
+func (d *Database) SetUserAdmin(userID string, admin bool) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE users SET admin = $2, updated_at = NOW(), version = version + 1 WHERE id = $1`, userID, admin)
+	return err
+}
+
+func (d *Database) SetUserKey(userID, key string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE users SET key_hash = $2, key_created_at = NOW(), key_last_used_at = NULL, updated_at = NOW(), version = version + 1 WHERE id = $1`, userID, apiKeyHash(key))
+	return err
+}
+
+func (d *Database) SetPasswordResetRequired(userID string, required bool) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE users SET password_reset_required = $2, updated_at = NOW(), version = version + 1 WHERE id = $1`, userID, required)
+	return err
+}
+
+// BanUser bans the user until the given time.
+func (d *Database) BanUser(userID string, until time.Time, reason string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE users SET banned_until = $2, ban_reason = $3, updated_at = NOW(), version = version + 1 WHERE id = $1`, userID, until, reason)
+	return err
+}
+
+// SetUserPending holds the user's account for approval, or releases it.
+func (d *Database) SetUserPending(userID string, pending bool) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE users SET pending = $2, updated_at = NOW(), version = version + 1 WHERE id = $1`, userID, pending)
+	return err
+}
+
+// UnbanUser ends the user's ban, if they have one.
+func (d *Database) UnbanUser(userID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE users SET banned_until = NULL, ban_reason = '', updated_at = NOW(), version = version + 1 WHERE id = $1`, userID)
+	return err
+}
+
+// DeleteTokensForUser ends every session the user has, returning how many.
+func (d *Database) DeleteTokensForUser(userID string) (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteUser soft-deletes a user and removes their sessions. The row stays,
+// so the email address remains taken and the account's history stays
+// readable to staff.
+func (d *Database) DeleteUser(userID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM tokens WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET deleted_at = NOW(), version = version + 1 WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,120 @@
+// forum/apiversion.go
+package forum
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API versioning policy
+//
+// JSON endpoints are served under /api/vN/. Within a version, responses only
+// grow: fields may be added, but never removed, renamed or retyped, and
+// status codes keep their meaning. A change that breaks that promise goes into
+// a new version. Versions share one set of handlers, which call apiVersionOf
+// where their output differs.
+//
+// A superseded version stays available. Its responses carry a Deprecation
+// header with the date it was deprecated, a Link to the successor, and, once
+// one is scheduled, a Sunset header. The version is only removed after its
+// sunset date.
+//
+// The original un-versioned /api/... routes are version 1 under another name.
+// They are deprecated and will be removed after Config.LegacyAPISunset.
+
+// apiVersionInfo describes one published API version.
+type apiVersionInfo struct {
+	Version    int
+	Deprecated time.Time // zero while the version is current
+	Sunset     time.Time // zero until removal is scheduled
+}
+
+// apiVersions lists every version still served, oldest first.
+var apiVersions = []apiVersionInfo{
+	{Version: 1},
+}
+
+// legacyAPIDeprecated is when the un-versioned /api/... routes were deprecated.
+var legacyAPIDeprecated = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// apiVersionKey carries the API version a request was made against.
+const apiVersionKey = contextKey("api-version")
+
+// apiVersionOf returns the API version of the request, or 0 outside the API.
+func apiVersionOf(r *http.Request) int {
+	v, _ := r.Context().Value(apiVersionKey).(int)
+	return v
+}
+
+func apiPrefix(version int) string {
+	return "/api/v" + strconv.Itoa(version)
+}
+
+// handleAPI registers handler at path under every API version. With legacy
+// set it is also served at the un-versioned /api path, as version 1.
+// Handlers always see the un-versioned path, so they can share routing code.
+func (h *Handlers) handleAPI(mux *http.ServeMux, path string, handler http.Handler, legacy bool) {
+	latest := apiVersions[len(apiVersions)-1].Version
+	for _, v := range apiVersions {
+		mux.Handle(apiPrefix(v.Version)+path, h.versioned(v, latest, path, handler))
+	}
+	if legacy {
+		v := apiVersionInfo{Version: 1, Deprecated: legacyAPIDeprecated, Sunset: h.config.LegacyAPISunset}
+		mux.Handle("/api"+path, h.versioned(v, latest, path, handler))
+	}
+}
+
+// versioned records the version in the request context, rewrites the path to
+// its un-versioned form and adds the version and deprecation headers.
+func (h *Handlers) versioned(v apiVersionInfo, latest int, path string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hdr := w.Header()
+		hdr.Set("API-Version", strconv.Itoa(v.Version))
+		if !v.Deprecated.IsZero() {
+			hdr.Set("Deprecation", "@"+strconv.FormatInt(v.Deprecated.Unix(), 10))
+			successor := apiPrefix(latest) + strings.TrimPrefix(r.URL.Path, apiBase(r.URL.Path))
+			hdr.Add("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		if !v.Sunset.IsZero() {
+			hdr.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+		}
+
+		u := *r.URL
+		u.Path = "/api" + strings.TrimPrefix(r.URL.Path, apiBase(r.URL.Path))
+		u.RawPath = ""
+		r2 := r.WithContext(context.WithValue(r.Context(), apiVersionKey, v.Version))
+		r2.URL = &u
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// apiBase returns the /api or /api/vN prefix of path.
+func apiBase(path string) string {
+	rest := strings.TrimPrefix(path, "/api")
+	if strings.HasPrefix(rest, "/v") {
+		if i := strings.IndexByte(rest[1:], '/'); i > 0 {
+			if _, err := strconv.Atoi(rest[2 : i+1]); err == nil {
+				return "/api" + rest[:i+1]
+			}
+		}
+	}
+	return "/api"
+}
+
+// apiNotFound answers unknown API paths, listing the versions that exist.
+func apiNotFound(w http.ResponseWriter, r *http.Request) {
+	versions := make([]string, len(apiVersions))
+	for i, v := range apiVersions {
+		versions[i] = apiPrefix(v.Version)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":    "unknown API endpoint " + r.URL.Path,
+		"versions": versions,
+	})
+}
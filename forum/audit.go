@@ -0,0 +1,113 @@
+// forum/audit.go
+package forum
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// AuditEntry records a staff or security-relevant action.
+type AuditEntry struct {
+	ID         int64             `json:"id" db:"id"`
+	ActorID    string            `json:"actor_id" db:"actor_id"`
+	Actor      string            `json:"actor" db:"actor"`
+	Action     string            `json:"action" db:"action"`
+	TargetType string            `json:"target_type" db:"target_type"`
+	TargetID   string            `json:"target_id" db:"target_id"`
+	Details    map[string]string `json:"details" db:"details"`
+	CreatedAt  time.Time         `json:"created_at" db:"created_at"`
+}
+
+// AuditViewData is the data structure for the admin audit log page.
+type AuditViewData struct {
+	User    *Viewer
+	Entries []AuditEntry
+}
+
+// audit records an action taken by actor. Failures are logged rather than
+// returned so that auditing never blocks the action itself.
+func (h *Handlers) audit(actor *User, action, targetType, targetID string, details map[string]string) {
+	entry := AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+	}
+	if actor != nil {
+		entry.ActorID = actor.ID
+		entry.Actor = actor.Handle
+	}
+	if err := h.db.RecordAudit(&entry); err != nil {
+		log.Printf("Error recording audit entry %q: %v", action, err)
+		entry.CreatedAt = time.Now()
+	}
+	h.emitModerationEvent(entry)
+}
+
+// showAuditLog renders the most recent audit entries for admins.
+func (h *Handlers) showAuditLog(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	entries, err := h.db.WithContext(r.Context()).ListAuditEntries(200)
+	if err != nil {
+		log.Printf("Error listing audit entries: %v", err)
+		http.Error(w, "Failed to retrieve audit log", http.StatusInternalServerError)
+		return
+	}
+	data := AuditViewData{User: NewViewer(user), Entries: entries}
+	if err := h.templates.ExecuteTemplate(w, "audit.html", data); err != nil {
+		log.Printf("Error executing audit template: %v", err)
+	}
+}
+
+// --- Audit Database Functions ---
+
+func (d *Database) RecordAudit(entry *AuditEntry) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	if entry.Details == nil {
+		entry.Details = map[string]string{}
+	}
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+	var actorID *string
+	if entry.ActorID != "" {
+		actorID = &entry.ActorID
+	}
+	query := `INSERT INTO audit_log (actor_id, actor, action, target_type, target_id, details)
+              VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	return d.pool.QueryRow(ctx, query,
+		actorID, entry.Actor, entry.Action, entry.TargetType, entry.TargetID, details,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// ListAuditEntries returns the newest audit entries first.
+func (d *Database) ListAuditEntries(limit int) ([]AuditEntry, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT id, COALESCE(actor_id::text, ''), actor, action, target_type, target_id, details, created_at
+              FROM audit_log
+              ORDER BY created_at DESC
+              LIMIT $1`
+	rows, err := d.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,236 @@
+// forum/avatars.go
+package forum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Uploads are decoded in full before they are scaled down, so their
+// dimensions are checked first: maxAvatarSource bounds the width and height
+// of an uploaded image, and maxAvatarSize those of the stored avatar.
+const (
+	maxAvatarSource = 4096
+	maxAvatarSize   = 512
+)
+
+// avatarMaxAge is how long browsers may use an avatar before checking it
+// again. It is short because a member's avatar URL never changes.
+const avatarMaxAge = 5 * time.Minute
+
+// defaultAvatar is shown for guests, members without an avatar when
+// Gravatar is off, and accounts that no longer exist.
+const defaultAvatar = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 32">` +
+	`<rect width="32" height="32" fill="#333"/>` +
+	`<circle cx="16" cy="12" r="6" fill="#888"/>` +
+	`<path d="M5 30c1-7 6-10 11-10s10 3 11 10z" fill="#888"/></svg>`
+
+// Avatar is an uploaded avatar image.
+type Avatar struct {
+	UserID      string
+	ContentType string
+	Data        []byte
+	UpdatedAt   time.Time
+}
+
+// etag returns the entity tag for the avatar, which changes with every
+// upload.
+func (a *Avatar) etag() string {
+	return `"` + strconv.FormatInt(a.UpdatedAt.UnixNano(), 36) + `"`
+}
+
+// gravatarURL returns the Gravatar image for email at size pixels, with a
+// generated pattern for addresses Gravatar doesn't know.
+func gravatarURL(email string, size int) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	v := url.Values{"s": {strconv.Itoa(size)}, "d": {"identicon"}}
+	return "https://www.gravatar.com/avatar/" + hex.EncodeToString(sum[:]) + "?" + v.Encode()
+}
+
+// squareThumbnail crops the centre square out of src and scales it to
+// size by size, averaging the source pixels behind each output pixel.
+func squareThumbnail(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0 := y0 + y*side/size
+		sy1 := max(y0+(y+1)*side/size, sy0+1)
+		for x := 0; x < size; x++ {
+			sx0 := x0 + x*side/size
+			sx1 := max(x0+(x+1)*side/size, sx0+1)
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// serveAvatar serves GET /avatar/{userID}: the member's uploaded avatar,
+// else a redirect to their Gravatar, else a placeholder.
+func (h *Handlers) serveAvatar(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	db := h.db.WithContext(r.Context())
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(avatarMaxAge.Seconds())))
+	avatar, err := db.GetAvatar(id.String())
+	switch {
+	case err == nil:
+		w.Header().Set("ETag", avatar.etag())
+		if r.Header.Get("If-None-Match") == avatar.etag() {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", avatar.ContentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(avatar.Data)
+		return
+	case !errors.Is(err, ErrNotFound):
+		log.Printf("Error loading avatar: %v", err)
+		http.Error(w, "Failed to load avatar", http.StatusInternalServerError)
+		return
+	}
+	if h.config.Gravatar {
+		if user, err := db.GetUserByID(id.String()); err == nil {
+			http.Redirect(w, r, gravatarURL(user.Email, h.config.AvatarSize), http.StatusFound)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write([]byte(defaultAvatar))
+}
+
+// uploadAvatar serves POST /settings/avatar with the image in "avatar".
+// JPEG, PNG and GIF images are accepted; they are cropped square, scaled to
+// AvatarSize and stored as PNG.
+func (h *Handlers) uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseMultipartForm(h.config.MaxUploadBytes); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		writeError(w, invalid("avatar", "choose an image to upload"), "avatar")
+		return
+	}
+	defer file.Close()
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		writeError(w, invalid("avatar", "must be a JPEG, PNG or GIF image"), "avatar")
+		return
+	}
+	if cfg.Width > maxAvatarSource || cfg.Height > maxAvatarSource {
+		writeError(w, invalid("avatar", "must be at most "+strconv.Itoa(maxAvatarSource)+" pixels on each side"), "avatar")
+		return
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		log.Printf("Error rewinding avatar upload: %v", err)
+		http.Error(w, "Failed to read avatar", http.StatusInternalServerError)
+		return
+	}
+	src, _, err := image.Decode(file)
+	if err != nil {
+		writeError(w, invalid("avatar", "could not be read as an image"), "avatar")
+		return
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, squareThumbnail(src, h.config.AvatarSize)); err != nil {
+		log.Printf("Error encoding avatar: %v", err)
+		http.Error(w, "Failed to save avatar", http.StatusInternalServerError)
+		return
+	}
+	if err := h.db.WithContext(r.Context()).SaveAvatar(user.ID, "image/png", buf.Bytes()); err != nil {
+		log.Printf("Error saving avatar: %v", err)
+		http.Error(w, "Failed to save avatar", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings#avatar", http.StatusSeeOther)
+}
+
+// deleteAvatar serves POST /settings/avatar/delete, going back to the
+// Gravatar or placeholder.
+func (h *Handlers) deleteAvatar(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if err := h.db.WithContext(r.Context()).DeleteAvatar(user.ID); err != nil {
+		log.Printf("Error deleting avatar: %v", err)
+		http.Error(w, "Failed to remove avatar", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings#avatar", http.StatusSeeOther)
+}
+
+// --- Avatar Database Functions ---
+
+// GetAvatar returns the user's uploaded avatar, or ErrNotFound if they have
+// none.
+func (d *Database) GetAvatar(userID string) (*Avatar, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	a := Avatar{UserID: userID}
+	err := d.readQueryRow(ctx, `SELECT content_type, data, updated_at FROM avatars WHERE user_id = $1`, userID).
+		Scan(&a.ContentType, &a.Data, &a.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// HasAvatar reports whether the user uploaded an avatar.
+func (d *Database) HasAvatar(userID string) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var has bool
+	err := d.readQueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM avatars WHERE user_id = $1)`, userID).Scan(&has)
+	return has, err
+}
+
+// SaveAvatar stores the user's avatar, replacing any they had.
+func (d *Database) SaveAvatar(userID, contentType string, data []byte) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `INSERT INTO avatars (user_id, content_type, data) VALUES ($1, $2, $3)
+              ON CONFLICT (user_id) DO UPDATE SET content_type = EXCLUDED.content_type, data = EXCLUDED.data, updated_at = NOW()`,
+		userID, contentType, data)
+	return err
+}
+
+// DeleteAvatar removes the user's avatar. Removing one they don't have is
+// harmless.
+func (d *Database) DeleteAvatar(userID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM avatars WHERE user_id = $1`, userID)
+	return err
+}
@@ -0,0 +1,292 @@
+// forum/batch.go
+package forum
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// batchPath is the bulk write endpoint; its body limit is MaxBatchBytes.
+const batchPath = "/api/v1/batch"
+
+// Batch item types.
+const (
+	BatchTopic = "topic"
+	BatchPost  = "post"
+)
+
+// Batch item statuses. Skipped items were valid but not written because the
+// atomic batch they were in failed.
+const (
+	BatchCreated = "created"
+	BatchFailed  = "failed"
+	BatchSkipped = "skipped"
+)
+
+// BatchRequest is the body of POST /api/v1/batch. Items are written in order,
+// so a post may refer to a topic created earlier in the same batch. An atomic
+// batch is written in one transaction and either all items are created or none.
+type BatchRequest struct {
+	Atomic bool        `json:"atomic"`
+	Items  []BatchItem `json:"items"`
+}
+
+// BatchItem is one topic or post to create; Type selects which field is used.
+type BatchItem struct {
+	Type  string `json:"type"`
+	Topic *Topic `json:"topic,omitempty"`
+	Post  *Post  `json:"post,omitempty"`
+}
+
+// BatchResult reports what happened to the item at Index.
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Topic  *Topic `json:"topic,omitempty"`
+	Post   *Post  `json:"post,omitempty"`
+}
+
+// BatchResponse is the body returned for every batch that could be read.
+type BatchResponse struct {
+	Created int           `json:"created"`
+	Failed  int           `json:"failed"`
+	Results []BatchResult `json:"results"`
+}
+
+// prepareBatchItem validates an item and fills in the fields the server owns,
+// returning a message for the client when the item can't be created.
+func (h *Handlers) prepareBatchItem(user *User, item *BatchItem) string {
+	switch item.Type {
+	case BatchTopic:
+		topic := item.Topic
+		if topic == nil {
+			return "topic is required"
+		}
+		if problem := h.titleProblem(topic.Title); problem != "" {
+			return "topic.title " + problem
+		}
+		if topic.ID == "" {
+			topic.ID = NewTopicID()
+		} else if _, err := uuid.Parse(topic.ID); err != nil {
+			return "topic.id must be a UUID"
+		}
+		if topic.Tags == nil {
+			topic.Tags = []string{}
+		}
+		topic.AuthorID = user.ID
+		topic.ReplyCount, topic.ViewCount = 0, 0
+		topic.LastPostAt, topic.LastPostAuthor = nil, ""
+		topic.SolutionPostID = nil
+	case BatchPost:
+		post := item.Post
+		if post == nil {
+			return "post is required"
+		}
+		if problem := h.bodyProblem(post.Body); problem != "" {
+			return "post.body " + problem
+		}
+		if _, err := uuid.Parse(post.TopicID); err != nil {
+			return "post.topic_id must be a UUID"
+		}
+		post.ID = 0
+		post.Author = user.Handle
+		post.AuthorID = user.ID
+		post.Wiki = false
+		post.UpdatedAt = nil
+		post.State = ""
+	default:
+		return fmt.Sprintf("unknown item type %q", item.Type)
+	}
+	return ""
+}
+
+// batchHandler serves POST /api/v1/batch for importers and bots. The whole
+// batch counts as one request for flood control, with every topic in it
+// counted against the hourly cap.
+func (h *Handlers) batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if h.rejectSuspended(w, r, user) {
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequestBody(w, err, "Invalid request body")
+		return
+	}
+	if len(req.Items) == 0 {
+		http.Error(w, "A batch needs at least one item", http.StatusBadRequest)
+		return
+	}
+	if limit := h.config.MaxBatchItems; limit > 0 && len(req.Items) > limit {
+		http.Error(w, fmt.Sprintf("A batch may hold at most %d items", limit), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]BatchResult, len(req.Items))
+	valid := true
+	var topics, posts int
+	for i := range req.Items {
+		results[i].Index = i
+		if msg := h.prepareBatchItem(user, &req.Items[i]); msg != "" {
+			results[i].Status = BatchFailed
+			results[i].Error = msg
+			valid = false
+			continue
+		}
+		if req.Items[i].Type == BatchTopic {
+			topics++
+		} else {
+			posts++
+		}
+	}
+	if topics > 0 && h.rejectTopicFlood(w, r, user, topics) {
+		return
+	}
+	if posts > 0 && h.rejectPostFlood(w, r, user) {
+		return
+	}
+
+	matches := make([][]ModRule, len(req.Items))
+	for i, item := range req.Items {
+		if item.Type == BatchPost && results[i].Status == "" {
+			item.Post.State, matches[i] = h.applyRules(RuleEventPostCreate, item.Post)
+		}
+	}
+
+	switch {
+	case req.Atomic && !valid:
+		for i := range results {
+			if results[i].Status == "" {
+				results[i].Status = BatchSkipped
+			}
+		}
+	case req.Atomic:
+		failed, err := h.db.CreateBatch(req.Items)
+		for i := range results {
+			switch {
+			case err == nil:
+				results[i].Status = BatchCreated
+			case i == failed:
+				log.Printf("Error writing batch item %d: %v", i, err)
+				results[i].Status = BatchFailed
+				results[i].Error = "failed to create " + req.Items[i].Type
+			default:
+				results[i].Status = BatchSkipped
+			}
+		}
+	default:
+		for i, item := range req.Items {
+			if results[i].Status != "" {
+				continue
+			}
+			var err error
+			if item.Type == BatchTopic {
+				err = h.db.CreateTopic(item.Topic)
+			} else {
+				err = h.db.CreatePost(item.Post)
+			}
+			if err != nil {
+				log.Printf("Error writing batch item %d: %v", i, err)
+				results[i].Status = BatchFailed
+				results[i].Error = "failed to create " + item.Type
+				continue
+			}
+			results[i].Status = BatchCreated
+		}
+	}
+
+	resp := BatchResponse{Results: results}
+	for i, item := range req.Items {
+		if results[i].Status != BatchCreated {
+			if results[i].Status == BatchFailed {
+				resp.Failed++
+			}
+			continue
+		}
+		resp.Created++
+		results[i].Topic = item.Topic
+		results[i].Post = item.Post
+		if item.Type == BatchPost {
+			h.afterBatchPost(user, item.Post, matches[i])
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// afterBatchPost does what createPost does once a post is stored: audit rule
+// matches, subscribe the author to the topic, publish or queue the post, and
+// notify the author of its parent and the topic's watchers.
+func (h *Handlers) afterBatchPost(user *User, post *Post, matched []ModRule) {
+	h.auditRuleMatches(RuleEventPostCreate, post, matched)
+	h.subscribeAuthor(post)
+	if post.State != PostVisible {
+		h.queueModeratedPost(post)
+		return
+	}
+	h.publishPost(*post)
+	var notified string
+	defer func() { h.notifyWatchers(*post, notified) }()
+	if post.ParentPostID == nil {
+		return
+	}
+	parent, err := h.db.GetPost(*post.ParentPostID)
+	if err != nil || parent.AuthorID == user.ID || parent.ByGuest() {
+		return
+	}
+	notified = parent.AuthorID
+	h.NotifCh <- Notification{
+		From:      user.ID,
+		UserID:    parent.AuthorID,
+		CreatedAt: time.Now(),
+		Message:   "New reply to your post",
+		Link:      postPath(post.ID),
+		ID:        uuid.New().String(),
+	}
+}
+
+// --- Batch Database Functions ---
+
+// CreateBatch writes every item in one transaction. If an item fails, nothing
+// is written and the failing item's index is returned with the error.
+func (d *Database) CreateBatch(items []BatchItem) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	topics := false
+	for i, item := range items {
+		switch item.Type {
+		case BatchTopic:
+			err = insertTopic(ctx, tx, item.Topic)
+			topics = true
+		case BatchPost:
+			err = insertPost(ctx, tx, item.Post)
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	if topics {
+		d.counts.invalidate()
+	}
+	return 0, nil
+}
@@ -0,0 +1,225 @@
+// forum/bbcode.go
+package forum
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Post formats for Config.PostFormat. Plain text is shown as written;
+// BBCode suits communities that moved here from phpBB and the like, whose
+// archives and habits are full of it.
+const (
+	PostFormatText   = "text"
+	PostFormatBBCode = "bbcode"
+)
+
+// validPostFormat reports whether f is a known post format.
+func validPostFormat(f string) bool {
+	return f == PostFormatText || f == PostFormatBBCode
+}
+
+// postBody renders a post body in the configured format for the "post"
+// template.
+func (h *Handlers) postBody(body string) template.HTML {
+	if h.config.PostFormat == PostFormatBBCode {
+		return renderBBCode(body)
+	}
+	return template.HTML(html.EscapeString(body))
+}
+
+// bbTag matches an opening or closing BBCode tag, with its optional
+// argument: [b], [/b], [url=https://...], [*].
+var bbTag = regexp.MustCompile(`(?i)\[(/?)([a-z]+|\*)(?:=([^\[\]]*))?\]`)
+
+// bbColor is the colour argument BBCode accepts: a name or a hex value.
+var bbColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3,6}|[a-zA-Z]+)$`)
+
+// bbSimple maps tags that wrap their contents in a plain element.
+var bbSimple = map[string]string{
+	"b": "strong",
+	"i": "em",
+	"u": "u",
+	"s": "s",
+}
+
+// renderBBCode converts BBCode to HTML. Everything else in body is escaped,
+// so the only markup in the result is what the tags produce: links and
+// images must be http(s), colours and sizes are checked, and tags that are
+// unknown, malformed or unbalanced are left as text. Open tags are closed at
+// the end, so the output is always well nested.
+func renderBBCode(body string) template.HTML {
+	var out strings.Builder
+	var open []bbElement // innermost last
+	closeTo := func(i int) {
+		for len(open) > i {
+			out.WriteString(open[len(open)-1].end)
+			open = open[:len(open)-1]
+		}
+	}
+	top := func() string {
+		if len(open) == 0 {
+			return ""
+		}
+		return open[len(open)-1].tag
+	}
+	rest := body
+	for {
+		loc := bbTag.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			out.WriteString(html.EscapeString(rest))
+			break
+		}
+		out.WriteString(html.EscapeString(rest[:loc[0]]))
+		raw := rest[loc[0]:loc[1]]
+		closing := loc[3] > loc[2]
+		name := strings.ToLower(rest[loc[4]:loc[5]])
+		arg, hasArg := "", loc[6] >= 0
+		if hasArg {
+			arg = strings.TrimSpace(strings.Trim(rest[loc[6]:loc[7]], `"'`))
+		}
+		rest = rest[loc[1]:]
+
+		if closing {
+			if i := lastOpen(open, name); i >= 0 && name != "*" {
+				closeTo(i)
+				continue
+			}
+			out.WriteString(html.EscapeString(raw))
+			continue
+		}
+
+		switch name {
+		case "code", "url", "img":
+			// Their contents are taken as they are, up to the closing tag.
+			end := strings.Index(strings.ToLower(rest), "[/"+name+"]")
+			if end < 0 {
+				out.WriteString(html.EscapeString(raw))
+				continue
+			}
+			inner := rest[:end]
+			rest = rest[end+len(name)+3:]
+			out.WriteString(bbVerbatim(name, arg, hasArg, inner, raw))
+		case "*":
+			if top() == "*" {
+				closeTo(len(open) - 1)
+			}
+			if top() != "list" {
+				out.WriteString(html.EscapeString(raw))
+				continue
+			}
+			out.WriteString("<li>")
+			open = append(open, bbElement{tag: "*", end: "</li>"})
+		default:
+			el, start, ok := bbOpen(name, arg, hasArg)
+			if !ok {
+				out.WriteString(html.EscapeString(raw))
+				continue
+			}
+			out.WriteString(start)
+			open = append(open, el)
+		}
+	}
+	closeTo(0)
+	return template.HTML(out.String())
+}
+
+// bbElement is an open tag: its BBCode name and the HTML that closes it.
+type bbElement struct {
+	tag, end string
+}
+
+// bbOpen returns the element for a tag with nested content and the HTML
+// that opens it, or false if the tag or its argument isn't acceptable.
+func bbOpen(name, arg string, hasArg bool) (bbElement, string, bool) {
+	if el, ok := bbSimple[name]; ok && !hasArg {
+		return bbElement{name, "</" + el + ">"}, "<" + el + ">", true
+	}
+	switch name {
+	case "quote":
+		el := bbElement{name, "</blockquote>"}
+		if hasArg && arg != "" {
+			return el, "<blockquote><cite>" + html.EscapeString(arg) + " wrote:</cite>", true
+		}
+		return el, "<blockquote>", true
+	case "list":
+		switch {
+		case !hasArg:
+			return bbElement{name, "</ul>"}, "<ul>", true
+		case arg == "1":
+			return bbElement{name, "</ol>"}, "<ol>", true
+		case arg == "a":
+			return bbElement{name, "</ol>"}, `<ol type="a">`, true
+		}
+	case "color":
+		if bbColor.MatchString(arg) {
+			return bbElement{name, "</span>"}, `<span style="color: ` + arg + `">`, true
+		}
+	case "size":
+		// phpBB sizes are percentages.
+		if n, err := strconv.Atoi(arg); err == nil {
+			return bbElement{name, "</span>"}, fmt.Sprintf(`<span style="font-size: %d%%">`, min(max(n, 50), 200)), true
+		}
+	}
+	return bbElement{}, "", false
+}
+
+// bbVerbatim renders [code], [url] and [img], whose contents aren't parsed.
+// raw is the opening tag, shown as text along with the contents when the
+// link isn't one we allow.
+func bbVerbatim(name, arg string, hasArg bool, inner, raw string) string {
+	switch name {
+	case "code":
+		return "<code>" + html.EscapeString(inner) + "</code>"
+	case "url":
+		target, text := inner, inner
+		if hasArg {
+			target = arg
+		}
+		if u := safeURL(target, true); u != "" {
+			return `<a href="` + html.EscapeString(u) + `" rel="nofollow ugc noopener">` + html.EscapeString(text) + `</a>`
+		}
+	case "img":
+		if u := safeURL(strings.TrimSpace(inner), false); u != "" {
+			return `<img src="` + html.EscapeString(u) + `" alt="" loading="lazy">`
+		}
+	}
+	return html.EscapeString(raw + inner + "[/" + name + "]")
+}
+
+// safeURL returns s if it is an absolute http(s) URL, or a mailto: one when
+// mail is set, and "" otherwise.
+func safeURL(s string, mail bool) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return ""
+		}
+	case "mailto":
+		if !mail {
+			return ""
+		}
+	default:
+		return ""
+	}
+	return u.String()
+}
+
+// lastOpen returns the index of the innermost open tag named name, or -1.
+func lastOpen(open []bbElement, name string) int {
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i].tag == name {
+			return i
+		}
+	}
+	return -1
+}
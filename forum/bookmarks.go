@@ -0,0 +1,309 @@
+// forum/bookmarks.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// bookmarkExcerpt is how many characters of a bookmarked post the
+// bookmarks page shows.
+const bookmarkExcerpt = 200
+
+// Bookmark is a topic or post a member saved to come back to. PostID is nil
+// for a topic bookmark. RemindAt, if set, is when they want a notification
+// about it; it is cleared once that is sent.
+type Bookmark struct {
+	ID         int64
+	UserID     string
+	TopicID    string
+	TopicTitle string
+	PostID     *int64
+	Excerpt    string
+	RemindAt   *time.Time
+	CreatedAt  time.Time
+}
+
+// Link returns the path of the bookmarked topic or post.
+func (b *Bookmark) Link() string {
+	if b.PostID != nil {
+		return postPath(*b.PostID)
+	}
+	return "/topics/" + b.TopicID
+}
+
+// BookmarksViewData is the data structure for the bookmarks page.
+type BookmarksViewData struct {
+	User            *Viewer
+	Bookmarks       []BookmarkView
+	ReminderOptions []ReminderOption
+}
+
+// bookmarkReminder reads the optional "remind" field, which names one of
+// reminderOptions. It returns nil when no reminder was asked for.
+func bookmarkReminder(r *http.Request) (*time.Time, error) {
+	key := r.FormValue("remind")
+	if key == "" {
+		return nil, nil
+	}
+	for _, opt := range reminderOptions {
+		if opt.Key == key {
+			at := time.Now().Add(opt.After)
+			return &at, nil
+		}
+	}
+	return nil, invalid("remind", "choose when to be reminded")
+}
+
+// saveBookmark stores b for the signed-in member, with the reminder asked
+// for, and sends them back to what they bookmarked.
+func (h *Handlers) saveBookmark(w http.ResponseWriter, r *http.Request, b *Bookmark) {
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	at, err := bookmarkReminder(r)
+	if err != nil {
+		writeError(w, err, "bookmark")
+		return
+	}
+	b.RemindAt = at
+	if err := h.db.WithContext(r.Context()).SaveBookmark(b); err != nil {
+		log.Printf("Error saving bookmark: %v", err)
+		http.Error(w, "Failed to save bookmark", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, b.Link(), http.StatusSeeOther)
+}
+
+// bookmarkTopic serves POST /topics/{id}/bookmark. Bookmarking a topic again
+// replaces its reminder.
+func (h *Handlers) bookmarkTopic(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if _, err := h.db.WithContext(r.Context()).GetTopic(topicID); err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	h.saveBookmark(w, r, &Bookmark{UserID: user.ID, TopicID: topicID.String()})
+}
+
+// bookmarkPost serves POST /posts/{id}/bookmark. Only visible posts can be
+// bookmarked.
+func (h *Handlers) bookmarkPost(w http.ResponseWriter, r *http.Request, postID int64) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	post, err := h.db.WithContext(r.Context()).GetPost(postID)
+	if err == nil && post.State != PostVisible {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+	h.saveBookmark(w, r, &Bookmark{UserID: user.ID, TopicID: post.TopicID, PostID: &post.ID})
+}
+
+// showBookmarks serves GET /bookmarks.
+func (h *Handlers) showBookmarks(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	bookmarks, err := h.db.WithContext(r.Context()).ListBookmarks(user.ID)
+	if err != nil {
+		log.Printf("Error listing bookmarks: %v", err)
+		http.Error(w, "Failed to retrieve bookmarks", http.StatusInternalServerError)
+		return
+	}
+	data := BookmarksViewData{
+		User:            NewViewer(user),
+		Bookmarks:       NewBookmarkViews(bookmarks),
+		ReminderOptions: reminderOptions,
+	}
+	if err := h.templates.ExecuteTemplate(w, "bookmarks.html", data); err != nil {
+		log.Printf("Error executing bookmarks template: %v", err)
+	}
+}
+
+// remindBookmark serves POST /bookmarks/{id}/remind, which sets or, with an
+// empty "remind", clears a bookmark's reminder.
+func (h *Handlers) remindBookmark(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	at, err := bookmarkReminder(r)
+	if err == nil {
+		err = h.db.WithContext(r.Context()).SetBookmarkReminder(user.ID, id, at)
+	}
+	if err != nil {
+		writeError(w, err, "bookmark")
+		return
+	}
+	http.Redirect(w, r, "/bookmarks", http.StatusSeeOther)
+}
+
+// deleteBookmark serves POST /bookmarks/{id}/delete.
+func (h *Handlers) deleteBookmark(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.WithContext(r.Context()).DeleteBookmark(user.ID, id); err != nil {
+		writeError(w, err, "bookmark")
+		return
+	}
+	http.Redirect(w, r, "/bookmarks", http.StatusSeeOther)
+}
+
+// deliverBookmarkReminders sends the bookmark reminders that are due. It
+// runs alongside deliverReminders.
+func (h *Handlers) deliverBookmarkReminders() {
+	for {
+		due, err := h.db.ClaimDueBookmarks(time.Now(), reminderBatch)
+		if err != nil {
+			log.Printf("Error claiming bookmark reminders: %v", err)
+			return
+		}
+		for _, b := range due {
+			h.NotifCh <- Notification{
+				UserID:    b.UserID,
+				ID:        uuid.New().String(),
+				CreatedAt: time.Now(),
+				Message:   "Reminder: " + b.TopicTitle,
+				Link:      b.Link(),
+			}
+		}
+		if len(due) < reminderBatch {
+			return
+		}
+	}
+}
+
+// --- Bookmark Database Functions ---
+
+// SaveBookmark stores b and sets b.ID. If the user already bookmarked the
+// same topic or post, that bookmark's reminder is replaced instead.
+func (d *Database) SaveBookmark(b *Bookmark) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	target := "(user_id, topic_id) WHERE post_id IS NULL"
+	if b.PostID != nil {
+		target = "(user_id, post_id) WHERE post_id IS NOT NULL"
+	}
+	query := `INSERT INTO bookmarks (user_id, topic_id, post_id, remind_at) VALUES ($1, $2, $3, $4)
+              ON CONFLICT ` + target + ` DO UPDATE SET remind_at = EXCLUDED.remind_at
+              RETURNING id, created_at`
+	return d.pool.QueryRow(ctx, query, b.UserID, b.TopicID, b.PostID, b.RemindAt).Scan(&b.ID, &b.CreatedAt)
+}
+
+// bookmarkLive keeps bookmarks whose topic, and post if any, can still be
+// seen. b is the bookmark, t its topic and p its post.
+var bookmarkLive = fmt.Sprintf(`%s AND (b.post_id IS NULL OR (%s AND p.state = '%s'))`,
+	notDeleted("t"), notDeleted("p"), PostVisible)
+
+// ListBookmarks returns the user's bookmarks, newest first. Bookmarks on
+// deleted or hidden topics and posts are left out.
+func (d *Database) ListBookmarks(userID string) ([]Bookmark, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := fmt.Sprintf(`SELECT b.id, b.user_id, b.topic_id, t.title, b.post_id, COALESCE(left(p.body, %d), ''), b.remind_at, b.created_at
+              FROM bookmarks b JOIN topics t ON t.id = b.topic_id LEFT JOIN posts p ON p.id = b.post_id
+              WHERE b.user_id = $1 AND %s
+              ORDER BY b.created_at DESC, b.id DESC`, bookmarkExcerpt, bookmarkLive)
+	rows, err := d.readQuery(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bookmarks []Bookmark
+	for rows.Next() {
+		var b Bookmark
+		if err := rows.Scan(&b.ID, &b.UserID, &b.TopicID, &b.TopicTitle, &b.PostID, &b.Excerpt, &b.RemindAt, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+// IsTopicBookmarked reports whether the user bookmarked the topic itself.
+func (d *Database) IsTopicBookmarked(userID, topicID string) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var saved bool
+	err := d.readQueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM bookmarks WHERE user_id = $1 AND topic_id = $2 AND post_id IS NULL)`, userID, topicID).Scan(&saved)
+	return saved, err
+}
+
+// SetBookmarkReminder sets or, if at is nil, clears the reminder on one of
+// the user's bookmarks. It returns ErrNotFound if they have no bookmark with
+// that ID.
+func (d *Database) SetBookmarkReminder(userID string, id int64, at *time.Time) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `UPDATE bookmarks SET remind_at = $3 WHERE id = $1 AND user_id = $2`, id, userID, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteBookmark removes one of the user's bookmarks. It returns ErrNotFound
+// if they have no bookmark with that ID.
+func (d *Database) DeleteBookmark(userID string, id int64) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM bookmarks WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimDueBookmarks clears the reminders of up to limit bookmarks due by now
+// and returns those still live. As with ClaimDueReminders, rows another
+// server is claiming are skipped.
+func (d *Database) ClaimDueBookmarks(now time.Time, limit int) ([]Bookmark, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `WITH due AS (
+                  UPDATE bookmarks SET remind_at = NULL WHERE id IN (
+                      SELECT id FROM bookmarks WHERE remind_at <= $1
+                      ORDER BY remind_at LIMIT $2
+                      FOR UPDATE SKIP LOCKED)
+                  RETURNING id, user_id, topic_id, post_id, created_at
+              )
+              SELECT b.id, b.user_id, b.topic_id, t.title, b.post_id, b.created_at
+              FROM due b JOIN topics t ON t.id = b.topic_id LEFT JOIN posts p ON p.id = b.post_id
+              WHERE ` + bookmarkLive
+	rows, err := d.pool.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bookmarks []Bookmark
+	for rows.Next() {
+		var b Bookmark
+		if err := rows.Scan(&b.ID, &b.UserID, &b.TopicID, &b.TopicTitle, &b.PostID, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
@@ -0,0 +1,169 @@
+// forum/captcha.go
+package forum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CAPTCHA providers accepted by FORUM_CAPTCHA. They all verify answers the
+// same way, through a siteverify endpoint, and differ only in where it and
+// their widget live.
+const (
+	CaptchaOff       = "off"
+	CaptchaHCaptcha  = "hcaptcha"
+	CaptchaReCaptcha = "recaptcha"
+	CaptchaTurnstile = "turnstile"
+)
+
+// CaptchaConfig puts a CAPTCHA in front of login and registration. Secret
+// comes from secrets; see server/main.go.
+type CaptchaConfig struct {
+	Provider string
+	SiteKey  string
+	Secret   string
+	// Timeout bounds each verification. VerifyURL overrides the provider's
+	// endpoint, e.g. for a test server.
+	Timeout   time.Duration
+	VerifyURL string
+}
+
+// captchaProvider describes one provider's widget and endpoint.
+type captchaProvider struct {
+	scriptURL string
+	class     string
+	// field is the form field the widget puts its answer in.
+	field     string
+	verifyURL string
+}
+
+var captchaProviders = map[string]captchaProvider{
+	CaptchaHCaptcha: {
+		scriptURL: "https://js.hcaptcha.com/1/api.js",
+		class:     "h-captcha",
+		field:     "h-captcha-response",
+		verifyURL: "https://api.hcaptcha.com/siteverify",
+	},
+	CaptchaReCaptcha: {
+		scriptURL: "https://www.google.com/recaptcha/api.js",
+		class:     "g-recaptcha",
+		field:     "g-recaptcha-response",
+		verifyURL: "https://www.google.com/recaptcha/api/siteverify",
+	},
+	CaptchaTurnstile: {
+		scriptURL: "https://challenges.cloudflare.com/turnstile/v0/api.js",
+		class:     "cf-turnstile",
+		field:     "cf-turnstile-response",
+		verifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	},
+}
+
+// CaptchaWidget is what a page needs to show the CAPTCHA: the provider's
+// script and an element with Class and a data-sitekey attribute.
+type CaptchaWidget struct {
+	ScriptURL string
+	Class     string
+	SiteKey   string
+}
+
+// errCaptchaFailed means the CAPTCHA answer was missing or wrong.
+var errCaptchaFailed = errors.New("CAPTCHA was not solved")
+
+// captcha checks answers with the configured provider.
+type captcha struct {
+	cfg      CaptchaConfig
+	provider captchaProvider
+}
+
+// newCaptcha returns the CAPTCHA cfg configures, or nil if it is off.
+func newCaptcha(cfg CaptchaConfig) (*captcha, error) {
+	if cfg.Provider == "" || cfg.Provider == CaptchaOff {
+		return nil, nil
+	}
+	provider, ok := captchaProviders[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown CAPTCHA provider %q", cfg.Provider)
+	}
+	if cfg.SiteKey == "" || cfg.Secret == "" {
+		return nil, fmt.Errorf("the %s CAPTCHA needs a site key and a secret", cfg.Provider)
+	}
+	if cfg.VerifyURL != "" {
+		provider.verifyURL = cfg.VerifyURL
+	}
+	return &captcha{cfg: cfg, provider: provider}, nil
+}
+
+// widget returns what pages need to show the CAPTCHA, or nil when c is nil.
+func (c *captcha) widget() *CaptchaWidget {
+	if c == nil {
+		return nil
+	}
+	return &CaptchaWidget{ScriptURL: c.provider.scriptURL, Class: c.provider.class, SiteKey: c.cfg.SiteKey}
+}
+
+// verify checks a widget's answer with the provider. It fails closed: if
+// the provider can't be reached, the answer doesn't count.
+func (c *captcha) verify(ctx context.Context, answer, remoteIP string) error {
+	if answer == "" {
+		return errCaptchaFailed
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	form := url.Values{"secret": {c.cfg.Secret}, "response": {answer}, "remoteip": {remoteIP}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.provider.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CAPTCHA verification returned %s", resp.Status)
+	}
+	var result struct {
+		Success bool     `json:"success"`
+		Errors  []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("reading CAPTCHA verification: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", errCaptchaFailed, strings.Join(result.Errors, ", "))
+	}
+	return nil
+}
+
+// checkCaptcha verifies the answer a form posted, when a CAPTCHA is on, and
+// returns a message to show if it didn't pass.
+func (h *Handlers) checkCaptcha(r *http.Request) string {
+	if h.captcha == nil {
+		return ""
+	}
+	return h.captchaRefusal(r, r.FormValue(h.captcha.provider.field))
+}
+
+// captchaRefusal verifies answer and returns a message to show if it
+// didn't pass.
+func (h *Handlers) captchaRefusal(r *http.Request, answer string) string {
+	err := h.captcha.verify(r.Context(), answer, clientIP(r))
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errCaptchaFailed):
+		log.Printf("CAPTCHA failed from %s: %v", clientIP(r), err)
+		return "Please complete the CAPTCHA."
+	default:
+		log.Printf("Error verifying CAPTCHA: %v", err)
+		return "We couldn't check the CAPTCHA. Please try again."
+	}
+}
@@ -0,0 +1,89 @@
+// forum/concurrency.go
+package forum
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// userSaveRetries is how many times ModifyUser reloads a user whose save lost
+// a race before giving up.
+const userSaveRetries = 3
+
+// Posts, topics and users carry a version that every edit increments. Edit
+// endpoints take the version the editor started from, either as a "version"
+// form or JSON field or as an If-Match header holding the ETag we served, and
+// answer 409 Conflict if someone else saved in between. A request without a
+// version is applied unconditionally, as before.
+
+// versionETag formats a version for the ETag header.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion reads the version from an If-Match header, accepting weak
+// tags. It returns 0 when the header is absent or "*".
+func ifMatchVersion(r *http.Request) (int, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+	tag = strings.Trim(strings.TrimPrefix(tag, "W/"), `"`)
+	version, err := strconv.Atoi(tag)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match header %q", r.Header.Get("If-Match"))
+	}
+	return version, nil
+}
+
+// expectedVersion returns the version sent in a JSON body, falling back to
+// If-Match when the body didn't carry one.
+func expectedVersion(r *http.Request, field int) (int, error) {
+	if field > 0 {
+		return field, nil
+	}
+	return ifMatchVersion(r)
+}
+
+// formVersion returns the "version" form value, falling back to If-Match.
+func formVersion(r *http.Request) (int, error) {
+	v := r.FormValue("version")
+	if v == "" {
+		return ifMatchVersion(r)
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid version %q", v)
+	}
+	return version, nil
+}
+
+// writeConflict tells the client its copy of what is named is stale.
+func writeConflict(w http.ResponseWriter, what string) {
+	http.Error(w, "This "+what+" was changed by someone else after you loaded it. Reload it and try again.", http.StatusConflict)
+}
+
+// --- Concurrency Database Functions ---
+
+// ModifyUser loads a user, applies fn and saves the result, reloading and
+// applying fn again when a concurrent write gets there first. It returns
+// ErrNotFound if the user doesn't exist.
+func (d *Database) ModifyUser(id string, fn func(*User) error) (*User, error) {
+	for attempt := 0; attempt < userSaveRetries; attempt++ {
+		user, err := d.GetUserByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(user); err != nil {
+			return nil, err
+		}
+		err = d.SaveUser(user)
+		if !errors.Is(err, ErrConflict) {
+			return user, err
+		}
+	}
+	return nil, ErrConflict
+}
@@ -0,0 +1,488 @@
+// forum/config.go
+package forum
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the instance-wide settings that can be tuned at startup.
+type Config struct {
+	// OnlineWindow is how recently a user must have been seen to count as online.
+	OnlineWindow time.Duration
+	// PresenceWriteInterval throttles how often last-seen timestamps are written.
+	PresenceWriteInterval time.Duration
+	// VisitGap is how long a member must be away before their next request
+	// starts a new visit, moving the "new since last visit" mark.
+	VisitGap time.Duration
+	// ShowWhosOnline enables the "who's online" widget on the topics page.
+	ShowWhosOnline bool
+	// WikiEditTrustLevel is the minimum trust level needed to edit someone else's wiki post.
+	WikiEditTrustLevel int
+	// PublicEditHistory lets everyone, not only staff, browse post revisions.
+	PublicEditHistory bool
+	// TrustedFlagLevel is the trust level at which a member's flags count as trusted for moderation rules.
+	TrustedFlagLevel int
+	// ReportReasons is the reason taxonomy members choose from when flagging a post.
+	// "other" is always accepted and requires an explanation.
+	ReportReasons []string
+	// PostFormat is how post bodies are shown: "text" as written, or
+	// "bbcode" for communities whose archives and habits come from phpBB.
+	PostFormat string
+	// PostInterval is the minimum gap between posts for new members. Each trust
+	// level above new halves it; staff are exempt.
+	PostInterval time.Duration
+	// TopicsPerHour caps new topics for new members. Each trust level above new
+	// adds the same allowance again; staff are exempt.
+	TopicsPerHour int
+	// TitleMinLength and TitleMaxLength bound topic titles, and BodyMinLength
+	// and BodyMaxLength post bodies, in characters. Surrounding whitespace
+	// doesn't count toward the minimum. A zero maximum disables it.
+	TitleMinLength int
+	TitleMaxLength int
+	BodyMinLength  int
+	BodyMaxLength  int
+	// MaxJSONBytes, MaxFormBytes and MaxUploadBytes cap request bodies by
+	// content type. Zero disables a limit.
+	MaxJSONBytes   int64
+	MaxFormBytes   int64
+	MaxUploadBytes int64
+	// MaxBatchItems and MaxBatchBytes bound a single /api/v1/batch request;
+	// MaxBatchBytes also bounds user imports, which hold up to MaxImportRows.
+	MaxBatchItems int
+	MaxBatchBytes int64
+	MaxImportRows int
+	// InviteOnly requires an invite code to register.
+	InviteOnly bool
+	// ApproveSignups holds accounts people register for themselves until an
+	// admin approves them from the moderation queue. Accounts made by admins
+	// or through single sign-on don't wait.
+	ApproveSignups bool
+	// GuestPosting lets visitors who aren't signed in reply to topics under a
+	// name of their choosing. GuestPostRateLimit is how many replies a minute
+	// each client address may post that way; zero disables the limit.
+	GuestPosting       bool
+	GuestPostRateLimit int
+	// InviteTrustLevel is the minimum trust level needed to generate invite codes.
+	InviteTrustLevel int
+	// InviteMaxUses and InviteTTL are the usage limit and lifetime of member-generated invites.
+	InviteMaxUses int
+	InviteTTL     time.Duration
+	// Password selects the algorithm and cost for new password hashes. Existing
+	// hashes are upgraded on the next successful login.
+	Password PasswordParams
+	// BreachCheck is "off", "warn" or "reject" for new passwords found in the
+	// Have I Been Pwned corpus. Lookups slower than BreachCheckTimeout are skipped.
+	BreachCheck        string
+	BreachCheckTimeout time.Duration
+	BreachCheckURL     string
+	// SecureCookies marks the session cookie Secure. Only turn it off for
+	// plain-HTTP development, since browsers drop Secure cookies without TLS.
+	SecureCookies bool
+	// SessionTTL is how long a login lasts, and RememberMeTTL how long one
+	// lasts when "remember me" is ticked. Logins that aren't remembered also
+	// end after SessionIdleTimeout without a request; zero turns that off.
+	SessionTTL         time.Duration
+	RememberMeTTL      time.Duration
+	SessionIdleTimeout time.Duration
+	// SessionSweepInterval is how often expired sessions are deleted.
+	SessionSweepInterval time.Duration
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For and
+	// X-Forwarded-Proto headers are believed.
+	TrustedProxies []netip.Prefix
+	// QueryTimeout bounds each database statement; SearchTimeout replaces it
+	// for heavy reads such as search and statistics.
+	QueryTimeout  time.Duration
+	SearchTimeout time.Duration
+	// SlowQueryThreshold is how long a statement runs before it is logged;
+	// zero turns the slow query log off.
+	SlowQueryThreshold time.Duration
+	// CountCacheTTL is how long topic counts are reused between writes, and
+	// ApproxCountThreshold the table size above which the unsearched listing
+	// uses the planner's estimate instead of COUNT(*).
+	CountCacheTTL        time.Duration
+	ApproxCountThreshold int64
+	// LegacyAPISunset, when set, is announced in a Sunset header on the
+	// deprecated un-versioned /api routes.
+	LegacyAPISunset time.Time
+	// Summarizer, when set, offers summaries of topics with at least
+	// SummaryMinPosts posts. FORUM_SUMMARIZER picks a built-in one; code can
+	// set its own. Calls slower than SummaryTimeout fail.
+	Summarizer      Summarizer
+	SummaryMinPosts int
+	SummaryTimeout  time.Duration
+	// LoginRateLimit and APIRateLimit are how many requests a minute one
+	// client address may make to /login and to the API. Zero disables a limit.
+	LoginRateLimit int
+	APIRateLimit   int
+	// AnonymousRateLimit and MemberRateLimit are how many requests a minute
+	// each visitor's address, and each member, may make to the pages and API.
+	// Login and incoming hooks have their own limits. Zero disables a limit.
+	AnonymousRateLimit int
+	MemberRateLimit    int
+	// After LoginLockoutThreshold failed passwords for one email address,
+	// or LoginLockoutIPThreshold from one client address, password login
+	// is locked for LoginLockout, doubling with each further failure up to
+	// LoginLockoutMax. Failures are forgotten after LoginLockoutMax without
+	// one. A zero threshold turns that lockout off.
+	LoginLockoutThreshold   int
+	LoginLockoutIPThreshold int
+	LoginLockout            time.Duration
+	LoginLockoutMax         time.Duration
+	// LogRequests logs every request with its status and duration.
+	LogRequests bool
+	// Templates is the glob the page templates are loaded from.
+	Templates string
+	// SuggestLimit caps each kind of search-as-you-type suggestion, and
+	// SuggestTimeout bounds the lookup; suggestions that would arrive later
+	// than that are no use to someone typing.
+	SuggestLimit   int
+	SuggestTimeout time.Duration
+	// DuplicateSimilarity is how alike, in percent, an existing title must
+	// be to a new topic's for createTopic to offer it as a likely duplicate.
+	// Zero turns the check off.
+	DuplicateSimilarity int
+	// ReminderInterval is how often due "remind me" reminders are sent, and
+	// ReminderLimit caps how many each member can have pending; zero means
+	// no cap.
+	ReminderInterval time.Duration
+	ReminderLimit    int
+	// PublishInterval is how often scheduled announcements are checked
+	// for publishing; zero turns scheduled publishing off.
+	PublishInterval time.Duration
+	// LinkPreviews fetches the pages bare URLs in posts point to and shows a
+	// card with their title, description and image under the post. Pages
+	// are fetched again once their preview is LinkPreviewTTL old.
+	LinkPreviews   bool
+	LinkPreviewTTL time.Duration
+	// Embeds shows YouTube and Vimeo links as players and Twitter links as
+	// cards, resolved through the providers' oEmbed endpoints and cached
+	// like previews. Players load from the providers' sites, so it is off
+	// by default.
+	Embeds bool
+	// MailTemplates is the directory email templates are loaded from, and
+	// MailLocale the locale emails are written in. SiteName and BaseURL
+	// head every email and make its links absolute.
+	MailTemplates string
+	MailLocale    string
+	SiteName      string
+	BaseURL       string
+	// SMTPAddr is the host:port mail is delivered through, signing in as
+	// SMTPUsername and SMTPPassword if set, and MailFrom the sender. With
+	// no SMTPAddr only the recipient and subject of mail are logged, and
+	// MagicLinks can't be turned on.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	// AvatarSize is the width and height, in pixels, uploaded avatars are
+	// scaled to. Members without one get their Gravatar when Gravatar is
+	// set; its URL carries a hash of their email address.
+	AvatarSize int
+	Gravatar   bool
+	// MagicLinks offers a sign-in link by email on the login page, valid
+	// for MagicLinkTTL.
+	MagicLinks   bool
+	MagicLinkTTL time.Duration
+	// ReadOnly refuses every change, e.g. during planned maintenance. The
+	// forum also goes read-only by itself while the database can't take
+	// writes; ReadOnlyCheckInterval is how often that is checked, and zero
+	// leaves it to be noticed when a write fails.
+	ReadOnly              bool
+	ReadOnlyCheckInterval time.Duration
+	// OIDC configures single sign-on; see oidc.go.
+	OIDC OIDCConfig
+	// Captcha guards login and registration; see captcha.go.
+	Captcha CaptchaConfig
+}
+
+// DefaultConfig returns the settings used when nothing is overridden.
+func DefaultConfig() Config {
+	return Config{
+		OnlineWindow:            5 * time.Minute,
+		PresenceWriteInterval:   time.Minute,
+		VisitGap:                30 * time.Minute,
+		ShowWhosOnline:          true,
+		WikiEditTrustLevel:      TrustMember,
+		TrustedFlagLevel:        TrustMember,
+		ReportReasons:           []string{"spam", "harassment", "off-topic", ReportReasonOther},
+		PostFormat:              PostFormatText,
+		PostInterval:            20 * time.Second,
+		TopicsPerHour:           3,
+		TitleMinLength:          1,
+		TitleMaxLength:          200,
+		BodyMinLength:           1,
+		BodyMaxLength:           32000,
+		MaxJSONBytes:            64 << 10,
+		MaxFormBytes:            256 << 10,
+		MaxUploadBytes:          8 << 20,
+		MaxBatchItems:           100,
+		MaxBatchBytes:           1 << 20,
+		MaxImportRows:           1000,
+		InviteTrustLevel:        TrustBasic,
+		InviteMaxUses:           1,
+		InviteTTL:               7 * 24 * time.Hour,
+		Password:                DefaultPasswordParams(),
+		BreachCheck:             BreachCheckOff,
+		BreachCheckTimeout:      2 * time.Second,
+		BreachCheckURL:          "https://api.pwnedpasswords.com/range",
+		SecureCookies:           true,
+		SessionTTL:              24 * time.Hour,
+		RememberMeTTL:           30 * 24 * time.Hour,
+		SessionIdleTimeout:      time.Hour,
+		SessionSweepInterval:    5 * time.Minute,
+		QueryTimeout:            DefaultQueryTimeout,
+		SearchTimeout:           30 * time.Second,
+		SlowQueryThreshold:      DefaultSlowQueryThreshold,
+		CountCacheTTL:           DefaultCountCacheTTL,
+		ApproxCountThreshold:    DefaultApproxCountThreshold,
+		SummaryMinPosts:         20,
+		SummaryTimeout:          30 * time.Second,
+		LoginRateLimit:          10,
+		LoginLockoutThreshold:   5,
+		LoginLockoutIPThreshold: 20,
+		LoginLockout:            time.Minute,
+		LoginLockoutMax:         time.Hour,
+		APIRateLimit:            300,
+		AnonymousRateLimit:      120,
+		MemberRateLimit:         600,
+		GuestPostRateLimit:      2,
+		Templates:               "templates/*.html",
+		SuggestLimit:            5,
+		DuplicateSimilarity:     50,
+		SuggestTimeout:          500 * time.Millisecond,
+		ReminderInterval:        time.Minute,
+		PublishInterval:         time.Minute,
+		LinkPreviews:            true,
+		LinkPreviewTTL:          24 * time.Hour,
+		ReminderLimit:           100,
+		MailTemplates:           "templates/mail",
+		SiteName:                "Forum",
+		BaseURL:                 "http://localhost:8080",
+		MailFrom:                "forum@localhost",
+		AvatarSize:              128,
+		Gravatar:                true,
+		MagicLinkTTL:            15 * time.Minute,
+		ReadOnlyCheckInterval:   10 * time.Second,
+		OIDC:                    OIDCConfig{Name: "SSO", HandleClaim: "preferred_username", AutoProvision: true},
+		Captcha:                 CaptchaConfig{Provider: CaptchaOff, Timeout: 5 * time.Second},
+	}
+}
+
+// ConfigFromEnv starts from DefaultConfig and applies any FORUM_* environment
+// overrides. It fails if a referenced secret file can't be read.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	cfg.OnlineWindow = envDuration("FORUM_ONLINE_WINDOW", cfg.OnlineWindow)
+	cfg.PresenceWriteInterval = envDuration("FORUM_PRESENCE_WRITE_INTERVAL", cfg.PresenceWriteInterval)
+	cfg.VisitGap = envDuration("FORUM_VISIT_GAP", cfg.VisitGap)
+	cfg.ShowWhosOnline = envBool("FORUM_SHOW_WHOS_ONLINE", cfg.ShowWhosOnline)
+	cfg.WikiEditTrustLevel = envInt("FORUM_WIKI_EDIT_TRUST_LEVEL", cfg.WikiEditTrustLevel)
+	cfg.PublicEditHistory = envBool("FORUM_PUBLIC_EDIT_HISTORY", cfg.PublicEditHistory)
+	cfg.TrustedFlagLevel = envInt("FORUM_TRUSTED_FLAG_LEVEL", cfg.TrustedFlagLevel)
+	cfg.ReportReasons = envList("FORUM_REPORT_REASONS", cfg.ReportReasons)
+	cfg.PostFormat = envString("FORUM_POST_FORMAT", cfg.PostFormat)
+	if !validPostFormat(cfg.PostFormat) {
+		return cfg, fmt.Errorf("invalid FORUM_POST_FORMAT %q: want %q or %q", cfg.PostFormat, PostFormatText, PostFormatBBCode)
+	}
+	cfg.PostInterval = envDuration("FORUM_POST_INTERVAL", cfg.PostInterval)
+	cfg.TopicsPerHour = envInt("FORUM_TOPICS_PER_HOUR", cfg.TopicsPerHour)
+	cfg.TitleMinLength = envInt("FORUM_TITLE_MIN_LENGTH", cfg.TitleMinLength)
+	cfg.TitleMaxLength = envInt("FORUM_TITLE_MAX_LENGTH", cfg.TitleMaxLength)
+	if err := checkLengthBounds("TITLE", cfg.TitleMinLength, cfg.TitleMaxLength); err != nil {
+		return cfg, err
+	}
+	cfg.BodyMinLength = envInt("FORUM_BODY_MIN_LENGTH", cfg.BodyMinLength)
+	cfg.BodyMaxLength = envInt("FORUM_BODY_MAX_LENGTH", cfg.BodyMaxLength)
+	if err := checkLengthBounds("BODY", cfg.BodyMinLength, cfg.BodyMaxLength); err != nil {
+		return cfg, err
+	}
+	cfg.MaxJSONBytes = envInt64("FORUM_MAX_JSON_BYTES", cfg.MaxJSONBytes)
+	cfg.MaxFormBytes = envInt64("FORUM_MAX_FORM_BYTES", cfg.MaxFormBytes)
+	cfg.MaxUploadBytes = envInt64("FORUM_MAX_UPLOAD_BYTES", cfg.MaxUploadBytes)
+	cfg.MaxBatchItems = envInt("FORUM_MAX_BATCH_ITEMS", cfg.MaxBatchItems)
+	cfg.MaxBatchBytes = envInt64("FORUM_MAX_BATCH_BYTES", cfg.MaxBatchBytes)
+	cfg.MaxImportRows = envInt("FORUM_MAX_IMPORT_ROWS", cfg.MaxImportRows)
+	cfg.InviteOnly = envBool("FORUM_INVITE_ONLY", cfg.InviteOnly)
+	cfg.ApproveSignups = envBool("FORUM_APPROVE_SIGNUPS", cfg.ApproveSignups)
+	cfg.GuestPosting = envBool("FORUM_GUEST_POSTING", cfg.GuestPosting)
+	cfg.GuestPostRateLimit = envInt("FORUM_GUEST_POST_RATE_LIMIT", cfg.GuestPostRateLimit)
+	cfg.InviteTrustLevel = envInt("FORUM_INVITE_TRUST_LEVEL", cfg.InviteTrustLevel)
+	cfg.InviteMaxUses = envInt("FORUM_INVITE_MAX_USES", cfg.InviteMaxUses)
+	cfg.InviteTTL = envDuration("FORUM_INVITE_TTL", cfg.InviteTTL)
+	cfg.Password.Algorithm = envString("FORUM_PASSWORD_ALGORITHM", cfg.Password.Algorithm)
+	cfg.Password.BcryptCost = envInt("FORUM_BCRYPT_COST", cfg.Password.BcryptCost)
+	cfg.Password.Argon2Time = uint32(envInt("FORUM_ARGON2_TIME", int(cfg.Password.Argon2Time)))
+	cfg.Password.Argon2Memory = uint32(envInt("FORUM_ARGON2_MEMORY_KIB", int(cfg.Password.Argon2Memory)))
+	cfg.Password.Argon2Threads = uint8(envInt("FORUM_ARGON2_THREADS", int(cfg.Password.Argon2Threads)))
+	cfg.Password.Policy.MinLength = envInt("FORUM_PASSWORD_MIN_LENGTH", cfg.Password.Policy.MinLength)
+	cfg.Password.Policy.RejectSimilar = envBool("FORUM_PASSWORD_REJECT_SIMILAR", cfg.Password.Policy.RejectSimilar)
+	cfg.Password.Policy.MinClasses = envInt("FORUM_PASSWORD_MIN_CLASSES", cfg.Password.Policy.MinClasses)
+	if path := os.Getenv("FORUM_PASSWORD_DENYLIST_FILE"); path != "" {
+		if err := cfg.Password.Policy.LoadDenylist(path); err != nil {
+			return cfg, fmt.Errorf("loading password denylist: %w", err)
+		}
+	}
+	cfg.BreachCheck = envString("FORUM_BREACH_CHECK", cfg.BreachCheck)
+	cfg.BreachCheckTimeout = envDuration("FORUM_BREACH_CHECK_TIMEOUT", cfg.BreachCheckTimeout)
+	cfg.BreachCheckURL = envString("FORUM_BREACH_CHECK_URL", cfg.BreachCheckURL)
+	cfg.SecureCookies = envBool("FORUM_SECURE_COOKIES", cfg.SecureCookies)
+	cfg.SessionTTL = envDuration("FORUM_SESSION_TTL", cfg.SessionTTL)
+	cfg.RememberMeTTL = envDuration("FORUM_REMEMBER_ME_TTL", cfg.RememberMeTTL)
+	cfg.SessionIdleTimeout = envDuration("FORUM_SESSION_IDLE_TIMEOUT", cfg.SessionIdleTimeout)
+	cfg.SessionSweepInterval = envDuration("FORUM_SESSION_SWEEP_INTERVAL", cfg.SessionSweepInterval)
+	cfg.QueryTimeout = envDuration("FORUM_QUERY_TIMEOUT", cfg.QueryTimeout)
+	cfg.SearchTimeout = envDuration("FORUM_SEARCH_TIMEOUT", cfg.SearchTimeout)
+	cfg.SlowQueryThreshold = envDuration("FORUM_SLOW_QUERY", cfg.SlowQueryThreshold)
+	cfg.CountCacheTTL = envDuration("FORUM_COUNT_CACHE_TTL", cfg.CountCacheTTL)
+	cfg.ApproxCountThreshold = envInt64("FORUM_APPROX_COUNT_THRESHOLD", cfg.ApproxCountThreshold)
+	cfg.LoginRateLimit = envInt("FORUM_LOGIN_RATE_LIMIT", cfg.LoginRateLimit)
+	cfg.APIRateLimit = envInt("FORUM_API_RATE_LIMIT", cfg.APIRateLimit)
+	cfg.AnonymousRateLimit = envInt("FORUM_ANONYMOUS_RATE_LIMIT", cfg.AnonymousRateLimit)
+	cfg.MemberRateLimit = envInt("FORUM_MEMBER_RATE_LIMIT", cfg.MemberRateLimit)
+	cfg.LoginLockoutThreshold = envInt("FORUM_LOGIN_LOCKOUT_THRESHOLD", cfg.LoginLockoutThreshold)
+	cfg.LoginLockoutIPThreshold = envInt("FORUM_LOGIN_LOCKOUT_IP_THRESHOLD", cfg.LoginLockoutIPThreshold)
+	cfg.LoginLockout = envDuration("FORUM_LOGIN_LOCKOUT", cfg.LoginLockout)
+	cfg.LoginLockoutMax = envDuration("FORUM_LOGIN_LOCKOUT_MAX", cfg.LoginLockoutMax)
+	cfg.LogRequests = envBool("FORUM_LOG_REQUESTS", cfg.LogRequests)
+	cfg.Templates = envString("FORUM_TEMPLATES", cfg.Templates)
+	cfg.SuggestLimit = envInt("FORUM_SUGGEST_LIMIT", cfg.SuggestLimit)
+	cfg.SuggestTimeout = envDuration("FORUM_SUGGEST_TIMEOUT", cfg.SuggestTimeout)
+	cfg.DuplicateSimilarity = envInt("FORUM_DUPLICATE_SIMILARITY", cfg.DuplicateSimilarity)
+	if cfg.DuplicateSimilarity < 0 || cfg.DuplicateSimilarity > 100 {
+		return cfg, fmt.Errorf("invalid FORUM_DUPLICATE_SIMILARITY %d: want 0 to 100", cfg.DuplicateSimilarity)
+	}
+	cfg.ReminderInterval = envDuration("FORUM_REMINDER_INTERVAL", cfg.ReminderInterval)
+	cfg.PublishInterval = envDuration("FORUM_PUBLISH_INTERVAL", cfg.PublishInterval)
+	cfg.LinkPreviews = envBool("FORUM_LINK_PREVIEWS", cfg.LinkPreviews)
+	cfg.LinkPreviewTTL = envDuration("FORUM_LINK_PREVIEW_TTL", cfg.LinkPreviewTTL)
+	cfg.Embeds = envBool("FORUM_EMBEDS", cfg.Embeds)
+	cfg.ReminderLimit = envInt("FORUM_REMINDER_LIMIT", cfg.ReminderLimit)
+	cfg.MailTemplates = envString("FORUM_MAIL_TEMPLATES", cfg.MailTemplates)
+	cfg.MailLocale = envString("FORUM_MAIL_LOCALE", cfg.MailLocale)
+	cfg.SiteName = envString("FORUM_SITE_NAME", cfg.SiteName)
+	cfg.BaseURL = envString("FORUM_BASE_URL", cfg.BaseURL)
+	cfg.SMTPAddr = envString("FORUM_SMTP_ADDR", cfg.SMTPAddr)
+	cfg.SMTPUsername = envString("FORUM_SMTP_USERNAME", cfg.SMTPUsername)
+	cfg.MailFrom = envString("FORUM_MAIL_FROM", cfg.MailFrom)
+	cfg.AvatarSize = envInt("FORUM_AVATAR_SIZE", cfg.AvatarSize)
+	if cfg.AvatarSize <= 0 || cfg.AvatarSize > maxAvatarSize {
+		return cfg, fmt.Errorf("invalid FORUM_AVATAR_SIZE %d: want 1 to %d", cfg.AvatarSize, maxAvatarSize)
+	}
+	cfg.Gravatar = envBool("FORUM_GRAVATAR", cfg.Gravatar)
+	cfg.MagicLinks = envBool("FORUM_MAGIC_LINKS", cfg.MagicLinks)
+	if cfg.MagicLinks && cfg.SMTPAddr == "" {
+		return cfg, errors.New("FORUM_MAGIC_LINKS needs FORUM_SMTP_ADDR to send the links")
+	}
+	cfg.MagicLinkTTL = envDuration("FORUM_MAGIC_LINK_TTL", cfg.MagicLinkTTL)
+	cfg.ReadOnly = envBool("FORUM_READ_ONLY", cfg.ReadOnly)
+	cfg.ReadOnlyCheckInterval = envDuration("FORUM_READ_ONLY_CHECK_INTERVAL", cfg.ReadOnlyCheckInterval)
+	cfg.OIDC.Issuer = envString("FORUM_OIDC_ISSUER", cfg.OIDC.Issuer)
+	cfg.OIDC.ClientID = envString("FORUM_OIDC_CLIENT_ID", cfg.OIDC.ClientID)
+	cfg.OIDC.RedirectURL = envString("FORUM_OIDC_REDIRECT_URL", cfg.OIDC.RedirectURL)
+	cfg.OIDC.Name = envString("FORUM_OIDC_NAME", cfg.OIDC.Name)
+	cfg.OIDC.Scopes = envList("FORUM_OIDC_SCOPES", cfg.OIDC.Scopes)
+	cfg.OIDC.HandleClaim = envString("FORUM_OIDC_HANDLE_CLAIM", cfg.OIDC.HandleClaim)
+	cfg.OIDC.AutoProvision = envBool("FORUM_OIDC_AUTO_PROVISION", cfg.OIDC.AutoProvision)
+	cfg.Captcha.Provider = envString("FORUM_CAPTCHA", cfg.Captcha.Provider)
+	cfg.Captcha.SiteKey = envString("FORUM_CAPTCHA_SITE_KEY", cfg.Captcha.SiteKey)
+	cfg.Captcha.Timeout = envDuration("FORUM_CAPTCHA_TIMEOUT", cfg.Captcha.Timeout)
+	cfg.Captcha.VerifyURL = envString("FORUM_CAPTCHA_VERIFY_URL", cfg.Captcha.VerifyURL)
+	if v := os.Getenv("FORUM_API_LEGACY_SUNSET"); v != "" {
+		sunset, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid FORUM_API_LEGACY_SUNSET %q: %w", v, err)
+		}
+		cfg.LegacyAPISunset = sunset
+	}
+	summarizer, err := newSummarizer(envString("FORUM_SUMMARIZER", SummarizerOff))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Summarizer = summarizer
+	cfg.SummaryMinPosts = envInt("FORUM_SUMMARY_MIN_POSTS", cfg.SummaryMinPosts)
+	cfg.SummaryTimeout = envDuration("FORUM_SUMMARY_TIMEOUT", cfg.SummaryTimeout)
+	proxies, err := parseCIDRs(envList("FORUM_TRUSTED_PROXIES", nil))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.TrustedProxies = proxies
+	if path := os.Getenv("FORUM_PASSWORD_PEPPER_FILE"); path != "" {
+		id, peppers, err := LoadPeppers(path)
+		if err != nil {
+			return cfg, fmt.Errorf("loading password peppers: %w", err)
+		}
+		cfg.Password.PepperID = id
+		cfg.Password.Peppers = peppers
+	}
+	if err := cfg.Password.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid password hashing settings: %w", err)
+	}
+	return cfg, nil
+}
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+func envBool(key string, def bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+func envInt64(key string, def int64) int64 {
+	if v := os.Getenv(key); v != "" {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+// envList reads a comma-separated list, ignoring empty entries.
+func envList(key string, def []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		return def
+	}
+	return list
+}
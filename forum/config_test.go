@@ -0,0 +1,27 @@
+// forum/config_test.go
+package forum_test
+
+import (
+	"testing"
+
+	"github.com/rexlx/volconvo/forum"
+)
+
+// TestMagicLinksNeedSMTP checks that sign-in links can't be turned on with
+// nowhere to send them, since they'd otherwise only reach the log.
+func TestMagicLinksNeedSMTP(t *testing.T) {
+	t.Setenv("FORUM_MAGIC_LINKS", "true")
+	t.Setenv("FORUM_SMTP_ADDR", "")
+	if _, err := forum.ConfigFromEnv(); err == nil {
+		t.Error("ConfigFromEnv with magic links and no SMTP server succeeded")
+	}
+
+	t.Setenv("FORUM_SMTP_ADDR", "mail.example.com:587")
+	cfg, err := forum.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv with an SMTP server: %v", err)
+	}
+	if !cfg.MagicLinks {
+		t.Error("MagicLinks is off with FORUM_MAGIC_LINKS set")
+	}
+}
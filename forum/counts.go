@@ -0,0 +1,89 @@
+// forum/counts.go
+package forum
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults for topic count caching. Counts are cached briefly because every
+// listing page needs one and a full COUNT(*) grows with the table.
+const (
+	DefaultCountCacheTTL        = 30 * time.Second
+	DefaultApproxCountThreshold = 100000
+)
+
+// SetCountCaching changes how long topic counts are cached and above how many
+// rows the unsearched listing switches to the planner's estimate. Zero
+// disables the cache or the estimate respectively.
+func (d *Database) SetCountCaching(ttl time.Duration, approxAbove int64) {
+	d.counts.mu.Lock()
+	defer d.counts.mu.Unlock()
+	d.counts.ttl = ttl
+	d.counts.approxAbove = approxAbove
+	d.counts.entries = nil
+}
+
+// countCache holds recent topic counts keyed by TopicFilter.key. Writes bump the
+// generation so a count computed before a write is never stored after it.
+type countCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	approxAbove int64
+	generation  uint64
+	entries     map[string]cachedCount
+}
+
+type cachedCount struct {
+	n       int
+	expires time.Time
+}
+
+// get returns a cached count and the generation to pass to put on a miss.
+func (c *countCache) get(key string) (int, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return 0, false, c.generation
+	}
+	return e.n, true, c.generation
+}
+
+func (c *countCache) put(key string, n int, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 || generation != c.generation {
+		return
+	}
+	if c.entries == nil {
+		c.entries = map[string]cachedCount{}
+	}
+	c.entries[key] = cachedCount{n: n, expires: time.Now().Add(c.ttl)}
+}
+
+// invalidate drops every cached count.
+func (c *countCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = nil
+}
+
+func (c *countCache) approxThreshold() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.approxAbove
+}
+
+// --- Count Database Functions ---
+
+// estimateRows returns the planner's row estimate for a table, which is kept
+// current by autovacuum and costs nothing to read.
+func (d *Database) estimateRows(table string) (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var n float64
+	err := d.readQueryRow(ctx, `SELECT reltuples FROM pg_class WHERE oid = to_regclass($1)`, table).Scan(&n)
+	return int64(n), err
+}
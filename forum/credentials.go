@@ -0,0 +1,274 @@
+// forum/credentials.go
+package forum
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// credentialListLimit caps each list in the credential inventory.
+const credentialListLimit = 500
+
+// SessionInfo describes a session token without revealing it.
+type SessionInfo struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Handle     string     `json:"handle"`
+	Email      string     `json:"email"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// APIKeyInfo describes a user's API key without revealing it.
+type APIKeyInfo struct {
+	UserID     string     `json:"user_id"`
+	Handle     string     `json:"handle"`
+	Email      string     `json:"email"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CredentialInventory is every active session and API key matching a search.
+type CredentialInventory struct {
+	Sessions []SessionInfo `json:"sessions"`
+	APIKeys  []APIKeyInfo  `json:"api_keys"`
+}
+
+// RevokeRequest names the credentials to revoke: session IDs, the user IDs
+// whose API keys should be replaced, or every session at once.
+type RevokeRequest struct {
+	Sessions    []string `json:"sessions"`
+	APIKeys     []string `json:"api_keys"`
+	AllSessions bool     `json:"all_sessions"`
+}
+
+// RevokeResult reports how many credentials a RevokeRequest revoked.
+type RevokeResult struct {
+	Sessions int64 `json:"sessions"`
+	APIKeys  int64 `json:"api_keys"`
+}
+
+// CredentialsViewData is the data structure for the admin credentials page.
+type CredentialsViewData struct {
+	User        *Viewer
+	SearchQuery string
+	Inventory   CredentialInventory
+	Revoked     *RevokeResult
+}
+
+// touchSession records that a session was used, at most once per
+// PresenceWriteInterval.
+func (h *Handlers) touchSession(tk *Token) {
+	now := time.Now()
+	if !h.credentialUse.due("session:"+tk.ID, now) {
+		return
+	}
+	if err := h.db.TouchToken(tk.ID, now); err != nil {
+		log.Printf("Error updating session last use: %v", err)
+	}
+}
+
+// touchAPIKey records that a user's API key was used by r, at most once per
+// PresenceWriteInterval.
+func (h *Handlers) touchAPIKey(r *http.Request, user *User) {
+	now := time.Now()
+	if !h.credentialUse.due("key:"+user.ID, now) {
+		return
+	}
+	if err := h.db.TouchAPIKey(user.ID, now); err != nil {
+		log.Printf("Error updating API key last use: %v", err)
+	}
+	h.authEvent(r, user, AuthAPIKeyUse, "", map[string]string{"path": r.URL.Path})
+}
+
+// revokeCredentials carries out req and records it in the audit log.
+func (h *Handlers) revokeCredentials(staff *User, req RevokeRequest) (RevokeResult, error) {
+	var res RevokeResult
+	var err error
+	if req.AllSessions {
+		res.Sessions, err = h.db.DeleteAllTokens()
+	} else if len(req.Sessions) > 0 {
+		res.Sessions, err = h.db.DeleteTokens(req.Sessions)
+	}
+	if err != nil {
+		return res, err
+	}
+	for _, userID := range req.APIKeys {
+		key, err := generateAPIKey()
+		if err != nil {
+			return res, err
+		}
+		if err := h.db.SetUserKey(userID, key); err != nil {
+			return res, err
+		}
+		res.APIKeys++
+	}
+	h.audit(staff, "credentials.revoke", "credentials", "", map[string]string{
+		"all_sessions": strconv.FormatBool(req.AllSessions),
+		"sessions":     strconv.FormatInt(res.Sessions, 10),
+		"api_keys":     strings.Join(req.APIKeys, ","),
+	})
+	return res, nil
+}
+
+// showCredentials serves GET /admin/credentials?q= and, after a revocation,
+// shows what was revoked.
+func (h *Handlers) showCredentials(w http.ResponseWriter, r *http.Request, revoked *RevokeResult) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	q := strings.TrimSpace(r.FormValue("q"))
+	inv, err := h.db.WithContext(r.Context()).ListCredentials(q, credentialListLimit)
+	if err != nil {
+		log.Printf("Error listing credentials: %v", err)
+		http.Error(w, "Failed to retrieve credentials", http.StatusInternalServerError)
+		return
+	}
+	data := CredentialsViewData{User: NewViewer(staff), SearchQuery: q, Inventory: inv, Revoked: revoked}
+	if err := h.templates.ExecuteTemplate(w, "credentials.html", data); err != nil {
+		log.Printf("Error executing credentials template: %v", err)
+	}
+}
+
+// revokeCredentialsForm serves POST /admin/credentials/revoke from the
+// credentials page's checkboxes.
+func (h *Handlers) revokeCredentialsForm(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	req := RevokeRequest{
+		Sessions:    r.Form["session"],
+		APIKeys:     r.Form["api_key"],
+		AllSessions: r.FormValue("all_sessions") == "on",
+	}
+	res, err := h.revokeCredentials(staff, req)
+	if err != nil {
+		log.Printf("Error revoking credentials: %v", err)
+		http.Error(w, "Failed to revoke credentials", http.StatusInternalServerError)
+		return
+	}
+	h.showCredentials(w, r, &res)
+}
+
+// credentialsAPI serves GET /api/admin/credentials?q=.
+func (h *Handlers) credentialsAPI(w http.ResponseWriter, r *http.Request) {
+	inv, err := h.db.WithContext(r.Context()).ListCredentials(strings.TrimSpace(r.URL.Query().Get("q")), credentialListLimit)
+	if err != nil {
+		log.Printf("Error listing credentials: %v", err)
+		http.Error(w, "Failed to retrieve credentials", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, inv)
+}
+
+// revokeCredentialsAPI serves POST /api/admin/credentials/revoke.
+func (h *Handlers) revokeCredentialsAPI(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	var req RevokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequestBody(w, err, "Invalid request body")
+		return
+	}
+	res, err := h.revokeCredentials(staff, req)
+	if err != nil {
+		log.Printf("Error revoking credentials: %v", err)
+		http.Error(w, "Failed to revoke credentials", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, res)
+}
+
+// --- Credential Database Functions ---
+
+func (d *Database) TouchToken(id string, at time.Time) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE tokens SET last_used_at = $2 WHERE id = $1`, id, at)
+	return err
+}
+
+func (d *Database) TouchAPIKey(userID string, at time.Time) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE users SET key_last_used_at = $2 WHERE id = $1`, userID, at)
+	return err
+}
+
+// ListCredentials returns unexpired sessions, most recently used first, and
+// API keys, most recently used first, for users whose email or handle match q.
+func (d *Database) ListCredentials(q string, limit int) (CredentialInventory, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var inv CredentialInventory
+	pattern := "%" + q + "%"
+
+	rows, err := d.pool.Query(ctx, `
+        SELECT t.id, t.user_id, t.handle, t.email, t.ip, t.user_agent, t.created_at, t.expires_at, t.last_used_at
+        FROM tokens t
+        WHERE t.expires_at > NOW() AND (t.email ILIKE $1 OR t.handle ILIKE $1)
+        ORDER BY COALESCE(t.last_used_at, t.created_at) DESC
+        LIMIT $2`, pattern, limit)
+	if err != nil {
+		return inv, err
+	}
+	for rows.Next() {
+		var s SessionInfo
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Handle, &s.Email, &s.IP, &s.UserAgent, &s.CreatedAt, &s.ExpiresAt, &s.LastUsedAt); err != nil {
+			rows.Close()
+			return inv, err
+		}
+		inv.Sessions = append(inv.Sessions, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return inv, err
+	}
+
+	rows, err = d.pool.Query(ctx, `
+        SELECT id, handle, email, COALESCE(key_created_at, created_at), key_last_used_at
+        FROM users
+        WHERE (email ILIKE $1 OR handle ILIKE $1) AND `+notDeleted("users")+`
+        ORDER BY key_last_used_at DESC NULLS LAST, created_at DESC
+        LIMIT $2`, pattern, limit)
+	if err != nil {
+		return inv, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k APIKeyInfo
+		if err := rows.Scan(&k.UserID, &k.Handle, &k.Email, &k.CreatedAt, &k.LastUsedAt); err != nil {
+			return inv, err
+		}
+		inv.APIKeys = append(inv.APIKeys, k)
+	}
+	return inv, rows.Err()
+}
+
+// DeleteTokens ends the given sessions, returning how many existed.
+func (d *Database) DeleteTokens(ids []string) (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM tokens WHERE id = ANY($1::uuid[])`, ids)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteAllTokens ends every session on the instance.
+func (d *Database) DeleteAllTokens() (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM tokens`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -3,12 +3,17 @@ package forum
 
 import (
 	"context"
-	"database/sql"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,7 +25,15 @@ CREATE TABLE IF NOT EXISTS topics (
     title TEXT NOT NULL,
     tags TEXT[] NOT NULL DEFAULT '{}',
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    author_id UUID NOT NULL
+    author_id UUID NOT NULL,
+    reply_count INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    search TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', title)) STORED,
+    last_post_at TIMESTAMPTZ,
+    last_post_author TEXT NOT NULL DEFAULT '',
+    solution_post_id INTEGER,
+    view_count BIGINT NOT NULL DEFAULT 0
 );
 CREATE TABLE IF NOT EXISTS posts (
     id SERIAL PRIMARY KEY,
@@ -30,6 +43,12 @@ CREATE TABLE IF NOT EXISTS posts (
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     author_id UUID NOT NULL,
     parent_post_id INTEGER,
+    wiki BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ,
+    state TEXT NOT NULL DEFAULT 'visible',
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    search TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', body)) STORED,
     CONSTRAINT fk_topic
         FOREIGN KEY(topic_id)
         REFERENCES topics(id)
@@ -38,14 +57,25 @@ CREATE TABLE IF NOT EXISTS posts (
 CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY,
     email TEXT NOT NULL UNIQUE,
-    key TEXT NOT NULL UNIQUE,
+    key_hash BYTEA NOT NULL,
     handle TEXT NOT NULL,
-    hash BYTEA,
     password TEXT,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     notifications JSONB NOT NULL DEFAULT '[]',
-    admin BOOLEAN NOT NULL DEFAULT FALSE
+    admin BOOLEAN NOT NULL DEFAULT FALSE,
+    last_seen_at TIMESTAMPTZ,
+    last_visit_at TIMESTAMPTZ,
+    hide_presence BOOLEAN NOT NULL DEFAULT FALSE,
+    password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+    key_created_at TIMESTAMPTZ,
+    key_last_used_at TIMESTAMPTZ,
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    page_size INTEGER NOT NULL DEFAULT 0,
+    banned_until TIMESTAMPTZ,
+    ban_reason TEXT NOT NULL DEFAULT '',
+    pending BOOLEAN NOT NULL DEFAULT FALSE
 );
 CREATE TABLE IF NOT EXISTS tokens (
     id UUID PRIMARY KEY,
@@ -55,174 +85,952 @@ CREATE TABLE IF NOT EXISTS tokens (
     handle TEXT NOT NULL,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     expires_at TIMESTAMPTZ NOT NULL,
-    hash BYTEA NOT NULL
+    hash BYTEA NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    last_used_at TIMESTAMPTZ,
+    user_agent TEXT NOT NULL DEFAULT ''
 );
 CREATE INDEX IF NOT EXISTS idx_posts_on_topic_id ON posts(topic_id);
+
+-- Columns added after the initial release. ADD COLUMN IF NOT EXISTS keeps
+-- CreateTables safe to run against databases created by older versions.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_visit_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_presence BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_users_on_last_seen_at ON users(last_seen_at);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS wiki BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT 'visible';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS key_created_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS key_last_used_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE topics ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE topics ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE topics ADD COLUMN IF NOT EXISTS solution_post_id INTEGER;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS page_size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS banned_until TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ban_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_topics_live_on_created_at ON topics(created_at) WHERE deleted_at IS NULL;
+-- Foreign keys to users, and from replies to their parent posts, are added by
+-- enforceForeignKeys, which reports orphaned rows before validating them.
+-- Password hashes used to be stored twice, as users.hash and users.password.
+-- Keep the self-describing text column and drop the duplicate.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'hash') THEN
+        UPDATE users SET password = convert_from(hash, 'UTF8') WHERE password IS NULL AND hash IS NOT NULL;
+        ALTER TABLE users DROP COLUMN hash;
+    END IF;
+END $$;
+-- API keys used to be stored as users.key in plaintext. Keep only their
+-- SHA-256 hash; see apiKeyHash.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'key') THEN
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS key_hash BYTEA;
+        UPDATE users SET key_hash = sha256(convert_to(key, 'UTF8')) WHERE key_hash IS NULL;
+        ALTER TABLE users ALTER COLUMN key_hash SET NOT NULL;
+        ALTER TABLE users DROP COLUMN key;
+    END IF;
+END $$;
+-- topics.reply_count is the number of visible posts, kept by CreatePost and
+-- SetPostState. Backfill it once when the column first appears.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'topics' AND column_name = 'reply_count') THEN
+        ALTER TABLE topics ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+        UPDATE topics t SET reply_count = (SELECT COUNT(*) FROM posts p WHERE p.topic_id = t.id AND p.state = 'visible');
+    END IF;
+END $$;
+-- topics.last_post_at and last_post_author describe the newest visible
+-- post, kept alongside reply_count; see lastPostRefresh. Backfill them once
+-- when the columns first appear.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'topics' AND column_name = 'last_post_at') THEN
+        ALTER TABLE topics ADD COLUMN last_post_at TIMESTAMPTZ;
+        ALTER TABLE topics ADD COLUMN last_post_author TEXT NOT NULL DEFAULT '';
+        UPDATE topics t SET last_post_at = l.created_at, last_post_author = l.author
+        FROM (
+            SELECT DISTINCT ON (topic_id) topic_id, created_at, author FROM posts
+            WHERE state = 'visible' AND deleted_at IS NULL
+            ORDER BY topic_id, created_at DESC, id DESC
+        ) l
+        WHERE t.id = l.topic_id;
+    END IF;
+END $$;
+CREATE INDEX IF NOT EXISTS idx_topics_live_on_last_post_at ON topics(last_post_at) WHERE deleted_at IS NULL;
+ALTER TABLE topics ADD COLUMN IF NOT EXISTS view_count BIGINT NOT NULL DEFAULT 0;
+-- One index per topic list sort other than the default; see topicSorts.
+CREATE INDEX IF NOT EXISTS idx_topics_live_on_activity ON topics (GREATEST(created_at, last_post_at), id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_topics_live_on_reply_count ON topics (reply_count, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_topics_live_on_view_count ON topics (view_count, id) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    editor_id UUID NOT NULL,
+    editor TEXT NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_post_revisions_on_post_id ON post_revisions(post_id);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id UUID,
+    actor TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_on_created_at ON audit_log(created_at);
+
+CREATE TABLE IF NOT EXISTS user_notes (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    author_id UUID NOT NULL,
+    author TEXT NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_user_notes_on_user_id ON user_notes(user_id);
+
+CREATE TABLE IF NOT EXISTS suspensions (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    created_by UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    lifted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_suspensions_on_user_id ON suspensions(user_id);
+
+CREATE TABLE IF NOT EXISTS mod_queue (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_by UUID,
+    resolved_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_mod_queue_on_subject ON mod_queue(kind, subject_type, subject_id);
+
+CREATE TABLE IF NOT EXISTS reports (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    reporter_id UUID NOT NULL,
+    reporter_trust INTEGER NOT NULL DEFAULT 0,
+    reason_code TEXT NOT NULL DEFAULT 'other',
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    outcome TEXT,
+    resolved_by UUID,
+    resolved_at TIMESTAMPTZ,
+    UNIQUE (post_id, reporter_id)
+);
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS reason_code TEXT NOT NULL DEFAULT 'other';
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS outcome TEXT;
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS resolved_by UUID;
+ALTER TABLE reports ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_reports_on_created_at ON reports(created_at);
+
+CREATE TABLE IF NOT EXISTS mod_rules (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    event TEXT NOT NULL,
+    conditions JSONB NOT NULL DEFAULT '[]',
+    action TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    dry_run BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS invites (
+    code TEXT PRIMARY KEY,
+    created_by UUID NOT NULL,
+    max_uses INTEGER NOT NULL DEFAULT 1,
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_invites_on_created_by ON invites(created_by);
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+    code TEXT NOT NULL REFERENCES invites(code) ON DELETE CASCADE,
+    user_id UUID NOT NULL UNIQUE,
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS incoming_hooks (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    topic_id UUID REFERENCES topics(id) ON DELETE CASCADE,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    title_template TEXT NOT NULL,
+    body_template TEXT NOT NULL,
+    created_by UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS topic_summaries (
+    topic_id UUID PRIMARY KEY REFERENCES topics(id) ON DELETE CASCADE,
+    summary TEXT NOT NULL,
+    post_count INTEGER NOT NULL,
+    last_post_id INTEGER NOT NULL,
+    generated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Active legal holds; target_id is a user or topic ID. Placing and releasing
+-- a hold is recorded in audit_log.
+CREATE TABLE IF NOT EXISTS legal_holds (
+    target_type TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    placed_by_id UUID,
+    placed_by TEXT NOT NULL DEFAULT '',
+    placed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (target_type, target_id)
+);
+
+-- Indexes for search-as-you-type suggestions; see suggest.go. Trigrams let
+-- title ILIKE '%...%' use an index. The extension goes in public so schemas
+-- created later, such as forumtest's, find it on their search_path.
+CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public;
+CREATE INDEX IF NOT EXISTS idx_topics_title_trgm ON topics USING gin (title gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_users_on_lower_handle ON users (lower(handle) text_pattern_ops) WHERE deleted_at IS NULL;
+
+-- Full-text search over titles and post bodies; see search.go. The columns
+-- are generated, so they follow every edit. The configuration must match
+-- searchConfig.
+ALTER TABLE topics ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', title)) STORED;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+CREATE INDEX IF NOT EXISTS idx_topics_on_search ON topics USING gin (search) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_posts_on_search ON posts USING gin (search) WHERE deleted_at IS NULL;
+
+-- Every tag that has been put on a topic, and aliases that new topics get
+-- the real tag for instead; see tags.go. The first start after tags was
+-- added fills it from the live topics.
+CREATE TABLE IF NOT EXISTS tags (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS tag_synonyms (
+    alias TEXT PRIMARY KEY,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_tag_synonyms_on_tag ON tag_synonyms (tag);
+CREATE INDEX IF NOT EXISTS idx_topics_on_tags ON topics USING gin (tags);
+INSERT INTO tags (name)
+    SELECT DISTINCT unnest(tags) FROM topics
+    WHERE deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM tags)
+    ON CONFLICT DO NOTHING;
+
+-- Members following a tag; see tagpages.go.
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS tag_follows (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, tag)
+);
+CREATE INDEX IF NOT EXISTS idx_tag_follows_on_tag ON tag_follows (tag);
+
+-- Members watching a topic for new posts; see subscriptions.go.
+CREATE TABLE IF NOT EXISTS subscriptions (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    topic_id UUID NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, topic_id)
+);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_on_topic_id ON subscriptions (topic_id);
+
+-- Pending "remind me" reminders; see reminders.go. A row is deleted when its
+-- notification is sent.
+CREATE TABLE IF NOT EXISTS reminders (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    topic_id UUID NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+    remind_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_reminders_on_remind_at ON reminders (remind_at);
+CREATE INDEX IF NOT EXISTS idx_reminders_on_user_id ON reminders (user_id, remind_at);
+
+-- Changes shown in a topic's timeline between its posts; see topicevents.go.
+CREATE TABLE IF NOT EXISTS topic_events (
+    id BIGSERIAL PRIMARY KEY,
+    topic_id UUID NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    actor_id UUID,
+    actor TEXT NOT NULL DEFAULT '',
+    data JSONB NOT NULL DEFAULT '{}',
+    staff_only BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_topic_events_on_topic_id ON topic_events (topic_id, created_at);
+
+-- Activity feeds page through a member's topics and posts by time.
+CREATE INDEX IF NOT EXISTS idx_topics_on_author_id ON topics (author_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_posts_on_author_id ON posts (author_id, created_at);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_on_user_id ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS passkeys (
+    id BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    credential JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_passkeys_on_user_id ON passkeys (user_id);
+
+CREATE TABLE IF NOT EXISTS login_links (
+    hash BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_login_links_on_user_id ON login_links (user_id);
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_login_failures_on_last_failure_at ON login_failures (last_failure_at);
+
+-- Session manager data (see sessionstore.go), keyed by the cookie token.
+CREATE TABLE IF NOT EXISTS sessions (
+    token TEXT PRIMARY KEY,
+    data BYTEA NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_on_expiry ON sessions (expiry);
+
+-- Sign-ins, sign-outs and other uses of credentials; see authevents.go.
+-- user_id is NULL for failed sign-ins against unknown addresses.
+CREATE TABLE IF NOT EXISTS auth_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_auth_events_on_user_id ON auth_events (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_auth_events_on_created_at ON auth_events (created_at);
+
+-- Saved topics and posts; see bookmarks.go. post_id is NULL for a topic
+-- bookmark, and remind_at is cleared once its reminder is sent.
+CREATE TABLE IF NOT EXISTS bookmarks (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    topic_id UUID NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+    post_id BIGINT REFERENCES posts(id) ON DELETE CASCADE,
+    remind_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bookmarks_on_topic ON bookmarks (user_id, topic_id) WHERE post_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bookmarks_on_post ON bookmarks (user_id, post_id) WHERE post_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_bookmarks_on_remind_at ON bookmarks (remind_at) WHERE remind_at IS NOT NULL;
+
+-- Uploaded avatars, already scaled; see avatars.go. There is no attachment
+-- store, so the images live here; each is a few kilobytes.
+CREATE TABLE IF NOT EXISTS avatars (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    content_type TEXT NOT NULL,
+    data BYTEA NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Read markers: the highest post ID each member has seen per topic; see
+-- reads.go.
+CREATE TABLE IF NOT EXISTS topic_reads (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    topic_id UUID NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+    last_post_id BIGINT NOT NULL,
+    read_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, topic_id)
+);
+CREATE INDEX IF NOT EXISTS idx_topic_reads_on_topic_id ON topic_reads (topic_id);
+
+-- Announcements admins scheduled to publish later, as a new topic or as a
+-- post in topic_id; see scheduled.go. published_at is set when the scheduler
+-- claims a row, and post_id or error once it has tried.
+CREATE TABLE IF NOT EXISTS scheduled_posts (
+    id BIGSERIAL PRIMARY KEY,
+    author_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    topic_id UUID REFERENCES topics(id) ON DELETE CASCADE,
+    title TEXT NOT NULL DEFAULT '',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    body TEXT NOT NULL,
+    publish_at TIMESTAMPTZ NOT NULL,
+    published_at TIMESTAMPTZ,
+    post_id INTEGER REFERENCES posts(id) ON DELETE SET NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_scheduled_posts_due ON scheduled_posts (publish_at) WHERE published_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS link_previews (
+    url TEXT PRIMARY KEY,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    image_url TEXT NOT NULL DEFAULT '',
+    provider TEXT NOT NULL DEFAULT '',
+    embed_url TEXT NOT NULL DEFAULT '',
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+ALTER TABLE link_previews ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE link_previews ADD COLUMN IF NOT EXISTS embed_url TEXT NOT NULL DEFAULT '';
 `
 
+// Database is the Postgres-backed store. WithContext and WithTimeout return
+// lightweight copies that share the same pools.
 type Database struct {
+	*pools
+	ctx     context.Context
+	timeout time.Duration
+}
+
+// pools is the connection state shared by every copy of a Database.
+type pools struct {
 	pool *pgxpool.Pool
+	// replicas serve read-heavy listing queries; see readQuery.
+	replicas    []*replica
+	nextReplica atomic.Uint32
+
+	queryTimeout time.Duration
+	tracer       queryTracer
+	counts       countCache
 }
 
 func NewDatabase(connectionString string) (*Database, error) {
-	pool, err := pgxpool.New(context.Background(), connectionString)
+	return OpenDatabase(connectionString, "")
+}
+
+// OpenDatabase connects using connectionString, overriding its password with
+// password when one is given so the DSN itself can be free of credentials.
+func OpenDatabase(connectionString, password string) (*Database, error) {
+	cfg, err := pgxpool.ParseConfig(connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database connection string: %w", err)
+	}
+	if password != "" {
+		cfg.ConnConfig.Password = password
+	}
+	d := &Database{pools: &pools{queryTimeout: DefaultQueryTimeout}}
+	d.tracer.slow.Store(int64(DefaultSlowQueryThreshold))
+	d.counts.ttl = DefaultCountCacheTTL
+	d.counts.approxAbove = DefaultApproxCountThreshold
+	cfg.ConnConfig.Tracer = &d.tracer
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
 	}
 	if err := pool.Ping(context.Background()); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
-	return &Database{pool: pool}, nil
+	d.pool = pool
+	return d, nil
 }
 
+// Close closes the primary and replica pools. Copies from WithContext share
+// them, so close only the Database that OpenDatabase returned.
+func (d *Database) Close() {
+	for _, r := range d.replicas {
+		r.pool.Close()
+	}
+	d.pool.Close()
+}
+
+// CreateTables applies the schema and enforces foreign keys (see
+// integrity.go). Migrations can be slow on large tables, so it runs without
+// the per-query timeout.
 func (d *Database) CreateTables() error {
-	_, err := d.pool.Exec(context.Background(), schema)
-	return err
+	if _, err := d.pool.Exec(context.Background(), schema); err != nil {
+		return err
+	}
+	if err := d.seedGuestAuthor(context.Background()); err != nil {
+		return err
+	}
+	return d.enforceForeignKeys(context.Background())
 }
 
 // --- Topic Functions ---
 
 func (d *Database) CreateTopic(topic *Topic) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	err := insertTopic(ctx, d.pool, topic)
+	if err == nil {
+		d.counts.invalidate()
+	}
+	return err
+}
+
+// querier is the part of a pool or transaction the insert helpers need.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// insertTopic stores topic, first swapping any tag synonyms for their tags.
+func insertTopic(ctx context.Context, q querier, topic *Topic) error {
+	tags, err := resolveTags(ctx, q, topic.Tags)
+	if err != nil {
+		return err
+	}
+	topic.Tags = tags
 	query := `INSERT INTO topics (id, title, tags, author_id) VALUES ($1, $2, $3, $4) RETURNING created_at`
-	return d.pool.QueryRow(context.Background(), query, topic.ID, topic.Title, topic.Tags, topic.AuthorID).Scan(&topic.CreatedAt)
+	if err := q.QueryRow(ctx, query, topic.ID, topic.Title, topic.Tags, topic.AuthorID).Scan(&topic.CreatedAt); err != nil {
+		return err
+	}
+	return registerTags(ctx, q, topic.Tags)
 }
 
+// GetTopic returns the topic with the given ID, or ErrNotFound if there is
+// none or it was deleted.
 func (d *Database) GetTopic(id uuid.UUID) (*Topic, error) {
-	var topic Topic
-	query := `SELECT id, title, tags, created_at, author_id FROM topics WHERE id = $1`
-	row := d.pool.QueryRow(context.Background(), query, id)
-	err := row.Scan(&topic.ID, &topic.Title, &topic.Tags, &topic.CreatedAt, &topic.AuthorID)
-	if err == sql.ErrNoRows {
-		return nil, nil // Return nil, nil for not found
+	return d.getTopic(id, false)
+}
+
+// TopicFilter narrows the topic listing. Query is a full-text search of
+// titles, which also matches a tag exactly; Tags keeps topics with all of
+// the tags, or any of them unless MatchAll is set. Since keeps topics
+// started or posted in after it, most recently active first. The zero value
+// lists every topic.
+type TopicFilter struct {
+	Query    string
+	Tags     []string
+	MatchAll bool
+	Since    time.Time
+	// Sort orders the listing; see topicSorts. It doesn't change the count.
+	Sort string
+}
+
+// Topic list sorts. The default lists the newest topics first, or for a
+// search the best matches; choosing a sort overrides the ranking.
+const (
+	TopicSortActivity = "activity"
+	TopicSortReplies  = "replies"
+	TopicSortViews    = "views"
+	TopicSortOldest   = "oldest"
+)
+
+// topicSorts maps each sort to its ORDER BY clause, each backed by an index
+// on live topics.
+var topicSorts = map[string]string{
+	"":                "created_at DESC, id DESC",
+	TopicSortActivity: "GREATEST(created_at, last_post_at) DESC, id DESC",
+	TopicSortReplies:  "reply_count DESC, id DESC",
+	TopicSortViews:    "view_count DESC, id DESC",
+	TopicSortOldest:   "created_at ASC, id ASC",
+}
+
+// PostFilter narrows and orders the posts listed on a topic page. The zero
+// value lists them all, oldest first.
+type PostFilter struct {
+	// Author keeps only the posts shown under that name.
+	Author string
+	// Sort orders the posts; see postSorts.
+	Sort string
+}
+
+// Post sorts within a topic. The default is PostSortOldest, which is the
+// empty Sort.
+const (
+	PostSortOldest = "oldest"
+	PostSortNewest = "newest"
+)
+
+// postSorts maps each sort to its ORDER BY clause.
+var postSorts = map[string]string{
+	"":             "created_at ASC, id ASC",
+	PostSortNewest: "created_at DESC, id DESC",
+}
+
+// IsZero reports whether f lists the whole topic in its usual order.
+func (f PostFilter) IsZero() bool {
+	return f == PostFilter{}
+}
+
+// where returns the conditions for f after the topic, which is $1, adding
+// its parameters to args.
+func (f PostFilter) where(args []any) (string, []any) {
+	where := `topic_id = $1 AND state = 'visible'`
+	if f.Author != "" {
+		args = append(args, f.Author)
+		where += fmt.Sprintf(` AND author = $%d`, len(args))
 	}
-	return &topic, err
+	return where, args
 }
 
-func (d *Database) SearchAndListTopics(searchQuery string, page, pageSize int) ([]Topic, error) {
+// where returns the conditions for f, numbering its parameters after args,
+// and args with f's values appended.
+func (f TopicFilter) where(args []any) (string, []any) {
+	cond := notDeleted("topics")
+	if f.Query != "" {
+		cond += fmt.Sprintf(" AND (search @@ websearch_to_tsquery('%s', $%d) OR $%d = ANY(tags))", searchConfig, len(args)+1, len(args)+2)
+		args = append(args, f.Query, strings.ToLower(f.Query))
+	}
+	if len(f.Tags) > 0 {
+		// Both operators can use idx_topics_on_tags.
+		op := "&&"
+		if f.MatchAll {
+			op = "@>"
+		}
+		cond += fmt.Sprintf(" AND tags %s $%d::text[]", op, len(args)+1)
+		args = append(args, f.Tags)
+	}
+	if !f.Since.IsZero() {
+		cond += fmt.Sprintf(" AND (created_at > $%d OR last_post_at > $%d)", len(args)+1, len(args)+1)
+		args = append(args, f.Since)
+	}
+	return cond, args
+}
+
+// key identifies f in the count cache.
+func (f TopicFilter) key() string {
+	key := f.Query
+	if len(f.Tags) > 0 {
+		match := "any"
+		if f.MatchAll {
+			match = "all"
+		}
+		key += "\x00" + match + "\x00" + strings.Join(f.Tags, "\x00")
+	}
+	if !f.Since.IsZero() {
+		key += "\x00since\x00" + f.Since.UTC().Format(time.RFC3339Nano)
+	}
+	return key
+}
+
+func (d *Database) SearchAndListTopics(filter TopicFilter, page, pageSize int) ([]Topic, error) {
+	ctx, cancel := d.op()
+	defer cancel()
 	offset := (page - 1) * pageSize
-	query := "SELECT id, title, tags, created_at, author_id FROM topics"
-	args := []interface{}{}
-	if searchQuery != "" {
-		query += " WHERE title ILIKE $1 OR $2 = ANY(tags)"
-		args = append(args, "%"+searchQuery+"%", strings.ToLower(searchQuery))
-	}
-	query += " ORDER BY created_at DESC LIMIT $%d OFFSET $%d"
-	query = fmt.Sprintf(query, len(args)+1, len(args)+2)
+	where, args := filter.where(nil)
+	order, ok := topicSorts[filter.Sort]
+	if !ok {
+		order = topicSorts[""]
+	}
+	if filter.Sort == "" && !filter.Since.IsZero() {
+		order = topicSorts[TopicSortActivity]
+	}
+	if filter.Query != "" && filter.Sort == "" {
+		// The best matches come first; where puts the query in $1.
+		order = fmt.Sprintf("ts_rank(search, websearch_to_tsquery('%s', $1)) DESC, ", searchConfig) + order
+	}
+	query := "SELECT " + topicColumns + " FROM topics WHERE " + where +
+		fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", order, len(args)+1, len(args)+2)
 	args = append(args, pageSize, offset)
-	rows, err := d.pool.Query(context.Background(), query, args...)
+	rows, err := d.readQuery(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var topics []Topic
 	for rows.Next() {
-		var topic Topic
-		if err := rows.Scan(&topic.ID, &topic.Title, &topic.Tags, &topic.CreatedAt, &topic.AuthorID); err != nil {
+		topic, err := scanTopic(rows)
+		if err != nil {
 			return nil, err
 		}
-		topics = append(topics, topic)
+		topics = append(topics, *topic)
 	}
 	return topics, rows.Err()
 }
 
-func (d *Database) CountTopics(searchQuery string) (int, error) {
-	query := "SELECT COUNT(*) FROM topics"
-	args := []interface{}{}
-	if searchQuery != "" {
-		query += " WHERE title ILIKE $1 OR $2 = ANY(tags)"
-		args = append(args, "%"+searchQuery+"%", strings.ToLower(searchQuery))
+// CountTopics counts the topics matching filter. Counts are cached for a
+// short while, and a large unfiltered listing uses the planner's estimate
+// instead of counting, since pagination doesn't need the exact figure.
+func (d *Database) CountTopics(filter TopicFilter) (int, error) {
+	key := filter.key()
+	count, ok, generation := d.counts.get(key)
+	if ok {
+		return count, nil
+	}
+	if threshold := d.counts.approxThreshold(); key == "" && threshold > 0 {
+		estimate, err := d.estimateRows("topics")
+		if err != nil {
+			return 0, err
+		}
+		if estimate >= threshold {
+			d.counts.put(key, int(estimate), generation)
+			return int(estimate), nil
+		}
 	}
+	count, err := d.countTopics(filter)
+	if err != nil {
+		return 0, err
+	}
+	d.counts.put(key, count, generation)
+	return count, nil
+}
+
+func (d *Database) countTopics(filter TopicFilter) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	where, args := filter.where(nil)
 	var count int
-	err := d.pool.QueryRow(context.Background(), query, args...).Scan(&count)
+	err := d.readQueryRow(ctx, "SELECT COUNT(*) FROM topics WHERE "+where, args...).Scan(&count)
 	return count, err
 }
 
 // --- Post Functions ---
 
 func (d *Database) CreatePost(post *Post) error {
-	query := `INSERT INTO posts (topic_id, author, body, author_id, parent_post_id) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
-	return d.pool.QueryRow(context.Background(), query, post.TopicID, post.Author, post.Body, post.AuthorID, post.ParentPostID).Scan(&post.ID, &post.CreatedAt)
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := insertPost(ctx, tx, post); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-func (d *Database) GetPostsByTopic(topicID uuid.UUID, page, pageSize int) ([]Post, error) {
-	offset := (page - 1) * pageSize
-	query := `SELECT id, topic_id, author, body, created_at, author_id, parent_post_id FROM posts 
-              WHERE topic_id = $1 
-              ORDER BY created_at ASC 
-              LIMIT $2 OFFSET $3`
-	rows, err := d.pool.Query(context.Background(), query, topicID, pageSize, offset)
+// insertPost stores post and counts it on its topic, which it also makes the
+// topic's last post. Run it in a transaction so the two can't disagree.
+// Posting to a missing or deleted topic returns pgx.ErrNoRows.
+func insertPost(ctx context.Context, q querier, post *Post) error {
+	if post.State == "" {
+		post.State = PostVisible
+	}
+	query := `INSERT INTO posts (topic_id, author, body, author_id, parent_post_id, state)
+              SELECT $1::uuid, $2::text, $3::text, $4::uuid, $5::integer, $6::text
+              WHERE EXISTS (SELECT 1 FROM topics WHERE id = $1::uuid AND ` + notDeleted("topics") + `)
+              RETURNING id, created_at`
+	err := q.QueryRow(ctx, query, post.TopicID, post.Author, post.Body, post.AuthorID, post.ParentPostID, post.State).Scan(&post.ID, &post.CreatedAt)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	var posts []Post
-	for rows.Next() {
-		var p Post
-		if err := rows.Scan(&p.ID, &p.TopicID, &p.Author, &p.Body, &p.CreatedAt, &p.AuthorID, &p.ParentPostID); err != nil {
-			return nil, err
-		}
-		posts = append(posts, p)
+	if post.State != PostVisible {
+		return nil
 	}
-	return posts, rows.Err()
+	// Imports may bring older posts, which don't replace a newer last post.
+	query = `UPDATE topics SET reply_count = reply_count + 1,
+                  last_post_author = CASE WHEN last_post_at IS NULL OR last_post_at <= $2 THEN $3 ELSE last_post_author END,
+                  last_post_at = GREATEST(last_post_at, $2)
+              WHERE id = $1`
+	_, err = q.Exec(ctx, query, post.TopicID, post.CreatedAt, post.Author)
+	return err
 }
 
-func (d *Database) GetPost(id int64) (*Post, error) {
-	var post Post
-	query := `SELECT id, topic_id, author, body, created_at, author_id, parent_post_id FROM posts WHERE id = $1`
-	row := d.pool.QueryRow(context.Background(), query, id)
-	err := row.Scan(&post.ID, &post.TopicID, &post.Author, &post.Body, &post.CreatedAt, &post.AuthorID, &post.ParentPostID)
-	if err == sql.ErrNoRows {
-		return nil, nil
+// lastPostRefresh recomputes last_post_at and last_post_author from the
+// newest visible post for the topics t matched by the condition appended to
+// it. Run it after changes that can take a topic's last post away, in the
+// same transaction.
+const lastPostRefresh = `UPDATE topics t SET last_post_at = l.created_at, last_post_author = COALESCE(l.author, '')
+              FROM topics t2 LEFT JOIN LATERAL (
+                  SELECT p.created_at, p.author FROM posts p
+                  WHERE p.topic_id = t2.id AND p.state = 'visible' AND p.deleted_at IS NULL
+                  ORDER BY p.created_at DESC, p.id DESC
+                  LIMIT 1
+              ) l ON true
+              WHERE t2.id = t.id AND `
+
+// lastPostOfPost is the lastPostRefresh condition for the topic of post $1.
+const lastPostOfPost = `t.id = (SELECT topic_id FROM posts WHERE id = $1)`
+
+// SetPostState moves a post between visible, held, and hidden, keeping the
+// topic's reply_count and last post in step when a post that isn't deleted
+// enters or leaves visible. A solution that leaves is unmarked.
+func (d *Database) SetPostState(postID int64, state string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	query := `WITH old AS (
+                  SELECT topic_id, state, deleted_at FROM posts WHERE id = $1 FOR UPDATE
+              ), updated AS (
+                  UPDATE posts SET state = $2 WHERE id = $1
+              )
+              UPDATE topics t
+              SET reply_count = reply_count + CASE WHEN $2 = 'visible' THEN 1 ELSE -1 END
+              FROM old
+              WHERE t.id = old.topic_id AND old.deleted_at IS NULL AND (old.state = 'visible') <> ($2 = 'visible')`
+	if _, err := tx.Exec(ctx, query, postID, state); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, lastPostRefresh+lastPostOfPost, postID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, dropHiddenSolution, postID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// postColumns is the column list understood by scanPost.
+const postColumns = `id, topic_id, author, body, created_at, author_id, parent_post_id, wiki, updated_at, state, version, deleted_at`
+
+// scanPost reads a single posts row selected with postColumns.
+func scanPost(row pgx.Row) (*Post, error) {
+	var p Post
+	err := row.Scan(&p.ID, &p.TopicID, &p.Author, &p.Body, &p.CreatedAt, &p.AuthorID, &p.ParentPostID, &p.Wiki, &p.UpdatedAt, &p.State, &p.Version, &p.DeletedAt)
+	if err != nil {
+		return nil, err
 	}
-	return &post, err
+	return &p, nil
 }
 
+func (d *Database) GetPostsByTopic(topicID uuid.UUID, page, pageSize int) ([]Post, error) {
+	return d.getPostsByTopic(topicID, PostFilter{}, page, pageSize, false)
+}
+
+// GetPost returns the post with the given ID, or ErrNotFound if there is
+// none, it was deleted, or its topic was.
+func (d *Database) GetPost(id int64) (*Post, error) {
+	return d.getPost(id, false)
+}
+
+// CountPostsByTopic returns the topic's visible post count from the
+// denormalized topics.reply_count.
 func (d *Database) CountPostsByTopic(topicID uuid.UUID) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
 	var count int
-	query := "SELECT COUNT(*) FROM posts WHERE topic_id = $1"
-	err := d.pool.QueryRow(context.Background(), query, topicID).Scan(&count)
+	query := "SELECT reply_count FROM topics WHERE id = $1"
+	err := d.readQueryRow(ctx, query, topicID).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
 	return count, err
 }
 
 // --- User and Token Functions ---
 
+// pgUniqueViolation is the SQLSTATE of a write that breaks a unique constraint.
+const pgUniqueViolation = "23505"
+
+// SaveUser inserts a new user (Version 0) or overwrites an existing one. A
+// new user whose email is taken returns ErrConflict. The overwrite only
+// happens if the row is still at user.Version and not deleted, so a save made
+// from a stale copy returns ErrConflict instead of undoing someone else's
+// change; on success user.Version is the stored version.
 func (d *Database) SaveUser(user *User) error {
+	ctx, cancel := d.op()
+	defer cancel()
 	notificationsJSON, err := json.Marshal(user.Notifications)
 	if err != nil {
 		return fmt.Errorf("failed to marshal notifications: %w", err)
 	}
 
+	if user.Version == 0 {
+		query := `
+            INSERT INTO users (id, email, key_hash, handle, password, created_at, updated_at, admin, notifications, hide_presence, password_reset_required, version, page_size, pending)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, 1, $12, $13)
+        `
+		_, err := d.pool.Exec(ctx, query,
+			user.ID,
+			user.Email,
+			user.KeyHash,
+			user.Handle,
+			user.Password,
+			user.Created,
+			user.Updated,
+			user.Admin,
+			notificationsJSON,
+			user.HidePresence,
+			user.PasswordResetRequired,
+			user.PageSize,
+			user.Pending,
+		)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		user.Version = 1
+		return nil
+	}
+
 	query := `
-        INSERT INTO users (id, email, key, handle, hash, password, created_at, updated_at, admin, notifications)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-        ON CONFLICT (email) DO UPDATE SET
-            key = EXCLUDED.key,
-            handle = EXCLUDED.handle,
-            hash = EXCLUDED.hash,
-            password = EXCLUDED.password,
-            updated_at = EXCLUDED.updated_at,
-            admin = EXCLUDED.admin,
-            notifications = EXCLUDED.notifications;
+        UPDATE users SET
+            key_hash = $2,
+            handle = $3,
+            password = $4,
+            updated_at = $5,
+            admin = $6,
+            notifications = $7,
+            hide_presence = $8,
+            password_reset_required = $9,
+            page_size = $10,
+            version = version + 1
+        WHERE id = $1 AND version = $11 AND deleted_at IS NULL
+        RETURNING version
     `
-	_, err = d.pool.Exec(context.Background(), query,
+	err = d.pool.QueryRow(ctx, query,
 		user.ID,
-		user.Email,
-		user.Key,
+		user.KeyHash,
 		user.Handle,
-		user.Hash,
 		user.Password,
-		user.Created,
 		user.Updated,
 		user.Admin,
 		notificationsJSON,
-	)
+		user.HidePresence,
+		user.PasswordResetRequired,
+		user.PageSize,
+		user.Version,
+	).Scan(&user.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrConflict
+	}
 	return err
 }
 
 func (d *Database) SaveToken(token *Token) error {
+	ctx, cancel := d.op()
+	defer cancel()
 	query := `
-        INSERT INTO tokens (id, user_id, email, token, handle, created_at, expires_at, hash)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        INSERT INTO tokens (id, user_id, email, token, handle, created_at, expires_at, hash, ip, user_agent)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
         ON CONFLICT (id) DO UPDATE SET
             user_id = EXCLUDED.user_id,
             email = EXCLUDED.email,
@@ -230,9 +1038,11 @@ func (d *Database) SaveToken(token *Token) error {
             handle = EXCLUDED.handle,
             created_at = EXCLUDED.created_at,
             expires_at = EXCLUDED.expires_at,
-            hash = EXCLUDED.hash;
+            hash = EXCLUDED.hash,
+            ip = EXCLUDED.ip,
+            user_agent = EXCLUDED.user_agent;
     `
-	_, err := d.pool.Exec(context.Background(), query,
+	_, err := d.pool.Exec(ctx, query,
 		token.ID,
 		token.UserID,
 		token.Email,
@@ -241,17 +1051,28 @@ func (d *Database) SaveToken(token *Token) error {
 		token.CreatedAt,
 		token.ExpiresAt,
 		token.Hash,
+		token.IP,
+		token.UserAgent,
 	)
 	return err
 }
 
-func (d *Database) GetTokenByValue(value string) (*Token, error) {
+// LookupSession returns the live session whose token is value. It never
+// returns a nil token without an error: a value that can't be a token is an
+// ErrValidation error, an unknown token is ErrNotFound and an expired one is
+// ErrUnauthorized.
+func (d *Database) LookupSession(value string) (*Token, error) {
+	if _, err := uuid.Parse(value); err != nil {
+		return nil, invalid("token", "not a session token")
+	}
+	ctx, cancel := d.op()
+	defer cancel()
 	var token Token
 	query := `
-        SELECT id, user_id, email, token, handle, created_at, expires_at, hash
+        SELECT id, user_id, email, token, handle, created_at, expires_at, hash, ip
         FROM tokens
         WHERE token = $1`
-	row := d.pool.QueryRow(context.Background(), query, value)
+	row := d.pool.QueryRow(ctx, query, value)
 	err := row.Scan(
 		&token.ID,
 		&token.UserID,
@@ -261,83 +1082,87 @@ func (d *Database) GetTokenByValue(value string) (*Token, error) {
 		&token.CreatedAt,
 		&token.ExpiresAt,
 		&token.Hash,
+		&token.IP,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, err
 	}
+	if !token.ExpiresAt.After(time.Now()) {
+		return nil, ErrUnauthorized
+	}
 	return &token, nil
 }
 
+// GetUserByEmail returns the user with the given email, or ErrNotFound if
+// there is none or the account was deleted.
 func (d *Database) GetUserByEmail(email string) (*User, error) {
-	var user User
-	var notificationsJSON []byte
-
-	query := `
-        SELECT id, email, key, handle, hash, password, created_at, updated_at, admin, notifications
-        FROM users
-        WHERE email = $1`
-
-	row := d.pool.QueryRow(context.Background(), query, email)
-
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.Key,
-		&user.Handle,
-		&user.Hash,
-		&user.Password,
-		&user.Created,
-		&user.Updated,
-		&user.Admin,
-		&notificationsJSON,
-	)
+	return d.getUser("email = $1", email, false)
+}
 
+// GetUserByAPIKey returns the user whose email and API key both match, or
+// ErrUnauthorized. An unknown email and a wrong key look the same.
+func (d *Database) GetUserByAPIKey(email, key string) (*User, error) {
+	user, err := d.getUser("email = $1", email, false)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrUnauthorized
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, err
 	}
-
-	if err := json.Unmarshal(notificationsJSON, &user.Notifications); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal notifications: %w", err)
+	if key == "" || subtle.ConstantTimeCompare(user.KeyHash, apiKeyHash(key)) != 1 {
+		return nil, ErrUnauthorized
 	}
-
-	return &user, nil
+	return user, nil
 }
 
-// GetUserByID is required for the notification logic.
+// GetUserByID returns the user with the given ID, or ErrNotFound.
 func (d *Database) GetUserByID(id string) (*User, error) {
-	var user User
-	var notificationsJSON []byte
+	return d.getUser("id = $1", id, false)
+}
 
-	query := `
-        SELECT id, email, key, handle, hash, password, created_at, updated_at, admin, notifications
-        FROM users
-        WHERE id = $1`
+// GetUserByHandle returns the oldest account using the given handle.
+func (d *Database) GetUserByHandle(handle string) (*User, error) {
+	return d.getUser("handle = $1", handle, false)
+}
 
-	row := d.pool.QueryRow(context.Background(), query, id)
+// userColumns is the column list understood by scanUser.
+const userColumns = `id, email, key_hash, handle, COALESCE(password, ''), created_at, updated_at, admin, notifications,
+        last_seen_at, last_visit_at, hide_presence, password_reset_required, version, deleted_at, page_size, banned_until, ban_reason, pending`
+
+// scanUser reads a single users row selected with userColumns.
+func scanUser(row pgx.Row) (*User, error) {
+	var user User
+	var notificationsJSON []byte
 
 	err := row.Scan(
 		&user.ID,
 		&user.Email,
-		&user.Key,
+		&user.KeyHash,
 		&user.Handle,
-		&user.Hash,
 		&user.Password,
 		&user.Created,
 		&user.Updated,
 		&user.Admin,
 		&notificationsJSON,
+		&user.LastSeenAt,
+		&user.LastVisitAt,
+		&user.HidePresence,
+		&user.PasswordResetRequired,
+		&user.Version,
+		&user.DeletedAt,
+		&user.PageSize,
+		&user.BannedUntil,
+		&user.BanReason,
+		&user.Pending,
 	)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, err
 	}
 
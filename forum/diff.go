@@ -0,0 +1,115 @@
+// forum/diff.go
+package forum
+
+import (
+	"regexp"
+)
+
+// Diff operation kinds.
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffCells bounds the size of the LCS table, which is built on every
+// view of a revisions page, anonymous ones included when edit history is
+// public. It allows about 500 changed words on each side, a couple of
+// megabytes; larger inputs are shown as a whole-text replacement instead of
+// a word-level diff.
+const maxDiffCells = 250_000
+
+// DiffOp is one run of unchanged, inserted, or deleted text.
+type DiffOp struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+var diffTokenPattern = regexp.MustCompile(`\s+|[^\s]+`)
+
+// WordDiff compares two texts word by word, keeping whitespace so that joining
+// the Text of every non-insert op reproduces a and every non-delete op reproduces b.
+func WordDiff(a, b string) []DiffOp {
+	x := diffTokenPattern.FindAllString(a, -1)
+	y := diffTokenPattern.FindAllString(b, -1)
+
+	// Trim the common prefix and suffix; edits are usually small.
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	ops = appendDiff(ops, DiffEqual, x[:prefix]...)
+	ops = append(ops, lcsDiff(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	ops = appendDiff(ops, DiffEqual, x[len(x)-suffix:]...)
+	return mergeDiff(ops)
+}
+
+// lcsDiff diffs two token slices using a longest-common-subsequence table.
+func lcsDiff(x, y []string) []DiffOp {
+	n, m := len(x), len(y)
+	if n == 0 || m == 0 || (n+1)*(m+1) > maxDiffCells {
+		var ops []DiffOp
+		ops = appendDiff(ops, DiffDelete, x...)
+		return appendDiff(ops, DiffInsert, y...)
+	}
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []DiffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			ops = appendDiff(ops, DiffEqual, x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = appendDiff(ops, DiffDelete, x[i])
+			i++
+		default:
+			ops = appendDiff(ops, DiffInsert, y[j])
+			j++
+		}
+	}
+	ops = appendDiff(ops, DiffDelete, x[i:]...)
+	return appendDiff(ops, DiffInsert, y[j:]...)
+}
+
+func appendDiff(ops []DiffOp, kind string, tokens ...string) []DiffOp {
+	for _, t := range tokens {
+		ops = append(ops, DiffOp{Kind: kind, Text: t})
+	}
+	return ops
+}
+
+// mergeDiff joins adjacent ops of the same kind.
+func mergeDiff(ops []DiffOp) []DiffOp {
+	var merged []DiffOp
+	for _, op := range ops {
+		if n := len(merged); n > 0 && merged[n-1].Kind == op.Kind {
+			merged[n-1].Text += op.Text
+			continue
+		}
+		merged = append(merged, op)
+	}
+	return merged
+}
@@ -0,0 +1,117 @@
+// forum/embeds.go
+package forum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// maxEmbedBytes caps an oEmbed response, which is a small JSON object.
+const maxEmbedBytes = 64 << 10
+
+// embedProvider is a site whose links are resolved through its oEmbed
+// endpoint instead of being fetched as pages. Links from providers with
+// PlayerHosts are shown as players, framed from one of those hosts; the
+// rest are shown as cards.
+type embedProvider struct {
+	Name        string
+	Links       []*regexp.Regexp
+	Endpoint    string
+	PlayerHosts []string
+}
+
+// embedProviders is the allowlist of oEmbed providers. Players are only
+// ever framed from the hosts listed here, whatever a provider returns.
+var embedProviders = []embedProvider{
+	{
+		Name: "YouTube",
+		Links: []*regexp.Regexp{
+			regexp.MustCompile(`^https?://(www\.|m\.)?youtube\.com/(watch\?|shorts/)`),
+			regexp.MustCompile(`^https?://youtu\.be/[\w-]+`),
+		},
+		Endpoint:    "https://www.youtube.com/oembed",
+		PlayerHosts: []string{"www.youtube.com", "www.youtube-nocookie.com"},
+	},
+	{
+		Name:        "Vimeo",
+		Links:       []*regexp.Regexp{regexp.MustCompile(`^https?://(www\.)?vimeo\.com/\d+`)},
+		Endpoint:    "https://vimeo.com/api/oembed.json",
+		PlayerHosts: []string{"player.vimeo.com"},
+	},
+	{
+		Name:     "Twitter",
+		Links:    []*regexp.Regexp{regexp.MustCompile(`^https?://(www\.|mobile\.)?(twitter|x)\.com/\w+/status/\d+`)},
+		Endpoint: "https://publish.twitter.com/oembed",
+	},
+}
+
+// embedProviderFor returns the provider that embeds link, or nil.
+func embedProviderFor(link string) *embedProvider {
+	for i, p := range embedProviders {
+		for _, re := range p.Links {
+			if re.MatchString(link) {
+				return &embedProviders[i]
+			}
+		}
+	}
+	return nil
+}
+
+// oEmbed is the part of an oEmbed response the forum uses.
+type oEmbed struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	HTML         string `json:"html"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+var (
+	iframeSrc = regexp.MustCompile(`(?i)<iframe[^>]*\ssrc="([^"]+)"`)
+	firstPara = regexp.MustCompile(`(?is)<p[^>]*>(.*?)</p>`)
+	anyTag    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// fetchEmbed resolves link through provider's oEmbed endpoint. The HTML the
+// provider returns is never shown as is: only a player address on one of
+// its PlayerHosts is kept, and the text of a card.
+func fetchEmbed(client *http.Client, provider *embedProvider, link string) (*LinkPreview, error) {
+	endpoint := provider.Endpoint + "?" + url.Values{"format": {"json"}, "url": {link}}.Encode()
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oembed: %s answered %s", provider.Name, resp.Status)
+	}
+	var oe oEmbed
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxEmbedBytes)).Decode(&oe); err != nil {
+		return nil, fmt.Errorf("oembed: reading %s response: %w", provider.Name, err)
+	}
+
+	p := &LinkPreview{URL: link, Provider: provider.Name, FetchedAt: time.Now()}
+	p.Title = truncate(cleanPreviewText(oe.Title), maxPreviewTitle)
+	if u, err := url.Parse(oe.ThumbnailURL); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		p.ImageURL = u.String()
+	}
+	if m := iframeSrc.FindStringSubmatch(oe.HTML); m != nil && len(provider.PlayerHosts) > 0 {
+		u, err := url.Parse(cleanPreviewText(m[1]))
+		if err == nil && u.Scheme == "https" && slices.Contains(provider.PlayerHosts, u.Host) {
+			p.EmbedURL = u.String()
+		}
+	}
+	if p.Title == "" && oe.AuthorName != "" {
+		p.Title = truncate("Post by "+cleanPreviewText(oe.AuthorName), maxPreviewTitle)
+	}
+	if m := firstPara.FindStringSubmatch(oe.HTML); m != nil {
+		p.Description = truncate(cleanPreviewText(anyTag.ReplaceAllString(m[1], " ")), maxPreviewDesc)
+	}
+	return p, nil
+}
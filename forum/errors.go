@@ -0,0 +1,120 @@
+// forum/errors.go
+package forum
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sentinel errors returned by the Database and User methods. Test for them
+// with errors.Is; writeError turns them into HTTP responses.
+var (
+	// ErrNotFound is returned when a record doesn't exist or was deleted.
+	ErrNotFound = errors.New("forum: not found")
+	// ErrConflict is returned by version-checked writes when the row changed
+	// after the caller read it; see concurrency.go.
+	ErrConflict = errors.New("forum: edit conflict")
+	// ErrUnauthorized is returned when credentials don't identify a user.
+	ErrUnauthorized = errors.New("forum: unauthorized")
+	// ErrValidation matches every *ValidationError and *PasswordPolicyError.
+	ErrValidation = errors.New("forum: invalid input")
+)
+
+// ValidationError reports input that was rejected, with a message per field.
+type ValidationError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+// invalid returns a ValidationError for one field.
+func invalid(field, message string) *ValidationError {
+	return &ValidationError{Fields: map[string]string{field: message}}
+}
+
+// Add records a problem with field and returns e.
+func (e *ValidationError) Add(field, message string) *ValidationError {
+	if e.Fields == nil {
+		e.Fields = map[string]string{}
+	}
+	e.Fields[field] = message
+	return e
+}
+
+// OrNil returns e if it holds any problems, or nil, so a built-up error can
+// be returned as an error without becoming a non-nil interface by accident.
+func (e *ValidationError) OrNil() error {
+	if e == nil || len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for f := range e.Fields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f + ": " + e.Fields[f]
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// errorStatus maps an error to the HTTP status it should be answered with.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict), errors.Is(err, ErrLegalHold):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case readOnlyError(err):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError answers with the status errorStatus gives err. what names the
+// thing being worked on, e.g. "topic", for the messages. Validation errors
+// are written as JSON listing the fields; unexpected errors are logged and
+// not shown to the client.
+func writeError(w http.ResponseWriter, err error, what string) {
+	var policyErr *PasswordPolicyError
+	var validationErr *ValidationError
+	switch status := errorStatus(err); {
+	case errors.As(err, &policyErr):
+		writePolicyError(w, policyErr)
+	case errors.As(err, &validationErr):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Error  string            `json:"error"`
+			Fields map[string]string `json:"fields"`
+		}{"Invalid " + what, validationErr.Fields})
+	case errors.Is(err, ErrConflict):
+		writeConflict(w, what)
+	case errors.Is(err, ErrLegalHold):
+		http.Error(w, "This "+what+" is under legal hold", status)
+	case status == http.StatusServiceUnavailable:
+		w.Header().Set("Retry-After", strconv.Itoa(int(readOnlyRecheck.Seconds())))
+		http.Error(w, readOnlyMessage, status)
+	case status == http.StatusInternalServerError:
+		log.Printf("Error with %s: %v", what, err)
+		http.Error(w, "Something went wrong with this "+what, status)
+	default:
+		http.Error(w, http.StatusText(status), status)
+	}
+}
@@ -0,0 +1,107 @@
+// forum/export.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TopicExport is the JSON form of /topics/{id}/export.
+type TopicExport struct {
+	Topic      Topic     `json:"topic"`
+	Posts      []Post    `json:"posts"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// exportTopic serves GET /topics/{id}/export?format=md|json, the whole thread
+// on one page. It shows exactly what the topic page shows: deleted topics are
+// not found and only visible posts are included.
+func (h *Handlers) exportTopic(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "md"
+	}
+	if format != "md" && format != "json" {
+		http.Error(w, `format must be "md" or "json"`, http.StatusBadRequest)
+		return
+	}
+	db := h.db.WithContext(r.Context())
+	topic, err := db.GetTopic(topicID)
+	if err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	posts, err := db.GetAllPostsByTopic(topicID)
+	if err != nil {
+		log.Printf("Error exporting topic %s: %v", topicID, err)
+		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
+		return
+	}
+	if posts == nil {
+		posts = []Post{}
+	}
+
+	export := TopicExport{Topic: *topic, Posts: posts, ExportedAt: time.Now().UTC()}
+	filename := "topic-" + topic.ID + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "json" {
+		writeJSON(w, export)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	fmt.Fprint(w, topicMarkdown(export))
+}
+
+// topicMarkdown renders an export as a Markdown document, one section per post.
+func topicMarkdown(e TopicExport) string {
+	const stamp = "Jan 02, 2006 at 15:04 UTC"
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", e.Topic.Title)
+	if len(e.Topic.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n\n", strings.Join(e.Topic.Tags, ", "))
+	}
+	fmt.Fprintf(&b, "Started %s. %d posts, exported %s.\n", e.Topic.CreatedAt.UTC().Format(stamp), len(e.Posts), e.ExportedAt.Format(stamp))
+	for _, p := range e.Posts {
+		fmt.Fprintf(&b, "\n---\n\n### #%d %s, %s", p.ID, p.Author, p.CreatedAt.UTC().Format(stamp))
+		if p.UpdatedAt != nil {
+			fmt.Fprintf(&b, " (edited %s)", p.UpdatedAt.UTC().Format(stamp))
+		}
+		b.WriteString("\n\n")
+		if p.ParentPostID != nil {
+			fmt.Fprintf(&b, "_In reply to #%d_\n\n", *p.ParentPostID)
+		}
+		b.WriteString(strings.TrimSpace(p.Body))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// --- Export Database Functions ---
+
+// GetAllPostsByTopic returns every visible post in a topic, oldest first.
+func (d *Database) GetAllPostsByTopic(topicID uuid.UUID) ([]Post, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT ` + postColumns + ` FROM posts
+              WHERE topic_id = $1 AND state = 'visible' AND ` + postNotDeleted("posts") + `
+              ORDER BY created_at ASC, id ASC`
+	rows, err := d.readQuery(ctx, query, topicID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *p)
+	}
+	return posts, rows.Err()
+}
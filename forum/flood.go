@@ -0,0 +1,123 @@
+// forum/flood.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// postInterval is the minimum time between posts for a member at the given trust level.
+func (h *Handlers) postInterval(trust int) time.Duration {
+	if trust >= TrustStaff {
+		return 0
+	}
+	return h.config.PostInterval >> uint(trust)
+}
+
+// topicsPerHour is how many topics a member at the given trust level may start per hour.
+// Zero means unlimited.
+func (h *Handlers) topicsPerHour(trust int) int {
+	if trust >= TrustStaff || h.config.TopicsPerHour <= 0 {
+		return 0
+	}
+	return h.config.TopicsPerHour * (trust + 1)
+}
+
+// slowDown writes a 429 telling the user when they may try again.
+func slowDown(w http.ResponseWriter, retry time.Duration, message string) {
+	secs := int(math.Ceil(retry.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, fmt.Sprintf("%s Please slow down and try again in %d seconds.", message, secs), http.StatusTooManyRequests)
+}
+
+// rejectPostFlood enforces the minimum interval between a user's posts and
+// reports whether the request was rejected.
+func (h *Handlers) rejectPostFlood(w http.ResponseWriter, r *http.Request, user *User) bool {
+	trust, err := h.db.TrustLevel(user)
+	if err != nil {
+		log.Printf("Error computing trust level: %v", err)
+	}
+	interval := h.postInterval(trust)
+	if interval <= 0 {
+		return false
+	}
+	last, err := h.db.LastPostTime(user.ID)
+	if err != nil {
+		log.Printf("Error checking last post time: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+	if last == nil {
+		return false
+	}
+	if wait := interval - time.Since(*last); wait > 0 {
+		log.Printf("Post flood control: user %s from %s", user.ID, clientIP(r))
+		slowDown(w, wait, "You're posting too quickly.")
+		return true
+	}
+	return false
+}
+
+// rejectTopicFlood enforces the hourly cap on new topics for a request
+// starting n of them and reports whether the request was rejected.
+func (h *Handlers) rejectTopicFlood(w http.ResponseWriter, r *http.Request, user *User, n int) bool {
+	trust, err := h.db.TrustLevel(user)
+	if err != nil {
+		log.Printf("Error computing trust level: %v", err)
+	}
+	limit := h.topicsPerHour(trust)
+	if limit == 0 {
+		return false
+	}
+	count, oldest, err := h.db.TopicsSince(user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		log.Printf("Error counting recent topics: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+	if count+n <= limit {
+		return false
+	}
+	log.Printf("Topic flood control: user %s from %s", user.ID, clientIP(r))
+	retry := time.Hour
+	if count > 0 {
+		retry = time.Until(oldest.Add(time.Hour))
+	}
+	slowDown(w, retry, fmt.Sprintf("You can start %d topics per hour.", limit))
+	return true
+}
+
+// --- Flood Control Database Functions ---
+
+// LastPostTime returns when the user last posted, or nil if they never have.
+func (d *Database) LastPostTime(authorID string) (*time.Time, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var last *time.Time
+	query := `SELECT MAX(created_at) FROM posts WHERE author_id = $1`
+	err := d.pool.QueryRow(ctx, query, authorID).Scan(&last)
+	return last, err
+}
+
+// TopicsSince counts the topics a user started after since, along with the oldest of them.
+func (d *Database) TopicsSince(authorID string, since time.Time) (int, time.Time, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var count int
+	var oldest *time.Time
+	query := `SELECT COUNT(*), MIN(created_at) FROM topics WHERE author_id = $1 AND created_at > $2`
+	if err := d.pool.QueryRow(ctx, query, authorID, since).Scan(&count, &oldest); err != nil {
+		return 0, time.Time{}, err
+	}
+	if oldest == nil {
+		return count, time.Time{}, nil
+	}
+	return count, *oldest, nil
+}
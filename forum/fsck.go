@@ -0,0 +1,194 @@
+// forum/fsck.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// fsckTimeout bounds a whole check run; the checks scan entire tables.
+const fsckTimeout = 10 * time.Minute
+
+// fsckSamples is how many offending row IDs a check reports.
+const fsckSamples = 10
+
+// FsckCheck is the outcome of one integrity check.
+type FsckCheck struct {
+	Name       string   `json:"name"`
+	Problem    string   `json:"problem"`
+	Found      int64    `json:"found"`
+	Samples    []string `json:"samples,omitempty"`
+	Repairable bool     `json:"repairable"`
+	Repaired   int64    `json:"repaired"`
+}
+
+// FsckReport is the response of /api/admin/fsck.
+type FsckReport struct {
+	Repair bool        `json:"repair"`
+	Checks []FsckCheck `json:"checks"`
+}
+
+// fsckCheck finds one kind of inconsistency. find selects the text ID of
+// every offending row; repair, when set, is a fix that loses nothing worth
+// keeping. Checks run in order, so repairs that change counts come before the
+// count check.
+type fsckCheck struct {
+	name    string
+	problem string
+	find    string
+	repair  string
+}
+
+// notificationElements lists a user's notifications, treating anything that
+// isn't an array as empty so jsonb_array_elements can't fail on it.
+const notificationElements = `jsonb_array_elements(CASE WHEN jsonb_typeof(notifications) = 'array' THEN notifications ELSE '[]'::jsonb END)`
+
+const malformedNotifications = `(jsonb_typeof(notifications) <> 'array'
+                  OR EXISTS (SELECT 1 FROM ` + notificationElements + ` e WHERE jsonb_typeof(e) <> 'object'))`
+
+var fsckChecks = []fsckCheck{
+	{
+		name:    "tokens_missing_user",
+		problem: "sessions belonging to users that no longer exist",
+		find:    `SELECT id::text FROM tokens t WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = t.user_id)`,
+		repair:  `DELETE FROM tokens t WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = t.user_id)`,
+	},
+	{
+		name:    "posts_missing_topic",
+		problem: "posts in topics that no longer exist",
+		find:    `SELECT id::text FROM posts p WHERE NOT EXISTS (SELECT 1 FROM topics t WHERE t.id = p.topic_id)`,
+		// Posts under legal hold are left for staff to deal with.
+		repair: `DELETE FROM posts p WHERE NOT EXISTS (SELECT 1 FROM topics t WHERE t.id = p.topic_id) AND NOT ` + postHeld("p"),
+	},
+	{
+		name:    "posts_missing_parent",
+		problem: "replies to posts that no longer exist",
+		find: `SELECT id::text FROM posts p
+               WHERE p.parent_post_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM posts pp WHERE pp.id = p.parent_post_id)`,
+		repair: `UPDATE posts p SET parent_post_id = NULL
+                 WHERE p.parent_post_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM posts pp WHERE pp.id = p.parent_post_id)`,
+	},
+	{
+		name:    "posts_missing_author",
+		problem: "posts whose author account no longer exists (reassign or purge them)",
+		find:    `SELECT id::text FROM posts p WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = p.author_id)`,
+	},
+	{
+		name:    "topics_missing_author",
+		problem: "topics whose author account no longer exists (reassign or delete them)",
+		find:    `SELECT id::text FROM topics t WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = t.author_id)`,
+	},
+	{
+		name:    "malformed_notifications",
+		problem: "users whose notifications are not a list of objects",
+		find:    `SELECT id::text FROM users WHERE ` + malformedNotifications,
+		// Keep the well-formed entries and drop the rest.
+		repair: `UPDATE users SET notifications = COALESCE(
+                     (SELECT jsonb_agg(e) FROM ` + notificationElements + ` e WHERE jsonb_typeof(e) = 'object'),
+                     '[]'::jsonb
+                 ), version = version + 1
+                 WHERE ` + malformedNotifications,
+	},
+	{
+		name:    "reply_count_drift",
+		problem: "topics whose reply_count doesn't match their visible posts",
+		find: `SELECT t.id::text FROM topics t
+               WHERE t.reply_count <> (SELECT COUNT(*) FROM posts p WHERE p.topic_id = t.id AND p.state = 'visible' AND p.deleted_at IS NULL)`,
+		repair: `UPDATE topics t SET reply_count = c.n
+                 FROM (
+                     SELECT t2.id, (SELECT COUNT(*) FROM posts p WHERE p.topic_id = t2.id AND p.state = 'visible' AND p.deleted_at IS NULL) AS n
+                     FROM topics t2
+                 ) c
+                 WHERE t.id = c.id AND t.reply_count <> c.n`,
+	},
+	{
+		name:    "last_post_drift",
+		problem: "topics whose last post doesn't match their newest visible post",
+		find:    `SELECT t.id::text FROM ` + lastPostDrift,
+		repair:  lastPostRefresh + `t.id IN (SELECT t.id FROM ` + lastPostDrift + `)`,
+	},
+}
+
+// lastPostDrift selects, as t, the topics whose last_post_at or
+// last_post_author disagree with their newest visible post.
+const lastPostDrift = `topics t LEFT JOIN LATERAL (
+                  SELECT p.created_at, p.author FROM posts p
+                  WHERE p.topic_id = t.id AND p.state = 'visible' AND p.deleted_at IS NULL
+                  ORDER BY p.created_at DESC, p.id DESC
+                  LIMIT 1
+              ) l ON true
+              WHERE t.last_post_at IS DISTINCT FROM l.created_at OR t.last_post_author <> COALESCE(l.author, '')`
+
+// fsckHandler serves /api/admin/fsck. GET only reports; POST also applies
+// the safe repairs and then validates any foreign keys the repairs unblocked.
+func (h *Handlers) fsckHandler(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	repair := r.Method == http.MethodPost
+	report, err := h.db.WithContext(r.Context()).WithTimeout(fsckTimeout).Fsck(repair)
+	if err != nil {
+		log.Printf("Error checking database: %v", err)
+		http.Error(w, "Failed to check database", http.StatusInternalServerError)
+		return
+	}
+	if repair {
+		details := map[string]string{}
+		for _, c := range report.Checks {
+			if c.Repaired > 0 {
+				details[c.Name] = strconv.FormatInt(c.Repaired, 10)
+			}
+		}
+		h.audit(staff, "db.repair", "database", "", details)
+	}
+	writeJSON(w, report)
+}
+
+// --- Fsck Database Functions ---
+
+// Fsck runs every check, applying the safe repairs when repair is set.
+func (d *Database) Fsck(repair bool) (*FsckReport, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	report := &FsckReport{Repair: repair}
+	for _, check := range fsckChecks {
+		res := FsckCheck{Name: check.name, Problem: check.problem, Repairable: check.repair != ""}
+		if err := d.pool.QueryRow(ctx, `SELECT COUNT(*) FROM (`+check.find+`) f`).Scan(&res.Found); err != nil {
+			return nil, fmt.Errorf("%s: %w", check.name, err)
+		}
+		if res.Found > 0 {
+			rows, err := d.pool.Query(ctx, check.find+fmt.Sprintf(` LIMIT %d`, fsckSamples))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", check.name, err)
+			}
+			for rows.Next() {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				res.Samples = append(res.Samples, id)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if repair && res.Found > 0 && res.Repairable {
+			tag, err := d.pool.Exec(ctx, check.repair)
+			if err != nil {
+				return nil, fmt.Errorf("repairing %s: %w", check.name, err)
+			}
+			res.Repaired = tag.RowsAffected()
+		}
+		report.Checks = append(report.Checks, res)
+	}
+	if repair {
+		d.counts.invalidate()
+		if err := d.enforceForeignKeys(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -9,12 +9,15 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 const PageSize = 50
@@ -34,33 +37,139 @@ type PaginationData struct {
 	PrevPage    int
 	HasNext     bool
 	HasPrev     bool
+	// Pages are the page numbers linked around the current one. ShowFirst
+	// and ShowLast say whether the first and last pages fall outside them
+	// and need links of their own.
+	Pages     []int
+	ShowFirst bool
+	ShowLast  bool
+	// Link is the listing's URL minus the page parameter; see pageLink.
+	Link string
 }
 
 // TopicsViewData is the data structure for the topics list page.
 type TopicsViewData struct {
-	Topics      []Topic
+	Topics      []TopicView
 	Pagination  PaginationData
 	SearchQuery string
-	User        *User
+	// FilterTags is the tag filter as typed, comma-separated.
+	FilterTags     string
+	MatchAny       bool
+	User           *Viewer
+	ShowWhosOnline bool
+	OnlineUsers    []ProfileView
+	// Sort is the chosen sort, kept by the search form, and Sorts offers
+	// the others.
+	Sort  string
+	Sorts []SortLink
+}
+
+// SortLink is one of the ways a list can be sorted.
+type SortLink struct {
+	Label   string
+	Link    string
+	Current bool
 }
 
 // TopicViewData is the data structure for the single topic page.
 type TopicViewData struct {
-	Topic      Topic
-	Posts      []Post
-	Pagination PaginationData
-	User       *User
+	Topic         TopicView
+	Timeline      []TimelineEntry
+	Pagination    PaginationData
+	User          *Viewer
+	ReportReasons []string
+	CanSummarize  bool
+	// ReminderOptions fill the "Remind me" menu for signed-in members.
+	ReminderOptions []ReminderOption
+	// Query is set when the page lists only the posts matching it.
+	Query string
+	// Sort and Author are the chosen PostFilter, and Sorts offers the
+	// other orders.
+	Sort   string
+	Author string
+	Sorts  []SortLink
+	// Watching says whether the signed-in member is subscribed to the topic.
+	Watching bool
+	// Bookmarked says whether they bookmarked the topic.
+	Bookmarked bool
+	// Solution is the accepted answer, shown above the posts.
+	Solution *PostView
+	// CanManage offers the forms to edit or delete the topic.
+	CanManage bool
+	// Threaded shows Threads, the whole topic as reply trees, in place of
+	// the paged Timeline. CanThread offers the choice.
+	Threaded  bool
+	CanThread bool
+	Threads   []ThreadView
+	// GuestPosting offers visitors who aren't signed in the reply form,
+	// with Captcha if one is configured.
+	GuestPosting bool
+	Captcha      *CaptchaWidget
+	// TitleMaxLength and BodyMaxLength let the forms stop at the server's
+	// limits; zero means none.
+	TitleMaxLength int
+	BodyMaxLength  int
+	// Form is a submission of one of the page's forms that was turned away.
+	Form *TopicForm
+}
+
+// TopicForm is a rejected submission of the topic page's post form, or of its
+// edit-topic form when EditTopic is set, shown again with Error so nothing
+// typed is lost.
+type TopicForm struct {
+	Error     string
+	EditTopic bool
+	Title     string
+	Tags      string
+	// Action is where the post form was sent, which Heading describes: a new
+	// post, a reply to ParentPostID, or an edit of the post at Version.
+	Action       string
+	Heading      string
+	ParentPostID string
+	Version      string
+	GuestName    string
+	Body         string
+}
+
+// PostFragment is the data for the shared "post" template, used both when a
+// topic page is rendered and when a new post is pushed to live viewers.
+type PostFragment struct {
+	Post          PostView
+	CanReply      bool
+	CanEdit       bool
+	CanToggleWiki bool
+	CanSeeHistory bool
+	CanFlag       bool
+	CanDelete     bool
+	CanBookmark   bool
+	// Solution marks the topic's accepted answer; CanSolve offers to mark or
+	// unmark it.
+	Solution bool
+	CanSolve bool
+	// CanRestore is set for admins looking at a deleted post.
+	CanRestore bool
+	// Previews are cards for the pages the post links to.
+	Previews []LinkPreview
 }
 
 // LoginViewData is used for the login page, to display potential errors.
 type LoginViewData struct {
 	Error string
+	// SSO names the single sign-on provider, if one is configured.
+	SSO string
+	// MagicLinks offers a sign-in link by email, and Notice says one was
+	// asked for.
+	MagicLinks bool
+	Notice     string
+	// Captcha is set when the forms need a CAPTCHA solved.
+	Captcha *CaptchaWidget
 }
 
 // NotificationsViewData is for the notifications page.
 type NotificationsViewData struct {
-	User          *User
+	User          *Viewer
 	Notifications []Notification
+	Reminders     []ReminderView
 }
 
 type Handlers struct {
@@ -68,89 +177,228 @@ type Handlers struct {
 	Session   *scs.SessionManager `json:"-"`
 	db        *Database
 	templates *template.Template
+	mail      *MailTemplates
+	// oidc is nil unless single sign-on is configured.
+	oidc     *oidcClient
+	webauthn *webauthn.WebAuthn
+	// captcha is nil unless a CAPTCHA is configured.
+	captcha  *captcha
+	config   Config
+	presence *presenceTracker
+	// credentialUse throttles last-used writes for sessions and API keys.
+	credentialUse *presenceTracker
+	// viewCounts counts each viewer once a visit; see countTopicView.
+	viewCounts *presenceTracker
+	// guestPosts limits replies from guests; nil means no limit.
+	guestPosts *rateLimiter
+	live       *topicHub
+	hookCh     chan WebhookEvent
+	// previewCh queues URLs for the link previewer; see linkpreviews.go.
+	previewCh chan string
 }
 
-func NewHandlers(db *Database) (*Handlers, error) {
+func NewHandlers(db *Database, cfg Config) (*Handlers, error) {
 	ntfCh := make(chan Notification, 100)
-	tpl, err := template.ParseGlob("templates/*.html")
+	mail, err := LoadMailTemplates(cfg.MailTemplates)
 	if err != nil {
 		return nil, err
 	}
 
 	sessionMgr := scs.New()
-	sessionMgr.Lifetime = 24 * time.Hour
-	sessionMgr.IdleTimeout = 1 * time.Hour
-	sessionMgr.Cookie.Persist = true
+	sessionMgr.Store = sessionStore{db: db}
+	// The cookie outlives the browser only for logins that are remembered;
+	// see signIn. Idle sessions are ended by sessionIdle instead of
+	// IdleTimeout, which can't tell remembered sessions apart.
+	sessionMgr.Lifetime = max(cfg.SessionTTL, cfg.RememberMeTTL)
+	sessionMgr.Cookie.Persist = false
 	sessionMgr.Cookie.Name = "token"
 	sessionMgr.Cookie.SameSite = http.SameSiteLaxMode
-	sessionMgr.Cookie.Secure = true
+	sessionMgr.Cookie.Secure = cfg.SecureCookies
 	sessionMgr.Cookie.HttpOnly = true
 	hndlr := &Handlers{
-		NotifCh:   ntfCh,
-		Session:   sessionMgr,
-		db:        db,
-		templates: tpl,
+		NotifCh:       ntfCh,
+		Session:       sessionMgr,
+		db:            db,
+		mail:          mail,
+		config:        cfg,
+		presence:      newPresenceTracker(cfg.PresenceWriteInterval, cfg.OnlineWindow),
+		credentialUse: newPresenceTracker(cfg.PresenceWriteInterval, 0),
+		viewCounts:    newPresenceTracker(cfg.VisitGap, 0),
+		live:          newTopicHub(),
+		hookCh:        make(chan WebhookEvent, 256),
+		previewCh:     make(chan string, 256),
+	}
+	if cfg.OIDC.Enabled() {
+		hndlr.oidc = newOIDCClient(cfg)
+	}
+	if cfg.GuestPostRateLimit > 0 {
+		hndlr.guestPosts = newRateLimiter(cfg.GuestPostRateLimit)
+	}
+	hndlr.webauthn, err = newWebAuthn(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hndlr.captcha, err = newCaptcha(cfg.Captcha)
+	if err != nil {
+		return nil, err
+	}
+	// Every page can show the read-only banner, so templates ask for the
+	// mode themselves rather than each view carrying it. Post bodies are
+	// rendered the same way, in the configured format.
+	hndlr.templates, err = template.New("").Funcs(template.FuncMap{
+		"readOnly": hndlr.readOnly,
+		"postBody": hndlr.postBody,
+	}).ParseGlob(cfg.Templates)
+	if err != nil {
+		return nil, err
 	}
 	return hndlr, nil
 }
 
 func (h *Handlers) RegisterRoutes(mux *http.ServeMux) {
-	// API routes
-	mux.HandleFunc("/api/user/create", h.addUserHandler)
-	mux.HandleFunc("/api/notifications/delete", h.deleteNotificationHandler) // New route
+	// Every route belongs to one of these groups, which say who may use it.
+	// Handlers can rely on the group: behind requireLogin or requireAPIUser
+	// the user in the context is never nil.
+	public := routeGroup{h: h, mux: mux, mws: []Middleware{h.logRequests, sameOrigin, h.refuseWritesWhenReadOnly}}
+	visitors := public.with(h.ValidateSessionToken, h.trafficLimit())
+	members := visitors.with(requireLogin)
+	staff := members.with(requireAdmin)
+	api := visitors.with(h.rateLimit(h.config.APIRateLimit))
+	apiMembers := api.with(requireAPIUser)
+	apiStaff := apiMembers.with(requireAdmin)
+
+	// API routes, served under each /api/vN; see apiversion.go. Routes that
+	// predate versioning are also kept at their old /api paths.
+	api.api("/user/create", h.addUserHandler, true)
+	apiMembers.api("/notifications/delete", h.deleteNotificationHandler, true)
+	apiStaff.api("/stats/moderation", h.moderationStatsHandler, true)
+	apiStaff.api("/stats/db", h.dbStatsHandler, true)
+	apiMembers.api("/batch", h.batchHandler, false)
+	api.api("/search/suggest", h.suggestHandler, true)
+	api.api("/tags/complete", h.completeTags, false)
+	apiStaff.api("/admin/", h.handleAdminAPI, true)
+	// Incoming hooks are signed server-to-server calls, never a session.
+	public.with(h.rateLimit(h.config.APIRateLimit)).api("/hooks/", h.receiveHook, false)
+	mux.HandleFunc("/api/", apiNotFound)
 
 	// Auth routes
-	mux.HandleFunc("/login", h.handleLogin)
-	mux.HandleFunc("/logout", h.handleLogout)
-	mux.HandleFunc("/notifications", h.listNotificationsHandler) // New route
-
-	// Content routes with auth middleware
-	mux.Handle("/topics", h.ValidateSessionToken(http.HandlerFunc(h.handleTopics)))
-	mux.Handle("/topics/", h.ValidateSessionToken(http.HandlerFunc(h.showTopic)))
+	public.with(h.rateLimit(h.config.LoginRateLimit)).page("/login", h.handleLogin)
+	public.with(h.rateLimit(h.config.LoginRateLimit)).page("GET /login/oidc", h.startOIDCLogin)
+	public.with(h.rateLimit(h.config.LoginRateLimit)).page("GET /login/oidc/callback", h.finishOIDCLogin)
+	public.with(h.rateLimit(h.config.LoginRateLimit)).page("POST /login/passkey/begin", h.beginPasskeyLogin)
+	public.with(h.rateLimit(h.config.LoginRateLimit)).page("POST /login/passkey/finish", h.finishPasskeyLogin)
+	public.with(h.rateLimit(h.config.LoginRateLimit)).page("POST /login/link", h.requestLoginLink)
+	public.with(h.rateLimit(h.config.LoginRateLimit)).page("GET /login/link/{token}", h.showLoginLink)
+	public.with(h.rateLimit(h.config.LoginRateLimit)).page("POST /login/link/{token}", h.useLoginLink)
+	visitors.page("/logout", h.handleLogout)
+	members.page("POST /logout/all", h.revokeAllSessions)
+	members.page("/notifications", h.listNotificationsHandler)
+	members.page("/settings", h.handleSettings)
+	members.page("/settings/password", h.changePassword)
+	members.page("POST /settings/passkeys/begin", h.beginPasskeyRegistration)
+	members.page("POST /settings/passkeys/finish", h.finishPasskeyRegistration)
+	members.page("POST /settings/passkeys/{id}/delete", h.deletePasskey)
+	members.page("POST /settings/api-key", h.regenerateAPIKey)
+	members.page("POST /settings/avatar", h.uploadAvatar)
+	members.page("POST /settings/avatar/delete", h.deleteAvatar)
+	members.page("GET /settings/sessions", h.showSessions)
+	members.page("POST /settings/sessions/{id}/revoke", h.revokeSession)
+	members.page("POST /settings/sessions/revoke-all", h.revokeAllSessions)
+	members.page("/suspended", h.handleSuspended)
+	members.page("/invites", h.handleInvites)
+
+	// Content routes, which decide for themselves what visitors may see.
+	// The mux answers 405 when a path matches but the method doesn't.
+	visitors.page("GET /topics", h.listTopics)
+	members.page("GET /topics/new", h.showNewTopics)
+	visitors.page("POST /topics", h.createTopic)
+	visitors.page("GET /topics/{id}", topicRoute(h.showTopic))
+	visitors.page("POST /topics/{id}/posts", topicRoute(h.createPost))
+	members.page("POST /topics/{id}/edit", topicRoute(h.editTopic))
+	members.page("POST /topics/{id}/delete", topicRoute(h.deleteTopic))
+	members.page("GET /topics/{id}/unread", topicRoute(h.showFirstUnread))
+	visitors.page("GET /topics/{id}/events", topicRoute(h.streamTopicEvents))
+	visitors.page("GET /topics/{id}/summary", topicRoute(h.showSummary))
+	visitors.page("GET /topics/{id}/export", topicRoute(h.exportTopic))
+	visitors.page("POST /topics/{id}/typing", topicRoute(h.postTyping))
+	members.page("POST /topics/{id}/remind", topicRoute(h.remindTopic))
+	members.page("POST /topics/{id}/watch", topicRoute(h.watchTopic(true)))
+	members.page("POST /topics/{id}/unwatch", topicRoute(h.watchTopic(false)))
+	members.page("POST /topics/{id}/bookmark", topicRoute(h.bookmarkTopic))
+	members.page("GET /bookmarks", h.showBookmarks)
+	members.page("POST /bookmarks/{id}/remind", h.remindBookmark)
+	members.page("POST /bookmarks/{id}/delete", h.deleteBookmark)
+	members.page("POST /reminders/{id}/delete", h.cancelReminder)
+	members.page("POST "+impersonationStopPath, h.stopImpersonation)
+	visitors.page("GET /users/{handle}", h.showProfile)
+	visitors.page("GET /users/{handle}/activity", h.showActivity)
+	members.page("GET /activity", h.showOwnActivity)
+	visitors.page("GET /search", h.showSearch)
+	// A topic page loads an avatar per post, so avatars get a limiter of
+	// their own rather than counting against the reader's page views.
+	public.with(h.rateLimit(h.config.MemberRateLimit)).page("GET /avatar/{userID}", h.serveAvatar)
+	visitors.page("GET /tags", h.listTagPages)
+	visitors.page("GET /tags/{name}", h.showTagPage)
+	members.page("POST /tags/{name}/follow", h.followTag(true))
+	members.page("POST /tags/{name}/unfollow", h.followTag(false))
+	visitors.page("POST /posts/{id}/edit", postRoute(h.editPost))
+	visitors.page("GET /posts/{id}", postRoute(h.showPost))
+	visitors.page("GET /posts/{id}/revisions", postRoute(h.showRevisions))
+	visitors.page("POST /posts/{id}/flag", postRoute(h.flagPost))
+	visitors.page("POST /posts/{id}/wiki", postRoute(h.setPostWiki))
+	members.page("POST /posts/{id}/bookmark", postRoute(h.bookmarkPost))
+	members.page("POST /posts/{id}/solution", postRoute(h.setSolution))
+	members.page("POST /posts/{id}/delete", postRoute(h.deletePost))
+	visitors.page("POST /preview", h.previewPost)
+	staff.page("POST /posts/{id}/restore", postRoute(h.restorePost))
+
+	// Staff routes
+	staff.page("/admin/", h.handleAdmin)
 }
 
 // listNotificationsHandler displays the user's notifications.
 func (h *Handlers) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
-	tkn, err := h.GetTokenFromSession(r)
-
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-
-	tk, err := h.db.GetTokenByValue(tkn)
-	if err != nil || tk.ExpiresAt.Before(time.Now()) {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-	user, err := h.db.GetUserByEmail(tk.Email)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
+	user, _ := r.Context().Value(userContextKey).(*User)
 
-	// Mark notifications as read when the page is viewed.
-	var changed bool
-	for i := range user.Notifications {
-		if user.Notifications[i].ReadAt.IsZero() {
-			user.Notifications[i].ReadAt = time.Now()
-			changed = true
+	// Mark notifications as read when the page is viewed, unless an admin
+	// is viewing it for them.
+	for _, n := range user.Notifications {
+		if user.impersonator != nil {
+			break
 		}
-	}
-
-	if changed {
-		if err := h.db.SaveUser(user); err != nil {
+		if !n.ReadAt.IsZero() {
+			continue
+		}
+		updated, err := h.db.ModifyUser(user.ID, func(u *User) error {
+			for i := range u.Notifications {
+				if u.Notifications[i].ReadAt.IsZero() {
+					u.Notifications[i].ReadAt = time.Now()
+				}
+			}
+			return nil
+		})
+		if err != nil {
 			log.Printf("Error marking notifications as read: %v", err)
 			// Non-critical error, so we still render the page.
+		} else {
+			user = updated
 		}
+		break
+	}
+
+	reminders, err := h.db.WithContext(r.Context()).ListReminders(user.ID)
+	if err != nil {
+		log.Printf("Error listing reminders: %v", err)
+		http.Error(w, "Failed to retrieve reminders", http.StatusInternalServerError)
+		return
 	}
 
 	data := NotificationsViewData{
-		User:          user,
+		User:          NewViewer(user),
 		Notifications: user.Notifications,
+		Reminders:     NewReminderViews(reminders),
 	}
-	err = h.templates.ExecuteTemplate(w, "notifications.html", data)
-	if err != nil {
+	if err := h.templates.ExecuteTemplate(w, "notifications.html", data); err != nil {
 		log.Printf("Error executing notifications template: %v", err)
 	}
 }
@@ -162,27 +410,10 @@ func (h *Handlers) deleteNotificationHandler(w http.ResponseWriter, r *http.Requ
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	tkn, err := h.GetTokenFromSession(r)
-
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-
-	tk, err := h.db.GetTokenByValue(tkn)
-	if err != nil || tk.ExpiresAt.Before(time.Now()) {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-	user, err := h.db.GetUserByEmail(tk.Email)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
+	user, _ := r.Context().Value(userContextKey).(*User)
 
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		badRequestBody(w, err, "Failed to parse form")
 		return
 	}
 	notificationID := r.FormValue("id")
@@ -192,13 +423,23 @@ func (h *Handlers) deleteNotificationHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	var found bool
-	var updatedNotifications []Notification
-	for _, n := range user.Notifications {
-		if n.ID == notificationID {
-			found = true
-		} else {
-			updatedNotifications = append(updatedNotifications, n)
+	_, err := h.db.ModifyUser(user.ID, func(u *User) error {
+		found = false
+		var updatedNotifications []Notification
+		for _, n := range u.Notifications {
+			if n.ID == notificationID {
+				found = true
+			} else {
+				updatedNotifications = append(updatedNotifications, n)
+			}
 		}
+		u.Notifications = updatedNotifications
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error deleting notification: %v", err)
+		http.Error(w, "Failed to delete notification", http.StatusInternalServerError)
+		return
 	}
 
 	if !found {
@@ -206,13 +447,6 @@ func (h *Handlers) deleteNotificationHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	user.Notifications = updatedNotifications
-	if err := h.db.SaveUser(user); err != nil {
-		log.Printf("Error deleting notification: %v", err)
-		http.Error(w, "Failed to delete notification", http.StatusInternalServerError)
-		return
-	}
-
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -224,58 +458,141 @@ func (h *Handlers) addUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		Handle   string `json:"handle"`
-		Admin    bool   `json:"admin"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		Handle     string `json:"handle"`
+		Admin      bool   `json:"admin"`
+		InviteCode string `json:"invite_code"`
+		// Captcha is the CAPTCHA widget's answer, needed when one is
+		// configured unless an admin is creating the account.
+		Captcha string `json:"captcha"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		badRequestBody(w, err, "Invalid request body")
 		return
 	}
+	// Admins may create admin accounts and skip the CAPTCHA and approval;
+	// anyone else signing up may not ask for admin rights.
+	caller, _ := r.Context().Value(userContextKey).(*User)
+	byAdmin := caller != nil && caller.Admin
+	if req.Admin && !byAdmin {
+		http.Error(w, "Only admins can create admin accounts", http.StatusForbidden)
+		return
+	}
+	if h.captcha != nil && !byAdmin {
+		if msg := h.captchaRefusal(r, req.Captcha); msg != "" {
+			http.Error(w, msg, http.StatusForbidden)
+			return
+		}
+	}
 
-	if req.Email == "" || req.Password == "" || req.Handle == "" {
-		http.Error(w, "Email, password, and handle are required fields", http.StatusBadRequest)
+	missing := &ValidationError{}
+	if req.Email == "" {
+		missing.Add("email", "required")
+	}
+	if req.Password == "" {
+		missing.Add("password", "required")
+	}
+	if req.Handle == "" {
+		missing.Add("handle", "required")
+	}
+	if err := missing.OrNil(); err != nil {
+		writeError(w, err, "user")
 		return
 	}
 
-	existingUser, _ := h.db.GetUserByEmail(req.Email)
-	if existingUser != nil {
+	_, err := h.db.GetUserByEmailIncludeDeleted(req.Email)
+	if err == nil {
 		http.Error(w, "User with this email already exists", http.StatusConflict)
 		return
 	}
+	if !errors.Is(err, ErrNotFound) {
+		writeError(w, err, "user")
+		return
+	}
 
-	user, err := NewUser(req.Email, req.Admin)
+	user, err := NewUser(req.Email, req.Admin && byAdmin)
 	if err != nil {
 		log.Printf("Error creating new user: %v", err)
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
 	user.Handle = req.Handle
+	if h.config.ApproveSignups && !byAdmin {
+		user.Pending = true
+	}
 
-	if err := user.SetPassword(req.Password); err != nil {
+	if err := user.SetPassword(req.Password, h.config.Password); err != nil {
+		var policyErr *PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			writePolicyError(w, policyErr)
+			return
+		}
 		log.Printf("Error setting password: %v", err)
 		http.Error(w, "Failed to set password", http.StatusInternalServerError)
 		return
 	}
+	if h.passwordBreached(r.Context(), req.Password) {
+		if h.config.BreachCheck == BreachCheckReject {
+			writePolicyError(w, &PasswordPolicyError{Violations: []PasswordViolation{breachedViolation}})
+			return
+		}
+		w.Header().Set("Warning", `299 - "`+breachedViolation.Message+`"`)
+	}
+
+	var invite *Invite
+	if h.config.InviteOnly {
+		if req.InviteCode == "" {
+			http.Error(w, "An invite code is required to register", http.StatusForbidden)
+			return
+		}
+		invite, err = h.db.ClaimInvite(req.InviteCode)
+		if errors.Is(err, errInviteInvalid) {
+			http.Error(w, "That invite code is invalid, used up, or expired", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			log.Printf("Error claiming invite: %v", err)
+			http.Error(w, "Failed to check invite code", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	if err := h.db.SaveUser(user); err != nil {
+		if invite != nil {
+			if err := h.db.ReleaseInvite(invite.Code); err != nil {
+				log.Printf("Error releasing invite: %v", err)
+			}
+		}
+		if errors.Is(err, ErrConflict) {
+			http.Error(w, "User with this email already exists", http.StatusConflict)
+			return
+		}
 		log.Printf("Error saving user: %v", err)
 		http.Error(w, "Failed to save user", http.StatusInternalServerError)
 		return
 	}
-
-	user.Sanitize()
+	if invite != nil {
+		if err := h.db.RecordInviteRedemption(invite.Code, user.ID); err != nil {
+			log.Printf("Error recording invite redemption: %v", err)
+		}
+	}
+	if user.Pending {
+		item := QueueItem{Kind: QueueSignup, UserID: user.ID, SubjectType: "user", SubjectID: user.ID, Body: user.Handle + " <" + user.Email + ">"}
+		if err := h.db.CreateQueueItem(&item); err != nil {
+			log.Printf("Error queueing signup: %v", err)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(NewAccountResponse(user))
 }
 
 // ValidateSessionToken checks for a valid session and adds the user to the request context.
-func (h *Handlers) ValidateSessionToken(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) ValidateSessionToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := h.GetTokenFromSession(r)
 		if err != nil {
 			// No session token, check for API key
@@ -286,33 +603,95 @@ func (h *Handlers) ValidateSessionToken(next http.HandlerFunc) http.HandlerFunc
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
-			user, err := h.db.GetUserByEmail(parts[0])
-			if err != nil || user == nil || user.Key != parts[1] {
-				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			user, err := h.db.GetUserByAPIKey(parts[0], parts[1])
+			if err != nil {
+				if errors.Is(err, ErrUnauthorized) {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				} else {
+					writeError(w, err, "API key")
+				}
+				return
+			}
+			if user.Banned() {
+				http.Error(w, banMessage(user), http.StatusForbidden)
 				return
 			}
+			if user.Pending {
+				http.Error(w, pendingMessage, http.StatusForbidden)
+				return
+			}
+			h.touchPresence(user)
+			h.touchAPIKey(r, user)
 			ctx := context.WithValue(r.Context(), userContextKey, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		tk, err := h.db.GetTokenByValue(token)
-		if err != nil || tk.ExpiresAt.Before(time.Now()) {
-			fmt.Println("Invalid session token:", token, err, tk)
-			// If session is invalid, clear it and proceed without a user.
+		tk, err := h.db.LookupSession(token)
+		if err != nil && errorStatus(err) == http.StatusInternalServerError {
+			log.Printf("Error looking up session: %v", err)
+			http.Error(w, "Could not check your session", http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			// The session is malformed, unknown or expired: clear it and
+			// proceed without a user.
 			h.Session.Remove(r.Context(), "token")
 			ctx := context.WithValue(r.Context(), userContextKey, (*User)(nil))
 			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
-		user, err := h.db.GetUserByEmail(tk.Email) // Assumes GetUserByEmail exists
+		if h.sessionIdle(r) {
+			h.Session.Remove(r.Context(), "token")
+			ctx := context.WithValue(r.Context(), userContextKey, (*User)(nil))
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		user, err := h.db.GetUserByID(tk.UserID)
+		if errors.Is(err, ErrNotFound) {
+			// The account was deleted after the session was issued.
+			h.Session.Remove(r.Context(), "token")
+			ctx := context.WithValue(r.Context(), userContextKey, (*User)(nil))
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		if err != nil {
+			http.Error(w, "Could not find user for session", http.StatusInternalServerError)
+			return
+		}
+		if user.Pending {
+			h.Session.Remove(r.Context(), "token")
+			http.Error(w, pendingMessage, http.StatusForbidden)
+			return
+		}
+		if user.Banned() {
+			// Banning deletes the user's sessions; this catches any that
+			// were created since.
+			h.Session.Remove(r.Context(), "token")
+			if _, err := h.db.DeleteTokensForUser(user.ID); err != nil {
+				log.Printf("Error revoking sessions: %v", err)
+			}
+			http.Error(w, banMessage(user), http.StatusForbidden)
+			return
+		}
+		h.touchPresence(user)
+		h.touchSession(tk)
+		target, err := h.impersonating(r, user)
 		if err != nil {
+			log.Printf("Error loading impersonated user: %v", err)
 			http.Error(w, "Could not find user for session", http.StatusInternalServerError)
 			return
 		}
+		if target != nil {
+			if !impersonationAllows(r) {
+				http.Error(w, "You are viewing the forum as "+target.Handle+"; stop viewing as them to make changes", http.StatusForbidden)
+				return
+			}
+			user = target
+		}
 		ctx := context.WithValue(r.Context(), userContextKey, user)
-		next(w, r.WithContext(ctx))
-	}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 func (h *Handlers) GetTokenFromSession(r *http.Request) (string, error) {
@@ -323,7 +702,12 @@ func (h *Handlers) GetTokenFromSession(r *http.Request) (string, error) {
 	return tk, nil
 }
 
+// AddTokenToSession signs the session in with tk. The session gets a new ID
+// first, so one planted before sign-in (session fixation) isn't signed in.
 func (h *Handlers) AddTokenToSession(r *http.Request, w http.ResponseWriter, tk *Token) error {
+	if err := h.Session.RenewToken(r.Context()); err != nil {
+		return fmt.Errorf("renewing session: %w", err)
+	}
 	h.Session.Put(r.Context(), "token", tk.Token)
 	return nil
 }
@@ -344,99 +728,183 @@ func (h *Handlers) handleLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) showLoginPage(w http.ResponseWriter, r *http.Request, errorMsg string) {
-	h.templates.ExecuteTemplate(w, "login.html", LoginViewData{Error: errorMsg})
+	h.renderLogin(w, LoginViewData{Error: errorMsg})
+}
+
+// renderLogin shows the login page with the sign-in options configured.
+func (h *Handlers) renderLogin(w http.ResponseWriter, data LoginViewData) {
+	if h.oidc != nil {
+		data.SSO = h.oidc.cfg.Name
+	}
+	data.MagicLinks = h.config.MagicLinks
+	data.Captcha = h.captcha.widget()
+	h.templates.ExecuteTemplate(w, "login.html", data)
 }
 
 func (h *Handlers) processLogin(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		badRequestBody(w, err, "Failed to parse form")
 		return
 	}
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 
-	user, err := h.db.GetUserByEmail(email)
+	if msg := h.checkCaptcha(r); msg != "" {
+		h.showLoginPage(w, r, msg)
+		return
+	}
+	wait, err := h.loginLockedFor(r, email)
 	if err != nil {
-		log.Printf("Error getting user by email: %v", err)
+		log.Printf("Error checking login lockout: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		h.authEvent(r, nil, AuthLoginFailed, email, map[string]string{"reason": "locked"})
+		h.refuseLockedLogin(w, wait)
+		return
+	}
+
+	user, err := h.db.GetUserByEmail(email)
+	if errors.Is(err, ErrNotFound) {
+		log.Printf("Failed login for unknown email from %s", clientIP(r))
+		h.recordLoginFailure(r, email)
+		h.authEvent(r, nil, AuthLoginFailed, email, map[string]string{"reason": "unknown email"})
 		h.showLoginPage(w, r, "Invalid email or password.")
 		return
 	}
-	if user == nil {
+	if err != nil {
+		log.Printf("Error getting user by email: %v", err)
 		h.showLoginPage(w, r, "Invalid email or password.")
 		return
 	}
 
-	ok, err := user.PasswordMatches(password)
+	ok, err := user.PasswordMatches(password, h.config.Password)
 	if err != nil {
 		log.Printf("Error matching password: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	if !ok {
+		log.Printf("Failed login for user %s from %s", user.ID, clientIP(r))
+		h.recordLoginFailure(r, email)
+		h.authEvent(r, user, AuthLoginFailed, "", map[string]string{"reason": "wrong password"})
 		h.showLoginPage(w, r, "Invalid email or password.")
 		return
 	}
+	h.clearLoginFailures(r, email)
+	if h.config.Password.NeedsRehash(user.Password) {
+		// Hash directly rather than via SetPassword so passwords that predate
+		// the current policy keep working.
+		hash, err := h.config.Password.Hash(password)
+		if err != nil {
+			log.Printf("Error re-hashing password: %v", err)
+		} else {
+			user.Password = hash
+			if err := h.db.SaveUser(user); err != nil {
+				log.Printf("Error saving re-hashed password: %v", err)
+			}
+		}
+	}
 
-	tk, err := user.SessionToken.CreateToken(user.ID, 24*time.Hour)
-	if err != nil {
-		log.Printf("Error creating session token: %v", err)
+	if err := h.signIn(r, user, r.FormValue("remember") != "", "password"); err != nil {
+		var refusal loginRefusal
+		if errors.As(err, &refusal) {
+			h.showLoginPage(w, r, string(refusal))
+			return
+		}
+		log.Printf("Error starting session: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	tk.Email = user.Email
-	if err := h.db.SaveToken(tk); err != nil {
-		log.Printf("Error saving session token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+
+	if user.PasswordResetRequired {
+		http.Redirect(w, r, "/settings#password", http.StatusSeeOther)
 		return
 	}
-	err = h.AddTokenToSession(r, w, tk)
-	if err != nil {
-		log.Printf("Error adding token to session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	http.Redirect(w, r, "/topics", http.StatusSeeOther)
+}
+
+// loginRefusal is why an account that proved who it is may still not sign
+// in, fit to show.
+type loginRefusal string
+
+func (e loginRefusal) Error() string { return string(e) }
+
+// signIn starts a session for user, who proved who they are by method, and
+// records the login. Banned and pending accounts are refused with a
+// loginRefusal, whatever the method.
+func (h *Handlers) signIn(r *http.Request, user *User, remember bool, method string) error {
+	if user.Banned() {
+		log.Printf("Refused login for banned user %s from %s", user.ID, clientIP(r))
+		h.authEvent(r, user, AuthLoginFailed, "", map[string]string{"method": method, "reason": "banned"})
+		return loginRefusal(banMessage(user))
+	}
+	if user.Pending {
+		h.authEvent(r, user, AuthLoginFailed, "", map[string]string{"method": method, "reason": "pending"})
+		return loginRefusal(pendingMessage)
+	}
+	if err := h.startSession(r, user, remember); err != nil {
+		return err
 	}
+	h.authEvent(r, user, AuthLogin, "", map[string]string{"method": method})
+	return nil
+}
 
-	http.Redirect(w, r, "/topics", http.StatusSeeOther)
+// startSession starts a session for user. A remembered session lasts
+// RememberMeTTL and survives the browser closing.
+func (h *Handlers) startSession(r *http.Request, user *User, remember bool) error {
+	ttl := h.config.SessionTTL
+	if remember {
+		ttl = h.config.RememberMeTTL
+	}
+	tk, err := user.SessionToken.CreateToken(user.ID, ttl)
+	if err != nil {
+		return fmt.Errorf("creating session token: %w", err)
+	}
+	tk.Email = user.Email
+	tk.IP = clientIP(r)
+	tk.UserAgent = truncate(r.UserAgent(), maxUserAgent)
+	if err := h.db.SaveToken(tk); err != nil {
+		return fmt.Errorf("saving session token: %w", err)
+	}
+	// A new session ID, so one planted before sign-in isn't signed in.
+	if err := h.Session.RenewToken(r.Context()); err != nil {
+		return fmt.Errorf("renewing session: %w", err)
+	}
+	h.Session.Put(r.Context(), "token", tk.Token)
+	h.Session.Put(r.Context(), "remember", remember)
+	h.Session.Put(r.Context(), "seen", time.Now().Unix())
+	h.Session.RememberMe(r.Context(), remember)
+	return nil
 }
 
 func (h *Handlers) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if user, _ := r.Context().Value(userContextKey).(*User); user != nil && user.impersonator != nil {
+		h.endImpersonation(r, user)
+	} else if user != nil {
+		h.authEvent(r, user, AuthLogout, "", nil)
+	}
 	h.Session.Remove(r.Context(), "token")
 	http.Redirect(w, r, "/topics", http.StatusSeeOther)
 }
 
-func (h *Handlers) handleTopics(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		h.listTopics(w, r)
-	case http.MethodPost:
-		h.createTopic(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
-}
-
 func (h *Handlers) listTopics(w http.ResponseWriter, r *http.Request) {
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 	if page < 1 {
 		page = 1
 	}
 	searchQuery := r.URL.Query().Get("q")
+	filter := TopicFilter{
+		Query:    searchQuery,
+		Tags:     normalizeTags(strings.Split(r.URL.Query().Get("tags"), ",")),
+		MatchAll: r.URL.Query().Get("match") != "any",
+		Sort:     r.URL.Query().Get("sort"),
+	}
+	if _, ok := topicSorts[filter.Sort]; !ok {
+		filter.Sort = ""
+	}
 
-	// token, err := h.GetTokenFromSession(r)
-	// if err != nil {
-	// 	http.Error(w, "Failed to retrieve token from session", http.StatusInternalServerError)
-	// 	return
-	// }
-	// tk, err := h.db.GetTokenByValue(token)
-	// if err != nil {
-	// 	http.Error(w, "Failed to retrieve token from database", http.StatusInternalServerError)
-	// 	return
-	// }
-	// user, err := h.db.GetUserByEmail(tk.Email)
-	// if err != nil {
-	// 	http.Error(w, "Failed to retrieve user from database", http.StatusInternalServerError)
-	// 	return
-	// }
 	user, ok := r.Context().Value(userContextKey).(*User)
 	if !ok || user == nil {
 		fmt.Println("No user in context, must be anonymous")
@@ -444,33 +912,61 @@ func (h *Handlers) listTopics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	topics, err := h.db.SearchAndListTopics(searchQuery, page, PageSize)
+	// Listing and search are bound to the request, so a client that gives up
+	// stops its queries too. Searches get the longer timeout.
+	db := h.db.WithContext(r.Context())
+	if searchQuery != "" || len(filter.Tags) > 0 {
+		db = db.WithTimeout(h.config.SearchTimeout)
+	}
+	pageSize := pageSizeFor(user)
+	topics, err := db.SearchAndListTopics(filter, page, pageSize)
 	if err != nil {
 		log.Printf("Error searching topics: %v", err)
 		http.Error(w, "Failed to retrieve topics", http.StatusInternalServerError)
 		return
 	}
 
-	totalTopics, err := h.db.CountTopics(searchQuery)
+	totalTopics, err := db.CountTopics(filter)
 	if err != nil {
 		log.Printf("Error counting topics: %v", err)
 		http.Error(w, "Failed to retrieve topics", http.StatusInternalServerError)
 		return
 	}
 
-	totalPages := (totalTopics + PageSize - 1) / PageSize
+	var online []User
+	if h.config.ShowWhosOnline {
+		online, err = db.ListOnlineUsers(time.Now().Add(-h.config.OnlineWindow), 50)
+		if err != nil {
+			// The widget is decorative, so don't fail the whole page over it.
+			log.Printf("Error listing online users: %v", err)
+		}
+	}
+
+	query := url.Values{}
+	if searchQuery != "" {
+		query.Set("q", searchQuery)
+	}
+	if len(filter.Tags) > 0 {
+		query.Set("tags", strings.Join(filter.Tags, ", "))
+		if !filter.MatchAll {
+			query.Set("match", "any")
+		}
+	}
+	sorts := topicSortLinks(query, filter.Sort)
+	if filter.Sort != "" {
+		query.Set("sort", filter.Sort)
+	}
 	data := TopicsViewData{
-		Topics:      topics,
-		SearchQuery: searchQuery,
-		User:        user,
-		Pagination: PaginationData{
-			CurrentPage: page,
-			TotalPages:  totalPages,
-			NextPage:    page + 1,
-			PrevPage:    page - 1,
-			HasNext:     page < totalPages,
-			HasPrev:     page > 1,
-		},
+		Sorts:          sorts,
+		Sort:           filter.Sort,
+		Topics:         h.topicViews(r, topics),
+		SearchQuery:    searchQuery,
+		FilterTags:     strings.Join(filter.Tags, ", "),
+		MatchAny:       !filter.MatchAll,
+		User:           NewViewer(user),
+		ShowWhosOnline: h.config.ShowWhosOnline,
+		OnlineUsers:    NewProfileViews(online),
+		Pagination:     newPagination(page, totalTopics, pageSize, pageLink("/topics", query)),
 	}
 
 	err = h.templates.ExecuteTemplate(w, "topics.html", data)
@@ -479,32 +975,87 @@ func (h *Handlers) listTopics(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handlers) showTopic(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/topics/")
-	parts := strings.Split(path, "/")
-	topicIDStr := parts[0]
+// topicSortChoices are the sorts the topic list offers, in menu order.
+var topicSortChoices = []struct{ sort, label string }{
+	{"", "Newest"},
+	{TopicSortActivity, "Recent activity"},
+	{TopicSortReplies, "Most replies"},
+	{TopicSortViews, "Most viewed"},
+	{TopicSortOldest, "Oldest"},
+}
 
-	if len(parts) == 2 && parts[1] == "posts" {
-		fmt.Println("Creating post for topic:", topicIDStr, parts)
-		if r.Method == http.MethodPost {
-			h.createPost(w, r, topicIDStr)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// topicSortLinks links to the first page of the listing described by query
+// in each sort. Searches are ranked by relevance unless sorted otherwise.
+func topicSortLinks(query url.Values, current string) []SortLink {
+	links := make([]SortLink, len(topicSortChoices))
+	for i, c := range topicSortChoices {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
 		}
-		return
+		label := c.label
+		if c.sort != "" {
+			q.Set("sort", c.sort)
+		} else if query.Get("q") != "" {
+			label = "Best match"
+		}
+		link := "/topics"
+		if len(q) > 0 {
+			link += "?" + q.Encode()
+		}
+		links[i] = SortLink{Label: label, Link: link, Current: c.sort == current}
 	}
+	return links
+}
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// postSortChoices are the orders the topic page offers.
+var postSortChoices = []struct{ sort, label string }{
+	{"", "Oldest first"},
+	{PostSortNewest, "Newest first"},
+}
+
+// topicPostFilter reads the topic page's sort and author parameters. An
+// unknown sort, or PostSortOldest, is the default order.
+func topicPostFilter(r *http.Request) PostFilter {
+	f := PostFilter{
+		Author: strings.TrimSpace(r.URL.Query().Get("author")),
+		Sort:   r.URL.Query().Get("sort"),
+	}
+	if _, ok := postSorts[f.Sort]; !ok {
+		f.Sort = ""
 	}
+	return f
+}
 
-	topicID, err := uuid.Parse(topicIDStr)
-	if err != nil {
-		http.NotFound(w, r)
-		return
+// values encodes f for the topic page's links.
+func (f PostFilter) values() url.Values {
+	v := url.Values{}
+	if f.Author != "" {
+		v.Set("author", f.Author)
 	}
+	if f.Sort != "" {
+		v.Set("sort", f.Sort)
+	}
+	return v
+}
 
+// postSortLinks links to the first page of topicID in each order, keeping
+// the author filter.
+func postSortLinks(topicID string, filter PostFilter) []SortLink {
+	links := make([]SortLink, len(postSortChoices))
+	for i, c := range postSortChoices {
+		f := PostFilter{Author: filter.Author, Sort: c.sort}
+		link := "/topics/" + topicID
+		if v := f.values(); len(v) > 0 {
+			link += "?" + v.Encode()
+		}
+		links[i] = SortLink{Label: c.label, Link: link, Current: c.sort == filter.Sort}
+	}
+	return links
+}
+
+// showTopic serves GET /topics/{id}, a page of the topic's posts.
+func (h *Handlers) showTopic(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 	if page < 1 {
 		page = 1
@@ -512,138 +1063,286 @@ func (h *Handlers) showTopic(w http.ResponseWriter, r *http.Request) {
 
 	user, _ := r.Context().Value(userContextKey).(*User)
 	// fmt.Println("showTopic User in context:", user)
-	topic, err := h.db.GetTopic(topicID)
+	db := h.db.WithContext(r.Context())
+	topic, err := db.GetTopic(topicID)
 	if err != nil {
-		http.NotFound(w, r)
+		writeError(w, err, "topic")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query != "" {
+		trust, err := h.db.TrustLevel(user)
+		if err != nil {
+			log.Printf("Error computing trust level: %v", err)
+		}
+		h.showTopicSearch(w, r, topic, query, page, pageSizeFor(user), trust)
 		return
 	}
+	h.countTopicView(r, topic)
+	h.showTopicPage(w, r, topic, page, nil)
+}
 
-	posts, err := h.db.GetPostsByTopic(topicID, page, PageSize)
+// showTopicPage renders a page of topic's posts. A rejected form is shown
+// again with a 400 status.
+func (h *Handlers) showTopicPage(w http.ResponseWriter, r *http.Request, topic *Topic, page int, form *TopicForm) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	db := h.db.WithContext(r.Context())
+	topicID := uuid.MustParse(topic.ID)
+	trust, err := h.db.TrustLevel(user)
+	if err != nil {
+		log.Printf("Error computing trust level: %v", err)
+	}
+
+	pageSize := pageSizeFor(user)
+	filter := topicPostFilter(r)
+	posts, err := db.GetPostsByTopicIncludeDeleted(topicID, filter, page, pageSize)
 	if err != nil {
 		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
 		return
 	}
 
-	totalPosts, err := h.db.CountPostsByTopic(topicID)
+	totalPosts, err := db.CountPostsByTopicIncludeDeleted(topicID, filter)
 	if err != nil {
 		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
 		return
 	}
 
-	totalPages := (totalPosts + PageSize - 1) / PageSize
-	data := TopicViewData{
-		Topic: *topic,
-		Posts: posts,
-		User:  user,
-		Pagination: PaginationData{
-			CurrentPage: page,
-			TotalPages:  totalPages,
-			NextPage:    page + 1,
-			PrevPage:    page - 1,
-			HasNext:     page < totalPages,
-			HasPrev:     page > 1,
-		},
+	// The timeline is secondary to the posts, so a failure only loses the
+	// events. Events are placed among the posts in their usual order, so
+	// other orders go without them.
+	var events []TopicEvent
+	if filter.IsZero() {
+		events, err = db.TopicEventsForPage(topicID, page, pageSize, user != nil && user.Admin)
+		if err != nil {
+			log.Printf("Error listing topic events: %v", err)
+		}
 	}
 
+	data := h.topicViewData(r, topic)
+	data.Form = form
+	data.Sort, data.Author = filter.Sort, filter.Author
+	data.Sorts = postSortLinks(topic.ID, filter)
+	data.Timeline = newTimeline(posts, h.postFragments(topic, posts, user, trust), events)
+	data.Pagination = newPagination(page, totalPosts, pageSize, pageLink("/topics/"+topic.ID, filter.values()))
+	data.CanThread = filter.IsZero() && totalPosts <= maxThreadedPosts
+	if data.CanThread && r.URL.Query().Get("view") == "threaded" {
+		tree, err := db.GetPostTree(topicID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
+			return
+		}
+		data.Threaded = true
+		data.Threads = h.threadViews(topic, tree, user, trust)
+		posts = flattenTree(tree)
+	}
+	// The read marker is the newest post read, which only holds for pages
+	// read in order.
+	if filter.IsZero() {
+		h.markTopicRead(user, topic.ID, posts)
+	}
+
+	if form != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
 	err = h.templates.ExecuteTemplate(w, "topic.html", data)
 	if err != nil {
 		log.Printf("Error executing template: %v", err)
 	}
 }
 
-func (h *Handlers) createPost(w http.ResponseWriter, r *http.Request, topicIDStr string) {
-	user, ok := r.Context().Value(userContextKey).(*User)
-	if !ok || user == nil {
-		fmt.Println("No user in context, must be anonymous")
-		http.Error(w, "You must be logged in to post", http.StatusUnauthorized)
+// topicViewData fills in the parts of the topic page that don't depend on
+// which posts are shown.
+func (h *Handlers) topicViewData(r *http.Request, topic *Topic) TopicViewData {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	db := h.db.WithContext(r.Context())
+	data := TopicViewData{
+		Topic:          NewTopicView(topic),
+		User:           NewViewer(user),
+		ReportReasons:  h.reportReasons(),
+		CanSummarize:   h.canSummarize(topic),
+		CanManage:      canManageTopic(user, topic),
+		Solution:       h.topicSolution(db, topic),
+		TitleMaxLength: h.config.TitleMaxLength,
+		BodyMaxLength:  h.config.BodyMaxLength,
+	}
+	var err error
+	if user != nil {
+		data.ReminderOptions = reminderOptions
+		if data.Watching, err = db.IsWatchingTopic(user.ID, topic.ID); err != nil {
+			log.Printf("Error checking topic subscription: %v", err)
+		}
+		if data.Bookmarked, err = db.IsTopicBookmarked(user.ID, topic.ID); err != nil {
+			log.Printf("Error checking topic bookmark: %v", err)
+		}
+	} else if h.config.GuestPosting {
+		data.GuestPosting = true
+		data.Captcha = h.captcha.widget()
+	}
+	return data
+}
+
+// createPost serves POST /topics/{id}/posts.
+func (h *Handlers) createPost(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if user != nil && (h.rejectSuspended(w, r, user) || h.rejectPostFlood(w, r, user)) {
 		return
 	}
 
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		badRequestBody(w, err, "Failed to parse form")
 		return
 	}
 
 	// 1. Initialize the basic post data first
+	body := r.FormValue("body")
 	post := Post{
-		TopicID:  topicIDStr,
-		Author:   user.Handle,
-		Body:     r.FormValue("body"),
-		AuthorID: user.ID,
+		TopicID: topicID.String(),
+		Body:    body,
+	}
+	if user != nil {
+		post.Author, post.AuthorID = user.Handle, user.ID
+	} else {
+		name := h.guestAuthor(w, r)
+		if name == "" {
+			return
+		}
+		post.Author, post.AuthorID = name, GuestAuthorID
 	}
 
 	// 2. Handle Reply Logic
+	var parentPost *Post
 	parentPostID := r.FormValue("parent_post_id")
 	if parentPostID != "" {
-		pid, err := strconv.Atoi(parentPostID)
+		pid, err := strconv.ParseInt(parentPostID, 10, 64)
 		if err != nil {
-			fmt.Println("Invalid parent post ID:", parentPostID, err)
 			http.Error(w, "Invalid parent post ID", http.StatusBadRequest)
 			return
 		}
 
-		parentPost, err := h.db.GetPost(int64(pid))
+		// Held and hidden posts are treated as missing: a reply quotes its
+		// parent, which would publish them.
+		parentPost, err = h.db.GetPost(pid)
+		if errors.Is(err, ErrNotFound) || (err == nil && parentPost.State != PostVisible) {
+			http.Error(w, "The post you replied to no longer exists", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to retrieve post from database", http.StatusInternalServerError)
 			return
 		}
+		if parentPost.TopicID != topicID.String() {
+			http.Error(w, "You can only reply to posts in this topic", http.StatusBadRequest)
+			return
+		}
 
 		// FIX: Set the structural link so the DB knows this is a reply
-		pid64 := int64(pid)
-		post.ParentPostID = &pid64
+		post.ParentPostID = &pid
 
 		// OPTIONAL: If you really want the "Quoting" style from your code,
 		// you can uncomment the line below. Otherwise, standard threading is usually cleaner.
 		post.Body = fmt.Sprintf("%s\n\n--- Replying to @%s ---\n\n%s", parentPost.Body, parentPost.Author, post.Body)
+	}
 
-		// FIX: Get the readable Topic Title for the notification
-		topicTitle := "Unknown Topic"
-		if tID, err := uuid.Parse(topicIDStr); err == nil {
-			if t, err := h.db.GetTopic(tID); err == nil {
-				topicTitle = t.Title
-			}
+	if problem := h.bodyProblem(body); problem != "" {
+		topic, err := h.db.GetTopic(topicID)
+		if err != nil {
+			writeError(w, err, "topic")
+			return
 		}
-
-		// FIX: Send a human-readable notification
-		h.NotifCh <- Notification{
-			From:      user.ID,
-			UserID:    parentPost.AuthorID,
-			CreatedAt: time.Now(),
-			Message:   fmt.Sprintf("New reply in topic: %s", topicTitle),
-			Link:      "/topics/" + topicIDStr,
-			ID:        uuid.New().String(),
+		form := &TopicForm{
+			Error:        "Post body " + problem + ".",
+			Action:       "/topics/" + topicID.String() + "/posts",
+			Heading:      "Add a New Post",
+			ParentPostID: parentPostID,
+			Body:         body,
 		}
-	}
-
-	if post.Body == "" {
-		http.Error(w, "Body is a required field", http.StatusBadRequest)
+		if parentPost != nil {
+			form.Heading = "Replying to " + parentPost.Author
+		}
+		if user == nil {
+			form.GuestName = post.Author
+		}
+		h.showTopicPage(w, r, topic, 1, form)
 		return
 	}
 
+	state, matched := h.applyRules(RuleEventPostCreate, &post)
+	post.State = state
 	if err := h.db.CreatePost(&post); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		log.Printf("Error creating post: %v", err)
 		http.Error(w, "Failed to create post", http.StatusInternalServerError)
 		return
 	}
+	h.auditRuleMatches(RuleEventPostCreate, &post, matched)
 
-	http.Redirect(w, r, "/topics/"+topicIDStr, http.StatusSeeOther)
+	h.subscribeAuthor(&post)
+	if post.State == PostVisible {
+		h.publishPost(post)
+		var notified string
+		if parentPost != nil {
+			notified = parentPost.AuthorID
+			h.notifyReply(parentPost, post)
+		}
+		h.notifyWatchers(post, notified)
+		http.Redirect(w, r, postPath(post.ID), http.StatusSeeOther)
+		return
+	}
+	h.queueModeratedPost(&post)
+	http.Redirect(w, r, "/topics/"+topicID.String(), http.StatusSeeOther)
 }
 
 func (h *Handlers) createTopic(w http.ResponseWriter, r *http.Request) {
-	var topic Topic
-	if err := json.NewDecoder(r.Body).Decode(&topic); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	user, ok := r.Context().Value(userContextKey).(*User)
+	if !ok || user == nil {
+		http.Error(w, "You must be logged in to create a topic", http.StatusUnauthorized)
+		return
+	}
+	if h.rejectSuspended(w, r, user) || h.rejectTopicFlood(w, r, user, 1) {
+		return
+	}
+
+	var req struct {
+		Topic
+		IgnoreDuplicates bool `json:"ignore_duplicates"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequestBody(w, err, "Invalid request body")
 		return
 	}
+	topic := req.Topic
 
-	if topic.ID == "" || topic.Title == "" {
-		http.Error(w, "Missing topic ID or title", http.StatusBadRequest)
+	if problem := h.titleProblem(topic.Title); problem != "" {
+		writeError(w, invalid("title", problem), "topic")
+		return
+	}
+	// Offer likely duplicates first, so the author can join an existing
+	// discussion instead.
+	if !req.IgnoreDuplicates {
+		if dups := h.findDuplicates(r, topic.Title); len(dups) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(DuplicatesResponse{Error: "Similar topics already exist", Duplicates: dups})
+			return
+		}
+	}
+	// Clients used to have to choose the ID. They still may, but the server
+	// assigns a time-ordered one when they don't.
+	if topic.ID == "" {
+		topic.ID = NewTopicID()
+	} else if _, err := uuid.Parse(topic.ID); err != nil {
+		http.Error(w, "Topic ID must be a UUID", http.StatusBadRequest)
 		return
 	}
 
 	if topic.Tags == nil {
 		topic.Tags = []string{}
 	}
+	topic.AuthorID = user.ID
 
 	if err := h.db.CreateTopic(&topic); err != nil {
 		log.Printf("Error creating topic: %v", err)
@@ -664,13 +1363,14 @@ func (h *Handlers) StartNotificationListener(rate time.Duration) {
 		select {
 		case notif := <-h.NotifCh:
 			if notif.UserID != "" {
-				user, err := h.db.GetUserByID(notif.UserID)
+				user, err := h.db.ModifyUser(notif.UserID, func(u *User) error {
+					u.Notifications = append(u.Notifications, notif)
+					return nil
+				})
 				if err != nil {
-					fmt.Printf("Error retrieving user %s: %v\n", notif.UserID, err)
+					fmt.Printf("Error saving notification for user %s: %v\n", notif.UserID, err)
 					continue
 				}
-				user.Notifications = append(user.Notifications, notif)
-				go h.db.SaveUser(user)
 				// Send the notification to the user
 				fmt.Printf("Sending notification to user %s: %s\n", user.Email, notif.Message)
 			}
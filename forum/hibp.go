@@ -0,0 +1,76 @@
+// forum/hibp.go
+package forum
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Breached password check modes.
+const (
+	BreachCheckOff    = "off"
+	BreachCheckWarn   = "warn"
+	BreachCheckReject = "reject"
+)
+
+// PasswordBreached is the policy violation code for a password found in a breach corpus.
+const PasswordBreached = "breached"
+
+// breachedViolation is reported when a breached password is rejected.
+var breachedViolation = PasswordViolation{
+	Code:    PasswordBreached,
+	Message: "This password has appeared in a data breach. Choose a different one.",
+}
+
+// passwordBreached asks the Have I Been Pwned range API whether password has
+// been seen in a breach. Only the first five hex characters of its SHA-1 leave
+// the server. The check fails open: errors and timeouts count as not breached.
+func (h *Handlers) passwordBreached(ctx context.Context, password string) bool {
+	if h.config.BreachCheck == BreachCheckOff || h.config.BreachCheck == "" {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.config.BreachCheckTimeout)
+	defer cancel()
+	found, err := h.lookupBreach(ctx, password)
+	if err != nil {
+		log.Printf("Breached password check failed, allowing password: %v", err)
+		return false
+	}
+	return found
+}
+
+func (h *Handlers) lookupBreach(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(h.config.BreachCheckURL, "/")+"/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding hides the real number of matches from anyone watching the response size.
+	req.Header.Set("Add-Padding", "true")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && candidate == suffix && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
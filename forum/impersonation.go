@@ -0,0 +1,110 @@
+// forum/impersonation.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// impersonationKey is the session key holding the ID of the member an admin
+// is viewing the forum as, and impersonationEndsKey when that stops by
+// itself, in unix seconds.
+const (
+	impersonationKey     = "impersonate"
+	impersonationEndsKey = "impersonate_ends"
+)
+
+// impersonationTTL is how long an admin can view as someone before it ends
+// on its own.
+const impersonationTTL = time.Hour
+
+// impersonationStopPath ends an impersonation. It is the one change allowed
+// while viewing as someone else.
+const impersonationStopPath = "/impersonation/stop"
+
+// impersonating returns the member the admin user is viewing the forum as,
+// or nil. An impersonation that ran out, or no longer makes sense because
+// user lost admin or the member was deleted or made an admin, is ended.
+func (h *Handlers) impersonating(r *http.Request, user *User) (*User, error) {
+	id, ok := h.Session.Get(r.Context(), impersonationKey).(string)
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().Unix() >= h.Session.GetInt64(r.Context(), impersonationEndsKey) {
+		h.clearImpersonation(r)
+		h.audit(user, "user.impersonate.stop", "user", id, map[string]string{"reason": "expired"})
+		return nil, nil
+	}
+	target, err := h.db.GetUserByID(id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err != nil || !user.Admin || target.Admin {
+		h.clearImpersonation(r)
+		h.audit(user, "user.impersonate.stop", "user", id, map[string]string{"reason": "no longer allowed"})
+		return nil, nil
+	}
+	target.impersonator = user
+	return target, nil
+}
+
+// impersonationAllows reports whether r may go ahead while an admin views
+// the forum as someone else. Only reads are allowed, apart from stopping and
+// logging out, so nothing is done in the member's name.
+func impersonationAllows(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return r.URL.Path == impersonationStopPath || r.URL.Path == "/logout"
+}
+
+// startImpersonation serves POST /admin/users/{id}/impersonate, letting the
+// admin browse as that member, without their password, for up to
+// impersonationTTL. Other admins can't be impersonated.
+func (h *Handlers) startImpersonation(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	target, err := h.db.WithContext(r.Context()).GetUserByID(userID)
+	if err != nil {
+		writeError(w, err, "user")
+		return
+	}
+	if target.Admin {
+		http.Error(w, "Admins can't be impersonated", http.StatusForbidden)
+		return
+	}
+	if err := h.Session.RenewToken(r.Context()); err != nil {
+		log.Printf("Error renewing session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.Session.Put(r.Context(), impersonationKey, target.ID)
+	h.Session.Put(r.Context(), impersonationEndsKey, time.Now().Add(impersonationTTL).Unix())
+	h.audit(staff, "user.impersonate.start", "user", target.ID, map[string]string{"handle": target.Handle})
+	http.Redirect(w, r, "/topics", http.StatusSeeOther)
+}
+
+// stopImpersonation serves POST /impersonation/stop and returns the admin to
+// the member's admin page.
+func (h *Handlers) stopImpersonation(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if user.impersonator == nil {
+		http.Redirect(w, r, "/topics", http.StatusSeeOther)
+		return
+	}
+	h.endImpersonation(r, user)
+	http.Redirect(w, r, "/admin/users/"+user.ID, http.StatusSeeOther)
+}
+
+// endImpersonation ends the admin's view as user and records it.
+func (h *Handlers) endImpersonation(r *http.Request, user *User) {
+	h.clearImpersonation(r)
+	h.audit(user.impersonator, "user.impersonate.stop", "user", user.ID, map[string]string{"handle": user.Handle})
+}
+
+func (h *Handlers) clearImpersonation(r *http.Request) {
+	h.Session.Remove(r.Context(), impersonationKey)
+	h.Session.Remove(r.Context(), impersonationEndsKey)
+}
@@ -0,0 +1,336 @@
+// forum/incominghooks.go
+package forum
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Default templates for incoming hooks: the payload's "title" and "body" fields.
+const (
+	defaultHookTitle = `{{.title}}`
+	defaultHookBody  = `{{.body}}`
+)
+
+// IncomingHook lets an external system post to the forum by calling
+// /api/v1/hooks/{id} with a body signed by the hook's secret. A hook with a
+// TopicID replies in that topic; otherwise each call starts a new topic
+// tagged with Tags. The payload is rendered through the title and body
+// templates, which see it as a map.
+type IncomingHook struct {
+	ID            string    `json:"id" db:"id"`
+	Name          string    `json:"name" db:"name"`
+	Secret        string    `json:"-" db:"secret"`
+	UserID        string    `json:"user_id" db:"user_id"`
+	TopicID       *string   `json:"topic_id" db:"topic_id"`
+	Tags          []string  `json:"tags" db:"tags"`
+	TitleTemplate string    `json:"title_template" db:"title_template"`
+	BodyTemplate  string    `json:"body_template" db:"body_template"`
+	CreatedBy     string    `json:"created_by" db:"created_by"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// IncomingHooksViewData is the data structure for the admin incoming hooks page.
+type IncomingHooksViewData struct {
+	User      *Viewer
+	Hooks     []IncomingHook
+	NewHook   *IncomingHook
+	NewSecret string
+	Error     string
+}
+
+// render executes tpl against the payload.
+func renderHookTemplate(name, tpl string, payload map[string]any) (string, error) {
+	t, err := template.New(name).Option("missingkey=zero").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, payload); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// validSignature checks the X-Volconvo-Signature header, "sha256=" and the
+// hex HMAC-SHA256 of body, the same scheme outgoing webhooks use.
+func validSignature(secret, header string, body []byte) bool {
+	got, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	sig, err := hex.DecodeString(got)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// receiveHook serves POST /api/v1/hooks/{id}.
+func (h *Handlers) receiveHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/hooks/"), "/")
+	if _, err := uuid.Parse(id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		badRequestBody(w, err, "Failed to read body")
+		return
+	}
+	hook, err := h.db.GetIncomingHook(id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error getting incoming hook: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Unknown hooks and bad signatures look the same to the caller.
+	if err != nil || !validSignature(hook.Secret, r.Header.Get("X-Volconvo-Signature"), body) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload map[string]any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		http.Error(w, "Body must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	text, err := renderHookTemplate("body", hook.BodyTemplate, payload)
+	if err != nil || text == "" {
+		http.Error(w, fmt.Sprintf("Body template produced no post: %v", err), http.StatusBadRequest)
+		return
+	}
+	author, err := h.db.GetUserByID(hook.UserID)
+	if err != nil {
+		log.Printf("Incoming hook %s has no author: %v", hook.ID, err)
+		http.Error(w, "Hook author is missing", http.StatusInternalServerError)
+		return
+	}
+	post := Post{Author: author.Handle, AuthorID: author.ID, Body: text}
+
+	if hook.TopicID != nil {
+		post.TopicID = *hook.TopicID
+		if err := h.db.CreatePost(&post); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "The hook's topic no longer exists", http.StatusGone)
+				return
+			}
+			log.Printf("Error creating hook post: %v", err)
+			http.Error(w, "Failed to create post", http.StatusInternalServerError)
+			return
+		}
+		h.publishPost(post)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"post": post})
+		return
+	}
+
+	title, err := renderHookTemplate("title", hook.TitleTemplate, payload)
+	if err != nil || title == "" {
+		http.Error(w, fmt.Sprintf("Title template produced no title: %v", err), http.StatusBadRequest)
+		return
+	}
+	topic := Topic{ID: NewTopicID(), Title: title, Tags: hook.Tags, AuthorID: author.ID}
+	post.TopicID = topic.ID
+	items := []BatchItem{{Type: BatchTopic, Topic: &topic}, {Type: BatchPost, Post: &post}}
+	if _, err := h.db.CreateBatch(items); err != nil {
+		log.Printf("Error creating hook topic: %v", err)
+		http.Error(w, "Failed to create topic", http.StatusInternalServerError)
+		return
+	}
+	h.publishPost(post)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"topic": topic, "post": post})
+}
+
+// showIncomingHooks renders /admin/hooks.
+func (h *Handlers) showIncomingHooks(w http.ResponseWriter, r *http.Request, data IncomingHooksViewData) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	data.User = NewViewer(staff)
+	hooks, err := h.db.ListIncomingHooks()
+	if err != nil {
+		log.Printf("Error listing incoming hooks: %v", err)
+		http.Error(w, "Failed to retrieve hooks", http.StatusInternalServerError)
+		return
+	}
+	data.Hooks = hooks
+	if data.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := h.templates.ExecuteTemplate(w, "incoming_hooks.html", data); err != nil {
+		log.Printf("Error executing incoming hooks template: %v", err)
+	}
+}
+
+// createIncomingHook serves POST /admin/hooks. The hook posts as the user
+// named by "author", or the admin creating it. The secret is shown once.
+func (h *Handlers) createIncomingHook(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	hook := IncomingHook{
+		ID:            uuid.New().String(),
+		Name:          strings.TrimSpace(r.FormValue("name")),
+		UserID:        staff.ID,
+		Tags:          normalizeTags(strings.Split(r.FormValue("tags"), ",")),
+		TitleTemplate: r.FormValue("title_template"),
+		BodyTemplate:  r.FormValue("body_template"),
+		CreatedBy:     staff.ID,
+	}
+	if hook.TitleTemplate == "" {
+		hook.TitleTemplate = defaultHookTitle
+	}
+	if hook.BodyTemplate == "" {
+		hook.BodyTemplate = defaultHookBody
+	}
+	fail := func(msg string) {
+		h.showIncomingHooks(w, r, IncomingHooksViewData{NewHook: &hook, Error: msg})
+	}
+	if hook.Name == "" {
+		fail("A name is required.")
+		return
+	}
+	if handle := strings.TrimSpace(r.FormValue("author")); handle != "" {
+		author, err := h.db.GetUserByHandle(handle)
+		if err != nil {
+			fail("No user has the handle " + handle + ".")
+			return
+		}
+		hook.UserID = author.ID
+	}
+	if topicID := strings.TrimSpace(r.FormValue("topic_id")); topicID != "" {
+		id, err := uuid.Parse(topicID)
+		if err != nil {
+			fail("The topic ID must be a UUID.")
+			return
+		}
+		if _, err := h.db.GetTopic(id); err != nil {
+			fail("No topic has that ID.")
+			return
+		}
+		hook.TopicID = &topicID
+	}
+	for name, tpl := range map[string]string{"title": hook.TitleTemplate, "body": hook.BodyTemplate} {
+		if _, err := template.New(name).Parse(tpl); err != nil {
+			fail(fmt.Sprintf("The %s template is invalid: %v", name, err))
+			return
+		}
+	}
+
+	secret, err := generateAPIKey()
+	if err != nil {
+		log.Printf("Error generating hook secret: %v", err)
+		http.Error(w, "Failed to create hook", http.StatusInternalServerError)
+		return
+	}
+	hook.Secret = secret
+	if err := h.db.CreateIncomingHook(&hook); err != nil {
+		log.Printf("Error creating incoming hook: %v", err)
+		http.Error(w, "Failed to create hook", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "hook.create", "incoming_hook", hook.ID, map[string]string{"name": hook.Name})
+	h.showIncomingHooks(w, r, IncomingHooksViewData{NewHook: &hook, NewSecret: secret})
+}
+
+// deleteIncomingHook serves POST /admin/hooks/{id}/delete.
+func (h *Handlers) deleteIncomingHook(w http.ResponseWriter, r *http.Request, id string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if _, err := uuid.Parse(id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.DeleteIncomingHook(id); err != nil {
+		log.Printf("Error deleting incoming hook: %v", err)
+		http.Error(w, "Failed to delete hook", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "hook.delete", "incoming_hook", id, nil)
+	http.Redirect(w, r, "/admin/hooks", http.StatusSeeOther)
+}
+
+// --- Incoming Hook Database Functions ---
+
+const incomingHookColumns = `id, name, secret, user_id, topic_id, tags, title_template, body_template, created_by, created_at`
+
+func scanIncomingHook(row pgx.Row) (*IncomingHook, error) {
+	var hook IncomingHook
+	err := row.Scan(&hook.ID, &hook.Name, &hook.Secret, &hook.UserID, &hook.TopicID, &hook.Tags,
+		&hook.TitleTemplate, &hook.BodyTemplate, &hook.CreatedBy, &hook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (d *Database) CreateIncomingHook(hook *IncomingHook) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO incoming_hooks (id, name, secret, user_id, topic_id, tags, title_template, body_template, created_by)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING created_at`
+	return d.pool.QueryRow(ctx, query,
+		hook.ID, hook.Name, hook.Secret, hook.UserID, hook.TopicID, hook.Tags, hook.TitleTemplate, hook.BodyTemplate, hook.CreatedBy,
+	).Scan(&hook.CreatedAt)
+}
+
+func (d *Database) GetIncomingHook(id string) (*IncomingHook, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	hook, err := scanIncomingHook(d.pool.QueryRow(ctx, `SELECT `+incomingHookColumns+` FROM incoming_hooks WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return hook, err
+}
+
+func (d *Database) ListIncomingHooks() ([]IncomingHook, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.pool.Query(ctx, `SELECT `+incomingHookColumns+` FROM incoming_hooks ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hooks []IncomingHook
+	for rows.Next() {
+		hook, err := scanIncomingHook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *hook)
+	}
+	return hooks, rows.Err()
+}
+
+func (d *Database) DeleteIncomingHook(id string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM incoming_hooks WHERE id = $1`, id)
+	return err
+}
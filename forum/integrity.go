@@ -0,0 +1,104 @@
+// forum/integrity.go
+package forum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// foreignKey is a reference CreateTables enforces once existing data allows.
+type foreignKey struct {
+	Name     string
+	Table    string
+	Column   string
+	RefTable string
+	OnDelete string
+}
+
+// foreignKeys are the references added after the initial release. Authored
+// content restricts hard deletes of its author (accounts are soft-deleted, and
+// PurgeUserContent removes content first), sessions go with their user, and a
+// reply, or a topic, outlives a purged parent or solution.
+var foreignKeys = []foreignKey{
+	{Name: "fk_topics_author", Table: "topics", Column: "author_id", RefTable: "users", OnDelete: "RESTRICT"},
+	{Name: "fk_posts_author", Table: "posts", Column: "author_id", RefTable: "users", OnDelete: "RESTRICT"},
+	{Name: "fk_posts_parent", Table: "posts", Column: "parent_post_id", RefTable: "posts", OnDelete: "SET NULL"},
+	{Name: "fk_topics_solution", Table: "topics", Column: "solution_post_id", RefTable: "posts", OnDelete: "SET NULL"},
+	{Name: "fk_tokens_user", Table: "tokens", Column: "user_id", RefTable: "users", OnDelete: "CASCADE"},
+}
+
+// OrphanReport counts rows of Table whose Column names a missing RefTable row.
+type OrphanReport struct {
+	Constraint string `json:"constraint"`
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	RefTable   string `json:"ref_table"`
+	Count      int64  `json:"count"`
+}
+
+// --- Integrity Database Functions ---
+
+// enforceForeignKeys adds any missing foreign key as NOT VALID, which checks
+// new writes straight away, then validates it against existing rows unless
+// orphans are found. Orphans are logged rather than deleted; once they're
+// fixed the next start validates the constraint.
+func (d *Database) enforceForeignKeys(ctx context.Context) error {
+	for _, fk := range foreignKeys {
+		var validated bool
+		err := d.pool.QueryRow(ctx, `SELECT convalidated FROM pg_constraint WHERE conname = $1 AND connamespace = current_schema()::regnamespace`, fk.Name).Scan(&validated)
+		if errors.Is(err, pgx.ErrNoRows) {
+			query := fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(id) ON DELETE %s NOT VALID`,
+				fk.Table, fk.Name, fk.Column, fk.RefTable, fk.OnDelete)
+			if _, err := d.pool.Exec(ctx, query); err != nil {
+				return fmt.Errorf("adding %s: %w", fk.Name, err)
+			}
+		} else if err != nil {
+			return err
+		}
+		if validated {
+			continue
+		}
+		report, err := d.countOrphans(ctx, fk)
+		if err != nil {
+			return err
+		}
+		if report.Count > 0 {
+			log.Printf("Integrity: %d %s rows have a %s with no matching %s row; %s is enforced for new writes only until they are fixed",
+				report.Count, fk.Table, fk.Column, fk.RefTable, fk.Name)
+			continue
+		}
+		if _, err := d.pool.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s VALIDATE CONSTRAINT %s`, fk.Table, fk.Name)); err != nil {
+			return fmt.Errorf("validating %s: %w", fk.Name, err)
+		}
+	}
+	return nil
+}
+
+func (d *Database) countOrphans(ctx context.Context, fk foreignKey) (OrphanReport, error) {
+	report := OrphanReport{Constraint: fk.Name, Table: fk.Table, Column: fk.Column, RefTable: fk.RefTable}
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s c
+                          WHERE c.%s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %s r WHERE r.id = c.%s)`,
+		fk.Table, fk.Column, fk.RefTable, fk.Column)
+	err := d.pool.QueryRow(ctx, query).Scan(&report.Count)
+	return report, err
+}
+
+// FindOrphans reports, for every foreign key, how many rows reference a
+// missing row.
+func (d *Database) FindOrphans() ([]OrphanReport, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	reports := make([]OrphanReport, 0, len(foreignKeys))
+	for _, fk := range foreignKeys {
+		report, err := d.countOrphans(ctx, fk)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
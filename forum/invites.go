@@ -0,0 +1,256 @@
+// forum/invites.go
+package forum
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Invite is a code that lets someone register while the forum is invite-only.
+type Invite struct {
+	Code      string    `json:"code" db:"code"`
+	CreatedBy string    `json:"created_by" db:"created_by"`
+	MaxUses   int       `json:"max_uses" db:"max_uses"`
+	Uses      int       `json:"uses" db:"uses"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Usable reports whether the invite can still be redeemed.
+func (i Invite) Usable() bool {
+	return i.Uses < i.MaxUses && time.Now().Before(i.ExpiresAt)
+}
+
+// InviteRedemption links an inviter to the member who registered with their code.
+type InviteRedemption struct {
+	Code          string    `json:"code" db:"code"`
+	InviterID     string    `json:"inviter_id" db:"inviter_id"`
+	InviterHandle string    `json:"inviter_handle" db:"inviter_handle"`
+	UserID        string    `json:"user_id" db:"user_id"`
+	UserHandle    string    `json:"user_handle" db:"user_handle"`
+	RedeemedAt    time.Time `json:"redeemed_at" db:"redeemed_at"`
+}
+
+// InvitesViewData is the data structure for a member's invites page.
+type InvitesViewData struct {
+	User      *Viewer
+	Invites   []Invite
+	CanInvite bool
+}
+
+// AdminInvitesViewData is the data structure for the admin invite tree page.
+type AdminInvitesViewData struct {
+	User        *Viewer
+	Redemptions []InviteRedemption
+}
+
+// errInviteInvalid is returned when a code is unknown, used up or expired.
+var errInviteInvalid = errors.New("invite code is invalid or has expired")
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// canInvite reports whether user may generate invite codes.
+func (h *Handlers) canInvite(user *User) bool {
+	if user == nil {
+		return false
+	}
+	if user.Admin {
+		return true
+	}
+	trust, err := h.db.TrustLevel(user)
+	if err != nil {
+		log.Printf("Error computing trust level: %v", err)
+		return false
+	}
+	return trust >= h.config.InviteTrustLevel
+}
+
+// handleInvites lists the user's invite codes and creates new ones on POST.
+// Admins may set "max_uses" and "days"; members get the configured defaults.
+func (h *Handlers) handleInvites(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	canInvite := h.canInvite(user)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !canInvite {
+			http.Error(w, "You can't invite members yet", http.StatusForbidden)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			badRequestBody(w, err, "Failed to parse form")
+			return
+		}
+		invite := Invite{
+			CreatedBy: user.ID,
+			MaxUses:   h.config.InviteMaxUses,
+			ExpiresAt: time.Now().Add(h.config.InviteTTL),
+		}
+		if user.Admin {
+			if n, err := strconv.Atoi(r.FormValue("max_uses")); err == nil && n > 0 {
+				invite.MaxUses = n
+			}
+			if days, err := strconv.Atoi(r.FormValue("days")); err == nil && days > 0 {
+				invite.ExpiresAt = time.Now().Add(time.Duration(days) * 24 * time.Hour)
+			}
+		}
+		code, err := generateInviteCode()
+		if err != nil {
+			log.Printf("Error generating invite code: %v", err)
+			http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+			return
+		}
+		invite.Code = code
+		if err := h.db.CreateInvite(&invite); err != nil {
+			log.Printf("Error creating invite: %v", err)
+			http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+			return
+		}
+		h.audit(user, "invite.create", "invite", invite.Code, map[string]string{
+			"max_uses":   strconv.Itoa(invite.MaxUses),
+			"expires_at": invite.ExpiresAt.Format(time.RFC3339),
+		})
+		http.Redirect(w, r, "/invites", http.StatusSeeOther)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	invites, err := h.db.ListInvitesByCreator(user.ID)
+	if err != nil {
+		log.Printf("Error listing invites: %v", err)
+		http.Error(w, "Failed to retrieve invites", http.StatusInternalServerError)
+		return
+	}
+	data := InvitesViewData{User: NewViewer(user), Invites: invites, CanInvite: canInvite}
+	if err := h.templates.ExecuteTemplate(w, "invites.html", data); err != nil {
+		log.Printf("Error executing invites template: %v", err)
+	}
+}
+
+// showAdminInvites renders /admin/invites, showing who invited whom.
+func (h *Handlers) showAdminInvites(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	redemptions, err := h.db.ListInviteRedemptions()
+	if err != nil {
+		log.Printf("Error listing invite redemptions: %v", err)
+		http.Error(w, "Failed to retrieve invites", http.StatusInternalServerError)
+		return
+	}
+	data := AdminInvitesViewData{User: NewViewer(user), Redemptions: redemptions}
+	if err := h.templates.ExecuteTemplate(w, "admin_invites.html", data); err != nil {
+		log.Printf("Error executing admin invites template: %v", err)
+	}
+}
+
+// --- Invite Database Functions ---
+
+func (d *Database) CreateInvite(invite *Invite) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO invites (code, created_by, max_uses, expires_at) VALUES ($1, $2, $3, $4) RETURNING created_at`
+	return d.pool.QueryRow(ctx, query,
+		invite.Code, invite.CreatedBy, invite.MaxUses, invite.ExpiresAt,
+	).Scan(&invite.CreatedAt)
+}
+
+// ListInvitesByCreator returns the invites a user has generated, newest first.
+func (d *Database) ListInvitesByCreator(userID string) ([]Invite, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT code, created_by, max_uses, uses, expires_at, created_at FROM invites
+              WHERE created_by = $1
+              ORDER BY created_at DESC`
+	rows, err := d.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var invites []Invite
+	for rows.Next() {
+		var i Invite
+		if err := rows.Scan(&i.Code, &i.CreatedBy, &i.MaxUses, &i.Uses, &i.ExpiresAt, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+// ClaimInvite uses up one redemption of code, returning errInviteInvalid if
+// it is unknown, exhausted or expired.
+func (d *Database) ClaimInvite(code string) (*Invite, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var i Invite
+	query := `UPDATE invites SET uses = uses + 1
+              WHERE code = $1 AND uses < max_uses AND expires_at > NOW()
+              RETURNING code, created_by, max_uses, uses, expires_at, created_at`
+	err := d.pool.QueryRow(ctx, query, strings.ToUpper(strings.TrimSpace(code))).Scan(
+		&i.Code, &i.CreatedBy, &i.MaxUses, &i.Uses, &i.ExpiresAt, &i.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// ReleaseInvite gives back a redemption claimed for a registration that failed.
+func (d *Database) ReleaseInvite(code string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE invites SET uses = uses - 1 WHERE code = $1 AND uses > 0`, code)
+	return err
+}
+
+func (d *Database) RecordInviteRedemption(code, userID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `INSERT INTO invite_redemptions (code, user_id) VALUES ($1, $2)`, code, userID)
+	return err
+}
+
+// ListInviteRedemptions returns every registration made with an invite, newest first.
+func (d *Database) ListInviteRedemptions() ([]InviteRedemption, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT r.code, i.created_by, COALESCE(inviter.handle, ''), r.user_id, COALESCE(invitee.handle, ''), r.redeemed_at
+              FROM invite_redemptions r
+              JOIN invites i ON i.code = r.code
+              LEFT JOIN users inviter ON inviter.id = i.created_by
+              LEFT JOIN users invitee ON invitee.id = r.user_id
+              ORDER BY r.redeemed_at DESC`
+	rows, err := d.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var redemptions []InviteRedemption
+	for rows.Next() {
+		var ir InviteRedemption
+		if err := rows.Scan(&ir.Code, &ir.InviterID, &ir.InviterHandle, &ir.UserID, &ir.UserHandle, &ir.RedeemedAt); err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, ir)
+	}
+	return redemptions, rows.Err()
+}
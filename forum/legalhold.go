@@ -0,0 +1,260 @@
+// forum/legalhold.go
+package forum
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// A legal hold on a user or topic keeps its content from ever being removed
+// for good. Ordinary deletes are soft, so held content that gets deleted stays
+// in the database with its revisions; what a hold blocks are the hard deletes
+// (purges, repairs and any retention job), which must skip anything matched by
+// topicHeld or postHeld.
+
+// Legal hold target types.
+const (
+	HoldTargetUser  = "user"
+	HoldTargetTopic = "topic"
+)
+
+// ErrLegalHold is returned when an operation would destroy held content.
+var ErrLegalHold = errors.New("content is under legal hold")
+
+// LegalHold is an active hold placed by staff.
+type LegalHold struct {
+	TargetType string    `json:"target_type" db:"target_type"`
+	TargetID   string    `json:"target_id" db:"target_id"`
+	Reason     string    `json:"reason" db:"reason"`
+	PlacedByID string    `json:"placed_by_id" db:"placed_by_id"`
+	PlacedBy   string    `json:"placed_by" db:"placed_by"`
+	PlacedAt   time.Time `json:"placed_at" db:"placed_at"`
+}
+
+// topicHeld is the condition that the topic referenced as alias, or its
+// author, is under legal hold.
+func topicHeld(alias string) string {
+	return `EXISTS (SELECT 1 FROM legal_holds lh WHERE
+                  (lh.target_type = 'topic' AND lh.target_id = ` + alias + `.id::text)
+                  OR (lh.target_type = 'user' AND lh.target_id = ` + alias + `.author_id::text))`
+}
+
+// postHeld is the condition that the post referenced as alias, its topic or
+// its author is under legal hold.
+func postHeld(alias string) string {
+	return `EXISTS (SELECT 1 FROM legal_holds lh WHERE
+                  (lh.target_type = 'topic' AND lh.target_id = ` + alias + `.topic_id::text)
+                  OR (lh.target_type = 'user' AND lh.target_id = ` + alias + `.author_id::text))`
+}
+
+// legalHoldsAPI serves GET and POST /api/admin/holds.
+func (h *Handlers) legalHoldsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		holds, err := h.db.WithContext(r.Context()).ListLegalHolds()
+		if err != nil {
+			log.Printf("Error listing legal holds: %v", err)
+			http.Error(w, "Failed to retrieve legal holds", http.StatusInternalServerError)
+			return
+		}
+		if holds == nil {
+			holds = []LegalHold{}
+		}
+		writeJSON(w, holds)
+		return
+	}
+	var req struct {
+		TargetType string `json:"target_type"`
+		TargetID   string `json:"target_id"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequestBody(w, err, "Invalid request body")
+		return
+	}
+	hold, status, msg := h.placeLegalHold(r, req.TargetType, req.TargetID, req.Reason)
+	if hold == nil {
+		http.Error(w, msg, status)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, hold)
+}
+
+// releaseLegalHoldAPI serves DELETE /api/admin/holds/{type}/{id}.
+func (h *Handlers) releaseLegalHoldAPI(w http.ResponseWriter, r *http.Request, targetType, targetID string) {
+	status, msg := h.releaseLegalHold(r, targetType, targetID)
+	if status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// holdUserForm serves POST /admin/users/{id}/hold.
+func (h *Handlers) holdUserForm(w http.ResponseWriter, r *http.Request, userID string) {
+	if hold, status, msg := h.placeLegalHold(r, HoldTargetUser, userID, r.FormValue("reason")); hold == nil {
+		http.Error(w, msg, status)
+		return
+	}
+	http.Redirect(w, r, "/admin/users/"+userID, http.StatusSeeOther)
+}
+
+// releaseUserHoldForm serves POST /admin/users/{id}/release-hold.
+func (h *Handlers) releaseUserHoldForm(w http.ResponseWriter, r *http.Request, userID string) {
+	if status, msg := h.releaseLegalHold(r, HoldTargetUser, userID); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+	http.Redirect(w, r, "/admin/users/"+userID, http.StatusSeeOther)
+}
+
+// placeLegalHold checks and records a new hold. On failure it returns a nil
+// hold with the status and message to answer with.
+func (h *Handlers) placeLegalHold(r *http.Request, targetType, targetID, reason string) (*LegalHold, int, string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, http.StatusBadRequest, "A reason is required"
+	}
+	id, err := uuid.Parse(targetID)
+	if err != nil {
+		return nil, http.StatusNotFound, "Unknown target"
+	}
+	db := h.db.WithContext(r.Context())
+	switch targetType {
+	case HoldTargetUser:
+		if _, err := db.GetUserByIDIncludeDeleted(id.String()); err != nil {
+			return nil, http.StatusNotFound, "Unknown user"
+		}
+	case HoldTargetTopic:
+		if _, err := db.GetTopicIncludeDeleted(id); err != nil {
+			return nil, http.StatusNotFound, "Unknown topic"
+		}
+	default:
+		return nil, http.StatusBadRequest, `target_type must be "user" or "topic"`
+	}
+
+	hold := &LegalHold{TargetType: targetType, TargetID: id.String(), Reason: reason}
+	if staff != nil {
+		hold.PlacedByID = staff.ID
+		hold.PlacedBy = staff.Handle
+	}
+	created, err := db.PlaceLegalHold(hold)
+	if err != nil {
+		log.Printf("Error placing legal hold: %v", err)
+		return nil, http.StatusInternalServerError, "Failed to place legal hold"
+	}
+	if !created {
+		return nil, http.StatusConflict, "Already under legal hold"
+	}
+	h.audit(staff, "hold.place", targetType, hold.TargetID, map[string]string{"reason": reason})
+	return hold, http.StatusCreated, ""
+}
+
+func (h *Handlers) releaseLegalHold(r *http.Request, targetType, targetID string) (int, string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	id, err := uuid.Parse(targetID)
+	if err != nil {
+		return http.StatusNotFound, "No such legal hold"
+	}
+	hold, err := h.db.WithContext(r.Context()).ReleaseLegalHold(targetType, id.String())
+	if err != nil {
+		log.Printf("Error releasing legal hold: %v", err)
+		return http.StatusInternalServerError, "Failed to release legal hold"
+	}
+	if hold == nil {
+		return http.StatusNotFound, "No such legal hold"
+	}
+	h.audit(staff, "hold.release", targetType, hold.TargetID, map[string]string{
+		"reason":    hold.Reason,
+		"placed_by": hold.PlacedBy,
+		"placed_at": hold.PlacedAt.UTC().Format(time.RFC3339),
+	})
+	return http.StatusOK, ""
+}
+
+// --- Legal Hold Database Functions ---
+
+const legalHoldColumns = `target_type, target_id, reason, placed_by_id, placed_by, placed_at`
+
+func scanLegalHold(row pgx.Row) (*LegalHold, error) {
+	var hold LegalHold
+	var placedByID *string
+	if err := row.Scan(&hold.TargetType, &hold.TargetID, &hold.Reason, &placedByID, &hold.PlacedBy, &hold.PlacedAt); err != nil {
+		return nil, err
+	}
+	if placedByID != nil {
+		hold.PlacedByID = *placedByID
+	}
+	return &hold, nil
+}
+
+// PlaceLegalHold records hold, reporting false if the target was already held.
+func (d *Database) PlaceLegalHold(hold *LegalHold) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var placedByID *string
+	if hold.PlacedByID != "" {
+		placedByID = &hold.PlacedByID
+	}
+	query := `INSERT INTO legal_holds (target_type, target_id, reason, placed_by_id, placed_by)
+              VALUES ($1, $2, $3, $4, $5)
+              ON CONFLICT (target_type, target_id) DO NOTHING
+              RETURNING placed_at`
+	err := d.pool.QueryRow(ctx, query, hold.TargetType, hold.TargetID, hold.Reason, placedByID, hold.PlacedBy).Scan(&hold.PlacedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReleaseLegalHold removes a hold and returns it, or nil if there was none.
+func (d *Database) ReleaseLegalHold(targetType, targetID string) (*LegalHold, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `DELETE FROM legal_holds WHERE target_type = $1 AND target_id = $2 RETURNING ` + legalHoldColumns
+	hold, err := scanLegalHold(d.pool.QueryRow(ctx, query, targetType, targetID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return hold, err
+}
+
+// GetLegalHold returns the hold on a target, or nil if it isn't held.
+func (d *Database) GetLegalHold(targetType, targetID string) (*LegalHold, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT ` + legalHoldColumns + ` FROM legal_holds WHERE target_type = $1 AND target_id = $2`
+	hold, err := scanLegalHold(d.pool.QueryRow(ctx, query, targetType, targetID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return hold, err
+}
+
+// ListLegalHolds returns every active hold, newest first.
+func (d *Database) ListLegalHolds() ([]LegalHold, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.pool.Query(ctx, `SELECT `+legalHoldColumns+` FROM legal_holds ORDER BY placed_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var holds []LegalHold
+	for rows.Next() {
+		hold, err := scanLegalHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, *hold)
+	}
+	return holds, rows.Err()
+}
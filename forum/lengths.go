@@ -0,0 +1,54 @@
+// forum/lengths.go
+package forum
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// checkLengthBounds validates the FORUM_<name>_MIN_LENGTH and
+// FORUM_<name>_MAX_LENGTH settings: something must be required, and the
+// maximum, if set, can't be below the minimum.
+func checkLengthBounds(name string, min, max int) error {
+	if min < 1 {
+		return fmt.Errorf("invalid FORUM_%s_MIN_LENGTH %d: want at least 1", name, min)
+	}
+	if max != 0 && max < min {
+		return fmt.Errorf("invalid FORUM_%s_MAX_LENGTH %d: want 0 or at least FORUM_%[1]s_MIN_LENGTH (%d)", name, max, min)
+	}
+	return nil
+}
+
+// lengthProblem describes what is wrong with the length of s, to follow the
+// field's name, or returns "" if it is between min and max characters.
+func lengthProblem(s string, min, max int) string {
+	n := utf8.RuneCountInString(strings.TrimSpace(s))
+	switch {
+	case n == 0:
+		return "is required"
+	case n < min:
+		return "must be at least " + characters(min)
+	case max > 0 && utf8.RuneCountInString(s) > max:
+		return "must be at most " + characters(max)
+	}
+	return ""
+}
+
+func characters(n int) string {
+	if n == 1 {
+		return "1 character"
+	}
+	return strconv.Itoa(n) + " characters"
+}
+
+// titleProblem and bodyProblem apply the configured limits to a topic title
+// and a post body; see lengthProblem.
+func (h *Handlers) titleProblem(title string) string {
+	return lengthProblem(title, h.config.TitleMinLength, h.config.TitleMaxLength)
+}
+
+func (h *Handlers) bodyProblem(body string) string {
+	return lengthProblem(body, h.config.BodyMinLength, h.config.BodyMaxLength)
+}
@@ -0,0 +1,57 @@
+// forum/limits.go
+package forum
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// bodyLimit picks the size limit for a request body from its content type.
+// Batch writes and user imports carry many items and get their own, larger limit.
+func (h *Handlers) bodyLimit(r *http.Request) int64 {
+	if r.URL.Path == batchPath || r.URL.Path == importPath {
+		return h.config.MaxBatchBytes
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		return h.config.MaxJSONBytes
+	case "multipart/form-data":
+		return h.config.MaxUploadBytes
+	default:
+		return h.config.MaxFormBytes
+	}
+}
+
+// LimitRequestBody caps every request body so a single client can't exhaust
+// memory with an oversized post. Handlers see the cap as a read error, which
+// badRequestBody turns into a 413.
+func (h *Handlers) LimitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit := h.bodyLimit(r); limit > 0 {
+			if r.ContentLength > limit {
+				tooLarge(w, limit)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// badRequestBody reports a failure to read or decode the request body,
+// answering 413 when the body exceeded its limit and 400 with message otherwise.
+func badRequestBody(w http.ResponseWriter, err error, message string) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		tooLarge(w, maxErr.Limit)
+		return
+	}
+	http.Error(w, message, http.StatusBadRequest)
+}
+
+func tooLarge(w http.ResponseWriter, limit int64) {
+	http.Error(w, fmt.Sprintf("Request body too large: the limit is %d KB", limit/1024), http.StatusRequestEntityTooLarge)
+}
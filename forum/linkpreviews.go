@@ -0,0 +1,388 @@
+// forum/linkpreviews.go
+package forum
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Link preview limits. Only the start of a page is read, which is where
+// its metadata lives.
+const (
+	maxPreviewsPerPost   = 3
+	maxPreviewBytes      = 512 << 10
+	maxPreviewRedirects  = 3
+	maxPreviewTitle      = 200
+	maxPreviewDesc       = 300
+	previewFetchTimeout  = 10 * time.Second
+	previewDialTimeout   = 5 * time.Second
+	previewHeaderTimeout = 5 * time.Second
+)
+
+// LinkPreview is what was found at URL when it was fetched. A page that
+// couldn't be fetched or has no title is remembered with an empty Title, so
+// it isn't fetched again until the preview expires, and shows no card.
+// Links resolved through an oEmbed provider name it as Provider, and those
+// shown as players have EmbedURL set; see embeds.go.
+type LinkPreview struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageURL    string    `json:"image_url"`
+	Provider    string    `json:"provider,omitempty"`
+	EmbedURL    string    `json:"embed_url,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// Host is the site the preview is from, shown on its card.
+func (p LinkPreview) Host() string {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// bareURL matches a URL on its own in a post body, not inside markup such
+// as BBCode's [url] tags.
+var bareURL = regexp.MustCompile(`(?:^|[\s(])(https?://[^\s<>"'\[\]]+)`)
+
+// bareURLs returns the distinct bare URLs in body, at most
+// maxPreviewsPerPost of them, in the order they appear.
+func bareURLs(body string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, m := range bareURL.FindAllStringSubmatch(body, -1) {
+		// Punctuation after a link usually belongs to the sentence.
+		raw := strings.TrimRight(m[1], ".,;:!?)")
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		urls = append(urls, raw)
+		if len(urls) == maxPreviewsPerPost {
+			break
+		}
+	}
+	return urls
+}
+
+// queueLinkPreviews asks the previewer for the pages body links to. The
+// queue is best effort: when it is full, links wait until the post is
+// edited or linked again.
+func (h *Handlers) queueLinkPreviews(body string) {
+	if !h.previewsOn() {
+		return
+	}
+	for _, u := range bareURLs(body) {
+		select {
+		case h.previewCh <- u:
+		default:
+			log.Printf("Link preview queue full, dropping %s", u)
+			return
+		}
+	}
+}
+
+// previewsOn reports whether links in posts are looked up at all: for
+// previews, for embeds, or both.
+func (h *Handlers) previewsOn() bool {
+	return h.config.LinkPreviews || h.config.Embeds
+}
+
+// showPreview returns p as it should be shown under a post, if at all.
+// Cards from oEmbed providers stand in for page previews, and players need
+// embeds to be on.
+func (h *Handlers) showPreview(p LinkPreview) (LinkPreview, bool) {
+	if !h.config.Embeds {
+		p.EmbedURL = ""
+	}
+	if p.Title == "" || (!h.config.LinkPreviews && p.EmbedURL == "") {
+		return p, false
+	}
+	return p, true
+}
+
+// attachPreviews fills in the cards for the live posts in fragments, which
+// were made from posts.
+func (h *Handlers) attachPreviews(posts []Post, fragments []PostFragment) {
+	if !h.previewsOn() {
+		return
+	}
+	links := make([][]string, len(posts))
+	var all []string
+	for i := range posts {
+		if posts[i].DeletedAt == nil {
+			links[i] = bareURLs(posts[i].Body)
+			all = append(all, links[i]...)
+		}
+	}
+	if len(all) == 0 {
+		return
+	}
+	previews, err := h.db.LinkPreviews(all)
+	if err != nil {
+		log.Printf("Error loading link previews: %v", err)
+		return
+	}
+	for i, urls := range links {
+		for _, u := range urls {
+			if p, ok := previews[u]; ok {
+				if p, ok := h.showPreview(p); ok {
+					fragments[i].Previews = append(fragments[i].Previews, p)
+				}
+			}
+		}
+	}
+}
+
+// StartLinkPreviewer fetches queued links one at a time, skipping those
+// with a fresh preview. With embeds on, links from an oEmbed provider are
+// resolved through it instead.
+func (h *Handlers) StartLinkPreviewer() {
+	if !h.previewsOn() {
+		log.Printf("Link previews are off; FORUM_LINK_PREVIEWS and FORUM_EMBEDS are false")
+		return
+	}
+	client := newPreviewClient()
+	for u := range h.previewCh {
+		// A fetched preview couldn't be saved.
+		if h.readOnly() {
+			continue
+		}
+		previews, err := h.db.LinkPreviews([]string{u})
+		if err != nil {
+			log.Printf("Error loading link preview: %v", err)
+			continue
+		}
+		var provider *embedProvider
+		if h.config.Embeds {
+			provider = embedProviderFor(u)
+		}
+		// A page preview cached before embeds were turned on is replaced.
+		if p, ok := previews[u]; ok && time.Since(p.FetchedAt) < h.config.LinkPreviewTTL && (provider == nil || p.Provider != "") {
+			continue
+		}
+		var p *LinkPreview
+		switch {
+		case provider != nil:
+			p, err = fetchEmbed(client, provider, u)
+		case h.config.LinkPreviews:
+			p, err = fetchPreview(client, u, h.config.SiteName)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Printf("Error fetching link preview for %s: %v", u, err)
+			p = &LinkPreview{URL: u}
+			if provider != nil {
+				p.Provider = provider.Name
+			}
+		}
+		if err := h.db.SaveLinkPreview(p); err != nil {
+			log.Printf("Error saving link preview: %v", err)
+		}
+	}
+}
+
+// errNonPublicAddress is returned for links to anything but the public
+// internet on the usual web ports.
+var errNonPublicAddress = errors.New("link preview: address is not public")
+
+// nonPublicPrefixes are ranges that pass netip's checks below but aren't
+// reachable on the public internet, or can be used to reach private ones.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// publicAddr reports whether ip is a public unicast address.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialPublic refuses connections to non-public addresses and ports. It runs
+// after DNS resolution, for every connection, so neither a hostname that
+// resolves to the forum's own network nor a redirect can get round it.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(ip) || (port != "80" && port != "443") {
+		return errNonPublicAddress
+	}
+	return nil
+}
+
+// newPreviewClient returns the client link previews are fetched with. It
+// ignores proxy settings, which would hide the real destination from
+// dialPublic.
+func newPreviewClient() *http.Client {
+	dialer := &net.Dialer{Timeout: previewDialTimeout, Control: dialPublic}
+	return &http.Client{
+		Timeout: previewFetchTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   previewDialTimeout,
+			ResponseHeaderTimeout: previewHeaderTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       time.Minute,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxPreviewRedirects {
+				return errors.New("link preview: too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errNonPublicAddress
+			}
+			return nil
+		},
+	}
+}
+
+// fetchPreview reads the title, description and image of the HTML page at
+// rawURL, preferring Open Graph metadata.
+func fetchPreview(client *http.Client, rawURL, siteName string) (*LinkPreview, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", siteName+" link preview")
+	req.Header.Set("Accept", "text/html")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("link preview: status %s", resp.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/html" {
+		return nil, fmt.Errorf("link preview: not a page (%q)", mt)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPreviewBytes))
+	if err != nil {
+		return nil, err
+	}
+	return parsePreview(rawURL, resp.Request.URL, string(page)), nil
+}
+
+var (
+	metaTag   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	titleTag  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	attribute = regexp.MustCompile(`(?s)([a-zA-Z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// parsePreview pulls the preview for rawURL out of page, which was served
+// from base after any redirects.
+func parsePreview(rawURL string, base *url.URL, page string) *LinkPreview {
+	meta := map[string]string{}
+	for _, tag := range metaTag.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, a := range attribute.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(a[1])] = a[2] + a[3] + a[4]
+		}
+		key := strings.ToLower(attrs["property"])
+		if key == "" {
+			key = strings.ToLower(attrs["name"])
+		}
+		if _, ok := meta[key]; key != "" && !ok {
+			meta[key] = attrs["content"]
+		}
+	}
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := cleanPreviewText(meta[k]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	p := &LinkPreview{URL: rawURL, FetchedAt: time.Now()}
+	p.Title = first("og:title", "twitter:title")
+	if p.Title == "" {
+		if m := titleTag.FindStringSubmatch(page); m != nil {
+			p.Title = cleanPreviewText(m[1])
+		}
+	}
+	p.Title = truncate(p.Title, maxPreviewTitle)
+	p.Description = truncate(first("og:description", "description", "twitter:description"), maxPreviewDesc)
+	if img := first("og:image", "twitter:image"); img != "" {
+		if u, err := base.Parse(img); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			p.ImageURL = u.String()
+		}
+	}
+	return p
+}
+
+// cleanPreviewText decodes entities in s and collapses its whitespace.
+func cleanPreviewText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// --- Link Preview Database Functions ---
+
+// LinkPreviews returns the stored previews for urls, keyed by URL. URLs
+// that were never fetched are missing.
+func (d *Database) LinkPreviews(urls []string) (map[string]LinkPreview, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.readQuery(ctx, `SELECT url, title, description, image_url, provider, embed_url, fetched_at
+                                   FROM link_previews WHERE url = ANY($1)`, urls)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	previews := make(map[string]LinkPreview, len(urls))
+	for rows.Next() {
+		var p LinkPreview
+		if err := rows.Scan(&p.URL, &p.Title, &p.Description, &p.ImageURL, &p.Provider, &p.EmbedURL, &p.FetchedAt); err != nil {
+			return nil, err
+		}
+		previews[p.URL] = p
+	}
+	return previews, rows.Err()
+}
+
+// SaveLinkPreview stores p, replacing any earlier preview of its URL.
+func (d *Database) SaveLinkPreview(p *LinkPreview) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO link_previews (url, title, description, image_url, provider, embed_url, fetched_at)
+              VALUES ($1, $2, $3, $4, $5, $6, NOW())
+              ON CONFLICT (url) DO UPDATE SET title = EXCLUDED.title, description = EXCLUDED.description,
+                  image_url = EXCLUDED.image_url, provider = EXCLUDED.provider, embed_url = EXCLUDED.embed_url,
+                  fetched_at = EXCLUDED.fetched_at`
+	_, err := d.pool.Exec(ctx, query, p.URL, p.Title, p.Description, p.ImageURL, p.Provider, p.EmbedURL)
+	return err
+}
@@ -0,0 +1,162 @@
+// forum/live.go
+package forum
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// typingInterval is the minimum time between typing events from one user in one topic.
+const typingInterval = 3 * time.Second
+
+// liveEvent is an ephemeral message pushed to everyone viewing a topic.
+type liveEvent struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// topicHub fans live events out to the open event streams of each topic.
+// Nothing that passes through it is persisted.
+type topicHub struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan liveEvent]struct{}
+	typing map[string]time.Time
+}
+
+func newTopicHub() *topicHub {
+	return &topicHub{
+		subs:   make(map[string]map[chan liveEvent]struct{}),
+		typing: make(map[string]time.Time),
+	}
+}
+
+// subscribe registers a listener for topicID. The returned func must be called
+// to release it.
+func (hub *topicHub) subscribe(topicID string) (chan liveEvent, func()) {
+	ch := make(chan liveEvent, 16)
+	hub.mu.Lock()
+	if hub.subs[topicID] == nil {
+		hub.subs[topicID] = make(map[chan liveEvent]struct{})
+	}
+	hub.subs[topicID][ch] = struct{}{}
+	hub.mu.Unlock()
+
+	return ch, func() {
+		hub.mu.Lock()
+		delete(hub.subs[topicID], ch)
+		if len(hub.subs[topicID]) == 0 {
+			delete(hub.subs, topicID)
+		}
+		hub.mu.Unlock()
+	}
+}
+
+// publish delivers ev to every listener of topicID. Slow listeners miss events
+// rather than blocking the sender.
+func (hub *topicHub) publish(topicID string, ev liveEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for ch := range hub.subs[topicID] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// allowTyping rate limits typing events per user and topic.
+func (hub *topicHub) allowTyping(topicID, userID string, now time.Time) bool {
+	key := topicID + ":" + userID
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if last, ok := hub.typing[key]; ok && now.Sub(last) < typingInterval {
+		return false
+	}
+	hub.typing[key] = now
+	// Drop stale entries so the map doesn't grow without bound.
+	for k, t := range hub.typing {
+		if now.Sub(t) > time.Minute {
+			delete(hub.typing, k)
+		}
+	}
+	return true
+}
+
+// streamTopicEvents serves GET /topics/{id}/events as a server-sent event stream.
+func (h *Handlers) streamTopicEvents(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("Error starting event stream: %v", err)
+		return
+	}
+
+	events, cancel := h.live.subscribe(topicID.String())
+	defer cancel()
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ev := <-events:
+			payload, err := json.Marshal(ev.Data)
+			if err != nil {
+				log.Printf("Error encoding live event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, payload)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// publishPost pushes the rendered post to everyone currently viewing its
+// topic, and queues previews of the pages it links to.
+func (h *Handlers) publishPost(post Post) {
+	h.queueLinkPreviews(post.Body)
+	var buf bytes.Buffer
+	// Viewers who are not logged in strip the reply controls client-side.
+	if err := h.templates.ExecuteTemplate(&buf, "post", PostFragment{Post: NewPostView(&post), CanReply: true}); err != nil {
+		log.Printf("Error rendering live post: %v", err)
+		return
+	}
+	h.live.publish(post.TopicID, liveEvent{
+		Type: "post",
+		Data: map[string]any{"id": post.ID, "author_id": post.AuthorID, "html": buf.String()},
+	})
+}
+
+// postTyping serves POST /topics/{id}/typing, telling other viewers a reply is being composed.
+func (h *Handlers) postTyping(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	user, ok := r.Context().Value(userContextKey).(*User)
+	if !ok || user == nil {
+		http.Error(w, "You must be logged in", http.StatusUnauthorized)
+		return
+	}
+	if !h.live.allowTyping(topicID.String(), user.ID, time.Now()) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	h.live.publish(topicID.String(), liveEvent{
+		Type: "typing",
+		Data: map[string]string{"user_id": user.ID, "handle": user.Handle},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
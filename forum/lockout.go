@@ -0,0 +1,145 @@
+// forum/lockout.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loginFailureKeys returns the login_failures keys a password attempt for
+// email from r counts against. Emails are counted whether or not they
+// belong to an account, so lockouts don't give away which do.
+func loginFailureKeys(r *http.Request, email string) (account, client string) {
+	return "email:" + strings.ToLower(strings.TrimSpace(email)), "ip:" + clientIP(r)
+}
+
+// lockoutDuration is how long password login locks after failures, given
+// the threshold for that kind of key: the base lockout at the threshold,
+// doubling with each failure past it, up to longest.
+func lockoutDuration(failures, threshold int, base, longest time.Duration) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	d := base
+	for i := threshold; i < failures && d < longest; i++ {
+		d *= 2
+	}
+	return min(d, longest)
+}
+
+// loginLockedFor returns how much longer password login for email from r
+// stays locked, or zero.
+func (h *Handlers) loginLockedFor(r *http.Request, email string) (time.Duration, error) {
+	account, client := loginFailureKeys(r, email)
+	until, err := h.db.LoginLockedUntil(account, client)
+	if err != nil || until == nil {
+		return 0, err
+	}
+	return max(time.Until(*until), 0), nil
+}
+
+// recordLoginFailure counts a wrong password for email from r and locks
+// password login once either count passes its threshold.
+func (h *Handlers) recordLoginFailure(r *http.Request, email string) {
+	account, client := loginFailureKeys(r, email)
+	for _, k := range []struct {
+		key, kind string
+		threshold int
+	}{
+		{account, "an email address", h.config.LoginLockoutThreshold},
+		{client, "a client address", h.config.LoginLockoutIPThreshold},
+	} {
+		if k.threshold <= 0 {
+			continue
+		}
+		failures, err := h.db.RecordLoginFailure(k.key, h.config.LoginLockoutMax)
+		if err != nil {
+			log.Printf("Error recording failed login: %v", err)
+			continue
+		}
+		lock := lockoutDuration(failures, k.threshold, h.config.LoginLockout, h.config.LoginLockoutMax)
+		if lock <= 0 {
+			continue
+		}
+		if err := h.db.SetLoginLock(k.key, time.Now().Add(lock)); err != nil {
+			log.Printf("Error locking login: %v", err)
+			continue
+		}
+		log.Printf("Password login locked for %v for %s after %d failures, the last from %s", lock, k.kind, failures, clientIP(r))
+	}
+}
+
+// clearLoginFailures forgets the failed passwords for email once it signs
+// in. Failures counted against the client address stand.
+func (h *Handlers) clearLoginFailures(r *http.Request, email string) {
+	account, _ := loginFailureKeys(r, email)
+	if err := h.db.ClearLoginFailures(account); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+}
+
+// refuseLockedLogin shows the login page with 429, saying when to try again.
+func (h *Handlers) refuseLockedLogin(w http.ResponseWriter, wait time.Duration) {
+	secs := max(int(math.Ceil(wait.Seconds())), 1)
+	when := fmt.Sprintf("%d seconds", secs)
+	if secs > 90 {
+		when = fmt.Sprintf("%d minutes", int(math.Ceil(wait.Minutes())))
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.WriteHeader(http.StatusTooManyRequests)
+	h.renderLogin(w, LoginViewData{Error: "Too many failed sign-in attempts. Please try again in " + when + "."})
+}
+
+// --- Login Failure Database Functions ---
+
+// LoginLockedUntil returns the latest lock among keys that hasn't ended, or
+// nil.
+func (d *Database) LoginLockedUntil(keys ...string) (*time.Time, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var until *time.Time
+	err := d.pool.QueryRow(ctx, `SELECT MAX(locked_until) FROM login_failures
+                                 WHERE key = ANY($1) AND locked_until > NOW()`, keys).Scan(&until)
+	return until, err
+}
+
+// RecordLoginFailure counts a failure against key and returns the count.
+// Counts start over once key has gone window without a failure, and keys
+// that have are cleared out.
+func (d *Database) RecordLoginFailure(key string, window time.Duration) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var failures int
+	err := d.pool.QueryRow(ctx, `WITH expired AS (
+                                     DELETE FROM login_failures
+                                     WHERE key <> $1 AND last_failure_at < NOW() - make_interval(secs => $2)
+                                 )
+                                 INSERT INTO login_failures (key, failures) VALUES ($1, 1)
+                                 ON CONFLICT (key) DO UPDATE SET
+                                     failures = CASE WHEN login_failures.last_failure_at < NOW() - make_interval(secs => $2)
+                                                     THEN 1 ELSE login_failures.failures + 1 END,
+                                     last_failure_at = NOW()
+                                 RETURNING failures`, key, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+// SetLoginLock locks password login for key until the given time.
+func (d *Database) SetLoginLock(key string, until time.Time) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE login_failures SET locked_until = $2 WHERE key = $1`, key, until)
+	return err
+}
+
+// ClearLoginFailures forgets the failures and any lock for key.
+func (d *Database) ClearLoginFailures(key string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM login_failures WHERE key = $1`, key)
+	return err
+}
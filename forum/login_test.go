@@ -0,0 +1,59 @@
+// forum/login_test.go
+package forum_test
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rexlx/volconvo/forum"
+	"github.com/rexlx/volconvo/forumtest"
+)
+
+// TestSignInRefusals checks that banned and pending accounts are turned
+// away with the same message however they sign in.
+func TestSignInRefusals(t *testing.T) {
+	e := forumtest.New(t, func(c *forum.Config) { c.MagicLinks = true })
+	banned := e.User()
+	if err := e.DB.BanUser(banned.ID, time.Now().Add(time.Hour), "spam"); err != nil {
+		t.Fatal(err)
+	}
+	pending := e.User(func(u *forum.User) { u.Pending = true })
+
+	password := func(u *forum.User) *http.Request {
+		return e.Form("/login", url.Values{"email": {u.Email}, "password": {forumtest.Password}})
+	}
+	magicLink := func(u *forum.User) *http.Request {
+		token := "link-" + u.ID
+		sum := sha256.Sum256([]byte(token))
+		if err := e.DB.SaveLoginLink(u.ID, sum[:], time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		return e.Request(http.MethodPost, "/login/link/"+token, nil)
+	}
+	tests := []struct {
+		name string
+		user *forum.User
+		req  func(*forum.User) *http.Request
+		want string
+	}{
+		{"Password/banned", banned, password, "Your account is banned"},
+		{"Password/pending", pending, password, "Your account is waiting for an admin to approve it."},
+		{"MagicLink/banned", banned, magicLink, "Your account is banned"},
+		{"MagicLink/pending", pending, magicLink, "Your account is waiting for an admin to approve it."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := e.Do(tt.req(tt.user))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want the login page; body:\n%s", rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("login page doesn't say %q:\n%s", tt.want, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// forum/magiclink.go
+package forum
+
+import (
+	"crypto/sha256"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// magicLinkNotice is shown whether or not the address has an account, so the
+// form can't be used to find out who is a member.
+const magicLinkNotice = "If there is an account for that address, we've emailed it a sign-in link."
+
+// LoginLinkViewData is the data structure for the page a sign-in link opens.
+type LoginLinkViewData struct {
+	Token string
+	Valid bool
+}
+
+// loginLinkHash is what the database keeps of a sign-in link's token, so a
+// leaked table can't be used to sign in.
+func loginLinkHash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// requestLoginLink serves POST /login/link, emailing a one-time sign-in link
+// to the account with the given address. Asking again replaces the previous
+// link.
+func (h *Handlers) requestLoginLink(w http.ResponseWriter, r *http.Request) {
+	if !h.config.MagicLinks {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	if msg := h.checkCaptcha(r); msg != "" {
+		h.showLoginPage(w, r, msg)
+		return
+	}
+	email := strings.TrimSpace(r.FormValue("email"))
+	user, err := h.db.GetUserByEmail(email)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		log.Printf("Sign-in link requested for unknown email from %s", clientIP(r))
+	case err != nil:
+		log.Printf("Error getting user by email: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	default:
+		if err := h.sendLoginLink(user); err != nil {
+			log.Printf("Error creating sign-in link: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	h.renderLogin(w, LoginViewData{Notice: magicLinkNotice})
+}
+
+// sendLoginLink stores a new sign-in link for user and emails it in the
+// background, so a slow mail server neither holds up the response nor hints
+// that the address belongs to an account.
+func (h *Handlers) sendLoginLink(user *User) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(h.config.MagicLinkTTL)
+	if err := h.db.SaveLoginLink(user.ID, loginLinkHash(token), expires); err != nil {
+		return err
+	}
+	mail, err := h.renderMail(MailLogin, user, MailLoginData{Link: "/login/link/" + token, Expires: expires.Format(dateTimeLayout)})
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := h.sendMail(mail); err != nil {
+			log.Printf("Error sending sign-in link: %v", err)
+		}
+	}()
+	return nil
+}
+
+// showLoginLink serves GET /login/link/{token}. It only asks the member to
+// confirm: mail scanners open links to check them, and that mustn't use the
+// link up.
+func (h *Handlers) showLoginLink(w http.ResponseWriter, r *http.Request) {
+	if !h.config.MagicLinks {
+		http.NotFound(w, r)
+		return
+	}
+	token := r.PathValue("token")
+	_, err := h.db.WithContext(r.Context()).LookupLoginLink(loginLinkHash(token))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error looking up sign-in link: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.templates.ExecuteTemplate(w, "login_link.html", LoginLinkViewData{Token: token, Valid: err == nil}); err != nil {
+		log.Printf("Error executing sign-in link template: %v", err)
+	}
+}
+
+// useLoginLink serves POST /login/link/{token}, using the link up and
+// starting a session as a password login would.
+func (h *Handlers) useLoginLink(w http.ResponseWriter, r *http.Request) {
+	if !h.config.MagicLinks {
+		http.NotFound(w, r)
+		return
+	}
+	var user *User
+	userID, err := h.db.ConsumeLoginLink(loginLinkHash(r.PathValue("token")))
+	if err == nil {
+		user, err = h.db.GetUserByID(userID)
+	}
+	if errors.Is(err, ErrNotFound) {
+		h.showLoginPage(w, r, "That sign-in link has expired or was already used. Please ask for a new one.")
+		return
+	}
+	if err == nil {
+		err = h.signIn(r, user, false, "magic_link")
+	}
+	var refusal loginRefusal
+	if errors.As(err, &refusal) {
+		h.showLoginPage(w, r, string(refusal))
+		return
+	}
+	if err != nil {
+		log.Printf("Error signing in with link: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user.PasswordResetRequired {
+		http.Redirect(w, r, "/settings#password", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/topics", http.StatusSeeOther)
+}
+
+// --- Sign-in Link Database Functions ---
+
+// SaveLoginLink stores a sign-in link for the user, replacing any they had,
+// and clears out expired ones.
+func (d *Database) SaveLoginLink(userID string, hash []byte, expiresAt time.Time) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `WITH cleared AS (
+                                    DELETE FROM login_links WHERE user_id = $1 OR expires_at < NOW()
+                                )
+                                INSERT INTO login_links (hash, user_id, expires_at) VALUES ($2, $1, $3)`,
+		userID, hash, expiresAt)
+	return err
+}
+
+// LookupLoginLink returns the user a live sign-in link is for, or
+// ErrNotFound, without using it up.
+func (d *Database) LookupLoginLink(hash []byte) (string, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var userID string
+	err := d.pool.QueryRow(ctx, `SELECT user_id FROM login_links WHERE hash = $1 AND expires_at > NOW()`, hash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return userID, err
+}
+
+// ConsumeLoginLink deletes a sign-in link and returns the user it was for,
+// or ErrNotFound if it was unknown or had expired.
+func (d *Database) ConsumeLoginLink(hash []byte) (string, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var userID string
+	var expiresAt time.Time
+	err := d.pool.QueryRow(ctx, `DELETE FROM login_links WHERE hash = $1 RETURNING user_id, expires_at`, hash).Scan(&userID, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !expiresAt.After(time.Now())) {
+		return "", ErrNotFound
+	}
+	return userID, err
+}
@@ -0,0 +1,337 @@
+// forum/mail.go
+package forum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Messages the forum sends by email. Each has a <name>.txt template, which
+// also defines the "subject", and a <name>.html template in
+// Config.MailTemplates.
+const (
+	MailVerify       = "verify"
+	MailReset        = "reset"
+	MailDigest       = "digest"
+	MailNotification = "notification"
+	MailLogin        = "login"
+)
+
+// mailNames lists the messages LoadMailTemplates requires.
+var mailNames = []string{MailVerify, MailReset, MailDigest, MailNotification, MailLogin}
+
+// Mail is a rendered email, ready to hand to whatever delivers it.
+type Mail struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// MailData is what every mail template is executed with. Data holds the
+// message's own fields, one of the Mail*Data types below.
+type MailData struct {
+	Site    string
+	BaseURL string
+	Handle  string
+	Data    any
+}
+
+// MailVerifyData is the data for MailVerify.
+type MailVerifyData struct {
+	Link    string
+	Expires string
+}
+
+// MailResetData is the data for MailReset.
+type MailResetData struct {
+	Link    string
+	Expires string
+}
+
+// MailDigestData is the data for MailDigest.
+type MailDigestData struct {
+	Since  string
+	Topics []MailDigestTopic
+}
+
+// MailDigestTopic is a topic listed in a digest.
+type MailDigestTopic struct {
+	Title string
+	Link  string
+	Posts int
+}
+
+// MailNotificationData is the data for MailNotification.
+type MailNotificationData struct {
+	Message string
+	Link    string
+}
+
+// MailLoginData is the data for MailLogin.
+type MailLoginData struct {
+	Link    string
+	Expires string
+}
+
+// MailTemplates renders the forum's emails from a directory of templates:
+//
+//	layout.txt, layout.html    the header and footer around every message;
+//	                           they include the message with {{template "body" .}}
+//	<name>.txt, <name>.html    a message, defining "body" and, in .txt, "subject"
+//	<locale>/...               the same files for a locale, e.g. de/ or pt-BR/
+//
+// A locale only needs the files it translates. Any part it lacks falls back
+// to the base language, so pt-BR to pt, and then to the top-level files.
+type MailTemplates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+	// Locales are the locale directories found, sorted.
+	Locales []string
+}
+
+// mailKey names a message part in a locale; "" is the default locale.
+func mailKey(locale, name string) string {
+	return locale + "/" + name
+}
+
+// LoadMailTemplates parses the templates in dir. It fails if a message or
+// layout is missing from the top level, or any template doesn't parse.
+func LoadMailTemplates(dir string) (*MailTemplates, error) {
+	m := &MailTemplates{text: map[string]*texttemplate.Template{}, html: map[string]*htmltemplate.Template{}}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading mail templates: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			m.Locales = append(m.Locales, e.Name())
+		}
+	}
+	slices.Sort(m.Locales)
+	for _, locale := range append([]string{""}, m.Locales...) {
+		for _, name := range mailNames {
+			if err := m.parse(dir, locale, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, name := range mailNames {
+		if m.text[mailKey("", name)] == nil || m.html[mailKey("", name)] == nil {
+			return nil, fmt.Errorf("mail template %q needs both %s.txt and %s.html in %s", name, name, name, dir)
+		}
+	}
+	return m, nil
+}
+
+// parse loads the locale's parts of the named message, each wrapped in the
+// closest layout for the locale.
+func (m *MailTemplates) parse(dir, locale, name string) error {
+	for _, ext := range []string{".txt", ".html"} {
+		path := filepath.Join(dir, locale, name+ext)
+		body, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		layoutPath, err := m.layout(dir, locale, ext)
+		if err != nil {
+			return err
+		}
+		layout, err := os.ReadFile(layoutPath)
+		if err != nil {
+			return fmt.Errorf("mail templates need a layout%s: %w", ext, err)
+		}
+		key := mailKey(locale, name)
+		if ext == ".txt" {
+			t, err := texttemplate.New("layout").Parse(string(layout))
+			if err == nil {
+				_, err = t.New(name).Parse(string(body))
+			}
+			if err != nil {
+				return fmt.Errorf("parsing %s: %w", path, err)
+			}
+			m.text[key] = t
+		} else {
+			t, err := htmltemplate.New("layout").Parse(string(layout))
+			if err == nil {
+				_, err = t.New(name).Parse(string(body))
+			}
+			if err != nil {
+				return fmt.Errorf("parsing %s: %w", path, err)
+			}
+			m.html[key] = t
+		}
+	}
+	return nil
+}
+
+// layout returns the path of the layout a locale's parts use: the locale's
+// own, its base language's, or the top-level one.
+func (m *MailTemplates) layout(dir, locale, ext string) (string, error) {
+	for _, l := range localeChain(locale) {
+		path := filepath.Join(dir, l, "layout"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "layout"+ext), nil
+}
+
+// localeChain returns the locales to try for locale, most specific first:
+// "pt-BR" gives pt-BR, pt and the default "".
+func localeChain(locale string) []string {
+	var chain []string
+	if locale != "" {
+		chain = append(chain, locale)
+		if base, _, ok := strings.Cut(locale, "-"); ok {
+			chain = append(chain, base)
+		}
+	}
+	return append(chain, "")
+}
+
+// Render executes the named message for a locale. Unknown locales use the
+// default templates.
+func (m *MailTemplates) Render(name, locale string, data MailData) (*Mail, error) {
+	var text *texttemplate.Template
+	var html *htmltemplate.Template
+	for _, l := range localeChain(locale) {
+		if text == nil {
+			text = m.text[mailKey(l, name)]
+		}
+		if html == nil {
+			html = m.html[mailKey(l, name)]
+		}
+	}
+	if text == nil || html == nil {
+		return nil, fmt.Errorf("no mail template %q", name)
+	}
+	var subject, body, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("rendering %s subject: %w", name, err)
+	}
+	if err := text.ExecuteTemplate(&body, "layout", data); err != nil {
+		return nil, fmt.Errorf("rendering %s text: %w", name, err)
+	}
+	if err := html.ExecuteTemplate(&htmlBody, "layout", data); err != nil {
+		return nil, fmt.Errorf("rendering %s HTML: %w", name, err)
+	}
+	return &Mail{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
+
+// renderMail renders a message to user in Config.MailLocale. Code that
+// sends email should build it here rather than from ad-hoc strings.
+func (h *Handlers) renderMail(name string, to *User, data any) (*Mail, error) {
+	mail, err := h.mail.Render(name, h.config.MailLocale, h.mailData(to.Handle, data))
+	if err != nil {
+		return nil, err
+	}
+	mail.To = to.Email
+	return mail, nil
+}
+
+func (h *Handlers) mailData(handle string, data any) MailData {
+	return MailData{Site: h.config.SiteName, BaseURL: strings.TrimSuffix(h.config.BaseURL, "/"), Handle: handle, Data: data}
+}
+
+// mailSamples is the made-up data the admin preview renders each message
+// with.
+func mailSamples() map[string]any {
+	expires := time.Now().Add(24 * time.Hour).Format(dateTimeLayout)
+	return map[string]any{
+		MailVerify: MailVerifyData{Link: "/verify?token=sample", Expires: expires},
+		MailReset:  MailResetData{Link: "/reset?token=sample", Expires: expires},
+		MailDigest: MailDigestData{
+			Since: time.Now().Add(-7 * 24 * time.Hour).Format(dateLayout),
+			Topics: []MailDigestTopic{
+				{Title: "Welcome to the forum", Link: "/topics/sample-1", Posts: 12},
+				{Title: "What are you working on this week?", Link: "/topics/sample-2", Posts: 3},
+			},
+		},
+		MailNotification: MailNotificationData{Message: "sample replied to your topic", Link: "/topics/sample-1"},
+		MailLogin:        MailLoginData{Link: "/login/link/sample", Expires: expires},
+	}
+}
+
+// MailPreview is a message as the admin preview page lists it.
+type MailPreview struct {
+	Name    string
+	Subject string
+	Error   string
+}
+
+// MailViewData is the data structure for the mail template preview page.
+type MailViewData struct {
+	User     *Viewer
+	Locale   string
+	Locales  []string
+	Messages []MailPreview
+}
+
+// showMailTemplates serves GET /admin/mail, each message's subject in the
+// chosen locale with links to preview its parts.
+func (h *Handlers) showMailTemplates(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	locale := r.URL.Query().Get("locale")
+	samples := mailSamples()
+	data := MailViewData{User: NewViewer(user), Locale: locale, Locales: h.mail.Locales}
+	for _, name := range mailNames {
+		preview := MailPreview{Name: name}
+		if mail, err := h.mail.Render(name, locale, h.mailData(user.Handle, samples[name])); err != nil {
+			preview.Error = err.Error()
+		} else {
+			preview.Subject = mail.Subject
+		}
+		data.Messages = append(data.Messages, preview)
+	}
+	if err := h.templates.ExecuteTemplate(w, "admin_mail.html", data); err != nil {
+		log.Printf("Error executing mail template: %v", err)
+	}
+}
+
+// previewMail serves GET /admin/mail/{name}/{part}, the message's "text" or
+// "html" part rendered with sample data for the "locale" query value. HTML
+// is sandboxed so a template can't run script in the admin's session.
+func (h *Handlers) previewMail(w http.ResponseWriter, r *http.Request, name, part string) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	sample, ok := mailSamples()[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	mail, err := h.mail.Render(name, r.URL.Query().Get("locale"), h.mailData(user.Handle, sample))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch part {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Subject: %s\n\n%s", mail.Subject, mail.Text)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Write([]byte(mail.HTML))
+	default:
+		http.NotFound(w, r)
+	}
+}
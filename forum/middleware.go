@@ -0,0 +1,258 @@
+// forum/middleware.go
+package forum
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Middleware wraps a handler with behaviour shared by a group of routes.
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps h in mws, the first being the outermost.
+func chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// routeGroup registers routes that share a middleware stack, so what guards a
+// route is stated once for the group rather than inside each handler.
+type routeGroup struct {
+	h   *Handlers
+	mux *http.ServeMux
+	mws []Middleware
+}
+
+// with returns a group that runs mws after the group's own middleware.
+func (g routeGroup) with(mws ...Middleware) routeGroup {
+	g.mws = append(append([]Middleware(nil), g.mws...), mws...)
+	return g
+}
+
+// page registers a browser route.
+func (g routeGroup) page(pattern string, fn http.HandlerFunc) {
+	g.mux.Handle(pattern, chain(fn, g.mws...))
+}
+
+// api registers a JSON route under every API version; see handleAPI.
+func (g routeGroup) api(path string, fn http.HandlerFunc, legacy bool) {
+	g.h.handleAPI(g.mux, path, chain(fn, g.mws...), legacy)
+}
+
+// topicRoute adapts a handler for a /topics/{id} route, passing it the parsed
+// topic ID. IDs that aren't UUIDs are not found.
+func topicRoute(fn func(http.ResponseWriter, *http.Request, uuid.UUID)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fn(w, r, id)
+	}
+}
+
+// postRoute adapts a handler for a /posts/{id} route, passing it the parsed
+// post ID.
+func postRoute(fn func(http.ResponseWriter, *http.Request, int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fn(w, r, id)
+	}
+}
+
+// requireLogin sends visitors without a session to the login page.
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _ := r.Context().Value(userContextKey).(*User); user == nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAPIUser answers API requests without a session or key with a 401.
+func requireAPIUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _ := r.Context().Value(userContextKey).(*User); user == nil {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin limits a route to admins. It goes after requireLogin or
+// requireAPIUser, which deal with anonymous requests.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _ := r.Context().Value(userContextKey).(*User); user == nil || !user.Admin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin rejects state-changing requests that a browser made on behalf of
+// another site, which is how CSRF works. Browsers say where a request came
+// from in Sec-Fetch-Site or, if older, Origin; clients that send neither,
+// such as scripts using an API key, aren't browsers and aren't affected.
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+			if site != "same-origin" && site != "none" {
+				http.Error(w, "Cross-site request refused", http.StatusForbidden)
+				return
+			}
+		} else if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "Cross-site request refused", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimiter counts requests per key in one-minute windows.
+type rateLimiter struct {
+	perMinute int
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{perMinute: perMinute, windows: map[string]*rateWindow{}}
+}
+
+// allow counts a request for key and reports whether it is within the
+// limit, and if not, how long until the window resets.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	win, ok := l.windows[key]
+	if !ok || now.Sub(win.start) >= time.Minute {
+		win = &rateWindow{start: now}
+		l.windows[key] = win
+	}
+	win.count++
+	if len(l.windows) > 10000 {
+		// Drop finished windows so the map doesn't grow without bound.
+		for k, v := range l.windows {
+			if now.Sub(v.start) >= time.Minute {
+				delete(l.windows, k)
+			}
+		}
+	}
+	return win.count <= l.perMinute, win.start.Add(time.Minute).Sub(now)
+}
+
+// rateLimit allows each client address perMinute requests a minute to the
+// routes it guards. Zero disables it. Each call makes a separate budget.
+func (h *Handlers) rateLimit(perMinute int) Middleware {
+	if perMinute <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	limiter := newRateLimiter(perMinute)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, retry := limiter.allow(clientIP(r)); !ok {
+				slowDown(w, retry, "Too many requests.")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// trafficLimit caps requests to every route behind ValidateSessionToken:
+// AnonymousRateLimit a minute per client address for visitors, and
+// MemberRateLimit a minute per account for members, so members behind a
+// shared address don't use up each other's budget. Zero disables either.
+func (h *Handlers) trafficLimit() Middleware {
+	anonymous := newRateLimiter(h.config.AnonymousRateLimit)
+	members := newRateLimiter(h.config.MemberRateLimit)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter, key := anonymous, clientIP(r)
+			if user, _ := r.Context().Value(userContextKey).(*User); user != nil {
+				limiter, key = members, user.ID
+			}
+			if limiter.perMinute > 0 {
+				if ok, retry := limiter.allow(key); !ok {
+					slowDown(w, retry, "Too many requests.")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// statusRecorder remembers the status a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the real writer, which event
+// streams need to flush.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// logRequests logs each request's method, path, status and duration when
+// Config.LogRequests is set.
+func (h *Handlers) logRequests(next http.Handler) http.Handler {
+	if !h.config.LogRequests {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		log.Printf("%s %s %d %s %s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond), clientIP(r))
+	})
+}
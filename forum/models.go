@@ -3,6 +3,8 @@ package forum
 
 import (
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Topic now includes the ID of the user who created it, as a string.
@@ -12,15 +14,64 @@ type Topic struct {
 	Tags      []string  `json:"tags" db:"tags"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	AuthorID  string    `json:"author_id" db:"author_id"` // Changed to string
+	// ReplyCount is the number of visible posts, maintained on write.
+	ReplyCount int `json:"reply_count" db:"reply_count"`
+	// ViewCount counts visits to the topic page; see countTopicView.
+	ViewCount int64 `json:"view_count" db:"view_count"`
+	// LastPostAt and LastPostAuthor describe the newest visible post,
+	// maintained alongside ReplyCount. LastPostAt is nil while there is none.
+	LastPostAt     *time.Time `json:"last_post_at,omitempty" db:"last_post_at"`
+	LastPostAuthor string     `json:"last_post_author,omitempty" db:"last_post_author"`
+	// SolutionPostID is the accepted answer, if the topic is solved; see
+	// solutions.go.
+	SolutionPostID *int64 `json:"solution_post_id,omitempty" db:"solution_post_id"`
+	// Version increases with every edit; see concurrency.go.
+	Version int `json:"version" db:"version"`
+	// DeletedAt is set when the topic is soft-deleted; see softdelete.go.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// NewTopicID returns an ID for a new topic. New IDs are UUIDv7, so they sort
+// by creation time; topics created before the switch keep their random v4
+// IDs, so code that needs creation order should still sort on created_at.
+func NewTopicID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.New().String()
+	}
+	return id.String()
 }
 
 // Post now includes the author's ID and parent post ID, using string for UUIDs.
 type Post struct {
-	ID           int64     `json:"id" db:"id"`
-	TopicID      string    `json:"topic_id" db:"topic_id"` // Changed to string
-	Author       string    `json:"author" db:"author"`
-	Body         string    `json:"body" db:"body"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	AuthorID     string    `json:"author_id" db:"author_id"` // Changed to string
-	ParentPostID *int64    `json:"parent_post_id" db:"parent_post_id"`
+	ID           int64      `json:"id" db:"id"`
+	TopicID      string     `json:"topic_id" db:"topic_id"` // Changed to string
+	Author       string     `json:"author" db:"author"`
+	Body         string     `json:"body" db:"body"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	AuthorID     string     `json:"author_id" db:"author_id"` // Changed to string
+	ParentPostID *int64     `json:"parent_post_id" db:"parent_post_id"`
+	Wiki         bool       `json:"wiki" db:"wiki"`
+	UpdatedAt    *time.Time `json:"updated_at" db:"updated_at"`
+	State        string     `json:"state" db:"state"`
+	Version      int        `json:"version" db:"version"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// Post states. Only visible posts are shown in topics; the others wait in the
+// moderation queue.
+const (
+	PostVisible = "visible"
+	PostHeld    = "held"
+	PostHidden  = "hidden"
+)
+
+// PostRevision is one saved version of a post's body, along with who wrote it.
+type PostRevision struct {
+	ID        int64     `json:"id" db:"id"`
+	PostID    int64     `json:"post_id" db:"post_id"`
+	EditorID  string    `json:"editor_id" db:"editor_id"`
+	Editor    string    `json:"editor" db:"editor"`
+	Body      string    `json:"body" db:"body"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
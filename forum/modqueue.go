@@ -0,0 +1,342 @@
+// forum/modqueue.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Moderation queue item kinds.
+const (
+	QueueAppeal        = "appeal"
+	QueueReport        = "report"
+	QueueModeratedPost = "moderated_post"
+	QueueSignup        = "signup"
+)
+
+// pendingMessage is shown to people whose signup hasn't been approved.
+const pendingMessage = "Your account is waiting for an admin to approve it."
+
+// QueueItem is something waiting for a moderator to look at it.
+type QueueItem struct {
+	ID          int64      `json:"id" db:"id"`
+	Kind        string     `json:"kind" db:"kind"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	SubjectType string     `json:"subject_type" db:"subject_type"`
+	SubjectID   string     `json:"subject_id" db:"subject_id"`
+	Body        string     `json:"body" db:"body"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ResolvedBy  *string    `json:"resolved_by" db:"resolved_by"`
+	ResolvedAt  *time.Time `json:"resolved_at" db:"resolved_at"`
+}
+
+// QueueViewData is the data structure for the moderation queue page.
+type QueueViewData struct {
+	User     *Viewer
+	Items    []QueueRow
+	Outcomes []string
+}
+
+// QueueRow is a queue item as the moderation queue shows it. For a report,
+// Reported is the author of the reported post, with the staff notes on them
+// newest first; it is nil for other items and for posts by guests.
+type QueueRow struct {
+	QueueItem
+	Reported *ReportedUser
+}
+
+// ReportedUser is the member a report is about.
+type ReportedUser struct {
+	ID     string
+	Handle string
+	Notes  []UserNote
+}
+
+// showModQueue renders the open moderation queue items for admins.
+func (h *Handlers) showModQueue(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	items, err := h.db.ListOpenQueueItems()
+	if err != nil {
+		log.Printf("Error listing moderation queue: %v", err)
+		http.Error(w, "Failed to retrieve moderation queue", http.StatusInternalServerError)
+		return
+	}
+	data := QueueViewData{User: NewViewer(user), Items: h.queueRows(items), Outcomes: ReportOutcomes}
+	if err := h.templates.ExecuteTemplate(w, "modqueue.html", data); err != nil {
+		log.Printf("Error executing moderation queue template: %v", err)
+	}
+}
+
+// queueRows adds to each report the reported member and the notes on them,
+// loading each post and each member's notes once. The queue still shows an
+// item whose details fail to load, without them.
+func (h *Handlers) queueRows(items []QueueItem) []QueueRow {
+	rows := make([]QueueRow, len(items))
+	authors := map[string]*ReportedUser{} // by post ID
+	notes := map[string][]UserNote{}      // by user ID
+	for i, item := range items {
+		rows[i].QueueItem = item
+		if item.Kind != QueueReport || item.SubjectType != "post" {
+			continue
+		}
+		reported, ok := authors[item.SubjectID]
+		if !ok {
+			postID, err := strconv.ParseInt(item.SubjectID, 10, 64)
+			if err != nil {
+				continue
+			}
+			post, err := h.db.GetPostIncludeDeleted(postID)
+			if err != nil {
+				log.Printf("Error loading reported post: %v", err)
+				continue
+			}
+			if !post.ByGuest() {
+				reported = &ReportedUser{ID: post.AuthorID, Handle: post.Author}
+			}
+			authors[item.SubjectID] = reported
+		}
+		if reported == nil {
+			continue
+		}
+		if _, ok := notes[reported.ID]; !ok {
+			list, err := h.db.GetUserNotes(reported.ID)
+			if err != nil {
+				log.Printf("Error loading user notes: %v", err)
+			}
+			notes[reported.ID] = list
+		}
+		reported.Notes = notes[reported.ID]
+		rows[i].Reported = reported
+	}
+	return rows
+}
+
+// resolveQueueItem serves POST /admin/queue/{id}/resolve. Report items need
+// an "outcome", which is recorded on every open report of the post.
+func (h *Handlers) resolveQueueItem(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	item, err := h.db.GetQueueItem(id)
+	if err != nil {
+		writeError(w, err, "queue item")
+		return
+	}
+	switch item.Kind {
+	case QueueReport:
+		h.resolveReportItem(w, r, item)
+		return
+	case QueueSignup:
+		h.rejectSignup(w, r, item)
+		return
+	}
+	resolved, err := h.db.ResolveQueueItem(id, staff.ID)
+	if err != nil {
+		log.Printf("Error resolving queue item: %v", err)
+		http.Error(w, "Failed to resolve item", http.StatusInternalServerError)
+		return
+	}
+	if !resolved {
+		http.NotFound(w, r)
+		return
+	}
+	h.audit(staff, "queue.resolve", "queue_item", idStr, nil)
+	http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+}
+
+// resolveReportItem records the outcome on the reported post's open reports
+// and closes every open report item for that post.
+func (h *Handlers) resolveReportItem(w http.ResponseWriter, r *http.Request, item *QueueItem) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	outcome := r.FormValue("outcome")
+	if !validOutcome(outcome) {
+		http.Error(w, "A valid outcome is required", http.StatusBadRequest)
+		return
+	}
+	postID, err := strconv.ParseInt(item.SubjectID, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	reports, err := h.db.ResolveReports(postID, outcome, staff.ID)
+	if err != nil {
+		log.Printf("Error resolving reports: %v", err)
+		http.Error(w, "Failed to resolve reports", http.StatusInternalServerError)
+		return
+	}
+	if err := h.db.ResolveQueueItemsForSubject(QueueReport, item.SubjectType, item.SubjectID, staff.ID); err != nil {
+		log.Printf("Error resolving queue items: %v", err)
+		http.Error(w, "Failed to resolve item", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "report.resolve", "post", item.SubjectID, map[string]string{
+		"outcome":    outcome,
+		"reports":    strconv.FormatInt(reports, 10),
+		"queue_item": strconv.FormatInt(item.ID, 10),
+	})
+	http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+}
+
+// approveQueueItem serves POST /admin/queue/{id}/approve, making the post an
+// item refers to visible again and resolving the item.
+func (h *Handlers) approveQueueItem(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	item, err := h.db.GetQueueItem(id)
+	if err != nil {
+		writeError(w, err, "queue item")
+		return
+	}
+	if item.Kind == QueueSignup {
+		h.approveSignup(w, r, item)
+		return
+	}
+	if item.SubjectType != "post" {
+		http.NotFound(w, r)
+		return
+	}
+	postID, err := strconv.ParseInt(item.SubjectID, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.SetPostState(postID, PostVisible); err != nil {
+		log.Printf("Error approving post: %v", err)
+		http.Error(w, "Failed to approve post", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.ResolveQueueItem(id, staff.ID); err != nil {
+		log.Printf("Error resolving queue item: %v", err)
+	}
+	h.audit(staff, "post.approve", "post", item.SubjectID, map[string]string{"queue_item": idStr})
+	http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+}
+
+// approveSignup lets a pending account sign in and resolves its item.
+func (h *Handlers) approveSignup(w http.ResponseWriter, r *http.Request, item *QueueItem) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := h.db.SetUserPending(item.SubjectID, false); err != nil {
+		log.Printf("Error approving signup: %v", err)
+		http.Error(w, "Failed to approve account", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.ResolveQueueItem(item.ID, staff.ID); err != nil {
+		log.Printf("Error resolving queue item: %v", err)
+	}
+	h.audit(staff, "user.approve", "user", item.SubjectID, map[string]string{"queue_item": strconv.FormatInt(item.ID, 10)})
+	http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+}
+
+// rejectSignup deletes a pending account and resolves its item. The email
+// address stays taken, as with any deleted account.
+func (h *Handlers) rejectSignup(w http.ResponseWriter, r *http.Request, item *QueueItem) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := h.db.DeleteUser(item.SubjectID); err != nil {
+		log.Printf("Error rejecting signup: %v", err)
+		http.Error(w, "Failed to reject account", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.ResolveQueueItem(item.ID, staff.ID); err != nil {
+		log.Printf("Error resolving queue item: %v", err)
+	}
+	h.audit(staff, "user.reject", "user", item.SubjectID, map[string]string{"queue_item": strconv.FormatInt(item.ID, 10)})
+	http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+}
+
+// --- Moderation Queue Database Functions ---
+
+func (d *Database) CreateQueueItem(item *QueueItem) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO mod_queue (kind, user_id, subject_type, subject_id, body)
+              VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	return d.pool.QueryRow(ctx, query,
+		item.Kind, item.UserID, item.SubjectType, item.SubjectID, item.Body,
+	).Scan(&item.ID, &item.CreatedAt)
+}
+
+func (d *Database) GetQueueItem(id int64) (*QueueItem, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var it QueueItem
+	query := `SELECT id, kind, user_id, subject_type, subject_id, body, created_at, resolved_by::text, resolved_at
+              FROM mod_queue WHERE id = $1`
+	err := d.pool.QueryRow(ctx, query, id).Scan(
+		&it.ID, &it.Kind, &it.UserID, &it.SubjectType, &it.SubjectID, &it.Body, &it.CreatedAt, &it.ResolvedBy, &it.ResolvedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// ListOpenQueueItems returns unresolved items, oldest first.
+func (d *Database) ListOpenQueueItems() ([]QueueItem, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT id, kind, user_id, subject_type, subject_id, body, created_at, resolved_by::text, resolved_at
+              FROM mod_queue
+              WHERE resolved_at IS NULL
+              ORDER BY created_at ASC`
+	rows, err := d.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []QueueItem
+	for rows.Next() {
+		var it QueueItem
+		if err := rows.Scan(&it.ID, &it.Kind, &it.UserID, &it.SubjectType, &it.SubjectID, &it.Body, &it.CreatedAt, &it.ResolvedBy, &it.ResolvedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// CountQueueItemsForSubject counts items of a kind about one subject, resolved or not.
+func (d *Database) CountQueueItemsForSubject(kind, subjectType, subjectID string) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var count int
+	query := `SELECT COUNT(*) FROM mod_queue WHERE kind = $1 AND subject_type = $2 AND subject_id = $3`
+	err := d.pool.QueryRow(ctx, query, kind, subjectType, subjectID).Scan(&count)
+	return count, err
+}
+
+// ResolveQueueItem marks an item handled, reporting whether it was still open.
+func (d *Database) ResolveQueueItem(id int64, resolverID string) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `UPDATE mod_queue SET resolved_by = $2, resolved_at = NOW() WHERE id = $1 AND resolved_at IS NULL`
+	tag, err := d.pool.Exec(ctx, query, id, resolverID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ResolveQueueItemsForSubject marks every open item of a kind about one subject handled.
+func (d *Database) ResolveQueueItemsForSubject(kind, subjectType, subjectID, resolverID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `UPDATE mod_queue SET resolved_by = $4, resolved_at = NOW()
+              WHERE kind = $1 AND subject_type = $2 AND subject_id = $3 AND resolved_at IS NULL`
+	_, err := d.pool.Exec(ctx, query, kind, subjectType, subjectID, resolverID)
+	return err
+}
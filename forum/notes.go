@@ -0,0 +1,119 @@
+// forum/notes.go
+package forum
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UserNote is a staff-only note attached to a user account.
+type UserNote struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	AuthorID  string    `json:"author_id" db:"author_id"`
+	Author    string    `json:"author" db:"author"`
+	Body      string    `json:"body" db:"body"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// addUserNote serves POST /admin/users/{id}/notes.
+func (h *Handlers) addUserNote(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	body := r.FormValue("body")
+	if body == "" {
+		http.Error(w, "Note body is required", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.db.GetUserByID(userID)
+	if err != nil {
+		writeError(w, err, "user")
+		return
+	}
+
+	note := UserNote{UserID: target.ID, AuthorID: staff.ID, Author: staff.Handle, Body: body}
+	if err := h.db.CreateUserNote(&note); err != nil {
+		log.Printf("Error creating user note: %v", err)
+		http.Error(w, "Failed to save note", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "user_note.create", "user", target.ID, map[string]string{
+		"note_id": strconv.FormatInt(note.ID, 10),
+	})
+
+	http.Redirect(w, r, "/admin/users/"+target.ID, http.StatusSeeOther)
+}
+
+// deleteUserNote serves POST /admin/users/{id}/notes/{noteID}/delete.
+func (h *Handlers) deleteUserNote(w http.ResponseWriter, r *http.Request, userID, noteIDStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	noteID, err := strconv.ParseInt(noteIDStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	deleted, err := h.db.DeleteUserNote(userID, noteID)
+	if err != nil {
+		log.Printf("Error deleting user note: %v", err)
+		http.Error(w, "Failed to delete note", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.NotFound(w, r)
+		return
+	}
+	h.audit(staff, "user_note.delete", "user", userID, map[string]string{
+		"note_id": noteIDStr,
+	})
+
+	http.Redirect(w, r, "/admin/users/"+userID, http.StatusSeeOther)
+}
+
+// --- User Note Database Functions ---
+
+func (d *Database) CreateUserNote(note *UserNote) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO user_notes (user_id, author_id, author, body) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	return d.pool.QueryRow(ctx, query, note.UserID, note.AuthorID, note.Author, note.Body).Scan(&note.ID, &note.CreatedAt)
+}
+
+// GetUserNotes returns the notes on a user, newest first.
+func (d *Database) GetUserNotes(userID string) ([]UserNote, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT id, user_id, author_id, author, body, created_at FROM user_notes
+              WHERE user_id = $1
+              ORDER BY created_at DESC`
+	rows, err := d.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notes []UserNote
+	for rows.Next() {
+		var n UserNote
+		if err := rows.Scan(&n.ID, &n.UserID, &n.AuthorID, &n.Author, &n.Body, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// DeleteUserNote removes a note, reporting whether it existed.
+func (d *Database) DeleteUserNote(userID string, noteID int64) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM user_notes WHERE id = $1 AND user_id = $2`, noteID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,372 @@
+// forum/oidc.go
+package forum
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/oauth2"
+)
+
+// Session keys holding an OpenID Connect login in progress.
+const (
+	oidcStateKey    = "oidc_state"
+	oidcNonceKey    = "oidc_nonce"
+	oidcVerifierKey = "oidc_verifier"
+)
+
+// maxHandleLength caps handles made from identity provider claims.
+const maxHandleLength = 32
+
+// OIDCConfig configures single sign-on through a generic OpenID Connect
+// provider. It is off unless Issuer is set. Password login keeps working
+// alongside it.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL, from which its endpoints and
+	// signing keys are discovered.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is this forum's callback, registered with the provider.
+	// It defaults to BaseURL + "/login/oidc/callback".
+	RedirectURL string
+	// Name labels the login button, e.g. "Okta".
+	Name   string
+	Scopes []string
+	// HandleClaim is the claim new members' handles are taken from, falling
+	// back to their name and then the local part of their email.
+	HandleClaim string
+	// AutoProvision creates an account for people the provider vouches for
+	// who don't have one yet. Without it only existing members, matched by
+	// verified email, can sign in this way.
+	AutoProvision bool
+}
+
+// Enabled reports whether single sign-on is configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// oidcClaims are the ID token claims the forum uses.
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// oidcClient discovers the provider on first use, so a provider that is
+// down at startup doesn't keep the forum from starting.
+type oidcClient struct {
+	cfg OIDCConfig
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func newOIDCClient(cfg Config) *oidcClient {
+	c := &oidcClient{cfg: cfg.OIDC}
+	if c.cfg.RedirectURL == "" {
+		c.cfg.RedirectURL = strings.TrimSuffix(cfg.BaseURL, "/") + "/login/oidc/callback"
+	}
+	return c
+}
+
+// setup returns the OAuth2 configuration and ID token verifier, discovering
+// the provider if that hasn't succeeded yet.
+func (c *oidcClient) setup(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.oauth != nil {
+		return c.oauth, c.verifier, nil
+	}
+	provider, err := oidc.NewProvider(ctx, c.cfg.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("discovering OpenID provider %s: %w", c.cfg.Issuer, err)
+	}
+	scopes := c.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	c.oauth = &oauth2.Config{
+		ClientID:     c.cfg.ClientID,
+		ClientSecret: c.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  c.cfg.RedirectURL,
+		Scopes:       scopes,
+	}
+	c.verifier = provider.Verifier(&oidc.Config{ClientID: c.cfg.ClientID})
+	return c.oauth, c.verifier, nil
+}
+
+// randomToken returns a URL-safe random string for OAuth2 state and nonces.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// startOIDCLogin serves GET /login/oidc, sending the browser to the
+// provider. State, nonce and a PKCE verifier are kept in the session for
+// the callback to check.
+func (h *Handlers) startOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	oauth, _, err := h.oidc.setup(r.Context())
+	if err != nil {
+		log.Printf("Error setting up single sign-on: %v", err)
+		h.showLoginPage(w, r, "Single sign-on is unavailable right now.")
+		return
+	}
+	state, err := randomToken()
+	var nonce string
+	if err == nil {
+		nonce, err = randomToken()
+	}
+	if err != nil {
+		log.Printf("Error generating single sign-on state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+	h.Session.Put(r.Context(), oidcStateKey, state)
+	h.Session.Put(r.Context(), oidcNonceKey, nonce)
+	h.Session.Put(r.Context(), oidcVerifierKey, verifier)
+	http.Redirect(w, r, oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), http.StatusFound)
+}
+
+// finishOIDCLogin serves GET /login/oidc/callback. The member is found by
+// the provider's subject, or else by verified email, in which case the
+// identity is linked to their account. Failing both, an account is created
+// if AutoProvision is on.
+func (h *Handlers) finishOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ctx := r.Context()
+	state := h.Session.PopString(ctx, oidcStateKey)
+	nonce := h.Session.PopString(ctx, oidcNonceKey)
+	verifier := h.Session.PopString(ctx, oidcVerifierKey)
+	q := r.URL.Query()
+	if msg := q.Get("error"); msg != "" {
+		log.Printf("Single sign-on refused from %s: %s %s", clientIP(r), msg, q.Get("error_description"))
+		h.showLoginPage(w, r, "Single sign-on was cancelled or refused.")
+		return
+	}
+	if state == "" || q.Get("state") != state {
+		h.showLoginPage(w, r, "Your single sign-on attempt expired. Please try again.")
+		return
+	}
+	oauth, idVerifier, err := h.oidc.setup(ctx)
+	if err != nil {
+		log.Printf("Error setting up single sign-on: %v", err)
+		h.showLoginPage(w, r, "Single sign-on is unavailable right now.")
+		return
+	}
+	token, err := oauth.Exchange(ctx, q.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		log.Printf("Error exchanging single sign-on code: %v", err)
+		h.showLoginPage(w, r, "Single sign-on failed. Please try again.")
+		return
+	}
+	rawID, ok := token.Extra("id_token").(string)
+	if !ok {
+		log.Printf("Single sign-on response from %s had no ID token", h.oidc.cfg.Issuer)
+		h.showLoginPage(w, r, "Single sign-on failed. Please try again.")
+		return
+	}
+	idToken, err := idVerifier.Verify(ctx, rawID)
+	if err == nil && idToken.Nonce != nonce {
+		err = errors.New("nonce mismatch")
+	}
+	if err != nil {
+		log.Printf("Invalid single sign-on ID token from %s: %v", clientIP(r), err)
+		h.showLoginPage(w, r, "Single sign-on failed. Please try again.")
+		return
+	}
+	var claims oidcClaims
+	var all map[string]any
+	err = idToken.Claims(&claims)
+	if err == nil {
+		err = idToken.Claims(&all)
+	}
+	if err != nil {
+		log.Printf("Error reading single sign-on claims: %v", err)
+		h.showLoginPage(w, r, "Single sign-on failed. Please try again.")
+		return
+	}
+	handle, _ := all[h.oidc.cfg.HandleClaim].(string)
+
+	user, err := h.oidcUser(idToken.Issuer, claims, handle)
+	if err != nil {
+		var msg oidcRefusal
+		if errors.As(err, &msg) {
+			h.showLoginPage(w, r, string(msg))
+			return
+		}
+		log.Printf("Error signing in with single sign-on: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.signIn(r, user, false, "oidc"); err != nil {
+		var refusal loginRefusal
+		if errors.As(err, &refusal) {
+			h.showLoginPage(w, r, string(refusal))
+			return
+		}
+		log.Printf("Error starting session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/topics", http.StatusSeeOther)
+}
+
+// oidcRefusal is a reason, fit to show, that a single sign-on was turned
+// away.
+type oidcRefusal string
+
+func (e oidcRefusal) Error() string { return string(e) }
+
+// oidcUser returns the account the provider's claims sign in to, linking or
+// creating it as needed.
+func (h *Handlers) oidcUser(issuer string, claims oidcClaims, handle string) (*User, error) {
+	user, err := h.db.GetUserByIdentity(issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, oidcRefusal("Your identity provider didn't share a verified email address, so we can't find your account.")
+	}
+
+	user, err = h.db.GetUserByEmailIncludeDeleted(claims.Email)
+	switch {
+	case err == nil && user.DeletedAt != nil:
+		return nil, oidcRefusal("The account for this email address was deleted.")
+	case err == nil:
+		if err := h.db.LinkIdentity(user.ID, issuer, claims.Subject); err != nil {
+			return nil, err
+		}
+		h.audit(user, "user.sso.link", "user", user.ID, map[string]string{"issuer": issuer})
+		return user, nil
+	case !errors.Is(err, ErrNotFound):
+		return nil, err
+	case !h.oidc.cfg.AutoProvision:
+		return nil, oidcRefusal("There is no account for " + claims.Email + ". Ask an administrator to create one.")
+	}
+
+	user, err = NewUser(claims.Email, false)
+	if err != nil {
+		return nil, err
+	}
+	user.Handle, err = h.freeHandle(handleFromClaims(handle, claims))
+	if err != nil {
+		return nil, err
+	}
+	// The account signs in through the provider. A random password keeps
+	// password login closed until the member sets one.
+	password, err := generateTemporaryPassword()
+	if err == nil {
+		user.Password, err = h.config.Password.Hash(password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := h.db.SaveUser(user); err != nil {
+		return nil, err
+	}
+	if err := h.db.LinkIdentity(user.ID, issuer, claims.Subject); err != nil {
+		return nil, err
+	}
+	h.audit(user, "user.sso.provision", "user", user.ID, map[string]string{"issuer": issuer, "email": user.Email})
+	return user, nil
+}
+
+// handleFromClaims picks a handle for a new member: the configured claim,
+// else their name, else their email's local part, keeping letters, digits,
+// '-', '_' and '.'.
+func handleFromClaims(claim string, claims oidcClaims) string {
+	local, _, _ := strings.Cut(claims.Email, "@")
+	for _, candidate := range []string{claim, claims.Name, local} {
+		handle := strings.Map(func(r rune) rune {
+			switch {
+			case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_', r == '.':
+				return r
+			case unicode.IsSpace(r):
+				return '_'
+			}
+			return -1
+		}, candidate)
+		if runes := []rune(handle); len(runes) > maxHandleLength {
+			handle = string(runes[:maxHandleLength])
+		}
+		if handle != "" {
+			return handle
+		}
+	}
+	return "member"
+}
+
+// freeHandle returns handle, or handle with a number added if a member
+// already uses it.
+func (h *Handlers) freeHandle(handle string) (string, error) {
+	candidate := handle
+	for i := 2; i <= 100; i++ {
+		_, err := h.db.GetUserByHandle(candidate)
+		if errors.Is(err, ErrNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = handle + strconv.Itoa(i)
+	}
+	return "", fmt.Errorf("no free handle like %q", handle)
+}
+
+// --- Identity Database Functions ---
+
+// GetUserByIdentity returns the live account linked to the provider's
+// subject, or ErrNotFound.
+func (d *Database) GetUserByIdentity(issuer, subject string) (*User, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var userID string
+	err := d.pool.QueryRow(ctx, `SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2`, issuer, subject).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.GetUserByID(userID)
+}
+
+// LinkIdentity records that the provider's subject signs in as the user.
+// Linking again is harmless.
+func (d *Database) LinkIdentity(userID, issuer, subject string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)
+                                 ON CONFLICT (issuer, subject) DO NOTHING`, issuer, subject, userID)
+	return err
+}
@@ -0,0 +1,55 @@
+// forum/pagination.go
+package forum
+
+import (
+	"net/url"
+	"slices"
+)
+
+// PageSizes are the page sizes members can pick in their settings.
+var PageSizes = []int{25, 50, 100}
+
+// paginationWindow is how many page numbers are linked either side of the
+// current page.
+const paginationWindow = 2
+
+// pageSizeFor returns the page size user picked, or PageSize for guests and
+// anyone who hasn't picked one.
+func pageSizeFor(user *User) int {
+	if user != nil && slices.Contains(PageSizes, user.PageSize) {
+		return user.PageSize
+	}
+	return PageSize
+}
+
+// pageLink returns path with query v, ready for a page parameter to be
+// appended.
+func pageLink(path string, v url.Values) string {
+	if len(v) == 0 {
+		return path + "?"
+	}
+	return path + "?" + v.Encode() + "&"
+}
+
+// newPagination returns the controls for page of a listing with total items
+// split into pages of pageSize. link comes from pageLink.
+func newPagination(page, total, pageSize int, link string) PaginationData {
+	totalPages := max((total+pageSize-1)/pageSize, 1)
+	p := PaginationData{
+		CurrentPage: page,
+		TotalPages:  totalPages,
+		NextPage:    page + 1,
+		PrevPage:    page - 1,
+		HasNext:     page < totalPages,
+		HasPrev:     page > 1,
+		Link:        link,
+	}
+	first := max(page-paginationWindow, 1)
+	last := min(page+paginationWindow, totalPages)
+	for n := first; n <= last; n++ {
+		p.Pages = append(p.Pages, n)
+	}
+	p.ShowFirst = first > 1
+	p.ShowLast = last < totalPages
+	return p
+}
@@ -0,0 +1,318 @@
+// forum/passkeys.go
+package forum
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Session keys holding a passkey ceremony in progress, as JSON
+// webauthn.SessionData.
+const (
+	passkeyRegistrationKey = "passkey_registration"
+	passkeyLoginKey        = "passkey_login"
+)
+
+// maxPasskeyName caps the label a member gives a passkey.
+const maxPasskeyName = 64
+
+// Passkey is a WebAuthn credential a member signs in with instead of a
+// password.
+type Passkey struct {
+	ID         []byte
+	UserID     string
+	Name       string
+	Credential webauthn.Credential
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// newWebAuthn sets up the relying party from BaseURL: passkeys are bound to
+// its host and only accepted from its origin.
+func newWebAuthn(cfg Config) (*webauthn.WebAuthn, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil || base.Hostname() == "" {
+		return nil, fmt.Errorf("passkeys need an absolute base URL, not %q", cfg.BaseURL)
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          base.Hostname(),
+		RPDisplayName: cfg.SiteName,
+		RPOrigins:     []string{base.Scheme + "://" + base.Host},
+	})
+}
+
+// passkeyUser is a member as the WebAuthn library sees them. The user
+// handle stored on the authenticator is the account ID.
+type passkeyUser struct {
+	user     *User
+	passkeys []Passkey
+}
+
+func (u passkeyUser) WebAuthnID() []byte          { return []byte(u.user.ID) }
+func (u passkeyUser) WebAuthnName() string        { return u.user.Email }
+func (u passkeyUser) WebAuthnDisplayName() string { return u.user.Handle }
+
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.passkeys))
+	for i, pk := range u.passkeys {
+		creds[i] = pk.Credential
+	}
+	return creds
+}
+
+// putCeremony and popCeremony keep a ceremony's session data between its
+// begin and finish requests. A ceremony can only be finished once.
+func (h *Handlers) putCeremony(r *http.Request, key string, session *webauthn.SessionData) error {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	h.Session.Put(r.Context(), key, string(b))
+	return nil
+}
+
+func (h *Handlers) popCeremony(r *http.Request, key string) (webauthn.SessionData, bool) {
+	var session webauthn.SessionData
+	raw := h.Session.PopString(r.Context(), key)
+	if raw == "" || json.Unmarshal([]byte(raw), &session) != nil {
+		return session, false
+	}
+	return session, true
+}
+
+// beginPasskeyRegistration serves POST /settings/passkeys/begin with the
+// options the browser passes to navigator.credentials.create. Passkeys
+// are discoverable, so signing in with one needs no email address.
+func (h *Handlers) beginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	passkeys, err := h.db.WithContext(r.Context()).ListPasskeys(user.ID)
+	if err != nil {
+		log.Printf("Error listing passkeys: %v", err)
+		http.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+	pu := passkeyUser{user: user, passkeys: passkeys}
+	creation, session, err := h.webauthn.BeginRegistration(pu,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(pu.WebAuthnCredentials()).CredentialDescriptors()))
+	if err == nil {
+		err = h.putCeremony(r, passkeyRegistrationKey, session)
+	}
+	if err != nil {
+		log.Printf("Error starting passkey registration: %v", err)
+		http.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, creation)
+}
+
+// finishPasskeyRegistration serves POST /settings/passkeys/finish?name=,
+// whose body is the browser's new credential.
+func (h *Handlers) finishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		name = "Passkey"
+	}
+	if len([]rune(name)) > maxPasskeyName {
+		http.Error(w, fmt.Sprintf("Passkey names can be at most %d characters", maxPasskeyName), http.StatusBadRequest)
+		return
+	}
+	session, ok := h.popCeremony(r, passkeyRegistrationKey)
+	if !ok {
+		http.Error(w, "Passkey registration expired. Please try again.", http.StatusBadRequest)
+		return
+	}
+	db := h.db.WithContext(r.Context())
+	passkeys, err := db.ListPasskeys(user.ID)
+	if err != nil {
+		log.Printf("Error listing passkeys: %v", err)
+		http.Error(w, "Failed to register passkey", http.StatusInternalServerError)
+		return
+	}
+	cred, err := h.webauthn.FinishRegistration(passkeyUser{user: user, passkeys: passkeys}, session, r)
+	if err != nil {
+		log.Printf("Passkey registration for user %s failed: %v", user.ID, passkeyErrorDetail(err))
+		http.Error(w, "Your passkey couldn't be registered.", http.StatusBadRequest)
+		return
+	}
+	if err := db.SavePasskey(&Passkey{ID: cred.ID, UserID: user.ID, Name: name, Credential: *cred}); err != nil {
+		log.Printf("Error saving passkey: %v", err)
+		http.Error(w, "Failed to register passkey", http.StatusInternalServerError)
+		return
+	}
+	h.audit(user, "user.passkey.add", "user", user.ID, map[string]string{"name": name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletePasskey serves POST /settings/passkeys/{id}/delete.
+func (h *Handlers) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	id, err := base64.RawURLEncoding.DecodeString(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.WithContext(r.Context()).DeletePasskey(user.ID, id); err != nil {
+		writeError(w, err, "passkey")
+		return
+	}
+	h.audit(user, "user.passkey.remove", "user", user.ID, map[string]string{"id": r.PathValue("id")})
+	http.Redirect(w, r, "/settings#passkeys", http.StatusSeeOther)
+}
+
+// beginPasskeyLogin serves POST /login/passkey/begin with the options the
+// browser passes to navigator.credentials.get. No account is named; the
+// authenticator offers the passkeys it holds for this forum.
+func (h *Handlers) beginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	assertion, session, err := h.webauthn.BeginDiscoverableLogin()
+	if err == nil {
+		err = h.putCeremony(r, passkeyLoginKey, session)
+	}
+	if err != nil {
+		log.Printf("Error starting passkey login: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, assertion)
+}
+
+// finishPasskeyLogin serves POST /login/passkey/finish, whose body is the
+// browser's assertion. On success the member gets the same session as a
+// password login and the response says where to go next.
+func (h *Handlers) finishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.popCeremony(r, passkeyLoginKey)
+	if !ok {
+		http.Error(w, "Your passkey sign-in expired. Please try again.", http.StatusBadRequest)
+		return
+	}
+	db := h.db.WithContext(r.Context())
+	var found passkeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err := db.GetUserByID(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		passkeys, err := db.ListPasskeys(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		found = passkeyUser{user: user, passkeys: passkeys}
+		return found, nil
+	}
+	_, cred, err := h.webauthn.FinishPasskeyLogin(handler, session, r)
+	if err == nil && cred.Authenticator.CloneWarning {
+		err = errors.New("signature counter went backwards; the authenticator may be cloned")
+	}
+	if err != nil {
+		log.Printf("Failed passkey login from %s: %v", clientIP(r), passkeyErrorDetail(err))
+		h.authEvent(r, found.user, AuthLoginFailed, "", map[string]string{"method": "passkey"})
+		http.Error(w, "That passkey wasn't accepted.", http.StatusUnauthorized)
+		return
+	}
+	if err := db.TouchPasskey(cred.ID, *cred, time.Now()); err != nil {
+		log.Printf("Error updating passkey: %v", err)
+	}
+	if err := h.signIn(r, found.user, false, "passkey"); err != nil {
+		var refusal loginRefusal
+		if errors.As(err, &refusal) {
+			http.Error(w, string(refusal), http.StatusForbidden)
+			return
+		}
+		log.Printf("Error starting session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	next := "/topics"
+	if found.user.PasswordResetRequired {
+		next = "/settings#password"
+	}
+	writeJSON(w, map[string]string{"redirect": next})
+}
+
+// passkeyErrorDetail adds the library's developer detail to err, which says
+// what actually failed, for the log.
+func passkeyErrorDetail(err error) string {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		return err.Error() + ": " + perr.DevInfo
+	}
+	return err.Error()
+}
+
+// --- Passkey Database Functions ---
+
+// ListPasskeys returns the user's passkeys, oldest first.
+func (d *Database) ListPasskeys(userID string) ([]Passkey, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.pool.Query(ctx, `SELECT id, user_id, name, credential, created_at, last_used_at
+                                    FROM passkeys WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var passkeys []Passkey
+	for rows.Next() {
+		var pk Passkey
+		var credJSON []byte
+		if err := rows.Scan(&pk.ID, &pk.UserID, &pk.Name, &credJSON, &pk.CreatedAt, &pk.LastUsedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(credJSON, &pk.Credential); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal passkey: %w", err)
+		}
+		passkeys = append(passkeys, pk)
+	}
+	return passkeys, rows.Err()
+}
+
+// SavePasskey stores a newly registered passkey.
+func (d *Database) SavePasskey(pk *Passkey) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	credJSON, err := json.Marshal(pk.Credential)
+	if err != nil {
+		return err
+	}
+	_, err = d.pool.Exec(ctx, `INSERT INTO passkeys (id, user_id, name, credential) VALUES ($1, $2, $3, $4)`,
+		pk.ID, pk.UserID, pk.Name, credJSON)
+	return err
+}
+
+// TouchPasskey records a sign-in with the passkey, keeping the credential's
+// updated signature counter.
+func (d *Database) TouchPasskey(id []byte, cred webauthn.Credential, at time.Time) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	credJSON, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	_, err = d.pool.Exec(ctx, `UPDATE passkeys SET credential = $2, last_used_at = $3 WHERE id = $1`, id, credJSON, at)
+	return err
+}
+
+// DeletePasskey removes one of the user's passkeys, or returns ErrNotFound.
+func (d *Database) DeletePasskey(userID string, id []byte) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM passkeys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// forum/passpolicy.go
+package forum
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// PasswordPolicy is what a new password must satisfy. It is checked when a
+// password is set, never when an existing one is verified.
+type PasswordPolicy struct {
+	MinLength int
+	// Denylist holds lower-cased passwords that are rejected outright.
+	Denylist map[string]bool
+	// RejectSimilar rejects passwords built from the account's handle or email.
+	RejectSimilar bool
+	// MinClasses is how many kinds of character a password must mix:
+	// lower-case letters, upper-case letters, digits and anything else. Zero
+	// and one don't require any mix.
+	MinClasses int
+}
+
+// Password policy violation codes, stable for API clients.
+const (
+	PasswordTooShort = "too_short"
+	PasswordCommon   = "common"
+	PasswordSimilar  = "similar"
+	PasswordSimple   = "too_simple"
+)
+
+// PasswordViolation is one reason a password was rejected.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every way a password fell short of the policy.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation `json:"violations"`
+}
+
+func (e *PasswordPolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return "password rejected: " + strings.Join(msgs, "; ")
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// DefaultPasswordPolicy returns the policy used when nothing is overridden.
+func DefaultPasswordPolicy() PasswordPolicy {
+	denylist := map[string]bool{}
+	readDenylist(strings.NewReader(commonPasswordList), denylist)
+	return PasswordPolicy{MinLength: 10, Denylist: denylist, RejectSimilar: true}
+}
+
+// LoadDenylist adds the passwords listed in path, one per line, to the policy.
+func (p *PasswordPolicy) LoadDenylist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if p.Denylist == nil {
+		p.Denylist = map[string]bool{}
+	}
+	return readDenylist(f, p.Denylist)
+}
+
+func readDenylist(r io.Reader, denylist map[string]bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		denylist[strings.ToLower(line)] = true
+	}
+	return scanner.Err()
+}
+
+// Validate checks password for an account with the given email and handle,
+// returning a *PasswordPolicyError if it is not acceptable.
+func (p PasswordPolicy) Validate(password, email, handle string) error {
+	var violations []PasswordViolation
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Use at least %d characters.", p.MinLength),
+		})
+	}
+	if p.MinClasses > 1 && characterClasses(password) < p.MinClasses {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordSimple,
+			Message: fmt.Sprintf("Mix at least %d of lower-case letters, upper-case letters, digits and symbols.", min(p.MinClasses, 4)),
+		})
+	}
+	lower := strings.ToLower(password)
+	if p.Denylist[lower] {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordCommon,
+			Message: "This password is too common. Choose something harder to guess.",
+		})
+	}
+	if p.RejectSimilar && similarToIdentity(lower, email, handle) {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordSimilar,
+			Message: "Your password can't contain your handle or email address.",
+		})
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// characterClasses counts the kinds of character in password: lower-case
+// letters, upper-case letters, digits and anything else.
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// similarToIdentity reports whether the lower-cased password contains, or is
+// contained in, the handle, the email, or the email's local part.
+func similarToIdentity(password, email, handle string) bool {
+	email = strings.ToLower(email)
+	local, _, _ := strings.Cut(email, "@")
+	for _, ident := range []string{strings.ToLower(handle), email, local} {
+		if len(ident) < 3 {
+			continue
+		}
+		if strings.Contains(password, ident) || strings.Contains(ident, password) {
+			return true
+		}
+	}
+	return false
+}
+
+// writePolicyError answers an API request with the policy violations as JSON.
+func writePolicyError(w http.ResponseWriter, err *PasswordPolicyError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(struct {
+		Error      string              `json:"error"`
+		Violations []PasswordViolation `json:"violations"`
+	}{"Password does not meet the password policy", err.Violations})
+}
@@ -0,0 +1,269 @@
+// forum/password.go
+package forum
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// PasswordParams selects the algorithm and cost used for new password hashes.
+// The parameters are encoded into every hash, so they can change without
+// invalidating existing passwords.
+type PasswordParams struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32 // KiB
+	Argon2Threads uint8
+	Argon2KeyLen  uint32
+	// PepperID names the pepper mixed into new hashes; empty disables peppering.
+	// Peppers holds every pepper still needed to verify existing hashes.
+	PepperID string
+	Peppers  map[string][]byte
+	// Policy is enforced by User.SetPassword.
+	Policy PasswordPolicy
+}
+
+// DefaultPasswordParams returns the hashing settings used when nothing is overridden.
+func DefaultPasswordParams() PasswordParams {
+	return PasswordParams{
+		Algorithm:     HashBcrypt,
+		BcryptCost:    12,
+		Argon2Time:    3,
+		Argon2Memory:  64 * 1024,
+		Argon2Threads: 2,
+		Argon2KeyLen:  32,
+		Policy:        DefaultPasswordPolicy(),
+	}
+}
+
+// Validate reports settings that would fail when the first password is
+// hashed, so they can be caught at startup instead.
+func (p PasswordParams) Validate() error {
+	switch p.Algorithm {
+	case HashBcrypt, "":
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost %d is outside %d-%d", p.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashArgon2id:
+		if p.Argon2Time == 0 || p.Argon2Memory == 0 || p.Argon2Threads == 0 || p.Argon2KeyLen == 0 {
+			return errors.New("argon2id time, memory, threads and key length must all be positive")
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q", p.Algorithm)
+	}
+	return nil
+}
+
+const argon2SaltLen = 16
+
+var errUnknownHash = errors.New("unrecognised password hash format")
+
+// pepperPrefix tags a hash made from a peppered password, followed by the
+// pepper's ID: "$pep$<id>$2a$12$...".
+const pepperPrefix = "$pep$"
+
+// Hash encodes password with the configured algorithm, peppered if a pepper is set.
+func (p PasswordParams) Hash(password string) (string, error) {
+	if p.PepperID == "" {
+		return p.hash(password)
+	}
+	pepper, ok := p.Peppers[p.PepperID]
+	if !ok {
+		return "", fmt.Errorf("password pepper %q is not loaded", p.PepperID)
+	}
+	inner, err := p.hash(applyPepper(pepper, password))
+	if err != nil {
+		return "", err
+	}
+	return pepperPrefix + p.PepperID + inner, nil
+}
+
+// applyPepper mixes the pepper in with HMAC-SHA256. The base64 digest stays
+// well under bcrypt's 72-byte input limit.
+func applyPepper(pepper []byte, password string) string {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// splitPepper separates a pepper tag from the hash it wraps.
+func splitPepper(encoded string) (pepperID, inner string) {
+	if !strings.HasPrefix(encoded, pepperPrefix) {
+		return "", encoded
+	}
+	rest := encoded[len(pepperPrefix):]
+	i := strings.IndexByte(rest, '$')
+	if i < 0 {
+		return "", encoded
+	}
+	return rest[:i], rest[i:]
+}
+
+func (p PasswordParams) hash(password string) (string, error) {
+	switch p.Algorithm {
+	case HashArgon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, p.Argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Argon2Memory, p.Argon2Time, p.Argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	case HashBcrypt, "":
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	default:
+		return "", fmt.Errorf("unknown password hash algorithm %q", p.Algorithm)
+	}
+}
+
+// NeedsRehash reports whether encoded was made with different settings or a
+// different pepper than p.
+func (p PasswordParams) NeedsRehash(encoded string) bool {
+	pepperID, encoded := splitPepper(encoded)
+	if pepperID != p.PepperID {
+		return true
+	}
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		if p.Algorithm != HashArgon2id {
+			return true
+		}
+		h, err := decodeArgon2id(encoded)
+		if err != nil {
+			return true
+		}
+		return h.time != p.Argon2Time || h.memory != p.Argon2Memory ||
+			h.threads != p.Argon2Threads || uint32(len(h.key)) != p.Argon2KeyLen
+	case strings.HasPrefix(encoded, "$2"):
+		if p.Algorithm != HashBcrypt && p.Algorithm != "" {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != p.BcryptCost
+	default:
+		return true
+	}
+}
+
+// Verify checks password against an encoded hash of either algorithm, using
+// whichever pepper the hash was tagged with.
+func (p PasswordParams) Verify(encoded, password string) (bool, error) {
+	pepperID, encoded := splitPepper(encoded)
+	if pepperID != "" {
+		pepper, ok := p.Peppers[pepperID]
+		if !ok {
+			return false, fmt.Errorf("password pepper %q is not loaded", pepperID)
+		}
+		password = applyPepper(pepper, password)
+	}
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		h, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+		return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, errUnknownHash
+	}
+}
+
+type argon2idHash struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// decodeArgon2id parses a PHC-format "$argon2id$v=19$m=..,t=..,p=..$salt$key" string.
+func decodeArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return nil, errUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errUnknownHash
+	}
+	var h argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, errUnknownHash
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errUnknownHash
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, errUnknownHash
+	}
+	return &h, nil
+}
+
+// LoadPeppers reads a pepper file of "id secret" lines, ignoring blanks and
+// "#" comments. The first entry is the current pepper; later entries are kept
+// so hashes made with them still verify until they are re-hashed on login.
+func LoadPeppers(path string) (currentID string, peppers map[string][]byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	peppers = map[string][]byte{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, secret, ok := strings.Cut(line, " ")
+		secret = strings.TrimSpace(secret)
+		if !ok || secret == "" || strings.Contains(id, "$") {
+			return "", nil, fmt.Errorf("%s: malformed pepper line %q", path, id)
+		}
+		if currentID == "" {
+			currentID = id
+		}
+		peppers[id] = []byte(secret)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+	if currentID == "" {
+		return "", nil, fmt.Errorf("%s: no peppers found", path)
+	}
+	return currentID, peppers, nil
+}
@@ -0,0 +1,278 @@
+// forum/posts.go
+package forum
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// postPath is the permalink of a post; see showPost.
+func postPath(id int64) string {
+	return "/posts/" + strconv.FormatInt(id, 10)
+}
+
+// topicPostLink links to a post on its topic page, where before posts come
+// ahead of it, pageSize to a page.
+func topicPostLink(topicID string, postID int64, before, pageSize int) string {
+	link := "/topics/" + topicID
+	if page := before/pageSize + 1; page > 1 {
+		link += "?page=" + strconv.Itoa(page)
+	}
+	return link + "#post-" + strconv.FormatInt(postID, 10)
+}
+
+// canEditPost reports whether user may change the body of post. Authors and
+// admins can always edit; wiki posts are also open to trusted members.
+func (h *Handlers) canEditPost(user *User, post *Post, trust int) bool {
+	if user == nil {
+		return false
+	}
+	if user.Admin || user.ID == post.AuthorID {
+		return true
+	}
+	return post.Wiki && trust >= h.config.WikiEditTrustLevel
+}
+
+// canToggleWiki reports whether user may turn wiki mode on or off for post.
+func canToggleWiki(user *User, post *Post) bool {
+	return user != nil && (user.Admin || user.ID == post.AuthorID)
+}
+
+// canDeletePost reports whether user may delete post: its author or an admin.
+func canDeletePost(user *User, post *Post) bool {
+	return user != nil && (user.Admin || user.ID == post.AuthorID)
+}
+
+// postFragments prepares posts in topic for the "post" template as seen by
+// user. Deleted posts become placeholders; only admins still see their
+// bodies, so they can decide whether to restore them.
+func (h *Handlers) postFragments(topic *Topic, posts []Post, user *User, trust int) []PostFragment {
+	fragments := make([]PostFragment, 0, len(posts))
+	for i := range posts {
+		if posts[i].DeletedAt != nil {
+			view := NewPostView(&posts[i])
+			canRestore := user != nil && user.Admin
+			if !canRestore {
+				view.Body = ""
+			}
+			fragments = append(fragments, PostFragment{Post: view, CanRestore: canRestore})
+			continue
+		}
+		fragments = append(fragments, PostFragment{
+			Post:          NewPostView(&posts[i]),
+			CanReply:      user != nil,
+			CanEdit:       h.canEditPost(user, &posts[i], trust),
+			CanToggleWiki: canToggleWiki(user, &posts[i]),
+			CanSeeHistory: posts[i].UpdatedAt != nil && h.canSeeHistory(user),
+			CanFlag:       user != nil && user.ID != posts[i].AuthorID,
+			CanDelete:     canDeletePost(user, &posts[i]),
+			CanBookmark:   user != nil,
+			Solution:      isSolution(topic, &posts[i]),
+			CanSolve:      canManageTopic(user, topic) && posts[i].State == PostVisible,
+		})
+	}
+	h.attachPreviews(posts, fragments)
+	return fragments
+}
+
+// editPost saves a new body for a post, recording the revision.
+func (h *Handlers) editPost(w http.ResponseWriter, r *http.Request, postID int64) {
+	user, ok := r.Context().Value(userContextKey).(*User)
+	if !ok || user == nil {
+		http.Error(w, "You must be logged in to edit", http.StatusUnauthorized)
+		return
+	}
+	if h.rejectSuspended(w, r, user) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	body := r.FormValue("body")
+	version, err := formVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	post, err := h.db.GetPost(postID)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+
+	trust, err := h.db.TrustLevel(user)
+	if err != nil {
+		log.Printf("Error computing trust level: %v", err)
+	}
+	if !h.canEditPost(user, post, trust) {
+		http.Error(w, "You are not allowed to edit this post", http.StatusForbidden)
+		return
+	}
+	if problem := h.bodyProblem(body); problem != "" {
+		h.rejectPostEdit(w, r, post, &TopicForm{
+			Error:   "Post body " + problem + ".",
+			Action:  postPath(post.ID) + "/edit",
+			Heading: "Editing post",
+			Version: r.FormValue("version"),
+			Body:    body,
+		})
+		return
+	}
+
+	if err := h.db.UpdatePostBody(post, body, user, version); err != nil {
+		if errors.Is(err, ErrConflict) {
+			writeConflict(w, "post")
+			return
+		}
+		log.Printf("Error updating post: %v", err)
+		http.Error(w, "Failed to update post", http.StatusInternalServerError)
+		return
+	}
+	h.enforceRules(RuleEventPostEdit, post)
+	if post.State == PostVisible {
+		h.queueLinkPreviews(body)
+	}
+
+	http.Redirect(w, r, "/topics/"+post.TopicID, http.StatusSeeOther)
+}
+
+// rejectPostEdit shows the rejected edit form again on the topic page where
+// post appears.
+func (h *Handlers) rejectPostEdit(w http.ResponseWriter, r *http.Request, post *Post, form *TopicForm) {
+	topic, err := h.db.GetTopic(uuid.MustParse(post.TopicID))
+	if err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	user, _ := r.Context().Value(userContextKey).(*User)
+	before, err := h.db.PostPosition(post)
+	if err != nil {
+		log.Printf("Error finding post position: %v", err)
+	}
+	h.showTopicPage(w, r, topic, before/pageSizeFor(user)+1, form)
+}
+
+// setPostWiki turns wiki mode on or off based on the "wiki" form value.
+func (h *Handlers) setPostWiki(w http.ResponseWriter, r *http.Request, postID int64) {
+	user, ok := r.Context().Value(userContextKey).(*User)
+	if !ok || user == nil {
+		http.Error(w, "You must be logged in", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+
+	post, err := h.db.GetPost(postID)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+	if !canToggleWiki(user, post) {
+		http.Error(w, "Only the author or an admin can change wiki mode", http.StatusForbidden)
+		return
+	}
+
+	if err := h.db.SetPostWiki(post.ID, r.FormValue("wiki") == "true"); err != nil {
+		log.Printf("Error updating wiki flag: %v", err)
+		http.Error(w, "Failed to update post", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/topics/"+post.TopicID, http.StatusSeeOther)
+}
+
+// deletePost serves POST /posts/{id}/delete. The post is soft-deleted and
+// leaves a "post removed" placeholder in its topic.
+func (h *Handlers) deletePost(w http.ResponseWriter, r *http.Request, postID int64) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	post, err := h.db.GetPost(postID)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+	if !canDeletePost(user, post) {
+		http.Error(w, "Only the author or an admin can delete this post", http.StatusForbidden)
+		return
+	}
+	if err := h.db.DeletePost(post.ID); err != nil {
+		log.Printf("Error deleting post: %v", err)
+		http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+		return
+	}
+	h.audit(user, "post.delete", "post", strconv.FormatInt(post.ID, 10), map[string]string{
+		"topic_id":  post.TopicID,
+		"author_id": post.AuthorID,
+	})
+	http.Redirect(w, r, "/topics/"+post.TopicID, http.StatusSeeOther)
+}
+
+// restorePost serves POST /posts/{id}/restore, undoing a delete. It is
+// limited to admins.
+func (h *Handlers) restorePost(w http.ResponseWriter, r *http.Request, postID int64) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	post, err := h.db.GetPostIncludeDeleted(postID)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+	if err := h.db.RestorePost(post.ID); err != nil {
+		log.Printf("Error restoring post: %v", err)
+		http.Error(w, "Failed to restore post", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "post.restore", "post", strconv.FormatInt(post.ID, 10), map[string]string{
+		"topic_id":  post.TopicID,
+		"author_id": post.AuthorID,
+	})
+	http.Redirect(w, r, "/topics/"+post.TopicID, http.StatusSeeOther)
+}
+
+// showPost serves GET /posts/{id}, redirecting to the topic page the post
+// is on, with the viewer's page size, scrolled to the post.
+func (h *Handlers) showPost(w http.ResponseWriter, r *http.Request, postID int64) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	db := h.db.WithContext(r.Context())
+	post, err := db.GetPost(postID)
+	if err == nil && post.State != PostVisible {
+		// Held and hidden posts aren't on the topic page.
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+	before, err := db.PostPosition(post)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+	http.Redirect(w, r, topicPostLink(post.TopicID, post.ID, before, pageSizeFor(user)), http.StatusFound)
+}
+
+// previewPost serves POST /preview, returning the form's body rendered as
+// it would be shown in a topic, as an HTML fragment. Guests may use it when
+// they may post.
+func (h *Handlers) previewPost(w http.ResponseWriter, r *http.Request) {
+	if user, _ := r.Context().Value(userContextKey).(*User); user == nil && !h.config.GuestPosting {
+		http.Error(w, "You must be logged in to preview", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, string(h.postBody(r.FormValue("body"))))
+}
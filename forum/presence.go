@@ -0,0 +1,176 @@
+// forum/presence.go
+package forum
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// presenceTracker remembers when each user's last-seen timestamp was written so
+// that busy users don't cause a database write on every request. Entries
+// older than keep are dropped as writes happen, so people who have left
+// don't stay in memory.
+type presenceTracker struct {
+	mu       sync.Mutex
+	interval time.Duration
+	keep     time.Duration
+	written  map[string]time.Time
+	// evicted is when old entries were last dropped.
+	evicted time.Time
+}
+
+// newPresenceTracker returns a tracker allowing a write per key every
+// interval and remembering keys for keep, or for interval if that is longer.
+func newPresenceTracker(interval, keep time.Duration) *presenceTracker {
+	return &presenceTracker{
+		interval: interval,
+		keep:     max(interval, keep),
+		written:  make(map[string]time.Time),
+	}
+}
+
+// due reports whether a write is needed for userID and, if so, records now as
+// the time of that write.
+func (p *presenceTracker) due(userID string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if last, ok := p.written[userID]; ok && now.Sub(last) < p.interval {
+		return false
+	}
+	p.written[userID] = now
+	p.evict(now)
+	return true
+}
+
+// evict drops the entries older than keep, at most once per keep. The
+// caller holds p.mu.
+func (p *presenceTracker) evict(now time.Time) {
+	if now.Sub(p.evicted) < p.keep {
+		return
+	}
+	for key, last := range p.written {
+		if now.Sub(last) >= p.keep {
+			delete(p.written, key)
+		}
+	}
+	p.evicted = now
+}
+
+// touchPresence updates the user's last-seen timestamp, at most once per
+// PresenceWriteInterval. Coming back after VisitGap or more starts a new
+// visit, and the old timestamp becomes their last visit.
+func (h *Handlers) touchPresence(user *User) {
+	if user == nil {
+		return
+	}
+	now := time.Now()
+	if !h.presence.due(user.ID, now) {
+		return
+	}
+	if user.LastSeenAt != nil && now.Sub(*user.LastSeenAt) >= h.config.VisitGap {
+		user.LastVisitAt = user.LastSeenAt
+	}
+	user.LastSeenAt = &now
+	if err := h.db.TouchLastSeen(user.ID, now, h.config.VisitGap); err != nil {
+		log.Printf("Error updating last seen for user %s: %v", user.ID, err)
+	}
+}
+
+// isOnline reports whether the user has been seen recently and allows others to know it.
+func (h *Handlers) isOnline(user *User) bool {
+	if user == nil || user.HidePresence || user.LastSeenAt == nil {
+		return false
+	}
+	return time.Since(*user.LastSeenAt) < h.config.OnlineWindow
+}
+
+// NewTopicsViewData is the data structure for the "new since last visit"
+// page.
+type NewTopicsViewData struct {
+	User       *Viewer
+	Since      string
+	Topics     []TopicView
+	Pagination PaginationData
+}
+
+// showNewTopics serves GET /topics/new, the topics started or posted in
+// since the member's last visit, or since they joined if this is their
+// first.
+func (h *Handlers) showNewTopics(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	user, _ := r.Context().Value(userContextKey).(*User)
+	since := user.Created
+	if user.LastVisitAt != nil {
+		since = *user.LastVisitAt
+	}
+	filter := TopicFilter{Since: since}
+	db := h.db.WithContext(r.Context())
+	pageSize := pageSizeFor(user)
+	topics, err := db.SearchAndListTopics(filter, page, pageSize)
+	if err != nil {
+		log.Printf("Error listing new topics: %v", err)
+		http.Error(w, "Failed to retrieve topics", http.StatusInternalServerError)
+		return
+	}
+	total, err := db.CountTopics(filter)
+	if err != nil {
+		log.Printf("Error counting new topics: %v", err)
+		http.Error(w, "Failed to retrieve topics", http.StatusInternalServerError)
+		return
+	}
+	data := NewTopicsViewData{
+		User:       NewViewer(user),
+		Since:      since.Format(dateTimeLayout),
+		Topics:     h.topicViews(r, topics),
+		Pagination: newPagination(page, total, pageSize, pageLink("/topics/new", nil)),
+	}
+	if err := h.templates.ExecuteTemplate(w, "new_topics.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// --- Presence Database Functions ---
+
+// TouchLastSeen records that the user was seen at the given time. If they
+// had been away for gap or longer, their previous last-seen time becomes
+// their last visit.
+func (d *Database) TouchLastSeen(userID string, at time.Time, gap time.Duration) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `UPDATE users SET last_visit_at = CASE WHEN last_seen_at <= $2 - make_interval(secs => $3) THEN last_seen_at ELSE last_visit_at END,
+                  last_seen_at = $2
+              WHERE id = $1`
+	_, err := d.pool.Exec(ctx, query, userID, at, gap.Seconds())
+	return err
+}
+
+// ListOnlineUsers returns users seen since the given time, skipping anyone who opted out.
+func (d *Database) ListOnlineUsers(since time.Time, limit int) ([]User, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT ` + userColumns + ` FROM users
+              WHERE last_seen_at >= $1 AND NOT hide_presence AND ` + notDeleted("users") + `
+              ORDER BY last_seen_at DESC
+              LIMIT $2`
+	rows, err := d.pool.Query(ctx, query, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		user.Sanitize()
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
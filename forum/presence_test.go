@@ -0,0 +1,35 @@
+// forum/presence_test.go
+package forum
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresenceTrackerEvicts(t *testing.T) {
+	p := newPresenceTracker(time.Minute, 5*time.Minute)
+	start := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	if !p.due("a", start) {
+		t.Fatal("first write for a not due")
+	}
+	if p.due("a", start.Add(30*time.Second)) {
+		t.Error("write for a due again within the interval")
+	}
+	if !p.due("b", start.Add(2*time.Minute)) {
+		t.Fatal("first write for b not due")
+	}
+	if _, ok := p.written["a"]; !ok {
+		t.Error("a evicted before keep passed")
+	}
+
+	// A write after keep drops a, who hasn't been seen since, but not b.
+	if !p.due("c", start.Add(6*time.Minute)) {
+		t.Fatal("first write for c not due")
+	}
+	if _, ok := p.written["a"]; ok {
+		t.Error("a still tracked after keep")
+	}
+	if _, ok := p.written["b"]; !ok {
+		t.Error("b evicted before keep passed")
+	}
+}
@@ -0,0 +1,253 @@
+// forum/profile.go
+package forum
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// ProfileViewData is the data structure for a user's public profile page.
+type ProfileViewData struct {
+	User    *Viewer
+	Profile ProfileView
+	Online  bool
+}
+
+// SettingsViewData is the data structure for the account settings page.
+type SettingsViewData struct {
+	User            *Viewer
+	Saved           bool
+	PasswordChanged bool
+	PasswordErrors  []string
+	PasswordWarning string
+
+	// Version, HidePresence, PasswordResetRequired and PageSize come from
+	// the account as it stands after any save; see withAccount.
+	Version               int
+	HidePresence          bool
+	PasswordResetRequired bool
+	PageSize              int
+	PageSizes             []int
+
+	Passkeys []PasskeyView
+	// HasAvatar is set when the member uploaded an avatar.
+	HasAvatar bool
+	// NewAPIKey is a key just generated for the member. Only its hash is
+	// kept, so this is the one time it is shown.
+	NewAPIKey string
+}
+
+// withAccount fills in the fields of d that come from u.
+func (d SettingsViewData) withAccount(u *User) SettingsViewData {
+	d.User = NewViewer(u)
+	d.Version = u.Version
+	d.HidePresence = u.HidePresence
+	d.PasswordResetRequired = u.PasswordResetRequired
+	d.PageSize = pageSizeFor(u)
+	d.PageSizes = PageSizes
+	return d
+}
+
+// showProfile renders /users/{handle}.
+func (h *Handlers) showProfile(w http.ResponseWriter, r *http.Request) {
+	handle := r.PathValue("handle")
+	profile, err := h.db.GetUserByHandle(handle)
+	if err != nil {
+		writeError(w, err, "user")
+		return
+	}
+	user, _ := r.Context().Value(userContextKey).(*User)
+	data := ProfileViewData{
+		User:    NewViewer(user),
+		Profile: NewProfileView(profile),
+		Online:  h.isOnline(profile),
+	}
+	if err := h.templates.ExecuteTemplate(w, "profile.html", data); err != nil {
+		log.Printf("Error executing profile template: %v", err)
+	}
+}
+
+// handleSettings shows and updates the logged-in user's preferences.
+func (h *Handlers) handleSettings(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+
+	var saved bool
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			badRequestBody(w, err, "Failed to parse form")
+			return
+		}
+		// The form carries the version it was rendered from, so settings
+		// submitted from a stale tab don't undo a newer save.
+		version, err := formVersion(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if version != 0 && version != user.Version {
+			writeConflict(w, "profile")
+			return
+		}
+		if v := r.FormValue("page_size"); v != "" {
+			pageSize, err := strconv.Atoi(v)
+			if err != nil || !slices.Contains(PageSizes, pageSize) {
+				http.Error(w, "Page size must be one of the listed sizes", http.StatusBadRequest)
+				return
+			}
+			user.PageSize = pageSize
+		}
+		user.HidePresence = r.FormValue("hide_presence") == "on"
+		if err := h.db.SaveUser(user); err != nil {
+			if errors.Is(err, ErrConflict) {
+				writeConflict(w, "profile")
+				return
+			}
+			log.Printf("Error saving settings: %v", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+		saved = true
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.renderSettings(w, r, user, SettingsViewData{Saved: saved})
+}
+
+// renderSettings shows the settings page for user with the results in data.
+func (h *Handlers) renderSettings(w http.ResponseWriter, r *http.Request, user *User, data SettingsViewData) {
+	passkeys, err := h.db.WithContext(r.Context()).ListPasskeys(user.ID)
+	if err != nil {
+		log.Printf("Error listing passkeys: %v", err)
+		http.Error(w, "Failed to retrieve settings", http.StatusInternalServerError)
+		return
+	}
+	data.Passkeys = NewPasskeyViews(passkeys)
+	if data.HasAvatar, err = h.db.WithContext(r.Context()).HasAvatar(user.ID); err != nil {
+		log.Printf("Error checking avatar: %v", err)
+	}
+	if err := h.templates.ExecuteTemplate(w, "settings.html", data.withAccount(user)); err != nil {
+		log.Printf("Error executing settings template: %v", err)
+	}
+}
+
+// regenerateAPIKey serves POST /settings/api-key, replacing the member's
+// API key and showing the new one once.
+func (h *Handlers) regenerateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	key, err := generateAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	if err := h.db.SetUserKey(user.ID, key); err != nil {
+		log.Printf("Error replacing API key: %v", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	user.KeyHash = apiKeyHash(key)
+	user.Version++
+	h.audit(user, "user.api_key.regenerate", "user", user.ID, nil)
+	w.Header().Set("Cache-Control", "no-store")
+	h.renderSettings(w, r, user, SettingsViewData{NewAPIKey: key})
+}
+
+// resetCredentials ends every session the user has and replaces their API
+// key, so nothing taken before a password change still works after it. This
+// browser gets a new session in place of its old one.
+func (h *Handlers) resetCredentials(r *http.Request, user *User) error {
+	if _, err := h.db.DeleteTokensForUser(user.ID); err != nil {
+		return fmt.Errorf("revoking sessions: %w", err)
+	}
+	key, err := generateAPIKey()
+	if err != nil {
+		return fmt.Errorf("generating API key: %w", err)
+	}
+	if err := h.db.SetUserKey(user.ID, key); err != nil {
+		return fmt.Errorf("replacing API key: %w", err)
+	}
+	// SetUserKey bumped the version; keep the settings form's copy current.
+	user.Key, user.KeyHash = key, apiKeyHash(key)
+	user.Version++
+	return h.startSession(r, user, h.Session.GetBool(r.Context(), "remember"))
+}
+
+// changePassword serves POST /settings/password. Policy violations are shown
+// on the settings page rather than as a bare error.
+func (h *Handlers) changePassword(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+
+	var data SettingsViewData
+	matches, err := user.PasswordMatches(r.FormValue("current_password"), h.config.Password)
+	if err != nil {
+		log.Printf("Error matching password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case !matches:
+		data.PasswordErrors = []string{"Your current password is incorrect."}
+	case r.FormValue("new_password") != r.FormValue("confirm_password"):
+		data.PasswordErrors = []string{"The new passwords don't match."}
+	default:
+		err := user.SetPassword(r.FormValue("new_password"), h.config.Password)
+		var policyErr *PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			for _, v := range policyErr.Violations {
+				data.PasswordErrors = append(data.PasswordErrors, v.Message)
+			}
+			break
+		}
+		if err != nil {
+			log.Printf("Error setting password: %v", err)
+			http.Error(w, "Failed to change password", http.StatusInternalServerError)
+			return
+		}
+		if h.passwordBreached(r.Context(), r.FormValue("new_password")) {
+			if h.config.BreachCheck == BreachCheckReject {
+				data.PasswordErrors = []string{breachedViolation.Message}
+				break
+			}
+			data.PasswordWarning = "Your password was changed, but it has appeared in a data breach. Consider choosing a different one."
+		}
+		user.PasswordResetRequired = false
+		if err := h.db.SaveUser(user); err != nil {
+			if errors.Is(err, ErrConflict) {
+				writeConflict(w, "account")
+				return
+			}
+			log.Printf("Error saving password: %v", err)
+			http.Error(w, "Failed to change password", http.StatusInternalServerError)
+			return
+		}
+		if err := h.resetCredentials(r, user); err != nil {
+			log.Printf("Error resetting credentials after password change: %v", err)
+			http.Error(w, "Your password was changed, but signing out your other sessions failed. Please use Sign Out Everywhere.", http.StatusInternalServerError)
+			return
+		}
+		h.audit(user, "user.password_change", "user", user.ID, nil)
+		h.authEvent(r, user, AuthPasswordChange, "", nil)
+		data.PasswordChanged = true
+	}
+
+	if len(data.PasswordErrors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	h.renderSettings(w, r, user, data)
+}
@@ -0,0 +1,200 @@
+// forum/provision.go
+package forum
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// importPath is the admin endpoint for bulk user provisioning.
+const importPath = "/admin/users/import"
+
+// Roles accepted when provisioning users.
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
+// Provisioning statuses.
+const (
+	ProvisionCreated = "created"
+	ProvisionExists  = "exists"
+	ProvisionFailed  = "failed"
+)
+
+// ProvisionRow is one user to create. CSV imports need a header row naming
+// the email, handle and (optional) role columns.
+type ProvisionRow struct {
+	Email  string `json:"email"`
+	Handle string `json:"handle"`
+	Role   string `json:"role"`
+}
+
+// ProvisionResult reports what happened to one row. The temporary password is
+// only ever returned here; the user is asked to change it when they first log in.
+type ProvisionResult struct {
+	Row               int    `json:"row"`
+	Email             string `json:"email"`
+	Handle            string `json:"handle"`
+	Status            string `json:"status"`
+	Error             string `json:"error,omitempty"`
+	UserID            string `json:"user_id,omitempty"`
+	TemporaryPassword string `json:"temporary_password,omitempty"`
+}
+
+// readProvisionRows parses a CSV or JSON import according to its content type.
+func readProvisionRows(r *http.Request) ([]ProvisionRow, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/csv" {
+		var rows []ProvisionRow
+		err := json.NewDecoder(r.Body).Decode(&rows)
+		return rows, err
+	}
+
+	cr := csv.NewReader(r.Body)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"email", "handle"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing %q column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	var rows []ProvisionRow
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, ProvisionRow{
+			Email:  field(record, "email"),
+			Handle: field(record, "handle"),
+			Role:   field(record, "role"),
+		})
+	}
+}
+
+// generateTemporaryPassword returns a random 16 character password.
+func generateTemporaryPassword() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b)), nil
+}
+
+// importUsers serves POST /admin/users/import. Each row becomes an account
+// with a temporary password that must be changed at first login. The
+// passwords are returned for the admin to hand out rather than mailed, so
+// they never pass through the mail log or an outbox.
+func (h *Handlers) importUsers(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	rows, err := readProvisionRows(r)
+	if err != nil {
+		badRequestBody(w, err, "Invalid import: "+err.Error())
+		return
+	}
+	if len(rows) == 0 {
+		http.Error(w, "The import has no rows", http.StatusBadRequest)
+		return
+	}
+	if limit := h.config.MaxImportRows; limit > 0 && len(rows) > limit {
+		http.Error(w, fmt.Sprintf("An import may hold at most %d rows", limit), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]ProvisionResult, len(rows))
+	for i, row := range rows {
+		results[i] = h.provisionUser(staff, row)
+		results[i].Row = i + 1
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// provisionUser creates the account for one import row.
+func (h *Handlers) provisionUser(staff *User, row ProvisionRow) ProvisionResult {
+	res := ProvisionResult{Email: row.Email, Handle: row.Handle, Status: ProvisionFailed}
+	if row.Role == "" {
+		row.Role = RoleMember
+	}
+	switch {
+	case !strings.Contains(row.Email, "@"):
+		res.Error = "a valid email is required"
+		return res
+	case row.Handle == "":
+		res.Error = "handle is required"
+		return res
+	case row.Role != RoleMember && row.Role != RoleAdmin:
+		res.Error = fmt.Sprintf("role must be %q or %q", RoleMember, RoleAdmin)
+		return res
+	}
+
+	existing, err := h.db.GetUserByEmailIncludeDeleted(row.Email)
+	if err == nil {
+		res.Status = ProvisionExists
+		res.UserID = existing.ID
+		return res
+	}
+	if !errors.Is(err, ErrNotFound) {
+		log.Printf("Error checking for existing user: %v", err)
+		res.Error = "failed to check for an existing account"
+		return res
+	}
+
+	user, err := NewUser(row.Email, row.Role == RoleAdmin)
+	if err != nil {
+		log.Printf("Error creating new user: %v", err)
+		res.Error = "failed to create user"
+		return res
+	}
+	user.Handle = row.Handle
+	password, err := generateTemporaryPassword()
+	if err == nil {
+		// A random password can't be on the denylist, so skip the policy.
+		user.Password, err = h.config.Password.Hash(password)
+	}
+	if err != nil {
+		log.Printf("Error setting temporary password: %v", err)
+		res.Error = "failed to set password"
+		return res
+	}
+	user.PasswordResetRequired = true
+	if err := h.db.SaveUser(user); err != nil {
+		log.Printf("Error saving user: %v", err)
+		res.Error = "failed to save user"
+		return res
+	}
+	h.audit(staff, "user.provision", "user", user.ID, map[string]string{"email": user.Email, "role": row.Role})
+
+	res.Status = ProvisionCreated
+	res.UserID = user.ID
+	res.TemporaryPassword = password
+	return res
+}
@@ -0,0 +1,123 @@
+// forum/proxy.go
+package forum
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientKey stores the resolved client address and scheme in the request context.
+const clientKey = contextKey("client")
+
+type clientInfo struct {
+	IP     string
+	Scheme string
+}
+
+// parseCIDRs parses a list of CIDRs or bare addresses.
+func parseCIDRs(list []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func (h *Handlers) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range h.config.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RealClient works out the client's IP and scheme. X-Forwarded-For and
+// X-Forwarded-Proto are only believed when the connection comes from a
+// trusted proxy; the client is the right-most forwarded address that isn't
+// itself a trusted proxy.
+func (h *Handlers) RealClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := clientInfo{IP: r.RemoteAddr, Scheme: "http"}
+		if r.TLS != nil {
+			info.Scheme = "https"
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err == nil {
+			info.IP = host
+		}
+		if peer, err := netip.ParseAddr(host); err == nil && h.trustedProxy(peer) {
+			info.IP = h.forwardedFor(r, peer.Unmap().String())
+			if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+				proto, _, _ = strings.Cut(proto, ",")
+				if proto = strings.ToLower(strings.TrimSpace(proto)); proto == "http" || proto == "https" {
+					info.Scheme = proto
+				}
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey, info)))
+	})
+}
+
+// forwardedFor walks X-Forwarded-For from the right, skipping trusted proxies.
+func (h *Handlers) forwardedFor(r *http.Request, peer string) string {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !h.trustedProxy(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// clientIP returns the request's client address as resolved by RealClient.
+func clientIP(r *http.Request) string {
+	if info, ok := r.Context().Value(clientKey).(clientInfo); ok {
+		return info.IP
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// requestScheme returns "https" or "http" as resolved by RealClient.
+func requestScheme(r *http.Request) string {
+	if info, ok := r.Context().Value(clientKey).(clientInfo); ok {
+		return info.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
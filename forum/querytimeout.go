@@ -0,0 +1,65 @@
+// forum/querytimeout.go
+package forum
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// DefaultQueryTimeout bounds every statement unless overridden.
+const DefaultQueryTimeout = 10 * time.Second
+
+// SetQueryTimeout changes the default per-statement timeout. Zero disables it.
+func (d *Database) SetQueryTimeout(t time.Duration) {
+	d.queryTimeout = t
+}
+
+// WithContext returns a Database whose statements are cancelled along with
+// ctx, typically the HTTP request's context so an aborted request stops its
+// queries.
+func (d *Database) WithContext(ctx context.Context) *Database {
+	c := *d
+	c.ctx = ctx
+	return &c
+}
+
+// WithTimeout returns a Database whose statements use t instead of the
+// default timeout, for known-heavy operations such as search and exports.
+func (d *Database) WithTimeout(t time.Duration) *Database {
+	c := *d
+	c.timeout = t
+	return &c
+}
+
+// op returns the context a single store call runs its statements under. The
+// calling method's name is attached so the tracer can group statements by it.
+func (d *Database) op() (context.Context, context.CancelFunc) {
+	ctx := d.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithValue(ctx, queryFamilyKey, callerName(2))
+	timeout := d.timeout
+	if timeout == 0 {
+		timeout = d.queryTimeout
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dbStatsHandler serves GET /api/stats/db for admins.
+func (h *Handlers) dbStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Statements StatementStats              `json:"statements"`
+		Queries    map[string]QueryFamilyStats `json:"queries"`
+	}{h.db.StatementStats(), h.db.QueryStats()})
+}
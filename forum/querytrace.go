@@ -0,0 +1,221 @@
+// forum/querytrace.go
+package forum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultSlowQueryThreshold is how long a statement may run before it is logged.
+const DefaultSlowQueryThreshold = 500 * time.Millisecond
+
+// queryFamilyKey carries the store method a statement belongs to.
+const queryFamilyKey = contextKey("query-family")
+
+// queryStartKey carries the tracedQuery of a running statement.
+const queryStartKey = contextKey("query-start")
+
+// latencyBuckets are the upper bounds of the latency histogram buckets.
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// SetSlowQueryThreshold changes when statements are logged as slow. Zero disables the log.
+func (d *Database) SetSlowQueryThreshold(t time.Duration) {
+	d.tracer.slow.Store(int64(t))
+}
+
+// StatementStats counts statements that didn't finish.
+type StatementStats struct {
+	TimedOut int64 `json:"timed_out"`
+	Canceled int64 `json:"canceled"`
+	Slow     int64 `json:"slow"`
+}
+
+// StatementStats reports how many statements have timed out, been cancelled
+// or run slowly since startup.
+func (d *Database) StatementStats() StatementStats {
+	return StatementStats{
+		TimedOut: d.tracer.timedOut.Load(),
+		Canceled: d.tracer.canceled.Load(),
+		Slow:     d.tracer.slowCount.Load(),
+	}
+}
+
+// QueryFamilyStats is the latency histogram for one store method. Buckets
+// maps each upper bound to the number of statements at or under it
+// (cumulative, as Prometheus histograms are).
+type QueryFamilyStats struct {
+	Count   int64            `json:"count"`
+	TotalMS float64          `json:"total_ms"`
+	Buckets map[string]int64 `json:"buckets"`
+}
+
+// QueryStats returns a latency histogram per store method.
+func (d *Database) QueryStats() map[string]QueryFamilyStats {
+	d.tracer.mu.Lock()
+	defer d.tracer.mu.Unlock()
+	out := make(map[string]QueryFamilyStats, len(d.tracer.families))
+	for name, h := range d.tracer.families {
+		stats := QueryFamilyStats{
+			Count:   h.count,
+			TotalMS: float64(h.total) / float64(time.Millisecond),
+			Buckets: make(map[string]int64, len(latencyBuckets)+1),
+		}
+		var cumulative int64
+		for i, le := range latencyBuckets {
+			cumulative += h.buckets[i]
+			stats.Buckets[le.String()] = cumulative
+		}
+		stats.Buckets["+Inf"] = h.count
+		out[name] = stats
+	}
+	return out
+}
+
+// queryTracer is the pgx tracer for every pool. It counts statements ended by
+// their context, logs slow ones, and keeps latency histograms.
+type queryTracer struct {
+	timedOut  atomic.Int64
+	canceled  atomic.Int64
+	slowCount atomic.Int64
+	slow      atomic.Int64 // threshold in nanoseconds
+	// unwritableUntil is when read-only mode ends, in unix nanoseconds;
+	// see readonly.go.
+	unwritableUntil atomic.Int64
+
+	mu       sync.Mutex
+	families map[string]*latencyHistogram
+}
+
+// tracedQuery is what TraceQueryStart remembers for TraceQueryEnd.
+type tracedQuery struct {
+	start time.Time
+	sql   string
+	args  []any
+}
+
+type latencyHistogram struct {
+	count   int64
+	total   time.Duration
+	buckets []int64 // per bucket, not cumulative; the last is overflow
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey, tracedQuery{start: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	switch {
+	case data.Err == nil:
+	case errors.Is(ctx.Err(), context.Canceled) || errors.Is(data.Err, context.Canceled):
+		t.canceled.Add(1)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) || pgconn.Timeout(data.Err):
+		t.timedOut.Add(1)
+	case readOnlyError(data.Err):
+		t.markUnwritable(readOnlyRecheck)
+	}
+
+	q, ok := ctx.Value(queryStartKey).(tracedQuery)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(q.start)
+	family, _ := ctx.Value(queryFamilyKey).(string)
+	if family == "" {
+		family = "other"
+	}
+	t.observe(family, elapsed)
+
+	if threshold := time.Duration(t.slow.Load()); threshold > 0 && elapsed >= threshold {
+		t.slowCount.Add(1)
+		log.Printf("Slow query (%s) in %s: %s args=%s", family, elapsed.Round(time.Millisecond), compactSQL(q.sql), sanitizeArgs(q.args))
+	}
+}
+
+func (t *queryTracer) observe(family string, elapsed time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.families == nil {
+		t.families = map[string]*latencyHistogram{}
+	}
+	h, ok := t.families[family]
+	if !ok {
+		h = &latencyHistogram{buckets: make([]int64, len(latencyBuckets)+1)}
+		t.families[family] = h
+	}
+	h.count++
+	h.total += elapsed
+	i := 0
+	for i < len(latencyBuckets) && elapsed > latencyBuckets[i] {
+		i++
+	}
+	h.buckets[i]++
+}
+
+// callerName returns the short name of the function skip frames up, e.g.
+// "GetPostsByTopic" for a Database method.
+func callerName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// compactSQL collapses the indentation of a multi-line query onto one line.
+func compactSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// sanitizeArgs describes query arguments without leaking user content:
+// numbers, booleans, times and UUIDs are shown, strings and bytes only by length.
+func sanitizeArgs(args []any) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case nil:
+			parts[i] = "NULL"
+		case int, int32, int64, uint32, float64, bool, uuid.UUID, time.Time, time.Duration:
+			parts[i] = fmt.Sprint(v)
+		case *int64:
+			if v == nil {
+				parts[i] = "NULL"
+			} else {
+				parts[i] = fmt.Sprint(*v)
+			}
+		case string:
+			if _, err := uuid.Parse(v); err == nil {
+				parts[i] = v
+			} else {
+				parts[i] = fmt.Sprintf("<string len=%d>", len(v))
+			}
+		case []byte:
+			parts[i] = fmt.Sprintf("<bytes len=%d>", len(v))
+		default:
+			parts[i] = fmt.Sprintf("<%T>", v)
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
@@ -0,0 +1,123 @@
+// forum/readonly.go
+package forum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// readOnlyRecheck is how long the forum stays read-only after the primary
+// refuses a write, unless WatchWritable finds it writable sooner.
+const readOnlyRecheck = 30 * time.Second
+
+// readOnlyMessage is what members see when a change is refused.
+const readOnlyMessage = "The forum is read-only for maintenance right now. You can keep reading; please try again in a few minutes."
+
+// Postgres error codes that mean the server can't take writes: a standby or
+// a primary set to default_transaction_read_only, and a server still
+// starting up or promoting.
+const (
+	pgReadOnlyTransaction = "25006"
+	pgCannotConnectNow    = "57P03"
+)
+
+// readOnlyError reports whether err means the primary couldn't take a write,
+// as opposed to the write itself being wrong.
+func readOnlyError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgReadOnlyTransaction || pgErr.Code == pgCannotConnectNow
+	}
+	var connErr *pgconn.ConnectError
+	return errors.As(err, &connErr)
+}
+
+// ReadOnly reports whether the primary was recently found unable to take
+// writes. Every query on it is watched for that, and WatchWritable checks
+// for it in the background.
+func (d *Database) ReadOnly() bool {
+	return time.Now().UnixNano() < d.tracer.unwritableUntil.Load()
+}
+
+// WatchWritable checks every interval whether the primary takes writes, so
+// the forum goes read-only before a member hits the failure and comes back
+// as soon as the primary does. A non-positive interval turns it off; the
+// forum then still goes read-only for readOnlyRecheck whenever a write is
+// refused.
+func (d *Database) WatchWritable(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		var writable bool
+		err := d.pool.QueryRow(ctx, `SELECT NOT pg_is_in_recovery() AND current_setting('transaction_read_only') = 'off'`).Scan(&writable)
+		cancel()
+		was := d.ReadOnly()
+		switch {
+		case err != nil && !readOnlyError(err) && !unreachable(err):
+			log.Printf("Error checking whether the database is writable: %v", err)
+		case err != nil || !writable:
+			d.tracer.markUnwritable(interval + readOnlyRecheck)
+			if !was {
+				log.Printf("Database is not writable; the forum is read-only (%v)", err)
+			}
+		default:
+			d.tracer.unwritableUntil.Store(0)
+			if was {
+				log.Printf("Database is writable again; the forum is back to normal")
+			}
+		}
+	}
+}
+
+// markUnwritable puts the forum in read-only mode for d.
+func (t *queryTracer) markUnwritable(d time.Duration) {
+	t.unwritableUntil.Store(time.Now().Add(d).UnixNano())
+}
+
+// readOnly reports whether changes are refused, either because
+// Config.ReadOnly is set for planned maintenance or because the database
+// can't take writes. Templates call it to show the read-only banner.
+func (h *Handlers) readOnly() bool {
+	return h.config.ReadOnly || (h.db != nil && h.db.ReadOnly())
+}
+
+// refuseWritesWhenReadOnly answers requests that would change something with
+// 503 and a Retry-After while the forum is read-only, so members get an
+// explanation rather than whatever error each handler would hit. Reads go
+// through and are served from replicas where the store allows.
+func (h *Handlers) refuseWritesWhenReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !h.readOnly() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(readOnlyRecheck.Seconds())))
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"error": readOnlyMessage})
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := h.templates.ExecuteTemplate(w, "readonly.html", nil); err != nil {
+			log.Printf("Error executing read-only template: %v", err)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+// forum/reads.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// A read marker records the newest post a member has seen in a topic, as the
+// highest post ID shown to them. Posts after it are unread. Topics they have
+// never opened have no marker and count as neither read nor unread, so a new
+// member's topic list isn't covered in badges.
+
+// markTopicRead moves the user's read marker in the topic up to the newest
+// of posts they were shown. Deleted posts don't count, as they are only
+// placeholders. Markers are a convenience, so failures are only logged.
+func (h *Handlers) markTopicRead(user *User, topicID string, posts []Post) {
+	if user == nil || h.readOnly() {
+		return
+	}
+	var last int64
+	for i := range posts {
+		if posts[i].DeletedAt == nil && posts[i].ID > last {
+			last = posts[i].ID
+		}
+	}
+	if last == 0 {
+		return
+	}
+	if err := h.db.MarkTopicRead(user.ID, topicID, last); err != nil {
+		log.Printf("Error marking topic read: %v", err)
+	}
+}
+
+// topicViews is NewTopicViews with each topic's unread count filled in for
+// the signed-in member.
+func (h *Handlers) topicViews(r *http.Request, topics []Topic) []TopicView {
+	views := NewTopicViews(topics)
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if user == nil || len(topics) == 0 {
+		return views
+	}
+	ids := make([]string, len(topics))
+	for i := range topics {
+		ids[i] = topics[i].ID
+	}
+	unread, err := h.db.WithContext(r.Context()).UnreadCounts(user.ID, ids)
+	if err != nil {
+		log.Printf("Error counting unread posts: %v", err)
+		return views
+	}
+	for i := range views {
+		views[i].Unread = unread[views[i].ID]
+	}
+	return views
+}
+
+// showFirstUnread serves GET /topics/{id}/unread, redirecting to the page
+// and post where the member stopped reading, or to the last page when
+// they're caught up.
+func (h *Handlers) showFirstUnread(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	db := h.db.WithContext(r.Context())
+	if _, err := db.GetTopic(topicID); err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	pageSize := pageSizeFor(user)
+	link := "/topics/" + topicID.String()
+	postID, before, err := db.FirstUnreadPost(user.ID, topicID)
+	if errors.Is(err, ErrNotFound) {
+		total, err := db.CountPostsByTopicIncludeDeleted(topicID, PostFilter{})
+		if err != nil {
+			http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
+			return
+		}
+		if pages := (total + pageSize - 1) / pageSize; pages > 1 {
+			link += "?page=" + strconv.Itoa(pages)
+		}
+		http.Redirect(w, r, link, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding first unread post: %v", err)
+		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, topicPostLink(topicID.String(), postID, before, pageSize), http.StatusSeeOther)
+}
+
+// --- Read Marker Database Functions ---
+
+// MarkTopicRead records that the user has seen the topic up to postID. The
+// marker never moves back, so reading an earlier page doesn't unread later
+// ones.
+func (d *Database) MarkTopicRead(userID, topicID string, postID int64) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO topic_reads (user_id, topic_id, last_post_id) VALUES ($1, $2, $3)
+              ON CONFLICT (user_id, topic_id) DO UPDATE
+              SET last_post_id = GREATEST(topic_reads.last_post_id, EXCLUDED.last_post_id), read_at = NOW()`
+	_, err := d.pool.Exec(ctx, query, userID, topicID, postID)
+	return err
+}
+
+// UnreadCounts returns, for each of topicIDs the user has a read marker in,
+// how many visible posts came after it. Topics they never opened are left
+// out.
+func (d *Database) UnreadCounts(userID string, topicIDs []string) (map[string]int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT r.topic_id::text, COUNT(p.id) FROM topic_reads r
+              LEFT JOIN posts p ON p.topic_id = r.topic_id AND p.id > r.last_post_id
+                  AND p.state = 'visible' AND p.deleted_at IS NULL
+              WHERE r.user_id = $1 AND r.topic_id = ANY($2::uuid[])
+              GROUP BY r.topic_id`
+	rows, err := d.readQuery(ctx, query, userID, topicIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// FirstUnreadPost returns the first visible post in the topic after the
+// user's read marker, or its first post if they have none, along with how
+// many posts the topic page shows before it. It returns ErrNotFound when
+// there is nothing unread.
+func (d *Database) FirstUnreadPost(userID string, topicID uuid.UUID) (int64, int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT f.id, (
+                  SELECT COUNT(*) FROM posts o
+                  WHERE o.topic_id = f.topic_id AND o.state = 'visible' AND (o.created_at, o.id) < (f.created_at, f.id)
+              )
+              FROM posts f
+              WHERE f.topic_id = $2 AND f.state = 'visible' AND f.deleted_at IS NULL
+                  AND f.id > COALESCE((SELECT last_post_id FROM topic_reads WHERE user_id = $1 AND topic_id = $2), 0)
+              ORDER BY f.created_at ASC, f.id ASC
+              LIMIT 1`
+	var postID int64
+	var before int
+	err := d.readQueryRow(ctx, query, userID, topicID).Scan(&postID, &before)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrNotFound
+	}
+	return postID, before, err
+}
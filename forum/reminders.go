@@ -0,0 +1,227 @@
+// forum/reminders.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// reminderBatch is how many due reminders one delivery query claims.
+const reminderBatch = 100
+
+// ReminderOption is a choice in the topic page's "Remind me" menu.
+type ReminderOption struct {
+	Key   string
+	Label string
+	After time.Duration
+}
+
+// reminderOptions are the delays a reminder can be set for.
+var reminderOptions = []ReminderOption{
+	{Key: "later", Label: "Later today", After: 3 * time.Hour},
+	{Key: "tomorrow", Label: "Tomorrow", After: 24 * time.Hour},
+	{Key: "3days", Label: "In 3 days", After: 3 * 24 * time.Hour},
+	{Key: "week", Label: "Next week", After: 7 * 24 * time.Hour},
+}
+
+// Reminder is a pending "remind me" on a topic.
+type Reminder struct {
+	ID         int64
+	UserID     string
+	TopicID    string
+	TopicTitle string
+	RemindAt   time.Time
+	CreatedAt  time.Time
+}
+
+// errTooManyReminders is returned when a user already has ReminderLimit
+// reminders pending.
+var errTooManyReminders = errors.New("too many pending reminders")
+
+// remindTopic serves POST /topics/{id}/remind with "in" naming one of
+// reminderOptions.
+func (h *Handlers) remindTopic(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	var after time.Duration
+	for _, opt := range reminderOptions {
+		if opt.Key == r.FormValue("in") {
+			after = opt.After
+		}
+	}
+	if after == 0 {
+		writeError(w, invalid("in", "choose when to be reminded"), "reminder")
+		return
+	}
+	db := h.db.WithContext(r.Context())
+	if _, err := db.GetTopic(topicID); err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	err := db.CreateReminder(user.ID, topicID.String(), time.Now().Add(after), h.config.ReminderLimit)
+	if errors.Is(err, errTooManyReminders) {
+		http.Error(w, "You have too many reminders pending; cancel some from your notifications page", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating reminder: %v", err)
+		http.Error(w, "Failed to set reminder", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/topics/"+topicID.String(), http.StatusSeeOther)
+}
+
+// cancelReminder serves POST /reminders/{id}/delete.
+func (h *Handlers) cancelReminder(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.WithContext(r.Context()).DeleteReminder(user.ID, id); err != nil {
+		writeError(w, err, "reminder")
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// StartReminderScheduler delivers due reminders, including those set on
+// bookmarks, as notifications every ReminderInterval. Each reminder is claimed and removed in one statement,
+// so several servers can run the scheduler without doubling up. A
+// ReminderInterval of zero leaves reminders undelivered.
+func (h *Handlers) StartReminderScheduler() {
+	if h.config.ReminderInterval <= 0 {
+		log.Printf("Reminder delivery is off; FORUM_REMINDER_INTERVAL is %v", h.config.ReminderInterval)
+		return
+	}
+	ticker := time.NewTicker(h.config.ReminderInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.deliverReminders()
+		h.deliverBookmarkReminders()
+	}
+}
+
+func (h *Handlers) deliverReminders() {
+	for {
+		due, err := h.db.ClaimDueReminders(time.Now(), reminderBatch)
+		if err != nil {
+			log.Printf("Error claiming reminders: %v", err)
+			return
+		}
+		for _, rm := range due {
+			h.NotifCh <- Notification{
+				UserID:    rm.UserID,
+				ID:        uuid.New().String(),
+				CreatedAt: time.Now(),
+				Message:   "Reminder: " + rm.TopicTitle,
+				Link:      "/topics/" + rm.TopicID,
+			}
+		}
+		if len(due) < reminderBatch {
+			return
+		}
+	}
+}
+
+// --- Reminder Database Functions ---
+
+// CreateReminder schedules a reminder for the user, unless they already
+// have limit pending, in which case it returns errTooManyReminders. A limit
+// of zero means no limit.
+func (d *Database) CreateReminder(userID, topicID string, at time.Time, limit int) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO reminders (user_id, topic_id, remind_at)
+              SELECT $1, $2, $3
+              WHERE $4 = 0 OR (SELECT COUNT(*) FROM reminders WHERE user_id = $1) < $4`
+	tag, err := d.pool.Exec(ctx, query, userID, topicID, at, limit)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errTooManyReminders
+	}
+	return nil
+}
+
+// ListReminders returns the user's pending reminders, soonest first.
+// Reminders on deleted topics are left out; they won't be delivered.
+func (d *Database) ListReminders(userID string) ([]Reminder, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT r.id, r.user_id, r.topic_id, t.title, r.remind_at, r.created_at
+              FROM reminders r JOIN topics t ON t.id = r.topic_id
+              WHERE r.user_id = $1 AND ` + notDeleted("t") + `
+              ORDER BY r.remind_at, r.id`
+	rows, err := d.readQuery(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reminders []Reminder
+	for rows.Next() {
+		var rm Reminder
+		if err := rows.Scan(&rm.ID, &rm.UserID, &rm.TopicID, &rm.TopicTitle, &rm.RemindAt, &rm.CreatedAt); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, rm)
+	}
+	return reminders, rows.Err()
+}
+
+// DeleteReminder cancels one of the user's reminders. It returns ErrNotFound
+// if they have no reminder with that ID.
+func (d *Database) DeleteReminder(userID string, id int64) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM reminders WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimDueReminders removes up to limit reminders due by now and returns
+// those whose topic is still live. Rows another server is claiming are
+// skipped rather than waited for.
+func (d *Database) ClaimDueReminders(now time.Time, limit int) ([]Reminder, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `WITH due AS (
+                  DELETE FROM reminders WHERE id IN (
+                      SELECT id FROM reminders WHERE remind_at <= $1
+                      ORDER BY remind_at LIMIT $2
+                      FOR UPDATE SKIP LOCKED)
+                  RETURNING id, user_id, topic_id, remind_at, created_at
+              )
+              SELECT due.id, due.user_id, due.topic_id, t.title, due.remind_at, due.created_at
+              FROM due JOIN topics t ON t.id = due.topic_id
+              WHERE ` + notDeleted("t")
+	rows, err := d.pool.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reminders []Reminder
+	for rows.Next() {
+		var rm Reminder
+		if err := rows.Scan(&rm.ID, &rm.UserID, &rm.TopicID, &rm.TopicTitle, &rm.RemindAt, &rm.CreatedAt); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, rm)
+	}
+	return reminders, rows.Err()
+}
@@ -0,0 +1,112 @@
+// forum/replicas.go
+package forum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// replicaRetryAfter is how long a replica that failed to connect is skipped.
+const replicaRetryAfter = 30 * time.Second
+
+// replica is a read-only copy of the primary. Reads are spread across healthy
+// replicas; one that can't be reached is skipped for a while and its reads go
+// to the primary instead.
+type replica struct {
+	pool      *pgxpool.Pool
+	downUntil atomic.Int64 // unix nanoseconds
+}
+
+func (r *replica) healthy() bool {
+	return time.Now().UnixNano() >= r.downUntil.Load()
+}
+
+func (r *replica) markDown(err error) {
+	log.Printf("Read replica %s unavailable, using primary: %v", r.pool.Config().ConnConfig.Host, err)
+	r.downUntil.Store(time.Now().Add(replicaRetryAfter).UnixNano())
+}
+
+// AddReplica registers a read replica. An unreachable replica is still added
+// and starts out skipped, so the forum keeps running on the primary.
+func (d *Database) AddReplica(connectionString, password string) error {
+	cfg, err := pgxpool.ParseConfig(connectionString)
+	if err != nil {
+		return fmt.Errorf("invalid replica connection string: %w", err)
+	}
+	if password != "" {
+		cfg.ConnConfig.Password = password
+	}
+	cfg.ConnConfig.Tracer = &d.tracer
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create replica pool: %w", err)
+	}
+	r := &replica{pool: pool}
+	if err := pool.Ping(context.Background()); err != nil {
+		r.markDown(err)
+	}
+	d.replicas = append(d.replicas, r)
+	return nil
+}
+
+// pickReplica returns the next healthy replica in rotation, or nil.
+func (d *Database) pickReplica() *replica {
+	n := len(d.replicas)
+	for i := 0; i < n; i++ {
+		r := d.replicas[int(d.nextReplica.Add(1))%n]
+		if r.healthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+// unreachable reports whether err means the server couldn't be reached, as
+// opposed to the query itself failing.
+func unreachable(err error) bool {
+	var connErr *pgconn.ConnectError
+	return errors.As(err, &connErr) || pgconn.SafeToRetry(err) || pgconn.Timeout(err)
+}
+
+// readQuery runs a read-only query on a replica, falling back to the primary.
+func (d *Database) readQuery(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	if r := d.pickReplica(); r != nil {
+		rows, err := r.pool.Query(ctx, query, args...)
+		if err == nil || !unreachable(err) {
+			return rows, err
+		}
+		r.markDown(err)
+	}
+	return d.pool.Query(ctx, query, args...)
+}
+
+// readQueryRow is the single-row form of readQuery.
+func (d *Database) readQueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return &fallbackRow{d: d, ctx: ctx, query: query, args: args}
+}
+
+type fallbackRow struct {
+	d     *Database
+	ctx   context.Context
+	query string
+	args  []any
+}
+
+func (row *fallbackRow) Scan(dest ...any) error {
+	if r := row.d.pickReplica(); r != nil {
+		err := r.pool.QueryRow(row.ctx, row.query, row.args...).Scan(dest...)
+		if err == nil || !unreachable(err) {
+			return err
+		}
+		r.markDown(err)
+	}
+	return row.d.pool.QueryRow(row.ctx, row.query, row.args...).Scan(dest...)
+}
@@ -0,0 +1,93 @@
+// forum/replies_test.go
+package forum_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rexlx/volconvo/forum"
+	"github.com/rexlx/volconvo/forumtest"
+)
+
+// TestReplyParent checks that a reply can only quote a visible post of the
+// same topic, so replying can't publish held or hidden posts.
+func TestReplyParent(t *testing.T) {
+	e := forumtest.New(t, func(c *forum.Config) { c.PostInterval = 0 })
+	member := e.User()
+	topic := e.Topic(member, "Replies")
+	other := e.Topic(member, "Elsewhere")
+
+	visible := e.Post(topic, member, "visible post", nil)
+	held := e.Post(topic, member, "held post", nil)
+	hidden := e.Post(topic, member, "hidden post", nil)
+	elsewhere := e.Post(other, member, "post in another topic", nil)
+	for id, state := range map[int64]string{held.ID: forum.PostHeld, hidden.ID: forum.PostHidden} {
+		if err := e.DB.SetPostState(id, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		parent string
+		want   int
+	}{
+		{"Visible", strconv.FormatInt(visible.ID, 10), http.StatusSeeOther},
+		{"Held", strconv.FormatInt(held.ID, 10), http.StatusNotFound},
+		{"Hidden", strconv.FormatInt(hidden.ID, 10), http.StatusNotFound},
+		{"OtherTopic", strconv.FormatInt(elsewhere.ID, 10), http.StatusBadRequest},
+		{"Malformed", "12x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := e.As(member, e.Form("/topics/"+topic.ID+"/posts", url.Values{
+				"body":           {"a reply"},
+				"parent_post_id": {tt.parent},
+			}))
+			if rec := e.Do(r); rec.Code != tt.want {
+				t.Errorf("reply to %s post = %d, want %d; body:\n%s", tt.name, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestGuestReply checks that a reply posted without an account is stored,
+// which needs the reserved guest author row behind fk_posts_author.
+func TestGuestReply(t *testing.T) {
+	e := forumtest.New(t, func(c *forum.Config) { c.GuestPosting = true })
+	member := e.User()
+	topic := e.Topic(member, "Guests welcome")
+	parent := e.Post(topic, member, "Say hello", nil)
+
+	rec := e.Do(e.Form("/topics/"+topic.ID+"/posts", url.Values{
+		"body":           {"Hello from a guest"},
+		"guest_name":     {"Visitor"},
+		"parent_post_id": {strconv.FormatInt(parent.ID, 10)},
+	}))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("guest reply status = %d, want %d; body:\n%s", rec.Code, http.StatusSeeOther, rec.Body.String())
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(rec.Header().Get("Location"), "/posts/"), 10, 64)
+	if err != nil {
+		t.Fatalf("guest reply redirected to %q, want its post", rec.Header().Get("Location"))
+	}
+	post, err := e.DB.GetPost(id)
+	if err != nil {
+		t.Fatalf("GetPost: %v", err)
+	}
+	if !post.ByGuest() || post.Author != "Visitor" {
+		t.Errorf("guest reply stored as %q (%s), want a guest post by Visitor", post.Author, post.AuthorID)
+	}
+	if post.ParentPostID == nil || *post.ParentPostID != parent.ID {
+		t.Errorf("guest reply parent = %v, want %d", post.ParentPostID, parent.ID)
+	}
+
+	// The reserved row is not an account anyone can find or sign in as.
+	if _, err := e.DB.GetUserByID(forum.GuestAuthorID); !errors.Is(err, forum.ErrNotFound) {
+		t.Errorf("GetUserByID(GuestAuthorID) = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,243 @@
+// forum/reports.go
+package forum
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportReasonOther is the catch-all reason that must come with an explanation.
+const ReportReasonOther = "other"
+
+// Outcomes a moderator can record when resolving reports.
+const (
+	OutcomeNoAction      = "no_action"
+	OutcomePostRemoved   = "post_removed"
+	OutcomeUserWarned    = "user_warned"
+	OutcomeUserSuspended = "user_suspended"
+	OutcomeDuplicate     = "duplicate"
+)
+
+// ReportOutcomes lists every valid resolution outcome.
+var ReportOutcomes = []string{OutcomeNoAction, OutcomePostRemoved, OutcomeUserWarned, OutcomeUserSuspended, OutcomeDuplicate}
+
+// Report is a member flagging a post for moderator attention.
+type Report struct {
+	ID            int64      `json:"id" db:"id"`
+	PostID        int64      `json:"post_id" db:"post_id"`
+	ReporterID    string     `json:"reporter_id" db:"reporter_id"`
+	ReporterTrust int        `json:"reporter_trust" db:"reporter_trust"`
+	ReasonCode    string     `json:"reason_code" db:"reason_code"`
+	Reason        string     `json:"reason" db:"reason"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	Outcome       *string    `json:"outcome" db:"outcome"`
+	ResolvedBy    *string    `json:"resolved_by" db:"resolved_by"`
+	ResolvedAt    *time.Time `json:"resolved_at" db:"resolved_at"`
+}
+
+// ModerationStats breaks moderation load down by category.
+type ModerationStats struct {
+	Since            time.Time      `json:"since"`
+	OpenReports      int            `json:"open_reports"`
+	ReportsByReason  map[string]int `json:"reports_by_reason"`
+	ReportsByOutcome map[string]int `json:"reports_by_outcome"`
+}
+
+// reportReasons returns the configured reasons, always ending with "other".
+func (h *Handlers) reportReasons() []string {
+	var reasons []string
+	for _, r := range h.config.ReportReasons {
+		if r != ReportReasonOther {
+			reasons = append(reasons, r)
+		}
+	}
+	return append(reasons, ReportReasonOther)
+}
+
+// validReportReason reports whether code is one of the configured reasons.
+func (h *Handlers) validReportReason(code string) bool {
+	for _, r := range h.reportReasons() {
+		if r == code {
+			return true
+		}
+	}
+	return false
+}
+
+func validOutcome(outcome string) bool {
+	for _, o := range ReportOutcomes {
+		if o == outcome {
+			return true
+		}
+	}
+	return false
+}
+
+// flagPost serves POST /posts/{id}/flag. Each member can flag a post once.
+func (h *Handlers) flagPost(w http.ResponseWriter, r *http.Request, postID int64) {
+	user, ok := r.Context().Value(userContextKey).(*User)
+	if !ok || user == nil {
+		http.Error(w, "You must be logged in to flag posts", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+
+	post, err := h.db.GetPost(postID)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+
+	reasonCode := r.FormValue("reason_code")
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if !h.validReportReason(reasonCode) {
+		http.Error(w, "Please choose a reason for flagging this post", http.StatusBadRequest)
+		return
+	}
+	if reasonCode == ReportReasonOther && reason == "" {
+		http.Error(w, "Please explain why you are flagging this post", http.StatusBadRequest)
+		return
+	}
+
+	trust, err := h.db.TrustLevel(user)
+	if err != nil {
+		log.Printf("Error computing trust level: %v", err)
+	}
+	report := Report{
+		PostID:        post.ID,
+		ReporterID:    user.ID,
+		ReporterTrust: trust,
+		ReasonCode:    reasonCode,
+		Reason:        reason,
+	}
+	created, err := h.db.CreateReport(&report)
+	if err != nil {
+		log.Printf("Error creating report: %v", err)
+		http.Error(w, "Failed to flag post", http.StatusInternalServerError)
+		return
+	}
+	if created {
+		item := QueueItem{
+			Kind:        QueueReport,
+			UserID:      user.ID,
+			SubjectType: "post",
+			SubjectID:   strconv.FormatInt(post.ID, 10),
+			Body:        strings.TrimSpace(report.ReasonCode + ": " + report.Reason),
+		}
+		if err := h.db.CreateQueueItem(&item); err != nil {
+			log.Printf("Error queueing report: %v", err)
+		}
+		h.enforceRules(RuleEventFlag, post)
+	}
+
+	http.Redirect(w, r, "/topics/"+post.TopicID, http.StatusSeeOther)
+}
+
+// --- Report Database Functions ---
+
+// CreateReport stores a report, returning false if this member already flagged the post.
+func (d *Database) CreateReport(report *Report) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO reports (post_id, reporter_id, reporter_trust, reason_code, reason)
+              VALUES ($1, $2, $3, $4, $5)
+              ON CONFLICT (post_id, reporter_id) DO NOTHING
+              RETURNING id, created_at`
+	rows, err := d.pool.Query(ctx, query, report.PostID, report.ReporterID, report.ReporterTrust, report.ReasonCode, report.Reason)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	if err := rows.Scan(&report.ID, &report.CreatedAt); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CountReports returns how many members flagged a post, and how many of them
+// were at or above trustedLevel when they did.
+func (d *Database) CountReports(postID int64, trustedLevel int) (int, int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var total, trusted int
+	query := `SELECT COUNT(*), COUNT(*) FILTER (WHERE reporter_trust >= $2) FROM reports WHERE post_id = $1`
+	err := d.pool.QueryRow(ctx, query, postID, trustedLevel).Scan(&total, &trusted)
+	return total, trusted, err
+}
+
+// ResolveReports records an outcome on every open report of a post.
+func (d *Database) ResolveReports(postID int64, outcome, resolverID string) (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `UPDATE reports SET outcome = $2, resolved_by = $3, resolved_at = NOW()
+              WHERE post_id = $1 AND resolved_at IS NULL`
+	tag, err := d.pool.Exec(ctx, query, postID, outcome, resolverID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetModerationStats counts reports filed since the given time by reason and outcome.
+func (d *Database) GetModerationStats(since time.Time) (*ModerationStats, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	stats := &ModerationStats{
+		Since:            since,
+		ReportsByReason:  map[string]int{},
+		ReportsByOutcome: map[string]int{},
+	}
+	query := `SELECT reason_code, COALESCE(outcome, 'open'), COUNT(*) FROM reports
+              WHERE created_at >= $1
+              GROUP BY reason_code, COALESCE(outcome, 'open')`
+	rows, err := d.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reason, outcome string
+		var count int
+		if err := rows.Scan(&reason, &outcome, &count); err != nil {
+			return nil, err
+		}
+		stats.ReportsByReason[reason] += count
+		if outcome == "open" {
+			stats.OpenReports += count
+		} else {
+			stats.ReportsByOutcome[outcome] += count
+		}
+	}
+	return stats, rows.Err()
+}
+
+// moderationStatsHandler serves GET /api/stats/moderation?days=N for admins.
+func (h *Handlers) moderationStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+	db := h.db.WithContext(r.Context()).WithTimeout(h.config.SearchTimeout)
+	stats, err := db.GetModerationStats(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Printf("Error getting moderation stats: %v", err)
+		http.Error(w, "Failed to retrieve stats", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
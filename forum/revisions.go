@@ -0,0 +1,254 @@
+// forum/revisions.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// --- Revision Database Functions ---
+
+// UpdatePostBody replaces a post's body and records the edit in post_revisions.
+// The first edit also snapshots the original body so the full history is kept.
+// With a non-zero version the edit only applies if the post is still at that
+// version, and ErrConflict is returned otherwise.
+func (d *Database) UpdatePostBody(post *Post, body string, editor *User, version int) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO post_revisions (post_id, editor_id, editor, body, created_at)
+        SELECT id, author_id, author, body, created_at FROM posts
+        WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM post_revisions WHERE post_id = $1)`,
+		post.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := `UPDATE posts SET body = $2, updated_at = $3, version = version + 1
+              WHERE id = $1 AND ($4 = 0 OR version = $4)
+              RETURNING version`
+	var newVersion int
+	err = tx.QueryRow(ctx, query, post.ID, body, now, version).Scan(&newVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+        INSERT INTO post_revisions (post_id, editor_id, editor, body, created_at)
+        VALUES ($1, $2, $3, $4, $5)`,
+		post.ID, editor.ID, editor.Handle, body, now)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	post.Body = body
+	post.UpdatedAt = &now
+	post.Version = newVersion
+	return nil
+}
+
+// SetPostWiki flags or unflags a post as a wiki.
+func (d *Database) SetPostWiki(postID int64, wiki bool) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE posts SET wiki = $2 WHERE id = $1`, postID, wiki)
+	return err
+}
+
+// GetPostRevisions returns every saved version of a post, oldest first.
+func (d *Database) GetPostRevisions(postID int64) ([]PostRevision, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT id, post_id, editor_id, editor, body, created_at FROM post_revisions
+              WHERE post_id = $1
+              ORDER BY created_at ASC, id ASC`
+	rows, err := d.pool.Query(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisions []PostRevision
+	for rows.Next() {
+		var rev PostRevision
+		if err := rows.Scan(&rev.ID, &rev.PostID, &rev.EditorID, &rev.Editor, &rev.Body, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// RevisionsViewData is the data structure for a post's edit history page.
+type RevisionsViewData struct {
+	User      *Viewer
+	Post      PostView
+	Revisions []PostRevision
+	From      *PostRevision
+	To        *PostRevision
+	Diff      []DiffOp
+}
+
+// canSeeHistory reports whether user may browse edit history. Staff always can;
+// everyone else only when the instance makes edit history public.
+func (h *Handlers) canSeeHistory(user *User) bool {
+	return h.config.PublicEditHistory || (user != nil && user.Admin)
+}
+
+// historyPost loads the post whose edit history user asked for. Staff get any
+// post, removed ones included; anyone else only visible posts, so the earlier
+// bodies of held and hidden posts stay out of view.
+func (h *Handlers) historyPost(user *User, id int64) (*Post, error) {
+	if user != nil && user.Admin {
+		return h.db.GetPostIncludeDeleted(id)
+	}
+	post, err := h.db.GetPost(id)
+	if err == nil && post.State != PostVisible {
+		return nil, ErrNotFound
+	}
+	return post, err
+}
+
+// RevisionDiff is the body of GET /api/admin/posts/{id}/revisions: the
+// post's revisions, oldest first, and the word-level changes from From to To.
+type RevisionDiff struct {
+	PostID    int64          `json:"post_id"`
+	Revisions []PostRevision `json:"revisions"`
+	From      *PostRevision  `json:"from"`
+	To        *PostRevision  `json:"to"`
+	Diff      []DiffOp       `json:"diff"`
+}
+
+// showRevisions renders a word-level diff between two revisions of a post,
+// selected with ?from= and ?to= revision IDs. It defaults to the latest edit.
+// Staff can also look back at the history of removed posts.
+func (h *Handlers) showRevisions(w http.ResponseWriter, r *http.Request, postID int64) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if !h.canSeeHistory(user) {
+		http.Error(w, "Edit history is only visible to staff", http.StatusForbidden)
+		return
+	}
+
+	post, err := h.historyPost(user, postID)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+
+	revisions, err := h.db.WithContext(r.Context()).GetPostRevisions(postID)
+	if err != nil {
+		log.Printf("Error getting revisions: %v", err)
+		http.Error(w, "Failed to retrieve revisions", http.StatusInternalServerError)
+		return
+	}
+
+	data := RevisionsViewData{User: NewViewer(user), Post: NewPostView(post), Revisions: revisions}
+	if len(revisions) > 0 {
+		data.From, data.To = defaultRevisions(revisions)
+		if rev := findRevision(revisions, r.URL.Query().Get("from")); rev != nil {
+			data.From = rev
+		}
+		if rev := findRevision(revisions, r.URL.Query().Get("to")); rev != nil {
+			data.To = rev
+		}
+		data.Diff = WordDiff(data.From.Body, data.To.Body)
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "revisions.html", data); err != nil {
+		log.Printf("Error executing revisions template: %v", err)
+	}
+}
+
+// revisionDiffAPI serves GET /api/admin/posts/{id}/revisions, the JSON
+// counterpart of the edit history page for moderation tools. Unlike the
+// page, it rejects ?from= and ?to= values that aren't revisions of the post.
+func (h *Handlers) revisionDiffAPI(w http.ResponseWriter, r *http.Request, idStr string) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	post, err := h.historyPost(user, id)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+	revisions, err := h.db.WithContext(r.Context()).GetPostRevisions(post.ID)
+	if err != nil {
+		writeError(w, err, "revision")
+		return
+	}
+	resp := RevisionDiff{PostID: post.ID, Revisions: revisions, Diff: []DiffOp{}}
+	if resp.Revisions == nil {
+		resp.Revisions = []PostRevision{}
+	}
+	q := r.URL.Query()
+	if len(revisions) == 0 {
+		if q.Get("from") != "" || q.Get("to") != "" {
+			writeError(w, invalid("from", "this post has never been edited"), "revision")
+			return
+		}
+		writeJSON(w, resp)
+		return
+	}
+	resp.From, resp.To = defaultRevisions(revisions)
+	problems := &ValidationError{}
+	if v := q.Get("from"); v != "" {
+		if resp.From = findRevision(revisions, v); resp.From == nil {
+			problems.Add("from", "no such revision of this post")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if resp.To = findRevision(revisions, v); resp.To == nil {
+			problems.Add("to", "no such revision of this post")
+		}
+	}
+	if err := problems.OrNil(); err != nil {
+		writeError(w, err, "revision")
+		return
+	}
+	resp.Diff = WordDiff(resp.From.Body, resp.To.Body)
+	writeJSON(w, resp)
+}
+
+// defaultRevisions picks what to compare when nothing is asked for: the
+// latest edit, or the only revision against itself.
+func defaultRevisions(revisions []PostRevision) (from, to *PostRevision) {
+	to = &revisions[len(revisions)-1]
+	from = to
+	if len(revisions) > 1 {
+		from = &revisions[len(revisions)-2]
+	}
+	return from, to
+}
+
+// findRevision looks up a revision by its ID as given in a query string.
+func findRevision(revisions []PostRevision, idStr string) *PostRevision {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil
+	}
+	for i := range revisions {
+		if revisions[i].ID == id {
+			return &revisions[i]
+		}
+	}
+	return nil
+}
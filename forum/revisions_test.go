@@ -0,0 +1,63 @@
+// forum/revisions_test.go
+package forum_test
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rexlx/volconvo/forum"
+	"github.com/rexlx/volconvo/forumtest"
+)
+
+// TestRevisionsOfHeldPosts checks that public edit history doesn't show the
+// revisions of a post held for moderation to anyone but staff.
+func TestRevisionsOfHeldPosts(t *testing.T) {
+	e := forumtest.New(t, func(c *forum.Config) { c.PublicEditHistory = true })
+	member := e.User()
+	admin := e.Admin()
+	topic := e.Topic(member, "Edit history")
+
+	edited := func(body string) *forum.Post {
+		p := e.Post(topic, member, body, nil)
+		if err := e.DB.UpdatePostBody(p, body+", edited", member, 0); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	visible := edited("visible post")
+	held := edited("held post")
+	if err := e.DB.SetPostState(held.ID, forum.PostHeld); err != nil {
+		t.Fatal(err)
+	}
+
+	page := func(p *forum.Post) *http.Request {
+		return e.Request(http.MethodGet, "/posts/"+strconv.FormatInt(p.ID, 10)+"/revisions", nil)
+	}
+	api := func(p *forum.Post) *http.Request {
+		return e.Request(http.MethodGet, "/api/admin/posts/"+strconv.FormatInt(p.ID, 10)+"/revisions", nil)
+	}
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"Anonymous/visible", page(visible), http.StatusOK},
+		{"Anonymous/held", page(held), http.StatusNotFound},
+		{"Member/held", e.As(member, page(held)), http.StatusNotFound},
+		{"Admin/held", e.As(admin, page(held)), http.StatusOK},
+		{"API/admin/held", e.WithAPIKey(admin, api(held)), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := e.Do(tt.req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body:\n%s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusNotFound && strings.Contains(rec.Body.String(), "held post") {
+				t.Errorf("refusal shows the held post:\n%s", rec.Body.String())
+			}
+		})
+	}
+}
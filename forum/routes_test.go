@@ -0,0 +1,45 @@
+// forum/routes_test.go
+package forum_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rexlx/volconvo/forumtest"
+)
+
+// TestRouteGroups makes one request per route group in RegisterRoutes, as
+// each kind of caller, so a route moved to the wrong group shows up.
+func TestRouteGroups(t *testing.T) {
+	e := forumtest.New(t)
+	member := e.User()
+	admin := e.Admin()
+	topic := e.Topic(member, "Route groups")
+	e.Post(topic, member, "First post", nil)
+
+	get := func(target string) *http.Request { return e.Request(http.MethodGet, target, nil) }
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"public", get("/login"), http.StatusOK},
+		{"visitors/anonymous", get("/topics/" + topic.ID), http.StatusOK},
+		{"visitors/member", e.As(member, get("/topics")), http.StatusOK},
+		{"members/anonymous", get("/settings"), http.StatusSeeOther},
+		{"members/member", e.As(member, get("/settings")), http.StatusOK},
+		{"staff/member", e.As(member, get("/admin/queue")), http.StatusForbidden},
+		{"staff/admin", e.As(admin, get("/admin/queue")), http.StatusOK},
+		{"api/anonymous", get("/api/search/suggest?q=route"), http.StatusOK},
+		{"api members/anonymous", e.Request(http.MethodPost, "/api/notifications/delete", nil), http.StatusUnauthorized},
+		{"api staff/member", e.WithAPIKey(member, get("/api/stats/moderation")), http.StatusForbidden},
+		{"api staff/admin", e.WithAPIKey(admin, get("/api/stats/moderation")), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := e.Do(tt.req); rec.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.req.Method, tt.req.URL, rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+// forum/rules.go
+package forum
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events that moderation rules can be attached to.
+const (
+	RuleEventPostCreate = "post_create"
+	RuleEventPostEdit   = "post_edit"
+	RuleEventFlag       = "flag"
+)
+
+// Actions a matching rule can take on the post.
+const (
+	RuleActionHold = "hold"
+	RuleActionHide = "hide"
+)
+
+// Facts that rule conditions can test. Every fact is an integer.
+const (
+	FactAccountAgeDays = "account_age_days"
+	FactLinkCount      = "link_count"
+	FactBodyLength     = "body_length"
+	FactTrustLevel     = "trust_level"
+	FactTrustedFlags   = "trusted_flags"
+	FactFlags          = "flags"
+)
+
+var ruleFacts = []string{FactAccountAgeDays, FactLinkCount, FactBodyLength, FactTrustLevel, FactTrustedFlags, FactFlags}
+
+var linkPattern = regexp.MustCompile(`(?i)https?://`)
+
+// RuleCondition compares one fact against a value, e.g. link_count > 3.
+type RuleCondition struct {
+	Fact  string `json:"fact"`
+	Op    string `json:"op"`
+	Value int    `json:"value"`
+}
+
+// ModRule is an admin-defined IF conditions THEN action rule. All conditions
+// must hold for the rule to match. Rules in dry-run mode only record matches
+// in the audit log.
+type ModRule struct {
+	ID         int64           `json:"id" db:"id"`
+	Name       string          `json:"name" db:"name"`
+	Event      string          `json:"event" db:"event"`
+	Conditions []RuleCondition `json:"conditions" db:"conditions"`
+	Action     string          `json:"action" db:"action"`
+	Enabled    bool            `json:"enabled" db:"enabled"`
+	DryRun     bool            `json:"dry_run" db:"dry_run"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// RulesViewData is the data structure for the admin rules page.
+type RulesViewData struct {
+	User    *Viewer
+	Rules   []ModRule
+	NewRule ModRule
+	Facts   []string
+	Error   string
+}
+
+// Validate checks that a rule only refers to known events, facts, and actions.
+func (rule *ModRule) Validate() error {
+	switch rule.Event {
+	case RuleEventPostCreate, RuleEventPostEdit, RuleEventFlag:
+	default:
+		return fmt.Errorf("unknown event %q", rule.Event)
+	}
+	switch rule.Action {
+	case RuleActionHold, RuleActionHide:
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	if rule.Name == "" {
+		return fmt.Errorf("rule name is required")
+	}
+	if len(rule.Conditions) == 0 {
+		return fmt.Errorf("at least one condition is required")
+	}
+	for _, c := range rule.Conditions {
+		known := false
+		for _, f := range ruleFacts {
+			known = known || f == c.Fact
+		}
+		if !known {
+			return fmt.Errorf("unknown fact %q", c.Fact)
+		}
+		switch c.Op {
+		case "<", "<=", ">", ">=", "==", "!=":
+		default:
+			return fmt.Errorf("unknown operator %q", c.Op)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether every condition holds for the given facts.
+func (rule *ModRule) Matches(facts map[string]int) bool {
+	for _, c := range rule.Conditions {
+		v := facts[c.Fact]
+		var ok bool
+		switch c.Op {
+		case "<":
+			ok = v < c.Value
+		case "<=":
+			ok = v <= c.Value
+		case ">":
+			ok = v > c.Value
+		case ">=":
+			ok = v >= c.Value
+		case "==":
+			ok = v == c.Value
+		case "!=":
+			ok = v != c.Value
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// postFacts gathers the facts rules can test about a post and its author.
+func (h *Handlers) postFacts(post *Post) (map[string]int, error) {
+	var author *User
+	if !post.ByGuest() {
+		var err error
+		if author, err = h.db.GetUserByID(post.AuthorID); err != nil {
+			return nil, err
+		}
+	}
+	trust, err := h.db.TrustLevel(author)
+	if err != nil {
+		return nil, err
+	}
+	facts := map[string]int{
+		FactLinkCount:  len(linkPattern.FindAllStringIndex(post.Body, -1)),
+		FactBodyLength: len([]rune(post.Body)),
+		FactTrustLevel: trust,
+	}
+	if author != nil {
+		facts[FactAccountAgeDays] = int(time.Since(author.Created).Hours() / 24)
+	}
+	if post.ID != 0 {
+		flags, trusted, err := h.db.CountReports(post.ID, h.config.TrustedFlagLevel)
+		if err != nil {
+			return nil, err
+		}
+		facts[FactFlags] = flags
+		facts[FactTrustedFlags] = trusted
+	}
+	return facts, nil
+}
+
+// applyRules evaluates every enabled rule for event against post and returns
+// the state the post should be in along with the rules that matched. Hide wins
+// over hold, and dry-run rules match without changing the outcome.
+func (h *Handlers) applyRules(event string, post *Post) (string, []ModRule) {
+	state := post.State
+	if state == "" {
+		state = PostVisible
+	}
+	rules, err := h.db.ListRules(event)
+	if err != nil {
+		log.Printf("Error loading moderation rules: %v", err)
+		return state, nil
+	}
+	if len(rules) == 0 {
+		return state, nil
+	}
+	facts, err := h.postFacts(post)
+	if err != nil {
+		log.Printf("Error gathering rule facts: %v", err)
+		return state, nil
+	}
+
+	var matched []ModRule
+	for _, rule := range rules {
+		if !rule.Matches(facts) {
+			continue
+		}
+		matched = append(matched, rule)
+		if rule.DryRun {
+			continue
+		}
+		switch rule.Action {
+		case RuleActionHide:
+			state = PostHidden
+		case RuleActionHold:
+			if state != PostHidden {
+				state = PostHeld
+			}
+		}
+	}
+	return state, matched
+}
+
+// auditRuleMatches records each matched rule against the post in the audit log.
+func (h *Handlers) auditRuleMatches(event string, post *Post, matched []ModRule) {
+	for _, rule := range matched {
+		h.audit(nil, "rule.match", "post", strconv.FormatInt(post.ID, 10), map[string]string{
+			"rule":    rule.Name,
+			"event":   event,
+			"action":  rule.Action,
+			"dry_run": strconv.FormatBool(rule.DryRun),
+		})
+	}
+}
+
+// enforceRules runs the rules for an existing post and, if its state changed,
+// saves the new state and queues it for review.
+func (h *Handlers) enforceRules(event string, post *Post) {
+	state, matched := h.applyRules(event, post)
+	h.auditRuleMatches(event, post, matched)
+	if state == post.State {
+		return
+	}
+	if err := h.db.SetPostState(post.ID, state); err != nil {
+		log.Printf("Error updating post state: %v", err)
+		return
+	}
+	post.State = state
+	h.queueModeratedPost(post)
+}
+
+// postStateAction is the audit action recorded when a post leaves the visible state.
+func postStateAction(state string) string {
+	return "post." + state
+}
+
+// queueModeratedPost puts a held or hidden post in the moderation queue and
+// records the change in the audit log.
+func (h *Handlers) queueModeratedPost(post *Post) {
+	if post.State == PostVisible {
+		return
+	}
+	h.audit(nil, postStateAction(post.State), "post", strconv.FormatInt(post.ID, 10), map[string]string{
+		"topic_id":  post.TopicID,
+		"author_id": post.AuthorID,
+	})
+	item := QueueItem{
+		Kind:        QueueModeratedPost,
+		UserID:      post.AuthorID,
+		SubjectType: "post",
+		SubjectID:   strconv.FormatInt(post.ID, 10),
+		Body:        fmt.Sprintf("[%s] %s", post.State, post.Body),
+	}
+	if err := h.db.CreateQueueItem(&item); err != nil {
+		log.Printf("Error queueing moderated post: %v", err)
+	}
+}
+
+// showRules renders the admin rules editor.
+func (h *Handlers) showRules(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	rules, err := h.db.ListAllRules()
+	if err != nil {
+		log.Printf("Error listing rules: %v", err)
+		http.Error(w, "Failed to retrieve rules", http.StatusInternalServerError)
+		return
+	}
+	data := RulesViewData{
+		User:  NewViewer(user),
+		Rules: rules,
+		// New rules start in dry-run mode so admins can watch them before they act.
+		NewRule: ModRule{Event: RuleEventPostCreate, Action: RuleActionHold, Enabled: true, DryRun: true},
+		Facts:   ruleFacts,
+		Error:   errMsg,
+	}
+	if err := h.templates.ExecuteTemplate(w, "rules.html", data); err != nil {
+		log.Printf("Error executing rules template: %v", err)
+	}
+}
+
+// saveRule serves POST /admin/rules. An "id" form value updates that rule;
+// otherwise a new one is created. Conditions are given one per line as
+// "fact op value", e.g. "link_count > 3".
+func (h *Handlers) saveRule(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	rule := ModRule{
+		Name:    strings.TrimSpace(r.FormValue("name")),
+		Event:   r.FormValue("event"),
+		Action:  r.FormValue("action"),
+		Enabled: r.FormValue("enabled") == "on",
+		DryRun:  r.FormValue("dry_run") == "on",
+	}
+	conditions, err := parseRuleConditions(r.FormValue("conditions"))
+	if err != nil {
+		h.showRules(w, r, err.Error())
+		return
+	}
+	rule.Conditions = conditions
+	if err := rule.Validate(); err != nil {
+		h.showRules(w, r, err.Error())
+		return
+	}
+
+	action := "rule.create"
+	if id := r.FormValue("id"); id != "" {
+		rule.ID, err = strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+		action = "rule.update"
+	}
+	if err := h.db.SaveRule(&rule); err != nil {
+		log.Printf("Error saving rule: %v", err)
+		http.Error(w, "Failed to save rule", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, action, "rule", strconv.FormatInt(rule.ID, 10), map[string]string{
+		"name":    rule.Name,
+		"enabled": strconv.FormatBool(rule.Enabled),
+		"dry_run": strconv.FormatBool(rule.DryRun),
+	})
+	http.Redirect(w, r, "/admin/rules", http.StatusSeeOther)
+}
+
+// deleteRule serves POST /admin/rules/{id}/delete.
+func (h *Handlers) deleteRule(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.DeleteRule(id); err != nil {
+		log.Printf("Error deleting rule: %v", err)
+		http.Error(w, "Failed to delete rule", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "rule.delete", "rule", idStr, nil)
+	http.Redirect(w, r, "/admin/rules", http.StatusSeeOther)
+}
+
+// parseRuleConditions reads one "fact op value" condition per line.
+func parseRuleConditions(text string) ([]RuleCondition, error) {
+	var conditions []RuleCondition
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("condition %q must look like \"fact op value\"", strings.TrimSpace(line))
+		}
+		v, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("condition %q must compare against a number", strings.TrimSpace(line))
+		}
+		conditions = append(conditions, RuleCondition{Fact: fields[0], Op: fields[1], Value: v})
+	}
+	return conditions, nil
+}
+
+// --- Rule Database Functions ---
+
+const ruleColumns = `id, name, event, conditions, action, enabled, dry_run, created_at`
+
+func (d *Database) queryRules(query string, args ...any) ([]ModRule, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rules []ModRule
+	for rows.Next() {
+		var rule ModRule
+		var conditions []byte
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Event, &conditions, &rule.Action, &rule.Enabled, &rule.DryRun, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(conditions, &rule.Conditions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal conditions for rule %d: %w", rule.ID, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// ListRules returns the enabled rules for an event.
+func (d *Database) ListRules(event string) ([]ModRule, error) {
+	return d.queryRules(`SELECT `+ruleColumns+` FROM mod_rules WHERE enabled AND event = $1 ORDER BY id`, event)
+}
+
+func (d *Database) ListAllRules() ([]ModRule, error) {
+	return d.queryRules(`SELECT ` + ruleColumns + ` FROM mod_rules ORDER BY id`)
+}
+
+func (d *Database) SaveRule(rule *ModRule) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return err
+	}
+	if rule.ID == 0 {
+		query := `INSERT INTO mod_rules (name, event, conditions, action, enabled, dry_run)
+                  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+		return d.pool.QueryRow(ctx, query,
+			rule.Name, rule.Event, conditions, rule.Action, rule.Enabled, rule.DryRun,
+		).Scan(&rule.ID, &rule.CreatedAt)
+	}
+	query := `UPDATE mod_rules SET name = $2, event = $3, conditions = $4, action = $5, enabled = $6, dry_run = $7
+              WHERE id = $1`
+	_, err = d.pool.Exec(ctx, query,
+		rule.ID, rule.Name, rule.Event, conditions, rule.Action, rule.Enabled, rule.DryRun)
+	return err
+}
+
+func (d *Database) DeleteRule(id int64) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM mod_rules WHERE id = $1`, id)
+	return err
+}
+
+// ConditionText renders the conditions in the one-per-line form the editor accepts.
+func (rule ModRule) ConditionText() string {
+	lines := make([]string, 0, len(rule.Conditions))
+	for _, c := range rule.Conditions {
+		lines = append(lines, fmt.Sprintf("%s %s %d", c.Fact, c.Op, c.Value))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,358 @@
+// forum/scheduled.go
+package forum
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// scheduledBatch is how many due scheduled posts are claimed at a time.
+const scheduledBatch = 20
+
+// publishAtLayout is how the admin form sends publish times, which are
+// read as UTC.
+const publishAtLayout = "2006-01-02T15:04"
+
+// ScheduledPost is an announcement an admin wrote to be published later,
+// either as a new topic with Title and Tags or as a post in TopicID.
+// PublishedAt is set once the scheduler has tried it: PostID on success,
+// Error otherwise.
+type ScheduledPost struct {
+	ID          int64
+	AuthorID    string
+	Author      string
+	TopicID     *string
+	Title       string
+	Tags        []string
+	Body        string
+	PublishAt   time.Time
+	PublishedAt *time.Time
+	PostID      *int64
+	Error       string
+	CreatedAt   time.Time
+}
+
+// ScheduledViewData is the data structure for /admin/scheduled.
+type ScheduledViewData struct {
+	User      *Viewer
+	Pending   []ScheduledPost
+	Published []ScheduledPost
+	Error     string
+}
+
+// StartPublishScheduler publishes scheduled posts as they fall due. Like
+// reminders, several servers can run it at once.
+func (h *Handlers) StartPublishScheduler() {
+	if h.config.PublishInterval <= 0 {
+		log.Printf("Scheduled publishing is off; FORUM_PUBLISH_INTERVAL is %v", h.config.PublishInterval)
+		return
+	}
+	ticker := time.NewTicker(h.config.PublishInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// Claimed posts would only fail to publish.
+		if h.readOnly() {
+			continue
+		}
+		h.publishDue()
+	}
+}
+
+func (h *Handlers) publishDue() {
+	for {
+		due, err := h.db.ClaimDueScheduledPosts(time.Now(), scheduledBatch)
+		if err != nil {
+			log.Printf("Error claiming scheduled posts: %v", err)
+			return
+		}
+		for i := range due {
+			var errText string
+			postID, err := h.publishScheduled(&due[i])
+			if err != nil {
+				log.Printf("Error publishing scheduled post %d: %v", due[i].ID, err)
+				errText = err.Error()
+			}
+			if err := h.db.FinishScheduledPost(due[i].ID, postID, errText); err != nil {
+				log.Printf("Error recording scheduled post %d: %v", due[i].ID, err)
+			}
+		}
+		if len(due) < scheduledBatch {
+			return
+		}
+	}
+}
+
+// publishScheduled creates sp's topic or post and sends the notifications
+// writing it by hand would, returning the new post's ID.
+func (h *Handlers) publishScheduled(sp *ScheduledPost) (*int64, error) {
+	author, err := h.db.GetUserByID(sp.AuthorID)
+	if err != nil {
+		return nil, fmt.Errorf("loading author: %w", err)
+	}
+	post := Post{Author: author.Handle, AuthorID: author.ID, Body: sp.Body}
+	if sp.TopicID != nil {
+		post.TopicID = *sp.TopicID
+		if err := h.db.CreatePost(&post); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, errors.New("the topic no longer exists")
+			}
+			return nil, err
+		}
+		h.publishPost(post)
+		h.subscribeAuthor(&post)
+		h.notifyWatchers(post)
+		return &post.ID, nil
+	}
+
+	topic := Topic{ID: NewTopicID(), Title: sp.Title, Tags: sp.Tags, AuthorID: author.ID}
+	post.TopicID = topic.ID
+	items := []BatchItem{{Type: BatchTopic, Topic: &topic}, {Type: BatchPost, Post: &post}}
+	if _, err := h.db.CreateBatch(items); err != nil {
+		return nil, err
+	}
+	h.publishPost(post)
+	h.subscribeAuthor(&post)
+	h.notifyTagFollowers(&topic, author)
+	return &post.ID, nil
+}
+
+// notifyTagFollowers tells the followers of topic's tags about it, once
+// each, leaving out its author.
+func (h *Handlers) notifyTagFollowers(topic *Topic, author *User) {
+	if len(topic.Tags) == 0 {
+		return
+	}
+	followers, err := h.db.ListTagFollowers(topic.Tags)
+	if err != nil {
+		log.Printf("Error listing tag followers: %v", err)
+		return
+	}
+	for _, id := range followers {
+		if id == author.ID {
+			continue
+		}
+		h.NotifCh <- Notification{
+			From:      author.ID,
+			UserID:    id,
+			CreatedAt: time.Now(),
+			Message:   fmt.Sprintf("%s started %s", author.Handle, topic.Title),
+			Link:      "/topics/" + topic.ID,
+			ID:        uuid.New().String(),
+		}
+	}
+}
+
+// showScheduled renders /admin/scheduled, with errMsg above the form when
+// a submission was refused.
+func (h *Handlers) showScheduled(w http.ResponseWriter, r *http.Request, errMsg string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	posts, err := h.db.ListScheduledPosts()
+	if err != nil {
+		log.Printf("Error listing scheduled posts: %v", err)
+		http.Error(w, "Failed to retrieve scheduled posts", http.StatusInternalServerError)
+		return
+	}
+	data := ScheduledViewData{User: NewViewer(staff), Error: errMsg}
+	for _, sp := range posts {
+		if sp.PublishedAt == nil {
+			data.Pending = append(data.Pending, sp)
+		} else {
+			data.Published = append(data.Published, sp)
+		}
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := h.templates.ExecuteTemplate(w, "scheduled.html", data); err != nil {
+		log.Printf("Error executing scheduled template: %v", err)
+	}
+}
+
+// scheduleAnnouncement serves POST /admin/scheduled. Leaving topic_id
+// empty schedules a new topic, which needs a title.
+func (h *Handlers) scheduleAnnouncement(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	sp := ScheduledPost{
+		AuthorID: staff.ID,
+		Title:    strings.TrimSpace(r.FormValue("title")),
+		Tags:     normalizeTags(strings.Split(r.FormValue("tags"), ",")),
+		Body:     r.FormValue("body"),
+	}
+	publishAt, err := time.ParseInLocation(publishAtLayout, r.FormValue("publish_at"), time.UTC)
+	bodyProblem := h.bodyProblem(sp.Body)
+	switch {
+	case err != nil:
+		h.showScheduled(w, r, "Publish time must be a date and time")
+		return
+	case !publishAt.After(time.Now()):
+		h.showScheduled(w, r, "Publish time must be in the future")
+		return
+	case bodyProblem != "":
+		h.showScheduled(w, r, "Body "+bodyProblem)
+		return
+	}
+	sp.PublishAt = publishAt
+	if id := strings.TrimSpace(r.FormValue("topic_id")); id != "" {
+		topicID, err := uuid.Parse(id)
+		if err != nil {
+			h.showScheduled(w, r, "Topic ID must be a UUID")
+			return
+		}
+		if _, err := h.db.GetTopic(topicID); err != nil {
+			h.showScheduled(w, r, "No such topic")
+			return
+		}
+		topic := topicID.String()
+		sp.TopicID, sp.Title, sp.Tags = &topic, "", nil
+	} else if sp.Title == "" {
+		h.showScheduled(w, r, "A new topic needs a title")
+		return
+	} else if problem := h.titleProblem(sp.Title); problem != "" {
+		h.showScheduled(w, r, "Title "+problem)
+		return
+	}
+	if err := h.db.CreateScheduledPost(&sp); err != nil {
+		log.Printf("Error scheduling post: %v", err)
+		http.Error(w, "Failed to schedule post", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "scheduled.create", "scheduled_post", strconv.FormatInt(sp.ID, 10), map[string]string{
+		"publish_at": sp.PublishAt.Format(time.RFC3339),
+	})
+	http.Redirect(w, r, "/admin/scheduled", http.StatusSeeOther)
+}
+
+// cancelScheduled serves POST /admin/scheduled/{id}/delete. Published posts
+// are left alone.
+func (h *Handlers) cancelScheduled(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.DeleteScheduledPost(id); err != nil {
+		writeError(w, err, "scheduled post")
+		return
+	}
+	h.audit(staff, "scheduled.delete", "scheduled_post", idStr, nil)
+	http.Redirect(w, r, "/admin/scheduled", http.StatusSeeOther)
+}
+
+// --- Scheduled Post Database Functions ---
+
+const scheduledColumns = `s.id, s.author_id, COALESCE(u.handle, ''), s.topic_id, s.title, s.tags, s.body,
+              s.publish_at, s.published_at, s.post_id, s.error, s.created_at`
+
+func scanScheduledPost(row pgx.Row) (*ScheduledPost, error) {
+	var sp ScheduledPost
+	err := row.Scan(&sp.ID, &sp.AuthorID, &sp.Author, &sp.TopicID, &sp.Title, &sp.Tags, &sp.Body,
+		&sp.PublishAt, &sp.PublishedAt, &sp.PostID, &sp.Error, &sp.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+func (d *Database) CreateScheduledPost(sp *ScheduledPost) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	if sp.Tags == nil {
+		sp.Tags = []string{}
+	}
+	query := `INSERT INTO scheduled_posts (author_id, topic_id, title, tags, body, publish_at)
+              VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	return d.pool.QueryRow(ctx, query, sp.AuthorID, sp.TopicID, sp.Title, sp.Tags, sp.Body, sp.PublishAt).Scan(&sp.ID, &sp.CreatedAt)
+}
+
+// ListScheduledPosts returns the pending scheduled posts, soonest first,
+// then the 50 most recently published.
+func (d *Database) ListScheduledPosts() ([]ScheduledPost, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `(SELECT ` + scheduledColumns + ` FROM scheduled_posts s LEFT JOIN users u ON u.id = s.author_id
+               WHERE s.published_at IS NULL ORDER BY s.publish_at)
+              UNION ALL
+              (SELECT ` + scheduledColumns + ` FROM scheduled_posts s LEFT JOIN users u ON u.id = s.author_id
+               WHERE s.published_at IS NOT NULL ORDER BY s.published_at DESC LIMIT 50)`
+	rows, err := d.readQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []ScheduledPost
+	for rows.Next() {
+		sp, err := scanScheduledPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *sp)
+	}
+	return posts, rows.Err()
+}
+
+// ClaimDueScheduledPosts marks up to limit scheduled posts due by now as
+// published and returns them for publishing. As with ClaimDueReminders,
+// rows another server is claiming are skipped.
+func (d *Database) ClaimDueScheduledPosts(now time.Time, limit int) ([]ScheduledPost, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `WITH due AS (
+                  UPDATE scheduled_posts SET published_at = $1 WHERE id IN (
+                      SELECT id FROM scheduled_posts WHERE published_at IS NULL AND publish_at <= $1
+                      ORDER BY publish_at LIMIT $2
+                      FOR UPDATE SKIP LOCKED)
+                  RETURNING *
+              )
+              SELECT ` + scheduledColumns + ` FROM due s LEFT JOIN users u ON u.id = s.author_id
+              ORDER BY s.publish_at`
+	rows, err := d.pool.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []ScheduledPost
+	for rows.Next() {
+		sp, err := scanScheduledPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *sp)
+	}
+	return posts, rows.Err()
+}
+
+// FinishScheduledPost records the outcome of publishing a claimed post.
+func (d *Database) FinishScheduledPost(id int64, postID *int64, errText string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE scheduled_posts SET post_id = $2, error = $3 WHERE id = $1`, id, postID, errText)
+	return err
+}
+
+// DeleteScheduledPost cancels a pending scheduled post. It returns
+// ErrNotFound if there is none or it was published already.
+func (d *Database) DeleteScheduledPost(id int64) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM scheduled_posts WHERE id = $1 AND published_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
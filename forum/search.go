@@ -0,0 +1,269 @@
+// forum/search.go
+package forum
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// searchConfig is the text search configuration for topic titles and post
+// bodies. The schema's generated search columns use it too, so changing it
+// means rebuilding them.
+const searchConfig = "english"
+
+// Kinds of SearchResult.
+const (
+	SearchTopic = "topic"
+	SearchPost  = "post"
+)
+
+// Search result snippets come back from Postgres with matches between these
+// markers rather than in tags, since the text around them isn't escaped.
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// ts_headline options for text shown whole, such as topic titles, and for
+// post bodies cut down to the fragments around the matches.
+var (
+	fullHeadline = "HighlightAll=true, StartSel=" + snippetStart + ", StopSel=" + snippetStop
+	bodyHeadline = "MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" ... \", StartSel=" + snippetStart + ", StopSel=" + snippetStop
+)
+
+// SearchResult is a topic whose title, or a post whose body, matches a
+// search. Snippet holds the matching text with matches between
+// snippetStart and snippetStop.
+type SearchResult struct {
+	Kind       string
+	TopicID    string
+	TopicTitle string
+	// PostID is set for posts.
+	PostID    int64
+	Snippet   string
+	CreatedAt time.Time
+}
+
+// SearchViewData is the data structure for the search page.
+type SearchViewData struct {
+	User       *Viewer
+	Query      string
+	Total      int
+	Results    []SearchResultView
+	Pagination PaginationData
+}
+
+// highlightSnippet escapes a snippet and turns its match markers into
+// <mark> elements. Stray markers from the text itself are dropped, so the
+// elements always pair up.
+func highlightSnippet(s string) template.HTML {
+	var b strings.Builder
+	open := false
+	for {
+		i := strings.IndexAny(s, snippetStart+snippetStop)
+		if i < 0 {
+			b.WriteString(html.EscapeString(s))
+			break
+		}
+		b.WriteString(html.EscapeString(s[:i]))
+		switch start := s[i:i+1] == snippetStart; {
+		case start && !open:
+			b.WriteString("<mark>")
+			open = true
+		case !start && open:
+			b.WriteString("</mark>")
+			open = false
+		}
+		s = s[i+1:]
+	}
+	if open {
+		b.WriteString("</mark>")
+	}
+	return template.HTML(b.String())
+}
+
+// showSearch serves GET /search?q=, a full-text search of topic titles and
+// post bodies with the best matches first.
+func (h *Handlers) showSearch(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize := pageSizeFor(user)
+	data := SearchViewData{User: NewViewer(user), Query: q}
+	if q != "" {
+		db := h.db.WithContext(r.Context())
+		results, err := db.Search(q, page, pageSize)
+		if err != nil {
+			log.Printf("Error searching: %v", err)
+			http.Error(w, "Failed to search", http.StatusInternalServerError)
+			return
+		}
+		total, err := db.CountSearchResults(q)
+		if err != nil {
+			log.Printf("Error counting search results: %v", err)
+			http.Error(w, "Failed to search", http.StatusInternalServerError)
+			return
+		}
+		data.Total = total
+		data.Results = NewSearchResultViews(results)
+		data.Pagination = newPagination(page, total, pageSize, pageLink("/search", url.Values{"q": {q}}))
+	}
+	if err := h.templates.ExecuteTemplate(w, "search.html", data); err != nil {
+		log.Printf("Error executing search template: %v", err)
+	}
+}
+
+// showTopicSearch serves GET /topics/{id}?q=, the topic page listing only
+// the posts that match q, best first, with the matches marked.
+func (h *Handlers) showTopicSearch(w http.ResponseWriter, r *http.Request, topic *Topic, q string, page, pageSize, trust int) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	db := h.db.WithContext(r.Context())
+	topicID := uuid.MustParse(topic.ID)
+	matches, err := db.SearchPostsInTopic(topicID, q, page, pageSize)
+	if err != nil {
+		log.Printf("Error searching topic: %v", err)
+		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
+		return
+	}
+	total, err := db.CountPostsInTopicSearch(topicID, q)
+	if err != nil {
+		log.Printf("Error counting topic search results: %v", err)
+		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
+		return
+	}
+	posts := make([]Post, len(matches))
+	for i := range matches {
+		posts[i] = matches[i].Post
+	}
+	fragments := h.postFragments(topic, posts, user, trust)
+	for i := range fragments {
+		fragments[i].Post.Highlight = highlightSnippet(matches[i].Snippet)
+	}
+	data := h.topicViewData(r, topic)
+	data.Query = q
+	data.Timeline = newTimeline(posts, fragments, nil)
+	data.Pagination = newPagination(page, total, pageSize, pageLink("/topics/"+topic.ID, url.Values{"q": {q}}))
+	if err := h.templates.ExecuteTemplate(w, "topic.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// --- Search Database Functions ---
+
+// searchMatches selects, for the query in the CTE q, the live topics whose
+// titles match and the visible posts whose bodies do, with each match's
+// text as doc and its rank.
+var searchMatches = fmt.Sprintf(`SELECT '%s' AS kind, t.id AS topic_id, t.title, 0::bigint AS post_id, t.title AS doc,
+                     ts_rank(t.search, q.query) AS rank, t.created_at
+              FROM topics t, q
+              WHERE t.search @@ q.query AND %s
+              UNION ALL
+              SELECT '%s', p.topic_id, t.title, p.id::bigint, p.body, ts_rank(p.search, q.query), p.created_at
+              FROM posts p JOIN topics t ON t.id = p.topic_id, q
+              WHERE p.search @@ q.query AND %s AND p.state = '%s' AND %s`,
+	SearchTopic, notDeleted("t"),
+	SearchPost, notDeleted("p"), PostVisible, notDeleted("t"))
+
+// searchQuery is the CTE holding the parsed search, from $1.
+var searchQuery = fmt.Sprintf(`WITH q AS (SELECT websearch_to_tsquery('%s', $1) AS query) `, searchConfig)
+
+// Search returns a page of the topics and posts matching q, the best
+// matches first. q takes web search syntax: quoted phrases, "or" and a
+// leading "-" to exclude a word.
+func (d *Database) Search(q string, page, pageSize int) ([]SearchResult, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	// Snippets are only made for the page being shown; ts_headline is slow.
+	query := searchQuery + fmt.Sprintf(`SELECT r.kind, r.topic_id, r.title, r.post_id,
+                     ts_headline('%s', r.doc, q.query, CASE WHEN r.kind = '%s' THEN $4 ELSE $5 END), r.created_at
+              FROM (%s
+                  ORDER BY rank DESC, created_at DESC, post_id DESC
+                  LIMIT $2 OFFSET $3) r, q
+              ORDER BY r.rank DESC, r.created_at DESC, r.post_id DESC`, searchConfig, SearchTopic, searchMatches)
+	rows, err := d.readQuery(ctx, query, q, pageSize, (page-1)*pageSize, fullHeadline, bodyHeadline)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []SearchResult
+	for rows.Next() {
+		var sr SearchResult
+		if err := rows.Scan(&sr.Kind, &sr.TopicID, &sr.TopicTitle, &sr.PostID, &sr.Snippet, &sr.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, sr)
+	}
+	return results, rows.Err()
+}
+
+// PostMatch is a post found by SearchPostsInTopic. Snippet is its whole
+// body with matches between snippetStart and snippetStop.
+type PostMatch struct {
+	Post
+	Snippet string
+}
+
+// SearchPostsInTopic returns a page of the topic's visible posts matching q,
+// the best matches first and then oldest first.
+func (d *Database) SearchPostsInTopic(topicID uuid.UUID, q string, page, pageSize int) ([]PostMatch, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := fmt.Sprintf(`WITH q AS (SELECT websearch_to_tsquery('%s', $2) AS query)
+              SELECT `+postColumns+`, ts_headline('%s', body, query, $5)
+              FROM (
+                  SELECT posts.*, q.query, ts_rank(posts.search, q.query) AS rank
+                  FROM posts, q
+                  WHERE topic_id = $1 AND search @@ q.query AND state = '%s' AND %s
+                  ORDER BY rank DESC, id
+                  LIMIT $3 OFFSET $4
+              ) m
+              ORDER BY rank DESC, id`, searchConfig, searchConfig, PostVisible, notDeleted("posts"))
+	rows, err := d.readQuery(ctx, query, topicID, q, pageSize, (page-1)*pageSize, fullHeadline)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var matches []PostMatch
+	for rows.Next() {
+		var m PostMatch
+		p := &m.Post
+		if err := rows.Scan(&p.ID, &p.TopicID, &p.Author, &p.Body, &p.CreatedAt, &p.AuthorID, &p.ParentPostID, &p.Wiki, &p.UpdatedAt, &p.State, &p.Version, &p.DeletedAt, &m.Snippet); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// CountPostsInTopicSearch counts the topic's visible posts matching q.
+func (d *Database) CountPostsInTopicSearch(topicID uuid.UUID, q string) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM posts
+              WHERE topic_id = $1 AND search @@ websearch_to_tsquery('%s', $2) AND state = '%s' AND %s`,
+		searchConfig, PostVisible, notDeleted("posts"))
+	var n int
+	err := d.readQueryRow(ctx, query, topicID, q).Scan(&n)
+	return n, err
+}
+
+// CountSearchResults counts the topics and posts matching q.
+func (d *Database) CountSearchResults(q string) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var n int
+	err := d.readQueryRow(ctx, searchQuery+`SELECT COUNT(*) FROM (`+searchMatches+`) r`, q).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,142 @@
+// forum/secrets.go
+package forum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretsDir is where Docker and Kubernetes mount secrets by default.
+const secretsDir = "/run/secrets"
+
+// Secrets resolves credentials without requiring them in plain environment
+// variables. For a secret NAME it tries, in order:
+//
+//  1. the NAME environment variable
+//  2. the file named by NAME_FILE
+//  3. /run/secrets/name (lower-cased, as Docker and Kubernetes mount them)
+//  4. the NAME key of the Vault KV secret at VAULT_SECRET_PATH, if VAULT_ADDR is set
+type Secrets struct {
+	dir        string
+	vaultAddr  string
+	vaultToken string
+	vaultPath  string
+	client     *http.Client
+
+	once      sync.Once
+	vaultData map[string]string
+	vaultErr  error
+}
+
+// SecretsFromEnv configures secret lookup from the environment. The Vault
+// token itself may come from VAULT_TOKEN, VAULT_TOKEN_FILE or a mounted secret.
+func SecretsFromEnv() (*Secrets, error) {
+	s := &Secrets{
+		dir:       secretsDir,
+		vaultAddr: strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+		vaultPath: strings.Trim(os.Getenv("VAULT_SECRET_PATH"), "/"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	if s.vaultAddr == "" {
+		return s, nil
+	}
+	if s.vaultPath == "" {
+		return nil, errors.New("VAULT_SECRET_PATH is required when VAULT_ADDR is set")
+	}
+	token, err := s.local("VAULT_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, errors.New("VAULT_TOKEN or VAULT_TOKEN_FILE is required when VAULT_ADDR is set")
+	}
+	s.vaultToken = token
+	return s, nil
+}
+
+// Get returns the named secret, or "" if it isn't set anywhere.
+func (s *Secrets) Get(name string) (string, error) {
+	v, err := s.local(name)
+	if err != nil || v != "" {
+		return v, err
+	}
+	if s.vaultAddr == "" {
+		return "", nil
+	}
+	s.once.Do(func() { s.vaultData, s.vaultErr = s.fetchVault(context.Background()) })
+	if s.vaultErr != nil {
+		return "", s.vaultErr
+	}
+	return s.vaultData[name], nil
+}
+
+// local looks for a secret in the environment and on disk.
+func (s *Secrets) local(name string) (string, error) {
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return readSecretFile(path)
+	}
+	v, err := readSecretFile(filepath.Join(s.dir, strings.ToLower(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return v, err
+}
+
+func readSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// fetchVault reads every key of the configured secret. Both KV v1 and KV v2
+// response shapes are understood.
+func (s *Secrets) fetchVault(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.vaultAddr+"/v1/"+s.vaultPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", s.vaultToken)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reading vault secret %s: unexpected status %s", s.vaultPath, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding vault secret: %w", err)
+	}
+	fields := body.Data
+	if nested, ok := body.Data["data"]; ok {
+		if err := json.Unmarshal(nested, &fields); err != nil {
+			return nil, fmt.Errorf("decoding vault secret: %w", err)
+		}
+	}
+	data := make(map[string]string, len(fields))
+	for k, raw := range fields {
+		var v string
+		if err := json.Unmarshal(raw, &v); err == nil {
+			data[k] = v
+		}
+	}
+	return data, nil
+}
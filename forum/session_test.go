@@ -0,0 +1,135 @@
+// forum/session_test.go
+package forum_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rexlx/volconvo/forum"
+	"github.com/rexlx/volconvo/forumtest"
+	"github.com/rexlx/volconvo/storetest"
+)
+
+func TestSessions(t *testing.T) {
+	storetest.RunSessions(t, func(t *testing.T) forum.SessionStore { return forumtest.NewDatabase(t) })
+}
+
+// loginPrompt is what the topic page shows visitors who aren't signed in.
+const loginPrompt = `Please <a href="/login">login</a> to post a comment.`
+
+// TestValidateSessionToken checks that a session holding a token that is
+// malformed, unknown or expired is cleared and the request served as
+// anonymous, rather than failing or signing anyone in.
+func TestValidateSessionToken(t *testing.T) {
+	e := forumtest.New(t, func(c *forum.Config) { c.GuestPosting = false })
+	member := e.User()
+	topic := e.Topic(member, "Sessions")
+
+	expired, err := new(forum.Token).CreateToken(member.ID, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.Email, expired.Handle = member.Email, member.Handle
+	if err := e.DB.SaveToken(expired); err != nil {
+		t.Fatal(err)
+	}
+	live, err := new(forum.Token).CreateToken(member.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live.Email, live.Handle = member.Email, member.Handle
+	if err := e.DB.SaveToken(live); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		signedIn  bool
+		keepToken bool
+	}{
+		{"Live", live.Token, true, true},
+		{"Missing", uuid.NewString(), false, false},
+		{"Expired", expired.Token, false, false},
+		{"Malformed", "' OR 1=1 --", false, false},
+	}
+	sm := e.Handlers.Session
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := sm.Load(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sm.Put(ctx, "token", tt.token)
+			cookie, _, err := sm.Commit(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := e.Request(http.MethodGet, "/topics/"+topic.ID, nil)
+			r.AddCookie(&http.Cookie{Name: sm.Cookie.Name, Value: cookie})
+			rec := e.Do(r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d; body:\n%s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			if anonymous := strings.Contains(rec.Body.String(), loginPrompt); anonymous == tt.signedIn {
+				t.Errorf("served anonymously = %t, want %t", anonymous, !tt.signedIn)
+			}
+
+			ctx, err = sm.Load(context.Background(), cookie)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kept := sm.Exists(ctx, "token"); kept != tt.keepToken {
+				t.Errorf("session kept its token = %t, want %t", kept, tt.keepToken)
+			}
+		})
+	}
+}
+
+// TestLoginRenewsSession checks that signing in issues a new session cookie,
+// so a session ID planted before login isn't the one signed in.
+func TestLoginRenewsSession(t *testing.T) {
+	e := forumtest.New(t)
+	member := e.User()
+	sm := e.Handlers.Session
+
+	ctx, err := sm.Load(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Put(ctx, "seen", time.Now().Unix())
+	planted, _, err := sm.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := e.Form("/login", url.Values{"email": {member.Email}, "password": {forumtest.Password}})
+	r.AddCookie(&http.Cookie{Name: sm.Cookie.Name, Value: planted})
+	rec := e.Do(r)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("login status = %d, want %d; body:\n%s", rec.Code, http.StatusSeeOther, rec.Body.String())
+	}
+	var issued string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sm.Cookie.Name {
+			issued = c.Value
+		}
+	}
+	if issued == "" || issued == planted {
+		t.Fatalf("session cookie after login = %q, want a new one (was %q)", issued, planted)
+	}
+
+	ctx, err = sm.Load(context.Background(), planted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Exists(ctx, "token") {
+		t.Error("the session planted before login was signed in")
+	}
+}
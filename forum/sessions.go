@@ -0,0 +1,161 @@
+// forum/sessions.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxUserAgent caps the user agent kept with a session.
+const maxUserAgent = 512
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// UserSession is one of a member's sessions as their sessions page lists
+// it. Current is the session the page was requested with.
+type UserSession struct {
+	SessionInfo
+	Current bool
+}
+
+// SessionsViewData is the data structure for the sessions settings page.
+type SessionsViewData struct {
+	User     *Viewer
+	Sessions []SessionView
+	// Activity is the member's recent sign-ins and other credential use.
+	Activity []AuthEvent
+}
+
+// showSessions serves GET /settings/sessions, the member's signed-in
+// browsers, most recently used first.
+func (h *Handlers) showSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	current, _ := h.GetTokenFromSession(r)
+	db := h.db.WithContext(r.Context())
+	sessions, err := db.ListUserSessions(user.ID, current)
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		http.Error(w, "Failed to retrieve sessions", http.StatusInternalServerError)
+		return
+	}
+	activity, err := db.ListAuthEvents(AuthEventFilter{UserID: user.ID}, recentAuthEvents)
+	if err != nil {
+		log.Printf("Error listing authentication events: %v", err)
+		http.Error(w, "Failed to retrieve recent activity", http.StatusInternalServerError)
+		return
+	}
+	data := SessionsViewData{User: NewViewer(user), Sessions: NewSessionViews(sessions), Activity: activity}
+	if err := h.templates.ExecuteTemplate(w, "sessions.html", data); err != nil {
+		log.Printf("Error executing sessions template: %v", err)
+	}
+}
+
+// revokeSession serves POST /settings/sessions/{id}/revoke, signing one of
+// the member's sessions out. Revoking the current one is logging out.
+func (h *Handlers) revokeSession(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	token, err := h.db.WithContext(r.Context()).DeleteUserToken(user.ID, id)
+	if err != nil {
+		writeError(w, err, "session")
+		return
+	}
+	h.audit(user, "user.session.revoke", "session", id, nil)
+	if current, _ := h.GetTokenFromSession(r); token == current {
+		h.ClearSession(w, r)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/settings/sessions", http.StatusSeeOther)
+}
+
+// revokeAllSessions serves POST /logout/all and POST
+// /settings/sessions/revoke-all, signing the member out everywhere, this
+// browser included, as after a suspected compromise. The browser's session
+// is destroyed outright rather than just losing its token.
+func (h *Handlers) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	n, err := h.db.WithContext(r.Context()).DeleteTokensForUser(user.ID)
+	if err != nil {
+		writeError(w, err, "session")
+		return
+	}
+	h.audit(user, "user.session.revoke_all", "user", user.ID, map[string]string{"sessions": strconv.FormatInt(n, 10)})
+	h.authEvent(r, user, AuthLogout, "", map[string]string{"sessions": strconv.FormatInt(n, 10)})
+	if err := h.Session.Destroy(r.Context()); err != nil {
+		log.Printf("Error destroying session: %v", err)
+		h.ClearSession(w, r)
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// sessionIdle reports whether a login that wasn't remembered has gone
+// SessionIdleTimeout without a request. Otherwise it notes this request.
+func (h *Handlers) sessionIdle(r *http.Request) bool {
+	ctx := r.Context()
+	if h.config.SessionIdleTimeout <= 0 || h.Session.GetBool(ctx, "remember") {
+		return false
+	}
+	now := time.Now()
+	if seen := h.Session.GetInt64(ctx, "seen"); seen != 0 && now.Sub(time.Unix(seen, 0)) > h.config.SessionIdleTimeout {
+		return true
+	}
+	h.Session.Put(ctx, "seen", now.Unix())
+	return false
+}
+
+// --- Session Database Functions ---
+
+// ListUserSessions returns the user's live sessions, marking the one whose
+// token is current.
+func (d *Database) ListUserSessions(userID, current string) ([]UserSession, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.pool.Query(ctx, `
+        SELECT id, user_id, handle, email, ip, user_agent, created_at, expires_at, last_used_at, token = $2
+        FROM tokens
+        WHERE user_id = $1 AND expires_at > NOW()
+        ORDER BY COALESCE(last_used_at, created_at) DESC`, userID, current)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []UserSession
+	for rows.Next() {
+		var s UserSession
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Handle, &s.Email, &s.IP, &s.UserAgent, &s.CreatedAt, &s.ExpiresAt, &s.LastUsedAt, &s.Current); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteUserToken ends one of the user's sessions and returns its token, or
+// ErrNotFound.
+func (d *Database) DeleteUserToken(userID, id string) (string, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var token string
+	err := d.pool.QueryRow(ctx, `DELETE FROM tokens WHERE id = $1 AND user_id = $2 RETURNING token`, id, userID).Scan(&token)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return token, err
+}
@@ -0,0 +1,130 @@
+// forum/sessionstore.go
+package forum
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// sessionStore keeps scs session data in the sessions table, so sessions
+// survive restarts and are shared by every instance. It implements
+// scs.CtxStore.
+type sessionStore struct {
+	db *Database
+}
+
+// FindCtx returns the data of an unexpired session.
+func (s sessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	data, err := s.db.WithContext(ctx).FindSessionData(token)
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+// CommitCtx saves a session. While the database is read-only the change is
+// dropped rather than failing the request: members keep their sessions, but
+// can't sign in or out until writes come back.
+func (s sessionStore) CommitCtx(ctx context.Context, token string, data []byte, expiry time.Time) error {
+	if s.db.ReadOnly() {
+		return nil
+	}
+	err := s.db.WithContext(ctx).SaveSessionData(token, data, expiry)
+	if readOnlyError(err) {
+		return nil
+	}
+	return err
+}
+
+// DeleteCtx removes a session.
+func (s sessionStore) DeleteCtx(ctx context.Context, token string) error {
+	if s.db.ReadOnly() {
+		return nil
+	}
+	err := s.db.WithContext(ctx).DeleteSessionData(token)
+	if readOnlyError(err) {
+		return nil
+	}
+	return err
+}
+
+// Find, Commit and Delete satisfy scs.Store; scs calls the Ctx versions.
+func (s sessionStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+func (s sessionStore) Commit(token string, data []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, data, expiry)
+}
+
+func (s sessionStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// --- Session Store Database Functions ---
+
+// FindSessionData returns the data of an unexpired session, or ErrNotFound.
+func (d *Database) FindSessionData(token string) ([]byte, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var data []byte
+	err := d.pool.QueryRow(ctx, `SELECT data FROM sessions WHERE token = $1 AND expiry > NOW()`, token).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// SaveSessionData creates or replaces a session.
+func (d *Database) SaveSessionData(token string, data []byte, expiry time.Time) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `INSERT INTO sessions (token, data, expiry) VALUES ($1, $2, $3)
+                                ON CONFLICT (token) DO UPDATE SET data = EXCLUDED.data, expiry = EXCLUDED.expiry`,
+		token, data, expiry)
+	return err
+}
+
+// DeleteSessionData removes a session.
+func (d *Database) DeleteSessionData(token string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM sessions WHERE token = $1`, token)
+	return err
+}
+
+// SweepSessions deletes expired sessions every interval. A non-positive
+// interval turns it off, leaving expired rows in place; they are never
+// loaded either way.
+func (d *Database) SweepSessions(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if d.ReadOnly() {
+			continue
+		}
+		if n, err := d.DeleteExpiredSessions(); err != nil {
+			log.Printf("Error deleting expired sessions: %v", err)
+		} else if n > 0 {
+			log.Printf("Deleted %d expired sessions", n)
+		}
+	}
+}
+
+// DeleteExpiredSessions removes expired sessions, returning how many.
+func (d *Database) DeleteExpiredSessions() (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `DELETE FROM sessions WHERE expiry <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
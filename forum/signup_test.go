@@ -0,0 +1,68 @@
+// forum/signup_test.go
+package forum_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/rexlx/volconvo/forum"
+	"github.com/rexlx/volconvo/forumtest"
+)
+
+// TestSignupAdminFlag checks that only an admin can create an admin account
+// through /api/user/create; anyone else asking for one is refused and no
+// account is made.
+func TestSignupAdminFlag(t *testing.T) {
+	e := forumtest.New(t)
+	member := e.User()
+	admin := e.Admin()
+
+	signup := func(handle string) *http.Request {
+		body, err := json.Marshal(map[string]any{
+			"email":    handle + "@example.com",
+			"handle":   handle,
+			"password": forumtest.Password,
+			"admin":    true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := e.Request(http.MethodPost, "/api/user/create", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+	tests := []struct {
+		name   string
+		handle string
+		req    *http.Request
+		want   int
+	}{
+		{"Anonymous", "anon", signup("anon"), http.StatusForbidden},
+		{"Member", "bymember", e.WithAPIKey(member, signup("bymember")), http.StatusForbidden},
+		{"Admin", "byadmin", e.WithAPIKey(admin, signup("byadmin")), http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := e.Do(tt.req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body:\n%s", rec.Code, tt.want, rec.Body.String())
+			}
+			u, err := e.DB.GetUserByEmail(tt.handle + "@example.com")
+			if tt.want != http.StatusCreated {
+				if !errors.Is(err, forum.ErrNotFound) {
+					t.Errorf("refused signup left an account: %v, %v", u, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserByEmail: %v", err)
+			}
+			if !u.Admin {
+				t.Error("account created by an admin with admin set is not an admin")
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// forum/smtp.go
+package forum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// sendMail delivers mail through Config.SMTPAddr. Without one only the
+// recipient and subject are logged: the body may hold a sign-in link.
+func (h *Handlers) sendMail(mail *Mail) error {
+	if h.config.SMTPAddr == "" {
+		log.Printf("No SMTP server configured; mail to %s not sent: %s", mail.To, mail.Subject)
+		return nil
+	}
+	msg, err := mail.message(h.config.MailFrom, time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if h.config.SMTPUsername != "" {
+		host, _, err := net.SplitHostPort(h.config.SMTPAddr)
+		if err != nil {
+			return fmt.Errorf("bad SMTP address %q: %w", h.config.SMTPAddr, err)
+		}
+		auth = smtp.PlainAuth("", h.config.SMTPUsername, h.config.SMTPPassword, host)
+	}
+	if err := smtp.SendMail(h.config.SMTPAddr, auth, h.config.MailFrom, []string{mail.To}, msg); err != nil {
+		return fmt.Errorf("sending mail to %s: %w", mail.To, err)
+	}
+	return nil
+}
+
+// message formats m as a multipart/alternative email, plain text first so
+// clients that can show HTML prefer it.
+func (m *Mail) message(from string, date time.Time) ([]byte, error) {
+	if strings.ContainsAny(from+m.To, "\r\n") {
+		return nil, errors.New("mail addresses can't contain line breaks")
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
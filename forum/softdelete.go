@@ -0,0 +1,168 @@
+// forum/softdelete.go
+package forum
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Topics, posts and users are soft-deleted: deleting one sets deleted_at and
+// the row drops out of every ordinary query, while staff views can still load
+// it through the IncludeDeleted variants. Queries should build their filters
+// from notDeleted and postNotDeleted rather than spelling the condition out, so
+// a new query can't forget part of it.
+
+// notDeleted is the condition that hides soft-deleted rows of the table
+// referenced as alias.
+func notDeleted(alias string) string {
+	return alias + ".deleted_at IS NULL"
+}
+
+// postNotDeleted hides deleted posts and the posts of deleted topics.
+func postNotDeleted(alias string) string {
+	return notDeleted(alias) + ` AND EXISTS (
+                  SELECT 1 FROM topics pt WHERE pt.id = ` + alias + `.topic_id AND ` + notDeleted("pt") + `
+              )`
+}
+
+// --- Soft Delete Database Functions ---
+
+// topicColumns is the column list read by scanTopic.
+const topicColumns = `id, title, tags, created_at, author_id, reply_count, view_count, last_post_at, last_post_author, solution_post_id, version, deleted_at`
+
+// scanTopic reads a single topics row selected with topicColumns.
+func scanTopic(row pgx.Row) (*Topic, error) {
+	var t Topic
+	err := row.Scan(&t.ID, &t.Title, &t.Tags, &t.CreatedAt, &t.AuthorID, &t.ReplyCount, &t.ViewCount, &t.LastPostAt, &t.LastPostAuthor, &t.SolutionPostID, &t.Version, &t.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (d *Database) getTopic(id uuid.UUID, includeDeleted bool) (*Topic, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT ` + topicColumns + ` FROM topics WHERE id = $1`
+	if !includeDeleted {
+		query += ` AND ` + notDeleted("topics")
+	}
+	topic, err := scanTopic(d.readQueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return topic, err
+}
+
+// GetTopicIncludeDeleted is GetTopic for staff views, returning deleted topics too.
+func (d *Database) GetTopicIncludeDeleted(id uuid.UUID) (*Topic, error) {
+	return d.getTopic(id, true)
+}
+
+func (d *Database) getPost(id int64, includeDeleted bool) (*Post, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT ` + postColumns + ` FROM posts WHERE id = $1`
+	if !includeDeleted {
+		query += ` AND ` + postNotDeleted("posts")
+	}
+	post, err := scanPost(d.pool.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return post, err
+}
+
+// GetPostIncludeDeleted is GetPost for staff views, returning deleted posts
+// and posts in deleted topics too.
+func (d *Database) GetPostIncludeDeleted(id int64) (*Post, error) {
+	return d.getPost(id, true)
+}
+
+func (d *Database) getPostsByTopic(topicID uuid.UUID, filter PostFilter, page, pageSize int, includeDeleted bool) ([]Post, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	offset := (page - 1) * pageSize
+	where, args := filter.where([]any{topicID})
+	query := `SELECT ` + postColumns + ` FROM posts WHERE ` + where
+	if !includeDeleted {
+		query += ` AND ` + postNotDeleted("posts")
+	}
+	order, ok := postSorts[filter.Sort]
+	if !ok {
+		order = postSorts[""]
+	}
+	query += fmt.Sprintf(` ORDER BY %s LIMIT $%d OFFSET $%d`, order, len(args)+1, len(args)+2)
+	rows, err := d.readQuery(ctx, query, append(args, pageSize, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *p)
+	}
+	return posts, rows.Err()
+}
+
+// GetPostsByTopicIncludeDeleted is GetPostsByTopic with deleted posts kept
+// in their places, for the topic page to show as placeholders, and the
+// posts chosen and ordered by filter.
+func (d *Database) GetPostsByTopicIncludeDeleted(topicID uuid.UUID, filter PostFilter, page, pageSize int) ([]Post, error) {
+	return d.getPostsByTopic(topicID, filter, page, pageSize, true)
+}
+
+// CountPostsByTopicIncludeDeleted counts what GetPostsByTopicIncludeDeleted
+// pages through. Unlike CountPostsByTopic it can't use reply_count, which
+// leaves deleted posts out.
+func (d *Database) CountPostsByTopicIncludeDeleted(topicID uuid.UUID, filter PostFilter) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	where, args := filter.where([]any{topicID})
+	var count int
+	err := d.readQueryRow(ctx, `SELECT COUNT(*) FROM posts WHERE `+where, args...).Scan(&count)
+	return count, err
+}
+
+// PostPosition counts the posts GetPostsByTopicIncludeDeleted lists before
+// post with no filter, which places it on a page of its topic.
+func (d *Database) PostPosition(post *Post) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT COUNT(*) FROM posts
+              WHERE topic_id = $1 AND state = 'visible' AND (created_at, id) < ($2, $3)`
+	var count int
+	err := d.readQueryRow(ctx, query, post.TopicID, post.CreatedAt, post.ID).Scan(&count)
+	return count, err
+}
+
+// getUser loads the first user matching cond, an expression over users with
+// arg as $1.
+func (d *Database) getUser(cond string, arg any, includeDeleted bool) (*User, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + cond
+	if !includeDeleted {
+		query += ` AND ` + notDeleted("users")
+	}
+	query += ` ORDER BY created_at ASC LIMIT 1`
+	return scanUser(d.pool.QueryRow(ctx, query, arg))
+}
+
+// GetUserByIDIncludeDeleted is GetUserByID for staff views.
+func (d *Database) GetUserByIDIncludeDeleted(id string) (*User, error) {
+	return d.getUser("id = $1", id, true)
+}
+
+// GetUserByEmailIncludeDeleted finds the account holding an email address
+// even if it was deleted, since deleted accounts keep their address.
+func (d *Database) GetUserByEmailIncludeDeleted(email string) (*User, error) {
+	return d.getUser("email = $1", email, true)
+}
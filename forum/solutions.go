@@ -0,0 +1,115 @@
+// forum/solutions.go
+package forum
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// dropHiddenSolution unmarks post $1 as its topic's solution if it is no
+// longer a visible post, so a solved topic always has an answer to show.
+const dropHiddenSolution = `UPDATE topics SET solution_post_id = NULL
+              WHERE solution_post_id = $1 AND NOT EXISTS (
+                  SELECT 1 FROM posts WHERE id = $1 AND state = 'visible' AND deleted_at IS NULL
+              )`
+
+// isSolution reports whether post is topic's accepted answer.
+func isSolution(topic *Topic, post *Post) bool {
+	return topic != nil && topic.SolutionPostID != nil && *topic.SolutionPostID == post.ID
+}
+
+// setSolution serves POST /posts/{id}/solution, marking the post as its
+// topic's accepted answer, or unmarking it when the "solution" form value is
+// "false". Topics have at most one solution, so marking a post replaces any
+// earlier one. Only those who can manage the topic may choose.
+func (h *Handlers) setSolution(w http.ResponseWriter, r *http.Request, postID int64) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	db := h.db.WithContext(r.Context())
+	post, err := db.GetPost(postID)
+	if err != nil {
+		writeError(w, err, "post")
+		return
+	}
+	topic, err := db.GetTopic(uuid.MustParse(post.TopicID))
+	if err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	if !canManageTopic(user, topic) {
+		http.Error(w, "Only the topic's author or an admin can choose its solution", http.StatusForbidden)
+		return
+	}
+
+	solve := r.FormValue("solution") != "false"
+	if solve && post.State != PostVisible {
+		http.Error(w, "Only visible posts can be solutions", http.StatusBadRequest)
+		return
+	}
+	link := postPath(post.ID)
+	if solve == isSolution(topic, post) {
+		http.Redirect(w, r, link, http.StatusSeeOther)
+		return
+	}
+	if solve {
+		err = db.SetTopicSolution(topic.ID, &post.ID)
+	} else {
+		err = db.SetTopicSolution(topic.ID, nil)
+	}
+	if err != nil {
+		// A post deleted or hidden meanwhile is no longer found.
+		writeError(w, err, "post")
+		return
+	}
+	kind := TopicSolved
+	if !solve {
+		kind = TopicUnsolved
+	}
+	h.recordTopicEvents(user, TopicEvent{TopicID: topic.ID, Kind: kind})
+	http.Redirect(w, r, link, http.StatusSeeOther)
+}
+
+// topicSolution returns the view of topic's accepted answer for the top of
+// the topic page, or nil if it has none.
+func (h *Handlers) topicSolution(db *Database, topic *Topic) *PostView {
+	if topic.SolutionPostID == nil {
+		return nil
+	}
+	post, err := db.GetPost(*topic.SolutionPostID)
+	if err != nil {
+		log.Printf("Error loading topic solution: %v", err)
+		return nil
+	}
+	if post.State != PostVisible {
+		return nil
+	}
+	view := NewPostView(post)
+	return &view
+}
+
+// --- Solution Database Functions ---
+
+// SetTopicSolution makes postID the topic's accepted answer, or leaves the
+// topic unsolved if postID is nil. It returns ErrNotFound unless the topic
+// is live and the post is a visible post in it.
+func (d *Database) SetTopicSolution(topicID string, postID *int64) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `UPDATE topics SET solution_post_id = $2
+              WHERE id = $1 AND ` + notDeleted("topics") + ` AND ($2::integer IS NULL OR EXISTS (
+                  SELECT 1 FROM posts WHERE id = $2 AND topic_id = $1 AND state = 'visible' AND deleted_at IS NULL
+              ))`
+	tag, err := d.pool.Exec(ctx, query, topicID, postID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// forum/store.go
+package forum
+
+import "github.com/google/uuid"
+
+// Store is the storage contract for the forum's core records: topics, posts
+// and users. *Database is the Postgres implementation. Another backend must
+// behave the same way, and storetest.Run checks that it does:
+//
+//   - Lookups of missing or soft-deleted records return ErrNotFound, as does
+//     ModifyUser for a missing user.
+//   - Listings page from 1. Topics come newest first and posts oldest first.
+//     Only visible, undeleted posts are listed.
+//   - Topic search matches whole words of titles, ignoring case and word
+//     endings, or a tag exactly. A tag filter keeps topics with all of its
+//     tags or with any of them.
+//   - A non-zero version makes an update conditional. A stale version, or a
+//     stale copy passed to SaveUser, returns ErrConflict. So does saving a
+//     new user (Version 0) whose email is taken.
+type Store interface {
+	CreateTopic(topic *Topic) error
+	GetTopic(id uuid.UUID) (*Topic, error)
+	SearchAndListTopics(filter TopicFilter, page, pageSize int) ([]Topic, error)
+	CountTopics(filter TopicFilter) (int, error)
+	UpdateTopic(topic *Topic, version int) error
+	DeleteTopic(id string) error
+
+	CreatePost(post *Post) error
+	GetPost(id int64) (*Post, error)
+	GetPostsByTopic(topicID uuid.UUID, page, pageSize int) ([]Post, error)
+	CountPostsByTopic(topicID uuid.UUID) (int, error)
+	UpdatePostBody(post *Post, body string, editor *User, version int) error
+	DeletePost(id int64) error
+
+	SaveUser(user *User) error
+	GetUserByID(id string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	ModifyUser(id string, fn func(*User) error) (*User, error)
+}
+
+// SessionStore saves and looks up login sessions. LookupSession never
+// returns a nil token with a nil error: malformed tokens are ErrValidation,
+// unknown ones ErrNotFound and expired ones ErrUnauthorized.
+// storetest.RunSessions checks this.
+type SessionStore interface {
+	SaveToken(token *Token) error
+	LookupSession(value string) (*Token, error)
+}
+
+var (
+	_ Store        = (*Database)(nil)
+	_ SessionStore = (*Database)(nil)
+)
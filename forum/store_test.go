@@ -0,0 +1,16 @@
+// forum/store_test.go
+package forum_test
+
+import (
+	"testing"
+
+	"github.com/rexlx/volconvo/forum"
+	"github.com/rexlx/volconvo/forumtest"
+	"github.com/rexlx/volconvo/storetest"
+)
+
+// TestStore checks *Database against the storage contract. Like every
+// database test it skips unless FORUMTEST_DATABASE_URL is set.
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) forum.Store { return forumtest.NewDatabase(t) })
+}
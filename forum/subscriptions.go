@@ -0,0 +1,152 @@
+// forum/subscriptions.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// watchTopic returns the handler for POST /topics/{id}/watch, or
+// /topics/{id}/unwatch when watch is false. Watchers are notified of every
+// new post in the topic.
+func (h *Handlers) watchTopic(watch bool) func(http.ResponseWriter, *http.Request, uuid.UUID) {
+	return func(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+		user, _ := r.Context().Value(userContextKey).(*User)
+		db := h.db.WithContext(r.Context())
+		if _, err := db.GetTopic(topicID); err != nil {
+			writeError(w, err, "topic")
+			return
+		}
+		var err error
+		if watch {
+			err = db.WatchTopic(user.ID, topicID.String())
+		} else {
+			err = db.UnwatchTopic(user.ID, topicID.String())
+		}
+		if err != nil {
+			log.Printf("Error updating topic subscription: %v", err)
+			http.Error(w, "Failed to update subscription", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/topics/"+topicID.String(), http.StatusSeeOther)
+	}
+}
+
+// subscribeAuthor makes the author of post a watcher of its topic, as
+// posting in a topic does. Guests can't watch.
+func (h *Handlers) subscribeAuthor(post *Post) {
+	if post.ByGuest() {
+		return
+	}
+	if err := h.db.WatchTopic(post.AuthorID, post.TopicID); err != nil {
+		log.Printf("Error subscribing author to topic: %v", err)
+	}
+}
+
+// notifyReply tells the author of parent about post, a reply to it, unless
+// they posted as a guest.
+func (h *Handlers) notifyReply(parent *Post, post Post) {
+	if parent.ByGuest() {
+		return
+	}
+	topicTitle := "Unknown Topic"
+	if t, err := h.db.GetTopic(uuid.MustParse(post.TopicID)); err == nil {
+		topicTitle = t.Title
+	}
+	h.NotifCh <- Notification{
+		From:      post.AuthorID,
+		UserID:    parent.AuthorID,
+		CreatedAt: time.Now(),
+		Message:   fmt.Sprintf("New reply in topic: %s", topicTitle),
+		Link:      postPath(post.ID),
+		ID:        uuid.New().String(),
+	}
+}
+
+// notifyWatchers tells the watchers of post's topic about it, leaving out
+// its author and anyone in skip, who has been notified already. It runs in
+// the background so a busy topic doesn't hold up the request.
+func (h *Handlers) notifyWatchers(post Post, skip ...string) {
+	go func() {
+		topic, err := h.db.GetTopicIncludeDeleted(uuid.MustParse(post.TopicID))
+		if err != nil {
+			log.Printf("Error loading topic for watchers: %v", err)
+			return
+		}
+		watchers, err := h.db.ListTopicWatchers(post.TopicID)
+		if err != nil {
+			log.Printf("Error listing topic watchers: %v", err)
+			return
+		}
+		left := map[string]bool{post.AuthorID: true}
+		for _, id := range skip {
+			left[id] = true
+		}
+		for _, id := range watchers {
+			if left[id] {
+				continue
+			}
+			h.NotifCh <- Notification{
+				From:      post.AuthorID,
+				UserID:    id,
+				CreatedAt: time.Now(),
+				Message:   fmt.Sprintf("%s posted in %s", post.Author, topic.Title),
+				Link:      postPath(post.ID),
+				ID:        uuid.New().String(),
+			}
+		}
+	}()
+}
+
+// --- Subscription Database Functions ---
+
+// IsWatchingTopic reports whether the user watches the topic.
+func (d *Database) IsWatchingTopic(userID, topicID string) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var watching bool
+	err := d.readQueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE user_id = $1 AND topic_id = $2)`, userID, topicID).Scan(&watching)
+	return watching, err
+}
+
+// WatchTopic subscribes the user to the topic. Watching twice is harmless.
+func (d *Database) WatchTopic(userID, topicID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `INSERT INTO subscriptions (user_id, topic_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, userID, topicID)
+	return err
+}
+
+// UnwatchTopic unsubscribes the user from the topic.
+func (d *Database) UnwatchTopic(userID, topicID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM subscriptions WHERE user_id = $1 AND topic_id = $2`, userID, topicID)
+	return err
+}
+
+// ListTopicWatchers returns the IDs of the topic's watchers whose accounts
+// are still active.
+func (d *Database) ListTopicWatchers(topicID string) ([]string, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.readQuery(ctx, `SELECT s.user_id FROM subscriptions s JOIN users u ON u.id = s.user_id
+                                   WHERE s.topic_id = $1 AND `+notDeleted("u"), topicID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,184 @@
+// forum/suggest.go
+package forum
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// suggestMinLength is the shortest query suggestions are looked up for;
+// shorter ones match too much to be useful.
+const suggestMinLength = 2
+
+// Suggestions are the search-as-you-type matches for a query.
+type Suggestions struct {
+	Topics []TopicSuggestion `json:"topics"`
+	Tags   []TagSuggestion   `json:"tags"`
+	Users  []UserSuggestion  `json:"users"`
+}
+
+// TopicSuggestion is a topic whose title matches.
+type TopicSuggestion struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// TagSuggestion is a tag starting with the query, with how many topics use it.
+type TagSuggestion struct {
+	Name   string `json:"name"`
+	Topics int    `json:"topics"`
+}
+
+// UserSuggestion is a member whose handle starts with the query.
+type UserSuggestion struct {
+	Handle string `json:"handle"`
+}
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// suggestHandler serves GET /api/search/suggest?q=. Every list is present,
+// if empty, so the dropdown can render the response as is.
+func (h *Handlers) suggestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if utf8.RuneCountInString(q) < suggestMinLength {
+		writeJSON(w, Suggestions{Topics: []TopicSuggestion{}, Tags: []TagSuggestion{}, Users: []UserSuggestion{}})
+		return
+	}
+	db := h.db.WithContext(r.Context()).WithTimeout(h.config.SuggestTimeout)
+	s, err := db.Suggest(q, h.config.SuggestLimit)
+	if err != nil {
+		log.Printf("Error looking up suggestions: %v", err)
+		http.Error(w, "Failed to look up suggestions", http.StatusInternalServerError)
+		return
+	}
+	// Suggestions are repeated as people type and go stale quickly.
+	w.Header().Set("Cache-Control", "private, max-age=30")
+	writeJSON(w, s)
+}
+
+// DuplicatesResponse is createTopic's answer when the new title is much like
+// existing ones. Sending the topic again with ignore_duplicates creates it.
+type DuplicatesResponse struct {
+	Error      string            `json:"error"`
+	Duplicates []TopicSuggestion `json:"duplicates"`
+}
+
+// findDuplicates returns live topics whose titles are much like title, most
+// alike first, or none if the check is off. It is advisory, so a failed or
+// slow lookup is logged and finds nothing.
+func (h *Handlers) findDuplicates(r *http.Request, title string) []TopicSuggestion {
+	if h.config.DuplicateSimilarity == 0 {
+		return nil
+	}
+	db := h.db.WithContext(r.Context()).WithTimeout(h.config.SuggestTimeout)
+	topics, err := db.SimilarTopics(title, float64(h.config.DuplicateSimilarity)/100, h.config.SuggestLimit)
+	if err != nil {
+		log.Printf("Error looking up duplicate topics: %v", err)
+		return nil
+	}
+	return topics
+}
+
+// --- Suggestion Database Functions ---
+
+// Suggest returns up to limit topics whose titles contain q, tags and handles
+// that start with it. Titles use the trigram index and handles the
+// lower(handle) index. Tags have no index of their own, so they are read
+// from live topics with the limit applied after grouping.
+func (d *Database) Suggest(q string, limit int) (*Suggestions, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	s := &Suggestions{Topics: []TopicSuggestion{}, Tags: []TagSuggestion{}, Users: []UserSuggestion{}}
+	pattern := likeEscaper.Replace(strings.ToLower(q))
+
+	rows, err := d.readQuery(ctx, `SELECT id, title FROM topics
+              WHERE `+notDeleted("topics")+` AND title ILIKE '%' || $1::text || '%'
+              ORDER BY lower(title) LIKE $1::text || '%' DESC, created_at DESC
+              LIMIT $2`, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var t TopicSuggestion
+		if err := rows.Scan(&t.ID, &t.Title); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Topics = append(s.Topics, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.readQuery(ctx, `SELECT tag, COUNT(*) FROM topics, unnest(tags) AS tag
+              WHERE `+notDeleted("topics")+` AND tag LIKE $1::text || '%'
+              GROUP BY tag ORDER BY COUNT(*) DESC, tag
+              LIMIT $2`, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var t TagSuggestion
+		if err := rows.Scan(&t.Name, &t.Topics); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Tags = append(s.Tags, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.readQuery(ctx, `SELECT handle FROM users
+              WHERE `+notDeleted("users")+` AND lower(handle) LIKE $1::text || '%'
+              ORDER BY lower(handle)
+              LIMIT $2`, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u UserSuggestion
+		if err := rows.Scan(&u.Handle); err != nil {
+			return nil, err
+		}
+		s.Users = append(s.Users, u)
+	}
+	return s, rows.Err()
+}
+
+// SimilarTopics returns up to limit live topics whose titles have at least
+// the given trigram similarity to title, most similar first. The % operator
+// lets it use idx_topics_title_trgm; it applies pg_trgm's own threshold, so
+// minimum should be at least that (0.3 by default).
+func (d *Database) SimilarTopics(title string, minimum float64, limit int) ([]TopicSuggestion, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT id, title FROM topics
+              WHERE ` + notDeleted("topics") + ` AND title % $1 AND similarity(title, $1) >= $2
+              ORDER BY similarity(title, $1) DESC, created_at DESC
+              LIMIT $3`
+	rows, err := d.readQuery(ctx, query, title, minimum, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var topics []TopicSuggestion
+	for rows.Next() {
+		var t TopicSuggestion
+		if err := rows.Scan(&t.ID, &t.Title); err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
@@ -0,0 +1,258 @@
+// forum/summary.go
+package forum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Summarizer writes a short summary of a thread. Deployments wire one in
+// through Config.Summarizer, e.g. a client for a language model; the built-in
+// ExtractiveSummarizer needs no outside service. Summaries are cached per
+// topic, so Summarize only runs again once the topic has new posts.
+type Summarizer interface {
+	Summarize(ctx context.Context, topic Topic, posts []Post) (string, error)
+}
+
+// Summarizer names accepted by FORUM_SUMMARIZER.
+const (
+	SummarizerOff        = "off"
+	SummarizerExtractive = "extractive"
+)
+
+// TopicSummary is a cached summary and the posts it was made from.
+type TopicSummary struct {
+	TopicID     string    `json:"topic_id" db:"topic_id"`
+	Summary     string    `json:"summary" db:"summary"`
+	PostCount   int       `json:"post_count" db:"post_count"`
+	LastPostID  int64     `json:"last_post_id" db:"last_post_id"`
+	GeneratedAt time.Time `json:"generated_at" db:"generated_at"`
+	Cached      bool      `json:"cached" db:"-"`
+}
+
+// canSummarize reports whether the summary link is offered for topic.
+func (h *Handlers) canSummarize(topic *Topic) bool {
+	return h.config.Summarizer != nil && topic.ReplyCount >= h.config.SummaryMinPosts
+}
+
+// showSummary serves GET /topics/{id}/summary, returning the cached summary
+// or making a new one when posts were added since.
+func (h *Handlers) showSummary(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	if h.config.Summarizer == nil {
+		http.Error(w, "Summaries are not enabled", http.StatusNotFound)
+		return
+	}
+	db := h.db.WithContext(r.Context())
+	topic, err := db.GetTopic(topicID)
+	if err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	if !h.canSummarize(topic) {
+		http.Error(w, "This topic is too short to summarize", http.StatusBadRequest)
+		return
+	}
+
+	lastPostID, err := db.LastPostID(topicID)
+	if err != nil {
+		log.Printf("Error getting last post: %v", err)
+		http.Error(w, "Failed to summarize topic", http.StatusInternalServerError)
+		return
+	}
+	cached, err := db.GetTopicSummary(topicID)
+	if err != nil {
+		log.Printf("Error getting topic summary: %v", err)
+	}
+	if cached != nil && cached.LastPostID == lastPostID && cached.PostCount == topic.ReplyCount {
+		cached.Cached = true
+		writeJSON(w, cached)
+		return
+	}
+
+	posts, err := db.GetAllPostsByTopic(topicID)
+	if err != nil {
+		log.Printf("Error getting posts to summarize: %v", err)
+		http.Error(w, "Failed to summarize topic", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.config.SummaryTimeout)
+	defer cancel()
+	text, err := h.config.Summarizer.Summarize(ctx, *topic, posts)
+	if err != nil {
+		log.Printf("Error summarizing topic %s: %v", topic.ID, err)
+		http.Error(w, "Failed to summarize topic", http.StatusBadGateway)
+		return
+	}
+	summary := TopicSummary{TopicID: topic.ID, Summary: text, PostCount: len(posts)}
+	if len(posts) > 0 {
+		summary.LastPostID = posts[len(posts)-1].ID
+	}
+	if err := db.SaveTopicSummary(&summary); err != nil {
+		log.Printf("Error caching topic summary: %v", err)
+		summary.GeneratedAt = time.Now()
+	}
+	writeJSON(w, summary)
+}
+
+// ExtractiveSummarizer builds a summary from the thread's own sentences: the
+// opening post's first sentence, then the sentences that use the thread's
+// most frequent words, in the order they were written.
+type ExtractiveSummarizer struct {
+	// Sentences is how many sentences follow the opening one.
+	Sentences int
+}
+
+// Summarize implements Summarizer.
+func (s ExtractiveSummarizer) Summarize(ctx context.Context, topic Topic, posts []Post) (string, error) {
+	if len(posts) == 0 {
+		return "", errors.New("no posts to summarize")
+	}
+	type sentence struct {
+		text  string
+		words []string
+		pos   int
+		score float64
+	}
+	var sentences []sentence
+	freq := map[string]int{}
+	for _, p := range posts {
+		for _, text := range splitSentences(p.Body) {
+			words := summaryWords(text)
+			for _, w := range words {
+				freq[w]++
+			}
+			sentences = append(sentences, sentence{text: text, words: words, pos: len(sentences)})
+		}
+	}
+	if len(sentences) == 0 {
+		return "", errors.New("no text to summarize")
+	}
+	for i := range sentences {
+		if len(sentences[i].words) == 0 {
+			continue
+		}
+		total := 0
+		for _, w := range sentences[i].words {
+			total += freq[w]
+		}
+		sentences[i].score = float64(total) / float64(len(sentences[i].words))
+	}
+
+	picked := []sentence{sentences[0]}
+	rest := append([]sentence(nil), sentences[1:]...)
+	sort.SliceStable(rest, func(i, j int) bool { return rest[i].score > rest[j].score })
+	for _, st := range rest {
+		if len(picked) > s.Sentences {
+			break
+		}
+		picked = append(picked, st)
+	}
+	sort.Slice(picked, func(i, j int) bool { return picked[i].pos < picked[j].pos })
+	texts := make([]string, len(picked))
+	for i, st := range picked {
+		texts[i] = st.text
+	}
+	return strings.Join(texts, " "), nil
+}
+
+// splitSentences breaks text at sentence-ending punctuation and line breaks.
+func splitSentences(text string) []string {
+	var out []string
+	start := 0
+	flush := func(end int) {
+		if s := strings.TrimSpace(text[start:end]); s != "" {
+			out = append(out, s)
+		}
+		start = end
+	}
+	for i, r := range text {
+		switch r {
+		case '.', '!', '?':
+			flush(i + 1)
+		case '\n':
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return out
+}
+
+// summaryWords returns the lowercased words of text worth counting, skipping
+// short ones, which are mostly function words.
+func summaryWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	words := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) > 3 {
+			words = append(words, f)
+		}
+	}
+	return words
+}
+
+// newSummarizer returns the built-in summarizer with the given name.
+func newSummarizer(name string) (Summarizer, error) {
+	switch name {
+	case "", SummarizerOff:
+		return nil, nil
+	case SummarizerExtractive:
+		return ExtractiveSummarizer{Sentences: 3}, nil
+	}
+	return nil, fmt.Errorf("unknown summarizer %q", name)
+}
+
+// --- Summary Database Functions ---
+
+// LastPostID returns the ID of the newest visible post in a topic, or 0.
+func (d *Database) LastPostID(topicID uuid.UUID) (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var id int64
+	query := `SELECT COALESCE(MAX(id), 0) FROM posts
+              WHERE topic_id = $1 AND state = 'visible' AND ` + postNotDeleted("posts")
+	err := d.readQueryRow(ctx, query, topicID).Scan(&id)
+	return id, err
+}
+
+// GetTopicSummary returns a topic's cached summary, or nil if it has none.
+func (d *Database) GetTopicSummary(topicID uuid.UUID) (*TopicSummary, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var s TopicSummary
+	query := `SELECT topic_id, summary, post_count, last_post_id, generated_at FROM topic_summaries WHERE topic_id = $1`
+	err := d.pool.QueryRow(ctx, query, topicID).Scan(&s.TopicID, &s.Summary, &s.PostCount, &s.LastPostID, &s.GeneratedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveTopicSummary stores s as the topic's summary, replacing any older one.
+func (d *Database) SaveTopicSummary(s *TopicSummary) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO topic_summaries (topic_id, summary, post_count, last_post_id)
+              VALUES ($1, $2, $3, $4)
+              ON CONFLICT (topic_id) DO UPDATE SET
+                  summary = EXCLUDED.summary,
+                  post_count = EXCLUDED.post_count,
+                  last_post_id = EXCLUDED.last_post_id,
+                  generated_at = NOW()
+              RETURNING generated_at`
+	return d.pool.QueryRow(ctx, query, s.TopicID, s.Summary, s.PostCount, s.LastPostID).Scan(&s.GeneratedAt)
+}
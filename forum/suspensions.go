@@ -0,0 +1,262 @@
+// forum/suspensions.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Suspension temporarily stops a user from posting.
+type Suspension struct {
+	ID        int64      `json:"id" db:"id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	Reason    string     `json:"reason" db:"reason"`
+	EndsAt    time.Time  `json:"ends_at" db:"ends_at"`
+	CreatedBy string     `json:"created_by" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	LiftedAt  *time.Time `json:"lifted_at" db:"lifted_at"`
+}
+
+// SuspendedViewData is the data structure for the page shown to suspended users.
+type SuspendedViewData struct {
+	User       *Viewer
+	Suspension *Suspension
+	Appealed   bool
+}
+
+// activeSuspension returns the user's current suspension, or nil if they may post.
+func (h *Handlers) activeSuspension(user *User) (*Suspension, error) {
+	if user == nil {
+		return nil, nil
+	}
+	return h.db.GetActiveSuspension(user.ID)
+}
+
+// rejectSuspended sends suspended users to the suspension page, refuses
+// banned ones, and reports whether it did either. Handlers that create or
+// change content call it first.
+func (h *Handlers) rejectSuspended(w http.ResponseWriter, r *http.Request, user *User) bool {
+	if user != nil && user.Banned() {
+		http.Error(w, banMessage(user), http.StatusForbidden)
+		return true
+	}
+	s, err := h.activeSuspension(user)
+	if err != nil {
+		log.Printf("Error checking suspension: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Your account is suspended until "+s.EndsAt.Format(time.RFC1123), http.StatusForbidden)
+		return true
+	}
+	http.Redirect(w, r, "/suspended", http.StatusSeeOther)
+	return true
+}
+
+// handleSuspended shows the suspension reason and end date, and accepts a
+// single appeal message.
+func (h *Handlers) handleSuspended(w http.ResponseWriter, r *http.Request) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	s, err := h.activeSuspension(user)
+	if err != nil {
+		log.Printf("Error checking suspension: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if s == nil {
+		http.Redirect(w, r, "/topics", http.StatusSeeOther)
+		return
+	}
+
+	sid := strconv.FormatInt(s.ID, 10)
+	appeals, err := h.db.CountQueueItemsForSubject(QueueAppeal, "suspension", sid)
+	if err != nil {
+		log.Printf("Error counting appeals: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if appeals > 0 {
+			http.Error(w, "You have already appealed this suspension", http.StatusConflict)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			badRequestBody(w, err, "Failed to parse form")
+			return
+		}
+		message := r.FormValue("appeal")
+		if message == "" {
+			http.Error(w, "Appeal message is required", http.StatusBadRequest)
+			return
+		}
+		item := QueueItem{
+			Kind:        QueueAppeal,
+			UserID:      user.ID,
+			SubjectType: "suspension",
+			SubjectID:   sid,
+			Body:        message,
+		}
+		created, err := h.db.CreateAppeal(s.ID, &item)
+		if err != nil {
+			log.Printf("Error submitting appeal: %v", err)
+			http.Error(w, "Failed to submit appeal", http.StatusInternalServerError)
+			return
+		}
+		if !created {
+			// Another submission got there first.
+			http.Error(w, "You have already appealed this suspension", http.StatusConflict)
+			return
+		}
+		appeals++
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := SuspendedViewData{User: NewViewer(user), Suspension: s, Appealed: appeals > 0}
+	if err := h.templates.ExecuteTemplate(w, "suspended.html", data); err != nil {
+		log.Printf("Error executing suspended template: %v", err)
+	}
+}
+
+// suspendUser serves POST /admin/users/{id}/suspend with "reason" and "days".
+func (h *Handlers) suspendUser(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	reason := r.FormValue("reason")
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if reason == "" || err != nil || days < 1 {
+		http.Error(w, "A reason and a positive number of days are required", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.db.GetUserByID(userID)
+	if err != nil {
+		writeError(w, err, "user")
+		return
+	}
+
+	s := Suspension{
+		UserID:    target.ID,
+		Reason:    reason,
+		EndsAt:    time.Now().Add(time.Duration(days) * 24 * time.Hour),
+		CreatedBy: staff.ID,
+	}
+	if err := h.db.CreateSuspension(&s); err != nil {
+		log.Printf("Error creating suspension: %v", err)
+		http.Error(w, "Failed to suspend user", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "user.suspend", "user", target.ID, map[string]string{
+		"reason":  reason,
+		"ends_at": s.EndsAt.Format(time.RFC3339),
+	})
+
+	http.Redirect(w, r, "/admin/users/"+target.ID, http.StatusSeeOther)
+}
+
+// liftSuspension serves POST /admin/users/{id}/unsuspend.
+func (h *Handlers) liftSuspension(w http.ResponseWriter, r *http.Request, userID string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	lifted, err := h.db.LiftSuspensions(userID)
+	if err != nil {
+		log.Printf("Error lifting suspension: %v", err)
+		http.Error(w, "Failed to lift suspension", http.StatusInternalServerError)
+		return
+	}
+	if lifted > 0 {
+		h.audit(staff, "user.unsuspend", "user", userID, nil)
+	}
+	http.Redirect(w, r, "/admin/users/"+userID, http.StatusSeeOther)
+}
+
+// --- Suspension Database Functions ---
+
+// CreateAppeal queues item as the appeal of suspension suspensionID unless
+// it already has one, reporting whether it did. The suspension's row is
+// locked first, so of two submissions at once only one is queued.
+func (d *Database) CreateAppeal(suspensionID int64, item *QueueItem) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM suspensions WHERE id = $1 FOR UPDATE`, suspensionID); err != nil {
+		return false, err
+	}
+	// A statement after the lock sees any appeal committed while waiting.
+	query := `INSERT INTO mod_queue (kind, user_id, subject_type, subject_id, body)
+              SELECT $1, $2::uuid, $3, $4, $5
+              WHERE NOT EXISTS (
+                  SELECT 1 FROM mod_queue WHERE kind = $1 AND subject_type = $3 AND subject_id = $4
+              )
+              RETURNING id, created_at`
+	err = tx.QueryRow(ctx, query,
+		item.Kind, item.UserID, item.SubjectType, item.SubjectID, item.Body,
+	).Scan(&item.ID, &item.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (d *Database) CreateSuspension(s *Suspension) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO suspensions (user_id, reason, ends_at, created_by) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	return d.pool.QueryRow(ctx, query, s.UserID, s.Reason, s.EndsAt, s.CreatedBy).Scan(&s.ID, &s.CreatedAt)
+}
+
+// GetActiveSuspension returns the suspension ending last among those still in force.
+func (d *Database) GetActiveSuspension(userID string) (*Suspension, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var s Suspension
+	query := `SELECT id, user_id, reason, ends_at, created_by, created_at, lifted_at FROM suspensions
+              WHERE user_id = $1 AND lifted_at IS NULL AND ends_at > NOW()
+              ORDER BY ends_at DESC
+              LIMIT 1`
+	err := d.pool.QueryRow(ctx, query, userID).Scan(
+		&s.ID, &s.UserID, &s.Reason, &s.EndsAt, &s.CreatedBy, &s.CreatedAt, &s.LiftedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LiftSuspensions ends every active suspension for a user early.
+func (d *Database) LiftSuspensions(userID string) (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `UPDATE suspensions SET lifted_at = NOW() WHERE user_id = $1 AND lifted_at IS NULL AND ends_at > NOW()`
+	tag, err := d.pool.Exec(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,332 @@
+// forum/tagpages.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxTagDescription is the longest description, in characters, a tag can have.
+const maxTagDescription = 500
+
+// TagSummary is a tag with its description and how many live topics and
+// members have it.
+type TagSummary struct {
+	Name        string
+	Description string
+	Topics      int
+	Followers   int
+}
+
+// TagListViewData is the data structure for /tags.
+type TagListViewData struct {
+	User       *Viewer
+	Tags       []TagView
+	Pagination PaginationData
+}
+
+// TagViewData is the data structure for /tags/{name}.
+type TagViewData struct {
+	User       *Viewer
+	Tag        TagView
+	Following  bool
+	Topics     []TopicView
+	Pagination PaginationData
+}
+
+// listTagPages serves GET /tags, every tag with the most used first.
+func (h *Handlers) listTagPages(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	user, _ := r.Context().Value(userContextKey).(*User)
+	db := h.db.WithContext(r.Context())
+	pageSize := pageSizeFor(user)
+	tags, err := db.ListTagSummaries(page, pageSize)
+	if err != nil {
+		log.Printf("Error listing tags: %v", err)
+		http.Error(w, "Failed to retrieve tags", http.StatusInternalServerError)
+		return
+	}
+	total, err := db.CountTags()
+	if err != nil {
+		log.Printf("Error counting tags: %v", err)
+		http.Error(w, "Failed to retrieve tags", http.StatusInternalServerError)
+		return
+	}
+	data := TagListViewData{
+		User:       NewViewer(user),
+		Tags:       NewTagViews(tags),
+		Pagination: newPagination(page, total, pageSize, pageLink("/tags", nil)),
+	}
+	if err := h.templates.ExecuteTemplate(w, "tags.html", data); err != nil {
+		log.Printf("Error executing tags template: %v", err)
+	}
+}
+
+// showTagPage serves GET /tags/{name}, the tag's description and a page of
+// its topics. A synonym redirects to the tag it stands for.
+func (h *Handlers) showTagPage(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(r.PathValue("name"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	user, _ := r.Context().Value(userContextKey).(*User)
+	db := h.db.WithContext(r.Context())
+	tag, err := db.GetTag(name)
+	if err != nil {
+		writeError(w, err, "tag")
+		return
+	}
+	if tag.Name != name {
+		http.Redirect(w, r, tagPath(tag.Name), http.StatusFound)
+		return
+	}
+
+	filter := TopicFilter{Tags: []string{tag.Name}}
+	pageSize := pageSizeFor(user)
+	topics, err := db.SearchAndListTopics(filter, page, pageSize)
+	if err != nil {
+		log.Printf("Error listing tag topics: %v", err)
+		http.Error(w, "Failed to retrieve topics", http.StatusInternalServerError)
+		return
+	}
+	data := TagViewData{
+		User:       NewViewer(user),
+		Tag:        NewTagView(tag),
+		Topics:     h.topicViews(r, topics),
+		Pagination: newPagination(page, tag.Topics, pageSize, pageLink(tagPath(tag.Name), nil)),
+	}
+	if user != nil {
+		data.Following, err = db.IsFollowingTag(user.ID, tag.Name)
+		if err != nil {
+			log.Printf("Error checking tag follow: %v", err)
+			http.Error(w, "Failed to retrieve tag", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := h.templates.ExecuteTemplate(w, "tag.html", data); err != nil {
+		log.Printf("Error executing tag template: %v", err)
+	}
+}
+
+// followTag serves POST /tags/{name}/follow and, with follow false,
+// POST /tags/{name}/unfollow.
+func (h *Handlers) followTag(follow bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := r.Context().Value(userContextKey).(*User)
+		db := h.db.WithContext(r.Context())
+		tag, err := db.GetTag(strings.ToLower(r.PathValue("name")))
+		if err != nil {
+			writeError(w, err, "tag")
+			return
+		}
+		if follow {
+			err = db.FollowTag(user.ID, tag.Name)
+		} else {
+			err = db.UnfollowTag(user.ID, tag.Name)
+		}
+		if err != nil {
+			log.Printf("Error updating tag follow: %v", err)
+			http.Error(w, "Failed to update tag", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, tagPath(tag.Name), http.StatusSeeOther)
+	}
+}
+
+// describeTag serves POST /admin/tags/describe with "tag" and "description".
+// An empty description clears it.
+func (h *Handlers) describeTag(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	name := strings.ToLower(strings.TrimSpace(r.FormValue("tag")))
+	description := strings.TrimSpace(r.FormValue("description"))
+	if utf8.RuneCountInString(description) > maxTagDescription {
+		writeError(w, invalid("description", "must be at most "+strconv.Itoa(maxTagDescription)+" characters"), "tag")
+		return
+	}
+	if err := h.db.SetTagDescription(name, description); err != nil {
+		writeError(w, err, "tag")
+		return
+	}
+	h.audit(staff, "tag.describe", "tag", name, map[string]string{"description": description})
+	http.Redirect(w, r, tagPath(name), http.StatusSeeOther)
+}
+
+// completeTags serves GET /api/tags/complete?q=, the tags starting with q
+// or with one of their synonyms, most used first, for tag inputs to offer as
+// they are typed. An empty q returns the most used tags.
+func (h *Handlers) completeTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	db := h.db.WithContext(r.Context()).WithTimeout(h.config.SuggestTimeout)
+	tags, err := db.CompleteTags(q, h.config.SuggestLimit)
+	if err != nil {
+		log.Printf("Error completing tags: %v", err)
+		http.Error(w, "Failed to look up tags", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=30")
+	writeJSON(w, tags)
+}
+
+// --- Tag Page Database Functions ---
+
+// tagSummaryColumns selects a TagSummary from tags aliased t.
+var tagSummaryColumns = `t.name, t.description,
+       (SELECT COUNT(*) FROM topics tp WHERE ` + notDeleted("tp") + ` AND tp.tags @> ARRAY[t.name]),
+       (SELECT COUNT(*) FROM tag_follows f WHERE f.tag = t.name)`
+
+// ListTagSummaries returns a page of tags, the most used first.
+func (d *Database) ListTagSummaries(page, pageSize int) ([]TagSummary, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT ` + tagSummaryColumns + ` FROM tags t
+              ORDER BY 3 DESC, t.name
+              LIMIT $1 OFFSET $2`
+	rows, err := d.readQuery(ctx, query, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []TagSummary
+	for rows.Next() {
+		var t TagSummary
+		if err := rows.Scan(&t.Name, &t.Description, &t.Topics, &t.Followers); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// CountTags counts the known tags.
+func (d *Database) CountTags() (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var n int
+	err := d.readQueryRow(ctx, `SELECT COUNT(*) FROM tags`).Scan(&n)
+	return n, err
+}
+
+// GetTag returns the named tag, or the tag name is a synonym of. It returns
+// ErrNotFound if there is neither.
+func (d *Database) GetTag(name string) (*TagSummary, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT ` + tagSummaryColumns + ` FROM tags t
+              WHERE t.name = COALESCE((SELECT tag FROM tag_synonyms WHERE alias = $1), $1)`
+	var t TagSummary
+	err := d.readQueryRow(ctx, query, name).Scan(&t.Name, &t.Description, &t.Topics, &t.Followers)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SetTagDescription sets the description shown on a tag's page. It returns
+// ErrNotFound for an unknown tag.
+func (d *Database) SetTagDescription(name, description string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tag, err := d.pool.Exec(ctx, `UPDATE tags SET description = $2 WHERE name = $1`, name, description)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IsFollowingTag reports whether the user follows tag.
+func (d *Database) IsFollowingTag(userID, tag string) (bool, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var following bool
+	err := d.readQueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tag_follows WHERE user_id = $1 AND tag = $2)`, userID, tag).Scan(&following)
+	return following, err
+}
+
+// FollowTag makes the user a follower of tag. Following twice is harmless.
+func (d *Database) FollowTag(userID, tag string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `INSERT INTO tag_follows (user_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING`, userID, tag)
+	return err
+}
+
+// UnfollowTag stops the user following tag.
+func (d *Database) UnfollowTag(userID, tag string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM tag_follows WHERE user_id = $1 AND tag = $2`, userID, tag)
+	return err
+}
+
+// ListTagFollowers returns the IDs of live users following any of tags,
+// each once.
+func (d *Database) ListTagFollowers(tags []string) ([]string, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.readQuery(ctx, `SELECT DISTINCT f.user_id FROM tag_follows f JOIN users u ON u.id = f.user_id
+                                   WHERE f.tag = ANY($1::text[]) AND `+notDeleted("u"), tags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CompleteTags returns up to limit tags whose name, or a synonym of it,
+// starts with prefix, the most used first. The result is never nil.
+func (d *Database) CompleteTags(prefix string, limit int) ([]TagSuggestion, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `SELECT t.name, (SELECT COUNT(*) FROM topics tp WHERE ` + notDeleted("tp") + ` AND tp.tags @> ARRAY[t.name])
+              FROM tags t
+              WHERE t.name LIKE $1::text || '%'
+                 OR EXISTS (SELECT 1 FROM tag_synonyms s WHERE s.tag = t.name AND s.alias LIKE $1::text || '%')
+              ORDER BY 2 DESC, t.name
+              LIMIT $2`
+	rows, err := d.readQuery(ctx, query, likeEscaper.Replace(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []TagSuggestion{}
+	for rows.Next() {
+		var t TagSuggestion
+		if err := rows.Scan(&t.Name, &t.Topics); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
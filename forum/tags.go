@@ -0,0 +1,451 @@
+// forum/tags.go
+package forum
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Tags live on topics as plain strings. The tags table remembers every tag
+// that has been used, so that staff can see tags nobody uses any more, and
+// tag_synonyms maps aliases onto the tag new topics should get instead.
+
+// TagInfo is a row of the admin tag manager.
+type TagInfo struct {
+	Name      string
+	Topics    int
+	Synonyms  []string
+	CreatedAt time.Time
+}
+
+// TagsViewData is the data structure for the admin tag manager.
+type TagsViewData struct {
+	User  *Viewer
+	Tags  []TagInfo
+	Error string
+}
+
+// errTagInUse is returned when deleting a tag that live topics still carry.
+var errTagInUse = errors.New("tag is still used by topics")
+
+// showTags renders /admin/tags.
+func (h *Handlers) showTags(w http.ResponseWriter, r *http.Request, errMsg string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	tags, err := h.db.WithContext(r.Context()).ListTags()
+	if err != nil {
+		log.Printf("Error listing tags: %v", err)
+		http.Error(w, "Failed to retrieve tags", http.StatusInternalServerError)
+		return
+	}
+	data := TagsViewData{User: NewViewer(staff), Tags: tags, Error: errMsg}
+	if err := h.templates.ExecuteTemplate(w, "admin_tags.html", data); err != nil {
+		log.Printf("Error executing tags template: %v", err)
+	}
+}
+
+// tagForm parses the form and returns the normalized value of each field,
+// or shows the tag manager with an error if any is empty.
+func (h *Handlers) tagForm(w http.ResponseWriter, r *http.Request, fields ...string) ([]string, bool) {
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return nil, false
+	}
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		values[i] = strings.ToLower(strings.TrimSpace(r.FormValue(f)))
+		if values[i] == "" {
+			h.showTags(w, r, "The "+f+" field is required.")
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// renameTag serves POST /admin/tags/rename with "tag" and "to". Renaming to a
+// tag that already exists folds the two together.
+func (h *Handlers) renameTag(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	v, ok := h.tagForm(w, r, "tag", "to")
+	if !ok {
+		return
+	}
+	if v[0] == v[1] {
+		h.showTags(w, r, "The new name is the same as the old one.")
+		return
+	}
+	n, err := h.db.RenameTag(v[0], v[1], staff)
+	if err != nil {
+		log.Printf("Error renaming tag: %v", err)
+		http.Error(w, "Failed to rename tag", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "tag.rename", "tag", v[0], map[string]string{"to": v[1], "topics": strconv.FormatInt(n, 10)})
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+// mergeTags serves POST /admin/tags/merge with "into" and a comma-separated
+// "from". The merged tags become synonyms of "into", so topics created with
+// them later get "into" instead.
+func (h *Handlers) mergeTags(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	v, ok := h.tagForm(w, r, "into", "from")
+	if !ok {
+		return
+	}
+	var from []string
+	for _, t := range normalizeTags(strings.Split(v[1], ",")) {
+		if t != v[0] {
+			from = append(from, t)
+		}
+	}
+	if len(from) == 0 {
+		h.showTags(w, r, "Name at least one tag other than the one being merged into.")
+		return
+	}
+	n, err := h.db.MergeTags(v[0], from, staff)
+	if err != nil {
+		log.Printf("Error merging tags: %v", err)
+		http.Error(w, "Failed to merge tags", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "tag.merge", "tag", v[0], map[string]string{"from": strings.Join(from, ","), "topics": strconv.FormatInt(n, 10)})
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+// deleteTag serves POST /admin/tags/delete with "tag". Only tags no live
+// topic uses can be deleted; retag or merge the others first.
+func (h *Handlers) deleteTag(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	v, ok := h.tagForm(w, r, "tag")
+	if !ok {
+		return
+	}
+	err := h.db.DeleteTag(v[0])
+	switch {
+	case errors.Is(err, errTagInUse):
+		h.showTags(w, r, "Topics still use "+v[0]+"; rename or merge it instead.")
+		return
+	case errors.Is(err, ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		log.Printf("Error deleting tag: %v", err)
+		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "tag.delete", "tag", v[0], nil)
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+// pruneTags serves POST /admin/tags/prune, deleting every unused tag.
+func (h *Handlers) pruneTags(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	deleted, err := h.db.DeleteUnusedTags()
+	if err != nil {
+		log.Printf("Error pruning tags: %v", err)
+		http.Error(w, "Failed to delete unused tags", http.StatusInternalServerError)
+		return
+	}
+	if len(deleted) > 0 {
+		h.audit(staff, "tag.prune", "tag", "", map[string]string{"tags": strings.Join(deleted, ",")})
+	}
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+// addTagSynonym serves POST /admin/tags/synonyms with "alias" and "tag".
+func (h *Handlers) addTagSynonym(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	v, ok := h.tagForm(w, r, "alias", "tag")
+	if !ok {
+		return
+	}
+	err := h.db.AddTagSynonym(v[0], v[1])
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		msgs := make([]string, 0, len(invalid.Fields))
+		for _, msg := range invalid.Fields {
+			msgs = append(msgs, msg)
+		}
+		sort.Strings(msgs)
+		h.showTags(w, r, strings.Join(msgs, ". ")+".")
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding tag synonym: %v", err)
+		http.Error(w, "Failed to add synonym", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "tag.synonym_add", "tag", v[1], map[string]string{"alias": v[0]})
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+// removeTagSynonym serves POST /admin/tags/synonyms/delete with "alias".
+func (h *Handlers) removeTagSynonym(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	v, ok := h.tagForm(w, r, "alias")
+	if !ok {
+		return
+	}
+	if err := h.db.RemoveTagSynonym(v[0]); err != nil {
+		log.Printf("Error removing tag synonym: %v", err)
+		http.Error(w, "Failed to remove synonym", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "tag.synonym_remove", "tag", "", map[string]string{"alias": v[0]})
+	http.Redirect(w, r, "/admin/tags", http.StatusSeeOther)
+}
+
+// --- Tag Database Functions ---
+
+// resolveTags normalizes tags for a new topic, replaces synonyms with their
+// tags and drops the duplicates that leaves, keeping the first occurrence.
+func resolveTags(ctx context.Context, q querier, tags []string) ([]string, error) {
+	tags = normalizeTags(tags)
+	if len(tags) == 0 {
+		return tags, nil
+	}
+	var resolved []string
+	err := q.QueryRow(ctx, `SELECT COALESCE(array_agg(t ORDER BY i), '{}') FROM (
+              SELECT COALESCE(s.tag, u.t) AS t, MIN(u.i) AS i
+              FROM unnest($1::text[]) WITH ORDINALITY AS u(t, i)
+              LEFT JOIN tag_synonyms s ON s.alias = u.t
+              GROUP BY 1) x`, tags).Scan(&resolved)
+	return resolved, err
+}
+
+// registerTags records tags in the tags table.
+func registerTags(ctx context.Context, q querier, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := q.Exec(ctx, `INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT DO NOTHING`, tags)
+	return err
+}
+
+// ListTags returns every known tag with how many live topics use it and its
+// synonyms, most used first.
+func (d *Database) ListTags() ([]TagInfo, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.readQuery(ctx, `SELECT t.name, t.created_at,
+                     (SELECT COUNT(*) FROM topics tp WHERE `+notDeleted("tp")+` AND tp.tags @> ARRAY[t.name]),
+                     COALESCE((SELECT array_agg(s.alias ORDER BY s.alias) FROM tag_synonyms s WHERE s.tag = t.name), '{}')
+              FROM tags t
+              ORDER BY 3 DESC, t.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []TagInfo
+	for rows.Next() {
+		var t TagInfo
+		if err := rows.Scan(&t.Name, &t.CreatedAt, &t.Topics, &t.Synonyms); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// RenameTag replaces from with to on every topic, deleted ones included, and
+// moves from's synonyms, followers and description to to. Each topic changed
+// gets a staff-only retagged event from actor. Renaming onto an existing tag folds the two
+// together. It returns how many topics changed.
+func (d *Database) RenameTag(from, to string, actor *User) (int64, error) {
+	return d.replaceTags(to, []string{from}, false, actor)
+}
+
+// MergeTags renames each of from to into, as RenameTag does, and records the
+// old names as synonyms of into so topics created with them later get into
+// instead. It returns how many topics changed.
+func (d *Database) MergeTags(into string, from []string, actor *User) (int64, error) {
+	return d.replaceTags(into, from, true, actor)
+}
+
+func (d *Database) replaceTags(into string, from []string, synonyms bool, actor *User) (int64, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	// Topics that already had into keep it once, where it first appeared.
+	// The timeline entries are staff-only, since the change is housekeeping
+	// rather than news about the topic.
+	actorID, handle := actorParams(actor)
+	query := `WITH old AS (
+                  SELECT id, tags FROM topics WHERE tags && $2::text[] FOR UPDATE
+              ), changed AS (
+                  UPDATE topics tp SET tags = ARRAY(
+                      SELECT CASE WHEN tag = ANY($2::text[]) THEN $1::text ELSE tag END
+                      FROM unnest(tp.tags) WITH ORDINALITY AS t(tag, n)
+                      GROUP BY 1 ORDER BY MIN(n)
+                  ), version = tp.version + 1
+                  FROM old WHERE tp.id = old.id
+                  RETURNING tp.id, old.tags AS before, tp.tags AS after
+              ), events AS (` + retagEvents("$3", "$4", "TRUE") + `)
+              SELECT COUNT(*) FROM changed`
+	var n int64
+	if err := tx.QueryRow(ctx, query, into, from, actorID, handle).Scan(&n); err != nil {
+		return 0, err
+	}
+	if err := registerTags(ctx, tx, []string{into}); err != nil {
+		return 0, err
+	}
+	// into keeps its own description if it has one.
+	query = `UPDATE tags t SET description = f.description
+             FROM (SELECT description FROM tags WHERE name = ANY($2::text[]) AND description <> '' LIMIT 1) f
+             WHERE t.name = $1 AND t.description = ''`
+	if _, err := tx.Exec(ctx, query, into, from); err != nil {
+		return 0, err
+	}
+	query = `INSERT INTO tag_follows (user_id, tag, created_at)
+             SELECT user_id, $1, MIN(created_at) FROM tag_follows WHERE tag = ANY($2::text[]) GROUP BY user_id
+             ON CONFLICT DO NOTHING`
+	if _, err := tx.Exec(ctx, query, into, from); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM tag_follows WHERE tag = ANY($1::text[])`, from); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM tags WHERE name = ANY($1::text[])`, from); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE tag_synonyms SET tag = $1 WHERE tag = ANY($2::text[])`, into, from); err != nil {
+		return 0, err
+	}
+	// into is a real tag now, so it can't also stand for another one.
+	if _, err := tx.Exec(ctx, `DELETE FROM tag_synonyms WHERE alias = $1`, into); err != nil {
+		return 0, err
+	}
+	if synonyms {
+		query = `INSERT INTO tag_synonyms (alias, tag) SELECT unnest($2::text[]), $1
+                  ON CONFLICT (alias) DO UPDATE SET tag = EXCLUDED.tag`
+		if _, err := tx.Exec(ctx, query, into, from); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	d.counts.invalidate()
+	return n, nil
+}
+
+// AddTagSynonym makes alias stand for tag on new topics. Existing topics are
+// left alone; merge the tags to change those as well.
+func (d *Database) AddTagSynonym(alias, tag string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	if alias == tag {
+		return invalid("alias", "a tag can't be a synonym of itself")
+	}
+	var aliasIsTag, tagIsAlias bool
+	query := `SELECT EXISTS (SELECT 1 FROM tags WHERE name = $1),
+                     EXISTS (SELECT 1 FROM tag_synonyms WHERE alias = $2)`
+	if err := d.pool.QueryRow(ctx, query, alias, tag).Scan(&aliasIsTag, &tagIsAlias); err != nil {
+		return err
+	}
+	problems := &ValidationError{}
+	if aliasIsTag {
+		problems.Add("alias", alias+" is already a tag; merge it instead")
+	}
+	if tagIsAlias {
+		problems.Add("tag", tag+" is itself a synonym")
+	}
+	if err := problems.OrNil(); err != nil {
+		return err
+	}
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := registerTags(ctx, tx, []string{tag}); err != nil {
+		return err
+	}
+	query = `INSERT INTO tag_synonyms (alias, tag) VALUES ($1, $2)
+             ON CONFLICT (alias) DO UPDATE SET tag = EXCLUDED.tag`
+	if _, err := tx.Exec(ctx, query, alias, tag); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RemoveTagSynonym stops alias standing for another tag.
+func (d *Database) RemoveTagSynonym(alias string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM tag_synonyms WHERE alias = $1`, alias)
+	return err
+}
+
+// DeleteTag forgets a tag, its synonyms and its followers. It returns errTagInUse if a live
+// topic still has the tag; deleted topics keep theirs.
+func (d *Database) DeleteTag(name string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	var inUse bool
+	query := `SELECT EXISTS (SELECT 1 FROM topics WHERE ` + notDeleted("topics") + ` AND tags @> ARRAY[t.name])
+              FROM tags t WHERE t.name = $1 FOR UPDATE`
+	err = tx.QueryRow(ctx, query, name).Scan(&inUse)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return errTagInUse
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM tag_synonyms WHERE tag = $1`, name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM tag_follows WHERE tag = $1`, name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM tags WHERE name = $1`, name); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeleteUnusedTags deletes every tag that no live topic has, no synonym
+// points at and nobody follows, and returns their names.
+func (d *Database) DeleteUnusedTags() ([]string, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `DELETE FROM tags t
+              WHERE NOT EXISTS (SELECT 1 FROM topics tp WHERE ` + notDeleted("tp") + ` AND tp.tags @> ARRAY[t.name])
+                AND NOT EXISTS (SELECT 1 FROM tag_synonyms s WHERE s.tag = t.name)
+                AND NOT EXISTS (SELECT 1 FROM tag_follows f WHERE f.tag = t.name)
+              RETURNING t.name`
+	rows, err := d.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deleted []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, name)
+	}
+	return deleted, rows.Err()
+}
@@ -0,0 +1,101 @@
+// forum/threads.go
+package forum
+
+import (
+	"github.com/google/uuid"
+)
+
+// maxThreadedPosts is the largest topic shown as a reply tree. The tree
+// can't be paged, so bigger topics stay flat.
+const maxThreadedPosts = 1000
+
+// PostNode is a post with the replies made to it, oldest first.
+type PostNode struct {
+	Post
+	Replies []*PostNode
+}
+
+// flattenTree lists the posts in nodes and all their replies, in tree order.
+func flattenTree(nodes []*PostNode) []Post {
+	var posts []Post
+	for _, n := range nodes {
+		posts = append(posts, n.Post)
+		posts = append(posts, flattenTree(n.Replies)...)
+	}
+	return posts
+}
+
+// ThreadView is a post and its replies as the "thread" template shows them.
+type ThreadView struct {
+	PostFragment
+	Replies []ThreadView
+}
+
+// threadViews prepares a reply tree in topic for the "thread" template as
+// seen by user.
+func (h *Handlers) threadViews(topic *Topic, nodes []*PostNode, user *User, trust int) []ThreadView {
+	views, _ := buildThreads(nodes, h.postFragments(topic, flattenTree(nodes), user, trust))
+	return views
+}
+
+// buildThreads arranges fragments, made from the posts in nodes in tree
+// order, into the same trees, returning the fragments left over.
+func buildThreads(nodes []*PostNode, fragments []PostFragment) ([]ThreadView, []PostFragment) {
+	views := make([]ThreadView, len(nodes))
+	for i, n := range nodes {
+		views[i].PostFragment, fragments = fragments[0], fragments[1:]
+		views[i].Replies, fragments = buildThreads(n.Replies, fragments)
+	}
+	return views, fragments
+}
+
+// --- Thread Database Functions ---
+
+// GetPostTree returns the topic's visible posts as reply trees, oldest first
+// at every level. Deleted posts are included, as on the flat topic page, so
+// their replies keep their place. A reply whose parent isn't a visible post
+// in the topic starts a tree of its own.
+func (d *Database) GetPostTree(topicID uuid.UUID) ([]*PostNode, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	// Replies always have higher IDs than their parents, which orders each
+	// level by age and rules out cycles.
+	query := `WITH RECURSIVE tree (post_id, path) AS (
+                  SELECT p.id, ARRAY[p.id] FROM posts p
+                  WHERE p.topic_id = $1 AND p.state = 'visible' AND NOT EXISTS (
+                      SELECT 1 FROM posts pp
+                      WHERE pp.id = p.parent_post_id AND pp.id < p.id AND pp.topic_id = p.topic_id AND pp.state = 'visible'
+                  )
+                  UNION ALL
+                  SELECT c.id, tree.path || c.id FROM posts c JOIN tree ON c.parent_post_id = tree.post_id
+                  WHERE c.topic_id = $1 AND c.state = 'visible' AND c.id > tree.post_id
+              )
+              SELECT ` + postColumns + `
+              FROM tree JOIN posts ON posts.id = tree.post_id
+              ORDER BY tree.path`
+	rows, err := d.readQuery(ctx, query, topicID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var roots []*PostNode
+	byID := map[int64]*PostNode{}
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		node := &PostNode{Post: *p}
+		byID[p.ID] = node
+		// Rows come in path order, so a parent is always seen before its
+		// replies.
+		if p.ParentPostID != nil {
+			if parent, ok := byID[*p.ParentPostID]; ok {
+				parent.Replies = append(parent.Replies, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots, rows.Err()
+}
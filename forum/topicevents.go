@@ -0,0 +1,205 @@
+// forum/topicevents.go
+package forum
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of TopicEvent.
+const (
+	TopicRenamed  = "renamed"
+	TopicRetagged = "retagged"
+	TopicSolved   = "solved"
+	TopicUnsolved = "unsolved"
+)
+
+// TopicEvent is a change to a topic shown in its timeline between the posts.
+// Events from housekeeping, such as renaming a tag across the forum, are
+// StaffOnly.
+type TopicEvent struct {
+	ID        int64
+	TopicID   string
+	Kind      string
+	ActorID   string
+	Actor     string
+	Data      TopicEventData
+	StaffOnly bool
+	CreatedAt time.Time
+}
+
+// TopicEventData holds what changed. Renames use From and To, retags Added
+// and Removed.
+type TopicEventData struct {
+	From    string   `json:"from,omitempty"`
+	To      string   `json:"to,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// TopicEventView is an event as the topic page shows it.
+type TopicEventView struct {
+	Kind      string
+	Actor     string
+	Text      string
+	When      string
+	StaffOnly bool
+}
+
+// NewTopicEventView returns the view of e.
+func NewTopicEventView(e *TopicEvent) TopicEventView {
+	v := TopicEventView{Kind: e.Kind, Actor: e.Actor, When: e.CreatedAt.Format(dateTimeLayout), StaffOnly: e.StaffOnly}
+	if v.Actor == "" {
+		v.Actor = "Staff"
+	}
+	switch e.Kind {
+	case TopicRenamed:
+		v.Text = fmt.Sprintf("renamed this topic from %q", e.Data.From)
+	case TopicRetagged:
+		var parts []string
+		if len(e.Data.Added) > 0 {
+			parts = append(parts, "adding "+strings.Join(e.Data.Added, ", "))
+		}
+		if len(e.Data.Removed) > 0 {
+			parts = append(parts, "removing "+strings.Join(e.Data.Removed, ", "))
+		}
+		v.Text = "retagged this topic, " + strings.Join(parts, " and ")
+	case TopicSolved:
+		v.Text = "marked a solution"
+	case TopicUnsolved:
+		v.Text = "unmarked the solution"
+	default:
+		v.Text = e.Kind + " this topic"
+	}
+	return v
+}
+
+// TimelineEntry is a post or an event on the topic page; exactly one is set.
+type TimelineEntry struct {
+	Post  *PostFragment
+	Event *TopicEventView
+}
+
+// newTimeline interleaves events with a page of posts and their fragments by
+// time. Events that happened at the same moment as a post come after it.
+func newTimeline(posts []Post, fragments []PostFragment, events []TopicEvent) []TimelineEntry {
+	timeline := make([]TimelineEntry, 0, len(fragments)+len(events))
+	e := 0
+	for i := range fragments {
+		for ; e < len(events) && events[e].CreatedAt.Before(posts[i].CreatedAt); e++ {
+			view := NewTopicEventView(&events[e])
+			timeline = append(timeline, TimelineEntry{Event: &view})
+		}
+		timeline = append(timeline, TimelineEntry{Post: &fragments[i]})
+	}
+	for ; e < len(events); e++ {
+		view := NewTopicEventView(&events[e])
+		timeline = append(timeline, TimelineEntry{Event: &view})
+	}
+	return timeline
+}
+
+// tagChanges returns the tags in after but not before, and the reverse.
+func tagChanges(before, after []string) (added, removed []string) {
+	for _, t := range after {
+		if !slices.Contains(before, t) {
+			added = append(added, t)
+		}
+	}
+	for _, t := range before {
+		if !slices.Contains(after, t) {
+			removed = append(removed, t)
+		}
+	}
+	return added, removed
+}
+
+// recordTopicEvents stores events on behalf of actor. Like audit, failures
+// are logged rather than returned so the timeline never blocks an edit.
+func (h *Handlers) recordTopicEvents(actor *User, events ...TopicEvent) {
+	for i := range events {
+		if actor != nil {
+			events[i].ActorID = actor.ID
+			events[i].Actor = actor.Handle
+		}
+		if err := h.db.AddTopicEvent(&events[i]); err != nil {
+			log.Printf("Error recording %s event on topic %s: %v", events[i].Kind, events[i].TopicID, err)
+		}
+	}
+}
+
+// --- Topic Event Database Functions ---
+
+// retagEvents returns an INSERT, for use as a CTE, recording a retagged
+// event for each row of a preceding CTE named changed with columns id,
+// before and after whose tags differ. actorID, actor and staffOnly are SQL
+// expressions, usually parameters.
+func retagEvents(actorID, actor, staffOnly string) string {
+	return `INSERT INTO topic_events (topic_id, kind, actor_id, actor, data, staff_only)
+            SELECT id, '` + TopicRetagged + `', ` + actorID + `::uuid, ` + actor + `::text, jsonb_build_object(
+                       'added', ARRAY(SELECT unnest(after) EXCEPT SELECT unnest(before)),
+                       'removed', ARRAY(SELECT unnest(before) EXCEPT SELECT unnest(after))),
+                   ` + staffOnly + `
+            FROM changed
+            WHERE NOT (before @> after AND after @> before)`
+}
+
+// actorParams returns the actor_id and actor values for actor, which may be
+// nil for changes made by the system.
+func actorParams(actor *User) (*string, string) {
+	if actor == nil {
+		return nil, ""
+	}
+	return &actor.ID, actor.Handle
+}
+
+// AddTopicEvent records an event, setting its ID and time.
+func (d *Database) AddTopicEvent(e *TopicEvent) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	var actorID *string
+	if e.ActorID != "" {
+		actorID = &e.ActorID
+	}
+	query := `INSERT INTO topic_events (topic_id, kind, actor_id, actor, data, staff_only)
+              VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	return d.pool.QueryRow(ctx, query, e.TopicID, e.Kind, actorID, e.Actor, e.Data, e.StaffOnly).Scan(&e.ID, &e.CreatedAt)
+}
+
+// TopicEventsForPage returns the events to show on a page of the topic's
+// posts, oldest first. An event goes on the page of the last post before it,
+// so events before the first post are on the first page and events after
+// the last post on the last. Deleted posts count, since the topic page keeps
+// their places. Staff-only events are left out unless staff is set.
+func (d *Database) TopicEventsForPage(topicID uuid.UUID, page, pageSize int, staff bool) ([]TopicEvent, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	nthPost := `(SELECT created_at FROM posts
+                 WHERE topic_id = $1 AND state = 'visible'
+                 ORDER BY created_at ASC LIMIT 1 OFFSET %s)`
+	query := `SELECT e.id, e.topic_id, e.kind, COALESCE(e.actor_id::text, ''), e.actor, e.data, e.staff_only, e.created_at
+              FROM topic_events e
+              WHERE e.topic_id = $1 AND ($4 OR NOT e.staff_only)
+                AND ($2 = 0 OR e.created_at >= ` + fmt.Sprintf(nthPost, "$2") + `)
+                AND e.created_at < COALESCE(` + fmt.Sprintf(nthPost, "$2 + $3") + `, 'infinity')
+              ORDER BY e.created_at, e.id`
+	rows, err := d.readQuery(ctx, query, topicID, (page-1)*pageSize, pageSize, staff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []TopicEvent
+	for rows.Next() {
+		var e TopicEvent
+		if err := rows.Scan(&e.ID, &e.TopicID, &e.Kind, &e.ActorID, &e.Actor, &e.Data, &e.StaffOnly, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
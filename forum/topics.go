@@ -0,0 +1,139 @@
+// forum/topics.go
+package forum
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// canManageTopic reports whether user may rename, retag or delete topic: its
+// author or an admin.
+func canManageTopic(user *User, topic *Topic) bool {
+	return user != nil && (user.Admin || user.ID == topic.AuthorID)
+}
+
+// editTopic serves POST /topics/{id}/edit, the topic page's form for changing
+// the title and tags. Tags are comma-separated; version guards against
+// overwriting someone else's change.
+func (h *Handlers) editTopic(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	if h.rejectSuspended(w, r, user) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	version, _ := strconv.Atoi(r.FormValue("version"))
+	topic, err := h.db.GetTopic(topicID)
+	if err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	if !canManageTopic(user, topic) {
+		http.Error(w, "Only the author or an admin can edit this topic", http.StatusForbidden)
+		return
+	}
+	title := strings.TrimSpace(r.FormValue("title"))
+	if problem := h.titleProblem(title); problem != "" {
+		h.showTopicPage(w, r, topic, 1, &TopicForm{
+			Error:     "Title " + problem + ".",
+			EditTopic: true,
+			Title:     title,
+			Tags:      r.FormValue("tags"),
+		})
+		return
+	}
+	oldTitle, oldTags := topic.Title, topic.Tags
+	topic.Title = title
+	topic.Tags = normalizeTags(strings.Split(r.FormValue("tags"), ","))
+	if err := h.db.UpdateTopic(topic, version); err != nil {
+		if errors.Is(err, ErrConflict) {
+			writeConflict(w, "topic")
+			return
+		}
+		log.Printf("Error updating topic: %v", err)
+		http.Error(w, "Failed to update topic", http.StatusInternalServerError)
+		return
+	}
+	h.audit(user, "topic.edit", "topic", topic.ID, map[string]string{
+		"old_title": oldTitle,
+		"old_tags":  strings.Join(oldTags, ","),
+	})
+	h.recordTopicEdit(user, topic, oldTitle, oldTags)
+	http.Redirect(w, r, "/topics/"+topic.ID, http.StatusSeeOther)
+}
+
+// deleteTopic serves POST /topics/{id}/delete. Like the admin API it
+// soft-deletes the topic, which hides its posts along with it.
+func (h *Handlers) deleteTopic(w http.ResponseWriter, r *http.Request, topicID uuid.UUID) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	topic, err := h.db.GetTopic(topicID)
+	if err != nil {
+		writeError(w, err, "topic")
+		return
+	}
+	if !canManageTopic(user, topic) {
+		http.Error(w, "Only the author or an admin can delete this topic", http.StatusForbidden)
+		return
+	}
+	if err := h.db.DeleteTopic(topic.ID); err != nil {
+		log.Printf("Error deleting topic: %v", err)
+		http.Error(w, "Failed to delete topic", http.StatusInternalServerError)
+		return
+	}
+	h.audit(user, "topic.delete", "topic", topic.ID, map[string]string{
+		"title":     topic.Title,
+		"author_id": topic.AuthorID,
+	})
+	http.Redirect(w, r, "/topics", http.StatusSeeOther)
+}
+
+// countTopicView adds a view to topic. Paging through it, or coming back
+// within VisitGap, doesn't count again; visitors who aren't signed in are
+// told apart by address.
+func (h *Handlers) countTopicView(r *http.Request, topic *Topic) {
+	if h.readOnly() {
+		return
+	}
+	viewer := clientIP(r)
+	if user, _ := r.Context().Value(userContextKey).(*User); user != nil {
+		viewer = user.ID
+	}
+	if !h.viewCounts.due(viewer+"\x00"+topic.ID, time.Now()) {
+		return
+	}
+	if err := h.db.CountTopicView(topic.ID); err != nil {
+		log.Printf("Error counting topic view: %v", err)
+	}
+}
+
+// recordTopicEdit adds renamed and retagged events to the topic's timeline
+// for the changes actor made.
+func (h *Handlers) recordTopicEdit(actor *User, topic *Topic, oldTitle string, oldTags []string) {
+	var events []TopicEvent
+	if topic.Title != oldTitle {
+		events = append(events, TopicEvent{TopicID: topic.ID, Kind: TopicRenamed, Data: TopicEventData{From: oldTitle, To: topic.Title}})
+	}
+	if added, removed := tagChanges(oldTags, topic.Tags); len(added)+len(removed) > 0 {
+		events = append(events, TopicEvent{TopicID: topic.ID, Kind: TopicRetagged, Data: TopicEventData{Added: added, Removed: removed}})
+	}
+	h.recordTopicEvents(actor, events...)
+}
+
+// --- Topic Database Functions ---
+
+// CountTopicView adds one to the topic's view count. It leaves the version
+// alone, since a view isn't an edit.
+func (d *Database) CountTopicView(topicID string) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `UPDATE topics SET view_count = view_count + 1 WHERE id = $1`, topicID)
+	return err
+}
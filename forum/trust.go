@@ -0,0 +1,59 @@
+// forum/trust.go
+package forum
+
+import (
+	"time"
+)
+
+// Trust levels are derived from a member's history rather than assigned by hand.
+const (
+	TrustNew = iota
+	TrustBasic
+	TrustMember
+	TrustRegular
+	TrustStaff
+)
+
+// trustRequirement is what a member needs to reach a given trust level.
+type trustRequirement struct {
+	level   int
+	posts   int
+	account time.Duration
+}
+
+// trustRequirements are checked from the highest level down.
+var trustRequirements = []trustRequirement{
+	{level: TrustRegular, posts: 100, account: 60 * 24 * time.Hour},
+	{level: TrustMember, posts: 30, account: 14 * 24 * time.Hour},
+	{level: TrustBasic, posts: 5, account: 24 * time.Hour},
+}
+
+// TrustLevel works out the user's current trust level from their post count and account age.
+func (d *Database) TrustLevel(user *User) (int, error) {
+	if user == nil {
+		return TrustNew, nil
+	}
+	if user.Admin {
+		return TrustStaff, nil
+	}
+	posts, err := d.CountPostsByAuthor(user.ID)
+	if err != nil {
+		return TrustNew, err
+	}
+	age := time.Since(user.Created)
+	for _, req := range trustRequirements {
+		if posts >= req.posts && age >= req.account {
+			return req.level, nil
+		}
+	}
+	return TrustNew, nil
+}
+
+func (d *Database) CountPostsByAuthor(authorID string) (int, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	var count int
+	query := "SELECT COUNT(*) FROM posts WHERE author_id = $1 AND " + postNotDeleted("posts")
+	err := d.pool.QueryRow(ctx, query, authorID).Scan(&count)
+	return count, err
+}
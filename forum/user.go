@@ -5,12 +5,10 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"io"
 	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Token struct {
@@ -22,6 +20,10 @@ type Token struct {
 	CreatedAt time.Time
 	ExpiresAt time.Time
 	Hash      []byte
+	// IP and UserAgent are the client address and browser the session was
+	// created from.
+	IP        string
+	UserAgent string
 }
 
 func (t *Token) MarshalBinary() ([]byte, error) {
@@ -35,6 +37,7 @@ func (t *Token) UnmarshalBinary(data []byte) error {
 func (t *Token) CreateToken(userID string, ttl time.Duration) (*Token, error) {
 	tk := &Token{
 		UserID:    userID,
+		CreatedAt: time.Now(),
 		ExpiresAt: time.Now().Add(ttl),
 	}
 	hotSauce := make([]byte, 64)
@@ -63,6 +66,7 @@ func NewUser(email string, admin bool) (*User, error) {
 		ID:            id,
 		Email:         email,
 		Key:           key,
+		KeyHash:       apiKeyHash(key),
 		Created:       now,
 		Updated:       now,
 		Admin:         admin,
@@ -70,10 +74,12 @@ func NewUser(email string, admin bool) (*User, error) {
 }
 
 type User struct {
-	ID            string         `json:"id"`
-	Email         string         `json:"email"`
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	// Key is the API key, known only when it was just generated; the
+	// database keeps KeyHash instead.
 	Key           string         `json:"key"`
-	Hash          []byte         `json:"hash"`
+	KeyHash       []byte         `json:"-"`
 	Password      string         `json:"password"`
 	Created       time.Time      `json:"created"`
 	Updated       time.Time      `json:"updated"`
@@ -81,15 +87,52 @@ type User struct {
 	Admin         bool           `json:"admin"`
 	SessionToken  *Token         `json:"session_token"`
 	Notifications []Notification `json:"notifications"`
+	LastSeenAt    *time.Time     `json:"last_seen_at"`
+	// LastVisitAt is when their previous visit ended, the LastSeenAt from
+	// before they came back after Config.VisitGap or more.
+	LastVisitAt  *time.Time `json:"last_visit_at,omitempty"`
+	HidePresence bool       `json:"hide_presence"`
+	// PasswordResetRequired sends the user to change their password when they
+	// next log in, e.g. after an admin provisioned the account.
+	PasswordResetRequired bool `json:"password_reset_required"`
+	// Version increases with every save; SaveUser refuses stale copies.
+	Version int `json:"version"`
+	// DeletedAt is set when the account is soft-deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// PageSize is how many topics or posts a page shows them; 0 means the
+	// site default. See PageSizes.
+	PageSize int `json:"page_size"`
+	// BannedUntil is when a ban ends, if the user was ever banned. Banned
+	// users can't sign in or post; see Banned.
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+	BanReason   string     `json:"ban_reason,omitempty"`
+	// Pending accounts wait for an admin's approval before they can sign in;
+	// see Config.ApproveSignups. Only SetUserPending changes it once saved.
+	Pending bool `json:"pending,omitempty"`
+
+	// impersonator is the admin viewing the forum as this user for the
+	// current request; see impersonation.go.
+	impersonator *User
 }
 
-func (u *User) SetPassword(password string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+// Banned reports whether the user is banned now.
+func (u *User) Banned() bool {
+	return u.BannedUntil != nil && u.BannedUntil.After(time.Now())
+}
+
+// SetPassword checks password against the policy and hashes it with params.
+// Policy failures are returned as a *PasswordPolicyError. The encoded hash
+// carries its own parameters, so PasswordMatches works whichever settings
+// produced it.
+func (u *User) SetPassword(password string, params PasswordParams) error {
+	if err := params.Policy.Validate(password, u.Email, u.Handle); err != nil {
+		return err
+	}
+	hash, err := params.Hash(password)
 	if err != nil {
 		return err
 	}
-	u.Hash = hash
-	u.Password = string(hash)
+	u.Password = hash
 	return nil
 }
 
@@ -101,24 +144,11 @@ func (u *User) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, u)
 }
 
-func (u *User) PasswordMatches(input string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(u.Hash, []byte(input))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			//invalid password
-			return false, nil
-		default:
-			//unknown error
-			return false, err
-		}
-	}
-
-	return true, nil
+func (u *User) PasswordMatches(input string, params PasswordParams) (bool, error) {
+	return params.Verify(u.Password, input)
 }
 
 func (u *User) Sanitize() {
-	u.Hash = nil
 	u.Password = ""
 }
 
@@ -133,6 +163,12 @@ func generateAPIKey() (string, error) {
 	return key, nil
 }
 
+// apiKeyHash is what the database keeps of an API key.
+func apiKeyHash(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
 type Notification struct {
 	From      string    `json:"from"`
 	ID        string    `json:"id"`
@@ -0,0 +1,455 @@
+// forum/views.go
+package forum
+
+import (
+	"encoding/base64"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Templates and JSON responses get the view types below rather than the
+// storage models, so fields like User.Password and User.Key can't reach a
+// page by accident. Each type holds only what its pages show, with times
+// already formatted.
+
+// Layouts used for rendered times.
+const (
+	dateLayout     = "Jan 02, 2006"
+	dateTimeLayout = "Jan 02, 2006 at 3:04 PM"
+)
+
+// formatTime formats t with layout, or returns "" if t is nil.
+func formatTime(t *time.Time, layout string) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// Viewer is the signed-in user as page chrome sees them.
+type Viewer struct {
+	ID     string
+	Handle string
+	Admin  bool
+	// Notifications is the number of notifications waiting for them.
+	Notifications int
+	// ImpersonatedBy is the admin viewing the forum as them, if any.
+	ImpersonatedBy string
+}
+
+// NewViewer returns the Viewer for u, or nil if nobody is signed in, so
+// templates can keep testing {{if .User}}.
+func NewViewer(u *User) *Viewer {
+	if u == nil {
+		return nil
+	}
+	v := &Viewer{ID: u.ID, Handle: u.Handle, Admin: u.Admin, Notifications: len(u.Notifications)}
+	if u.impersonator != nil {
+		v.ImpersonatedBy = u.impersonator.Handle
+	}
+	return v
+}
+
+// ProfileView is a member as other members see them.
+type ProfileView struct {
+	Handle string
+	Joined string
+	// LastSeen is empty if they were never seen or hide their presence.
+	LastSeen string
+}
+
+// NewProfileView returns the public view of u.
+func NewProfileView(u *User) ProfileView {
+	v := ProfileView{Handle: u.Handle, Joined: u.Created.Format(dateLayout)}
+	if !u.HidePresence {
+		v.LastSeen = formatTime(u.LastSeenAt, dateTimeLayout)
+	}
+	return v
+}
+
+// NewProfileViews converts a list of users with NewProfileView.
+func NewProfileViews(users []User) []ProfileView {
+	views := make([]ProfileView, len(users))
+	for i := range users {
+		views[i] = NewProfileView(&users[i])
+	}
+	return views
+}
+
+// AccountView is a user as staff see them on the admin user page.
+type AccountView struct {
+	ID                    string
+	Handle                string
+	Email                 string
+	Admin                 bool
+	PasswordResetRequired bool
+	Joined                string
+	LastSeen              string
+	// Deleted is when the account was deleted, or empty.
+	Deleted string
+	// BannedUntil is when the user's ban ends, or empty if they aren't
+	// banned.
+	BannedUntil string
+	BanReason   string
+}
+
+// NewAccountView returns the staff view of u.
+func NewAccountView(u *User) AccountView {
+	v := AccountView{
+		ID:                    u.ID,
+		Handle:                u.Handle,
+		Email:                 u.Email,
+		Admin:                 u.Admin,
+		PasswordResetRequired: u.PasswordResetRequired,
+		Joined:                u.Created.Format(dateTimeLayout),
+		LastSeen:              formatTime(u.LastSeenAt, dateTimeLayout),
+		Deleted:               formatTime(u.DeletedAt, dateTimeLayout),
+	}
+	if u.Banned() {
+		v.BannedUntil = u.BannedUntil.Format(dateTimeLayout)
+		v.BanReason = u.BanReason
+	}
+	return v
+}
+
+// UserRow is one line of the admin user list.
+type UserRow struct {
+	ID                    string
+	Handle                string
+	Email                 string
+	Joined                string
+	LastSeen              string
+	Admin                 bool
+	Pending               bool
+	Banned                bool
+	Suspended             bool
+	Deleted               bool
+	PasswordResetRequired bool
+}
+
+// NewUserRows converts a page of ListUsers results.
+func NewUserRows(users []UserSummary) []UserRow {
+	rows := make([]UserRow, len(users))
+	for i, s := range users {
+		rows[i] = UserRow{
+			ID:                    s.User.ID,
+			Handle:                s.User.Handle,
+			Email:                 s.User.Email,
+			Joined:                s.User.Created.Format(dateLayout),
+			LastSeen:              formatTime(s.User.LastSeenAt, dateLayout),
+			Admin:                 s.User.Admin,
+			Pending:               s.User.Pending,
+			Banned:                s.User.Banned(),
+			Suspended:             s.SuspendedUntil != nil,
+			Deleted:               s.User.DeletedAt != nil,
+			PasswordResetRequired: s.User.PasswordResetRequired,
+		}
+	}
+	return rows
+}
+
+// TagLink is a tag with the path of its page.
+type TagLink struct {
+	Name string
+	Path string
+}
+
+// tagPath returns the path of the page for tag. Tags may hold slashes, so
+// the name is escaped as a single path segment.
+func tagPath(tag string) string {
+	return "/tags/" + url.PathEscape(tag)
+}
+
+// NewTagLinks returns the links for tags.
+func NewTagLinks(tags []string) []TagLink {
+	links := make([]TagLink, len(tags))
+	for i, t := range tags {
+		links[i] = TagLink{Name: t, Path: tagPath(t)}
+	}
+	return links
+}
+
+// TagView is a tag as the tag list and tag page show it.
+type TagView struct {
+	TagLink
+	Description string
+	Topics      int
+	Followers   int
+}
+
+// NewTagView returns the view of t.
+func NewTagView(t *TagSummary) TagView {
+	return TagView{
+		TagLink:     TagLink{Name: t.Name, Path: tagPath(t.Name)},
+		Description: t.Description,
+		Topics:      t.Topics,
+		Followers:   t.Followers,
+	}
+}
+
+// NewTagViews converts a list of tags with NewTagView.
+func NewTagViews(tags []TagSummary) []TagView {
+	views := make([]TagView, len(tags))
+	for i := range tags {
+		views[i] = NewTagView(&tags[i])
+	}
+	return views
+}
+
+// TopicView is a topic as the topic list and topic page show it.
+type TopicView struct {
+	ID         string
+	Title      string
+	Tags       []TagLink
+	ReplyCount int
+	Views      int64
+	Created    string
+	// LastPost and LastPostAuthor are empty while the topic has no posts.
+	LastPost       string
+	LastPostAuthor string
+	// Unread counts the posts after the signed-in member's read marker.
+	Unread int
+	Solved bool
+	// TagList and Version fill the edit form.
+	TagList string
+	Version int
+}
+
+// NewTopicView returns the view of t.
+func NewTopicView(t *Topic) TopicView {
+	view := TopicView{
+		ID:         t.ID,
+		Title:      t.Title,
+		Tags:       NewTagLinks(t.Tags),
+		ReplyCount: t.ReplyCount,
+		Views:      t.ViewCount,
+		Created:    t.CreatedAt.Format(dateTimeLayout),
+		TagList:    strings.Join(t.Tags, ", "),
+		Version:    t.Version,
+		Solved:     t.SolutionPostID != nil,
+	}
+	if t.LastPostAt != nil {
+		view.LastPost = t.LastPostAt.Format(dateTimeLayout)
+		view.LastPostAuthor = t.LastPostAuthor
+	}
+	return view
+}
+
+// NewTopicViews converts a list of topics with NewTopicView.
+func NewTopicViews(topics []Topic) []TopicView {
+	views := make([]TopicView, len(topics))
+	for i := range topics {
+		views[i] = NewTopicView(&topics[i])
+	}
+	return views
+}
+
+// PostView is a post as the "post" template shows it. Body is left as text;
+// html/template escapes it when the page is rendered.
+type PostView struct {
+	ID       int64
+	TopicID  string
+	AuthorID string
+	Author   string
+	// Guest marks a post made without an account.
+	Guest   bool
+	Body    string
+	Wiki    bool
+	Version int
+	Posted  string
+	// Edited is when the post was last edited, or empty.
+	Edited string
+	// Deleted marks a post shown only as a placeholder.
+	Deleted bool
+	// Highlight, when set, is shown in place of the body: the body as plain
+	// text with search matches marked.
+	Highlight template.HTML
+}
+
+// NewPostView returns the view of p.
+func NewPostView(p *Post) PostView {
+	return PostView{
+		ID:       p.ID,
+		TopicID:  p.TopicID,
+		AuthorID: p.AuthorID,
+		Author:   p.Author,
+		Guest:    p.ByGuest(),
+		Body:     p.Body,
+		Wiki:     p.Wiki,
+		Version:  p.Version,
+		Posted:   p.CreatedAt.Format(dateTimeLayout),
+		Edited:   formatTime(p.UpdatedAt, dateTimeLayout),
+		Deleted:  p.DeletedAt != nil,
+	}
+}
+
+// ReminderView is a pending reminder as the notifications page lists it.
+type ReminderView struct {
+	ID         int64
+	TopicID    string
+	TopicTitle string
+	Due        string
+}
+
+// NewReminderViews converts a list of reminders.
+func NewReminderViews(reminders []Reminder) []ReminderView {
+	views := make([]ReminderView, len(reminders))
+	for i, rm := range reminders {
+		views[i] = ReminderView{ID: rm.ID, TopicID: rm.TopicID, TopicTitle: rm.TopicTitle, Due: rm.RemindAt.Format(dateTimeLayout)}
+	}
+	return views
+}
+
+// BookmarkView is a bookmark as the bookmarks page lists it. Excerpt is
+// set for posts, and Remind is when its reminder is due, if it has one.
+type BookmarkView struct {
+	ID         int64
+	Link       string
+	TopicTitle string
+	Post       bool
+	Excerpt    string
+	Saved      string
+	Remind     string
+}
+
+// NewBookmarkViews converts a member's bookmarks.
+func NewBookmarkViews(bookmarks []Bookmark) []BookmarkView {
+	views := make([]BookmarkView, len(bookmarks))
+	for i := range bookmarks {
+		b := &bookmarks[i]
+		views[i] = BookmarkView{
+			ID:         b.ID,
+			Link:       b.Link(),
+			TopicTitle: b.TopicTitle,
+			Post:       b.PostID != nil,
+			Excerpt:    b.Excerpt,
+			Saved:      b.CreatedAt.Format(dateTimeLayout),
+			Remind:     formatTime(b.RemindAt, dateTimeLayout),
+		}
+	}
+	return views
+}
+
+// ActivityView is an item as the activity page shows it.
+type ActivityView struct {
+	Kind       string
+	Link       string
+	TopicTitle string
+	Excerpt    string
+	// State is set for posts that aren't visible, which only their author
+	// sees in the feed.
+	State string
+	When  string
+}
+
+// NewActivityViews converts a page of activity.
+func NewActivityViews(items []ActivityItem) []ActivityView {
+	views := make([]ActivityView, len(items))
+	for i, it := range items {
+		v := ActivityView{Kind: it.Kind, Link: "/topics/" + it.TopicID, TopicTitle: it.TopicTitle, Excerpt: it.Excerpt, When: it.CreatedAt.Format(dateTimeLayout)}
+		if it.Kind == ActivityPost {
+			// Posts not yet, or no longer, visible aren't on the topic page.
+			if it.State != PostVisible {
+				v.State = it.State
+			} else {
+				v.Link = postPath(it.PostID)
+			}
+		}
+		views[i] = v
+	}
+	return views
+}
+
+// SearchResultView is a match as the search page lists it. Snippet is the
+// matching text, escaped, with the matches marked.
+type SearchResultView struct {
+	Kind       string
+	Link       string
+	TopicTitle string
+	Snippet    template.HTML
+	When       string
+}
+
+// NewSearchResultViews converts a page of search results.
+func NewSearchResultViews(results []SearchResult) []SearchResultView {
+	views := make([]SearchResultView, len(results))
+	for i, sr := range results {
+		v := SearchResultView{Kind: sr.Kind, Link: "/topics/" + sr.TopicID, TopicTitle: sr.TopicTitle, Snippet: highlightSnippet(sr.Snippet), When: sr.CreatedAt.Format(dateTimeLayout)}
+		if sr.Kind == SearchPost {
+			v.Link = postPath(sr.PostID)
+		}
+		views[i] = v
+	}
+	return views
+}
+
+// PasskeyView is a passkey as the settings page lists it. ID is
+// base64url-encoded for use in its delete URL.
+type PasskeyView struct {
+	ID       string
+	Name     string
+	Added    string
+	LastUsed string
+}
+
+// NewPasskeyViews converts a member's passkeys.
+func NewPasskeyViews(passkeys []Passkey) []PasskeyView {
+	views := make([]PasskeyView, len(passkeys))
+	for i, pk := range passkeys {
+		views[i] = PasskeyView{
+			ID:       base64.RawURLEncoding.EncodeToString(pk.ID),
+			Name:     pk.Name,
+			Added:    pk.CreatedAt.Format(dateLayout),
+			LastUsed: formatTime(pk.LastUsedAt, dateTimeLayout),
+		}
+	}
+	return views
+}
+
+// AccountResponse is the JSON returned when an account is created. It
+// includes the API key, which the new owner has no other way to learn.
+type AccountResponse struct {
+	ID      string    `json:"id"`
+	Email   string    `json:"email"`
+	Handle  string    `json:"handle"`
+	Admin   bool      `json:"admin"`
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+	// Pending is set when the account waits for an admin's approval.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// NewAccountResponse returns the creation response for u.
+func NewAccountResponse(u *User) AccountResponse {
+	return AccountResponse{ID: u.ID, Email: u.Email, Handle: u.Handle, Admin: u.Admin, Key: u.Key, Created: u.Created, Pending: u.Pending}
+}
+
+// SessionView is a signed-in browser as the sessions page lists it.
+type SessionView struct {
+	ID        string
+	IP        string
+	UserAgent string
+	Created   string
+	Expires   string
+	LastUsed  string
+	Current   bool
+}
+
+// NewSessionViews converts a member's sessions.
+func NewSessionViews(sessions []UserSession) []SessionView {
+	views := make([]SessionView, len(sessions))
+	for i, s := range sessions {
+		views[i] = SessionView{
+			ID:        s.ID,
+			IP:        s.IP,
+			UserAgent: s.UserAgent,
+			Created:   s.CreatedAt.Format(dateTimeLayout),
+			Expires:   s.ExpiresAt.Format(dateTimeLayout),
+			LastUsed:  formatTime(s.LastUsedAt, dateTimeLayout),
+			Current:   s.Current,
+		}
+	}
+	return views
+}
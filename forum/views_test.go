@@ -0,0 +1,133 @@
+// forum/views_test.go
+package forum_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rexlx/volconvo/forum"
+)
+
+// secretUser returns a user whose password hash and API key are marked so a
+// leak is easy to spot, with every time set.
+func secretUser(t *testing.T) *forum.User {
+	t.Helper()
+	u, err := forum.NewUser("member@example.com", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Handle = "member"
+	u.Password = "secret-password-hash"
+	u.Key = "secret-api-key"
+	u.KeyHash = []byte("secret-key-hash")
+	u.Created = time.Date(2024, time.March, 5, 14, 7, 0, 0, time.UTC)
+	seen := time.Date(2024, time.April, 1, 9, 30, 0, 0, time.UTC)
+	u.LastSeenAt = &seen
+	return u
+}
+
+// TestViewsHideSecrets checks that no converter of a user carries its
+// password hash or API key, in a field or in its output.
+func TestViewsHideSecrets(t *testing.T) {
+	u := secretUser(t)
+	tests := []struct {
+		name string
+		view any
+		// keyAllowed is set for the one view meant to hand out the key.
+		keyAllowed bool
+	}{
+		{"NewViewer", forum.NewViewer(u), false},
+		{"NewProfileView", forum.NewProfileView(u), false},
+		{"NewProfileViews", forum.NewProfileViews([]forum.User{*u}), false},
+		{"NewAccountView", forum.NewAccountView(u), false},
+		{"NewUserRows", forum.NewUserRows([]forum.UserSummary{{User: *u}}), false},
+		{"NewAccountResponse", forum.NewAccountResponse(u), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.view)
+			if err != nil {
+				t.Fatal(err)
+			}
+			secrets := []string{u.Password, string(u.KeyHash)}
+			if !tt.keyAllowed {
+				secrets = append(secrets, u.Key)
+			}
+			for _, out := range []string{string(b), fmt.Sprintf("%+v", tt.view)} {
+				for _, secret := range secrets {
+					if strings.Contains(out, secret) {
+						t.Errorf("%s output contains %q: %s", tt.name, secret, out)
+					}
+				}
+			}
+			fields := []string{"Password", "KeyHash"}
+			if !tt.keyAllowed {
+				fields = append(fields, "Key")
+			}
+			for _, field := range fields {
+				if hasField(reflect.TypeOf(tt.view), field) {
+					t.Errorf("%s returns a type with a %s field", tt.name, field)
+				}
+			}
+		})
+	}
+}
+
+// hasField reports whether typ, or a type it holds, has a field named name.
+func hasField(typ reflect.Type, name string) bool {
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return hasField(typ.Elem(), name)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if f.Name == name || hasField(f.Type, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TestViewTimes checks that converters format times for display and leave
+// missing ones empty.
+func TestViewTimes(t *testing.T) {
+	u := secretUser(t)
+	hidden := *u
+	hidden.HidePresence = true
+	never := *u
+	never.LastSeenAt = nil
+
+	created := time.Date(2024, time.June, 1, 18, 45, 0, 0, time.UTC)
+	edited := created.Add(time.Hour)
+	post := &forum.Post{ID: 1, Body: "b", CreatedAt: created, UpdatedAt: &edited}
+	topic := &forum.Topic{ID: "t", Title: "T", CreatedAt: created, LastPostAt: &edited, LastPostAuthor: "member"}
+
+	tests := []struct {
+		name, got, want string
+	}{
+		{"ProfileView.Joined", forum.NewProfileView(u).Joined, "Mar 05, 2024"},
+		{"ProfileView.LastSeen", forum.NewProfileView(u).LastSeen, "Apr 01, 2024 at 9:30 AM"},
+		{"ProfileView.LastSeen hidden", forum.NewProfileView(&hidden).LastSeen, ""},
+		{"ProfileView.LastSeen never", forum.NewProfileView(&never).LastSeen, ""},
+		{"AccountView.Joined", forum.NewAccountView(u).Joined, "Mar 05, 2024 at 2:07 PM"},
+		{"AccountView.Deleted", forum.NewAccountView(u).Deleted, ""},
+		{"UserRow.Joined", forum.NewUserRows([]forum.UserSummary{{User: *u}})[0].Joined, "Mar 05, 2024"},
+		{"UserRow.LastSeen", forum.NewUserRows([]forum.UserSummary{{User: *u}})[0].LastSeen, "Apr 01, 2024"},
+		{"PostView.Posted", forum.NewPostView(post).Posted, "Jun 01, 2024 at 6:45 PM"},
+		{"PostView.Edited", forum.NewPostView(post).Edited, "Jun 01, 2024 at 7:45 PM"},
+		{"PostView.Edited never", forum.NewPostView(&forum.Post{CreatedAt: created}).Edited, ""},
+		{"TopicView.Created", forum.NewTopicView(topic).Created, "Jun 01, 2024 at 6:45 PM"},
+		{"TopicView.LastPost", forum.NewTopicView(topic).LastPost, "Jun 01, 2024 at 7:45 PM"},
+		{"TopicView.LastPost none", forum.NewTopicView(&forum.Topic{CreatedAt: created}).LastPost, ""},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// forum/webhooks.go
+package forum
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook kinds. Moderation hooks receive enforcement activity only, so they
+// can be pointed at compliance tooling without leaking forum content traffic.
+const (
+	WebhookModeration = "moderation"
+)
+
+// moderationEvents are the audit actions forwarded to moderation webhooks.
+var moderationEvents = map[string]bool{
+	"post.held":      true,
+	"post.hidden":    true,
+	"post.approve":   true,
+	"post.delete":    true,
+	"post.restore":   true,
+	"topic.delete":   true,
+	"user.purge":     true,
+	"user.suspend":   true,
+	"user.unsuspend": true,
+	"user.ban":       true,
+	"user.unban":     true,
+	"user.approve":   true,
+	"user.reject":    true,
+	"queue.resolve":  true,
+	"report.resolve": true,
+	"rule.create":    true,
+	"rule.update":    true,
+	"rule.delete":    true,
+}
+
+// webhookRetries is how many times a failed delivery is attempted in total.
+const webhookRetries = 3
+
+// Webhook is an external endpoint that receives signed event payloads.
+type Webhook struct {
+	ID        int64     `json:"id" db:"id"`
+	URL       string    `json:"url" db:"url"`
+	Secret    string    `json:"-" db:"secret"`
+	Kind      string    `json:"kind" db:"kind"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// WebhookEvent is the JSON body posted to a webhook.
+type WebhookEvent struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Type       string     `json:"type"`
+	OccurredAt time.Time  `json:"occurred_at"`
+	Data       AuditEntry `json:"data"`
+}
+
+// WebhooksViewData is the data structure for the admin webhooks page.
+type WebhooksViewData struct {
+	User      *Viewer
+	Webhooks  []Webhook
+	NewSecret string
+}
+
+// emitModerationEvent queues an audit entry for delivery if it is a moderation action.
+func (h *Handlers) emitModerationEvent(entry AuditEntry) {
+	if !moderationEvents[entry.Action] {
+		return
+	}
+	ev := WebhookEvent{
+		ID:         uuid.New().String(),
+		Kind:       WebhookModeration,
+		Type:       entry.Action,
+		OccurredAt: entry.CreatedAt,
+		Data:       entry,
+	}
+	select {
+	case h.hookCh <- ev:
+	default:
+		log.Printf("Webhook queue full, dropping %s event %s", ev.Type, ev.ID)
+	}
+}
+
+// StartWebhookDispatcher delivers queued webhook events until the channel closes.
+func (h *Handlers) StartWebhookDispatcher() {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for ev := range h.hookCh {
+		hooks, err := h.db.ListWebhooks(ev.Kind)
+		if err != nil {
+			log.Printf("Error loading webhooks: %v", err)
+			continue
+		}
+		body, err := json.Marshal(ev)
+		if err != nil {
+			log.Printf("Error encoding webhook event: %v", err)
+			continue
+		}
+		for _, hook := range hooks {
+			go deliverWebhook(client, hook, ev, body)
+		}
+	}
+}
+
+// deliverWebhook posts body to hook, retrying with backoff on failure.
+func deliverWebhook(client *http.Client, hook Webhook, ev WebhookEvent, body []byte) {
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	backoff := time.Second
+	for attempt := 1; attempt <= webhookRetries; attempt++ {
+		err := postWebhook(client, hook.URL, ev, signature, body)
+		if err == nil {
+			return
+		}
+		log.Printf("Webhook %d delivery of %s failed (attempt %d/%d): %v", hook.ID, ev.ID, attempt, webhookRetries, err)
+		time.Sleep(backoff)
+		backoff *= 5
+	}
+}
+
+func postWebhook(client *http.Client, url string, ev WebhookEvent, signature string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Volconvo-Event", ev.Type)
+	req.Header.Set("X-Volconvo-Delivery", ev.ID)
+	req.Header.Set("X-Volconvo-Signature", signature)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// showWebhooks renders the admin webhooks page.
+func (h *Handlers) showWebhooks(w http.ResponseWriter, r *http.Request, newSecret string) {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	hooks, err := h.db.ListAllWebhooks()
+	if err != nil {
+		log.Printf("Error listing webhooks: %v", err)
+		http.Error(w, "Failed to retrieve webhooks", http.StatusInternalServerError)
+		return
+	}
+	data := WebhooksViewData{User: NewViewer(user), Webhooks: hooks, NewSecret: newSecret}
+	if err := h.templates.ExecuteTemplate(w, "webhooks.html", data); err != nil {
+		log.Printf("Error executing webhooks template: %v", err)
+	}
+}
+
+// createWebhook serves POST /admin/webhooks. The signing secret is generated
+// here and shown once.
+func (h *Handlers) createWebhook(w http.ResponseWriter, r *http.Request) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	if err := r.ParseForm(); err != nil {
+		badRequestBody(w, err, "Failed to parse form")
+		return
+	}
+	url := r.FormValue("url")
+	if url == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+	secret, err := generateAPIKey()
+	if err != nil {
+		log.Printf("Error generating webhook secret: %v", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	hook := Webhook{URL: url, Secret: secret, Kind: WebhookModeration, Enabled: true}
+	if err := h.db.CreateWebhook(&hook); err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "webhook.create", "webhook", strconv.FormatInt(hook.ID, 10), map[string]string{"url": url})
+	h.showWebhooks(w, r, secret)
+}
+
+// deleteWebhook serves POST /admin/webhooks/{id}/delete.
+func (h *Handlers) deleteWebhook(w http.ResponseWriter, r *http.Request, idStr string) {
+	staff, _ := r.Context().Value(userContextKey).(*User)
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.DeleteWebhook(id); err != nil {
+		log.Printf("Error deleting webhook: %v", err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	h.audit(staff, "webhook.delete", "webhook", idStr, nil)
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// --- Webhook Database Functions ---
+
+func (d *Database) CreateWebhook(hook *Webhook) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	query := `INSERT INTO webhooks (url, secret, kind, enabled) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	return d.pool.QueryRow(ctx, query, hook.URL, hook.Secret, hook.Kind, hook.Enabled).Scan(&hook.ID, &hook.CreatedAt)
+}
+
+func (d *Database) queryWebhooks(query string, args ...any) ([]Webhook, error) {
+	ctx, cancel := d.op()
+	defer cancel()
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hooks []Webhook
+	for rows.Next() {
+		var hook Webhook
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.Secret, &hook.Kind, &hook.Enabled, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// ListWebhooks returns the enabled webhooks of a kind.
+func (d *Database) ListWebhooks(kind string) ([]Webhook, error) {
+	return d.queryWebhooks(`SELECT id, url, secret, kind, enabled, created_at FROM webhooks WHERE enabled AND kind = $1`, kind)
+}
+
+func (d *Database) ListAllWebhooks() ([]Webhook, error) {
+	return d.queryWebhooks(`SELECT id, url, secret, kind, enabled, created_at FROM webhooks ORDER BY id`)
+}
+
+func (d *Database) DeleteWebhook(id int64) error {
+	ctx, cancel := d.op()
+	defer cancel()
+	_, err := d.pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	return err
+}
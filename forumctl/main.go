@@ -0,0 +1,168 @@
+// forumctl/main.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rexlx/volconvo/forum"
+)
+
+const usage = `Usage: forumctl <command> [flags]
+
+Commands:
+  users import [-url URL] FILE   create users from a CSV or JSON file
+  fsck [-url URL] [-repair]      check the database for inconsistencies,
+                                 applying the safe fixes with -repair
+
+forumctl talks to a running server. It reads the server address from FORUM_URL
+(default http://localhost:8080) and authenticates with FORUM_API_KEY, an admin's
+"email:key" pair.
+`
+
+func main() {
+	log.SetFlags(0)
+	args := os.Args[1:]
+	switch {
+	case len(args) >= 2 && args[0] == "users" && args[1] == "import":
+		importUsers(args[2:])
+		return
+	case len(args) >= 1 && args[0] == "fsck":
+		fsck(args[1:])
+		return
+	}
+	fmt.Fprint(os.Stderr, usage)
+	os.Exit(2)
+}
+
+// importUsers posts FILE to /admin/users/import and prints a row per user.
+// It exits non-zero if any row failed.
+func importUsers(args []string) {
+	fs := flag.NewFlagSet("users import", flag.ExitOnError)
+	baseURL := fs.String("url", envOr("FORUM_URL", "http://localhost:8080"), "forum server address")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	body, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Could not read %s: %v", path, err)
+	}
+	contentType := "application/json"
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		contentType = "text/csv"
+	}
+
+	resp := call(*baseURL, http.MethodPost, "/admin/users/import", contentType, bytes.NewReader(body), "Import")
+	defer resp.Body.Close()
+
+	var results []forum.ProvisionResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		log.Fatalf("Could not read import results: %v", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROW\tEMAIL\tHANDLE\tSTATUS\tTEMPORARY PASSWORD\tERROR")
+	failed := 0
+	for _, res := range results {
+		if res.Status == forum.ProvisionFailed {
+			failed++
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", res.Row, res.Email, res.Handle, res.Status, res.TemporaryPassword, res.Error)
+	}
+	tw.Flush()
+	if failed > 0 {
+		log.Fatalf("%d of %d rows failed", failed, len(results))
+	}
+}
+
+// fsck runs the server's database checks and prints a row per check. It
+// exits non-zero if problems remain afterwards.
+func fsck(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	baseURL := fs.String("url", envOr("FORUM_URL", "http://localhost:8080"), "forum server address")
+	repair := fs.Bool("repair", false, "apply the safe fixes")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	method := http.MethodGet
+	if *repair {
+		method = http.MethodPost
+	}
+	resp := call(*baseURL, method, "/api/v1/admin/fsck", "", nil, "Check")
+	defer resp.Body.Close()
+
+	var report forum.FsckReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		log.Fatalf("Could not read check results: %v", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tFOUND\tREPAIRED\tPROBLEM\tEXAMPLES")
+	remaining := 0
+	for _, c := range report.Checks {
+		repaired := "-"
+		if c.Repairable {
+			repaired = fmt.Sprint(c.Repaired)
+		}
+		if c.Found > c.Repaired {
+			remaining++
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", c.Name, c.Found, repaired, c.Problem, strings.Join(c.Samples, ","))
+	}
+	tw.Flush()
+	if remaining > 0 {
+		if !*repair {
+			log.Fatalf("%d checks found problems; run with -repair to apply the safe fixes", remaining)
+		}
+		log.Fatalf("%d checks found problems that need fixing by hand", remaining)
+	}
+}
+
+// call sends an authenticated request to the server and exits unless it
+// answers 200 OK. what names the operation in error messages.
+func call(baseURL, method, path, contentType string, body io.Reader, what string) *http.Response {
+	apiKey := os.Getenv("FORUM_API_KEY")
+	if apiKey == "" {
+		log.Fatal("FORUM_API_KEY is not set")
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(baseURL, "/")+path, body)
+	if err != nil {
+		log.Fatalf("Could not build request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", apiKey)
+	client := &http.Client{Timeout: 15 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatalf("%s failed: %v", what, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		log.Fatalf("%s failed: %s: %s", what, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,109 @@
+// forumtest/fixtures.go
+package forumtest
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/rexlx/volconvo/forum"
+)
+
+// fixtureSeq keeps fixture emails and handles unique within a test binary.
+var fixtureSeq atomic.Int64
+
+// UserOption adjusts a fixture user before it is saved.
+type UserOption func(*forum.User)
+
+// WithHandle sets the user's handle.
+func WithHandle(handle string) UserOption {
+	return func(u *forum.User) { u.Handle = handle }
+}
+
+// WithEmail sets the user's email address.
+func WithEmail(email string) UserOption {
+	return func(u *forum.User) { u.Email = email }
+}
+
+// AsAdmin makes the user an admin.
+func AsAdmin(u *forum.User) { u.Admin = true }
+
+// User saves a member whose password is Password. Handles and emails are
+// user1, user2, ... unless an option sets them.
+func (e *Env) User(opts ...UserOption) *forum.User {
+	e.T.Helper()
+	n := fixtureSeq.Add(1)
+	u, err := forum.NewUser(fmt.Sprintf("user%d@example.com", n), false)
+	if err != nil {
+		e.T.Fatalf("forumtest: new user: %v", err)
+	}
+	u.Handle = fmt.Sprintf("user%d", n)
+	for _, opt := range opts {
+		opt(u)
+	}
+	// Hash directly: the password policy is the code under test elsewhere.
+	if u.Password, err = e.Config.Password.Hash(Password); err != nil {
+		e.T.Fatalf("forumtest: hashing password: %v", err)
+	}
+	if err := e.DB.SaveUser(u); err != nil {
+		e.T.Fatalf("forumtest: saving user: %v", err)
+	}
+	return u
+}
+
+// Admin saves an admin user.
+func (e *Env) Admin(opts ...UserOption) *forum.User {
+	e.T.Helper()
+	return e.User(append([]UserOption{AsAdmin}, opts...)...)
+}
+
+// Topic saves a topic by author.
+func (e *Env) Topic(author *forum.User, title string, tags ...string) *forum.Topic {
+	e.T.Helper()
+	if tags == nil {
+		tags = []string{}
+	}
+	t := &forum.Topic{ID: forum.NewTopicID(), Title: title, Tags: tags, AuthorID: author.ID}
+	if err := e.DB.CreateTopic(t); err != nil {
+		e.T.Fatalf("forumtest: creating topic: %v", err)
+	}
+	return t
+}
+
+// Post saves a visible post in topic, replying to parent if it isn't nil.
+func (e *Env) Post(topic *forum.Topic, author *forum.User, body string, parent *forum.Post) *forum.Post {
+	e.T.Helper()
+	p := &forum.Post{TopicID: topic.ID, Author: author.Handle, AuthorID: author.ID, Body: body}
+	if parent != nil {
+		p.ParentPostID = &parent.ID
+	}
+	if err := e.DB.CreatePost(p); err != nil {
+		e.T.Fatalf("forumtest: creating post: %v", err)
+	}
+	return p
+}
+
+// PostTree describes a post and the replies to it.
+type PostTree struct {
+	Author  *forum.User
+	Body    string
+	Replies []PostTree
+}
+
+// Thread saves trees in topic depth first, each reply after its parent, and
+// returns the posts in the order they were created.
+func (e *Env) Thread(topic *forum.Topic, trees ...PostTree) []*forum.Post {
+	e.T.Helper()
+	var posts []*forum.Post
+	var add func(parent *forum.Post, tree PostTree)
+	add = func(parent *forum.Post, tree PostTree) {
+		p := e.Post(topic, tree.Author, tree.Body, parent)
+		posts = append(posts, p)
+		for _, reply := range tree.Replies {
+			add(p, reply)
+		}
+	}
+	for _, tree := range trees {
+		add(nil, tree)
+	}
+	return posts
+}
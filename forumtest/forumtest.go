@@ -0,0 +1,160 @@
+// forumtest/forumtest.go
+
+// Package forumtest is scaffolding for tests of the forum package and of
+// forks built on it: a throwaway database, fixture builders, requests signed
+// in through a real session, and golden-file assertions.
+//
+// The forum stores everything in Postgres, so there is no in-memory store.
+// Instead each test gets its own schema in the database named by
+// FORUMTEST_DATABASE_URL, created on demand and dropped when the test ends;
+// tests skip when the variable is unset.
+package forumtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rexlx/volconvo/forum"
+)
+
+// DatabaseEnv names the Postgres database tests run against.
+const DatabaseEnv = "FORUMTEST_DATABASE_URL"
+
+// Password is the password of every fixture user.
+const Password = "correct horse battery staple"
+
+// Env is one test's forum: its database, handlers and routes.
+type Env struct {
+	T        testing.TB
+	DB       *forum.Database
+	Config   forum.Config
+	Handlers *forum.Handlers
+	// Server is the full route table behind the session middleware, as
+	// served by cmd/server.
+	Server http.Handler
+}
+
+// New returns a forum on a fresh database, with the default configuration
+// changed by any configure functions.
+func New(t testing.TB, configure ...func(*forum.Config)) *Env {
+	t.Helper()
+	cfg := forum.DefaultConfig()
+	cfg.Templates = filepath.Join(TemplateDir(t), "*.html")
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	db := NewDatabase(t)
+	db.SetQueryTimeout(cfg.QueryTimeout)
+	h, err := forum.NewHandlers(db, cfg)
+	if err != nil {
+		t.Fatalf("forumtest: creating handlers: %v", err)
+	}
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return &Env{
+		T:        t,
+		DB:       db,
+		Config:   cfg,
+		Handlers: h,
+		Server:   h.Session.LoadAndSave(mux),
+	}
+}
+
+// NewDatabase returns a database with the forum schema in a schema of its
+// own, which is dropped when the test ends. It skips the test if
+// FORUMTEST_DATABASE_URL is unset.
+func NewDatabase(t testing.TB) *forum.Database {
+	t.Helper()
+	dsn := os.Getenv(DatabaseEnv)
+	if dsn == "" {
+		t.Skipf("forumtest: %s is not set", DatabaseEnv)
+	}
+	var b [6]byte
+	rand.Read(b[:])
+	schema := "forumtest_" + hex.EncodeToString(b[:])
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("forumtest: connecting: %v", err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("forumtest: creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		conn, err := pgx.Connect(context.Background(), dsn)
+		if err != nil {
+			t.Logf("forumtest: dropping %s: %v", schema, err)
+			return
+		}
+		defer conn.Close(context.Background())
+		if _, err := conn.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Logf("forumtest: dropping %s: %v", schema, err)
+		}
+	})
+
+	// public stays on the path for extensions such as uuid-ossp.
+	db, err := forum.OpenDatabase(withSearchPath(dsn, schema+",public"), "")
+	if err != nil {
+		t.Fatalf("forumtest: opening database: %v", err)
+	}
+	t.Cleanup(db.Close)
+	if err := db.CreateTables(); err != nil {
+		t.Fatalf("forumtest: creating tables: %v", err)
+	}
+	return db
+}
+
+// withSearchPath sets search_path in a URL or keyword/value connection string.
+func withSearchPath(dsn, path string) string {
+	if strings.Contains(dsn, "://") {
+		if u, err := url.Parse(dsn); err == nil {
+			q := u.Query()
+			q.Set("search_path", path)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + path
+}
+
+// TemplateDir finds the forum's templates directory: FORUMTEST_TEMPLATES if
+// set, else the nearest templates directory above the working directory, else
+// the one next to this package.
+func TemplateDir(t testing.TB) string {
+	t.Helper()
+	if dir := os.Getenv("FORUMTEST_TEMPLATES"); dir != "" {
+		return dir
+	}
+	isTemplates := func(dir string) bool {
+		_, err := os.Stat(filepath.Join(dir, "topic.html"))
+		return err == nil
+	}
+	if wd, err := os.Getwd(); err == nil {
+		for dir := wd; ; dir = filepath.Dir(dir) {
+			if isTemplates(filepath.Join(dir, "templates")) {
+				return filepath.Join(dir, "templates")
+			}
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+	if _, file, _, ok := runtime.Caller(0); ok {
+		if dir := filepath.Join(filepath.Dir(file), "..", "templates"); isTemplates(dir) {
+			return dir
+		}
+	}
+	t.Fatal("forumtest: templates directory not found; set FORUMTEST_TEMPLATES")
+	return ""
+}
@@ -0,0 +1,64 @@
+// forumtest/golden.go
+package forumtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// UpdateEnv, when set, makes AssertGolden rewrite golden files instead of
+// comparing against them.
+const UpdateEnv = "FORUMTEST_UPDATE"
+
+// AssertGolden compares got with testdata/name.golden. Whitespace at the ends
+// of lines and blank lines are ignored, since templates are indented freely.
+// replace holds old, new pairs applied to got first, to swap values that
+// change between runs, such as IDs and timestamps, for fixed placeholders.
+func AssertGolden(t testing.TB, name string, got []byte, replace ...string) {
+	t.Helper()
+	if len(replace)%2 != 0 {
+		t.Fatal("forumtest: AssertGolden needs old, new pairs")
+	}
+	text := strings.NewReplacer(replace...).Replace(string(got))
+	path := filepath.Join("testdata", name+".golden")
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("forumtest: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(normalizeHTML(text)), 0o644); err != nil {
+			t.Fatalf("forumtest: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("forumtest: %v (run with %s=1 to create it)", err, UpdateEnv)
+	}
+	gotLines := strings.Split(normalizeHTML(text), "\n")
+	wantLines := strings.Split(normalizeHTML(string(want)), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Fatalf("%s differs at line %d:\n got: %s\nwant: %s\n(run with %s=1 to accept)", path, i+1, g, w, UpdateEnv)
+		}
+	}
+}
+
+// normalizeHTML trims every line and drops the empty ones.
+func normalizeHTML(s string) string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n") + "\n"
+}
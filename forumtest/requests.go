@@ -0,0 +1,82 @@
+// forumtest/requests.go
+package forumtest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rexlx/volconvo/forum"
+)
+
+// Request returns an anonymous request to the forum.
+func (e *Env) Request(method, target string, body io.Reader) *http.Request {
+	return httptest.NewRequest(method, target, body)
+}
+
+// Form returns an anonymous form post.
+func (e *Env) Form(target string, values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// As signs r in as user the way a browser would be: it saves a session token
+// for them, stores it in a new scs session and sends the session cookie.
+func (e *Env) As(user *forum.User, r *http.Request) *http.Request {
+	e.T.Helper()
+	tk, err := user.SessionToken.CreateToken(user.ID, time.Hour)
+	if err != nil {
+		e.T.Fatalf("forumtest: creating token: %v", err)
+	}
+	tk.Email = user.Email
+	tk.Handle = user.Handle
+	if err := e.DB.SaveToken(tk); err != nil {
+		e.T.Fatalf("forumtest: saving token: %v", err)
+	}
+
+	sm := e.Handlers.Session
+	ctx, err := sm.Load(context.Background(), "")
+	if err != nil {
+		e.T.Fatalf("forumtest: loading session: %v", err)
+	}
+	if err := e.Handlers.AddTokenToSession(r.WithContext(ctx), nil, tk); err != nil {
+		e.T.Fatalf("forumtest: signing session in: %v", err)
+	}
+	cookie, _, err := sm.Commit(ctx)
+	if err != nil {
+		e.T.Fatalf("forumtest: committing session: %v", err)
+	}
+	r.AddCookie(&http.Cookie{Name: sm.Cookie.Name, Value: cookie})
+	return r
+}
+
+// WithAPIKey authenticates r with user's API key instead of a session.
+func (e *Env) WithAPIKey(user *forum.User, r *http.Request) *http.Request {
+	r.Header.Set("Authorization", user.Email+":"+user.Key)
+	return r
+}
+
+// Do serves r through the full route table and returns the response.
+func (e *Env) Do(r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.Server.ServeHTTP(rec, r)
+	return rec
+}
+
+// Get is Do for an anonymous GET of target.
+func (e *Env) Get(target string) *httptest.ResponseRecorder {
+	return e.Do(e.Request(http.MethodGet, target, nil))
+}
+
+// ExpectStatus fails the test unless rec has the given status.
+func (e *Env) ExpectStatus(rec *httptest.ResponseRecorder, want int) {
+	e.T.Helper()
+	if rec.Code != want {
+		e.T.Fatalf("status = %d, want %d; body:\n%s", rec.Code, want, rec.Body.String())
+	}
+}
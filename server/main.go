@@ -5,29 +5,84 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/rexlx/volconvo/forum"
 )
 
 func main() {
-	// Get the database connection string from an environment variable.
-	dbURL := os.Getenv("DATABASE_URL")
+	secrets, err := forum.SecretsFromEnv()
+	if err != nil {
+		log.Fatalf("Could not configure secrets: %v", err)
+	}
+
+	// The connection string may come from DATABASE_URL, DATABASE_URL_FILE, a
+	// mounted secret or Vault. DATABASE_PASSWORD, looked up the same way,
+	// overrides any password in it.
+	dbURL, err := secrets.Get("DATABASE_URL")
+	if err != nil {
+		log.Fatalf("Could not load DATABASE_URL: %v", err)
+	}
 	if dbURL == "" {
-		log.Println("DATABASE_URL environment variable is not set")
-		dbURL = "user=rxlx password=thereISnosp0)n host=192.168.86.120 dbname=volconvo" // Default for local development
+		log.Fatal("DATABASE_URL is not set")
+	}
+	dbPassword, err := secrets.Get("DATABASE_PASSWORD")
+	if err != nil {
+		log.Fatalf("Could not load DATABASE_PASSWORD: %v", err)
 	}
 
 	// Initialize the database connection.
-	forumDB, err := forum.NewDatabase(dbURL)
+	forumDB, err := forum.OpenDatabase(dbURL, dbPassword)
 	if err != nil {
 		log.Fatalf("Could not initialize database: %v", err)
 	}
 	log.Println("Successfully connected to the database.")
-	forumDB.CreateTables()
+
+	// Optional read replicas, as a comma-separated DATABASE_REPLICA_URLS.
+	replicaURLs, err := secrets.Get("DATABASE_REPLICA_URLS")
+	if err != nil {
+		log.Fatalf("Could not load DATABASE_REPLICA_URLS: %v", err)
+	}
+	for _, dsn := range strings.Split(replicaURLs, ",") {
+		if dsn = strings.TrimSpace(dsn); dsn == "" {
+			continue
+		}
+		if err := forumDB.AddReplica(dsn, dbPassword); err != nil {
+			log.Fatalf("Could not add read replica: %v", err)
+		}
+	}
+	if err := forumDB.CreateTables(); err != nil {
+		log.Printf("Error applying schema: %v", err)
+	}
+
+	cfg, err := forum.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Could not load configuration: %v", err)
+	}
+	// The single sign-on client secret, SMTP password and CAPTCHA secret
+	// are looked up like the database credentials.
+	cfg.OIDC.ClientSecret, err = secrets.Get("FORUM_OIDC_CLIENT_SECRET")
+	if err != nil {
+		log.Fatalf("Could not load FORUM_OIDC_CLIENT_SECRET: %v", err)
+	}
+	cfg.SMTPPassword, err = secrets.Get("FORUM_SMTP_PASSWORD")
+	if err != nil {
+		log.Fatalf("Could not load FORUM_SMTP_PASSWORD: %v", err)
+	}
+	cfg.Captcha.Secret, err = secrets.Get("FORUM_CAPTCHA_SECRET")
+	if err != nil {
+		log.Fatalf("Could not load FORUM_CAPTCHA_SECRET: %v", err)
+	}
+
+	forumDB.SetQueryTimeout(cfg.QueryTimeout)
+	forumDB.SetSlowQueryThreshold(cfg.SlowQueryThreshold)
+	forumDB.SetCountCaching(cfg.CountCacheTTL, cfg.ApproxCountThreshold)
+	go forumDB.WatchWritable(cfg.ReadOnlyCheckInterval)
+	go forumDB.SweepSessions(cfg.SessionSweepInterval)
 
 	// Create the forum handler, injecting the database dependency.
-	forumHandler, err := forum.NewHandlers(forumDB)
+	forumHandler, err := forum.NewHandlers(forumDB, cfg)
 	if err != nil {
 		log.Fatalf("Could not create forum handler: %v", err)
 	}
@@ -36,17 +91,32 @@ func main() {
 	mux := http.NewServeMux()
 	forumHandler.RegisterRoutes(mux)
 
+	tlsCfg, err := tlsSettingsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+
 	// Start the server.
-	port := ":8080"
-	log.Printf("Starting forum server on %s", port)
-	sessionHandler := forumHandler.Session.LoadAndSave(mux)
+	addr := os.Getenv("FORUM_ADDR")
+	if addr == "" {
+		addr = ":8080"
+		if tlsCfg.enabled() {
+			addr = ":443"
+		}
+	}
+	log.Printf("Starting forum server on %s (TLS: %t)", addr, tlsCfg.enabled())
+	sessionHandler := forumHandler.RealClient(forumHandler.Session.LoadAndSave(forumHandler.LimitRequestBody(mux)))
 	svr := &http.Server{
-		Addr:    port,
+		Addr:    addr,
 		Handler: sessionHandler,
 	}
 
 	go forumHandler.StartNotificationListener(1250 * time.Second)
-	if err := svr.ListenAndServe(); err != nil {
+	go forumHandler.StartWebhookDispatcher()
+	go forumHandler.StartReminderScheduler()
+	go forumHandler.StartPublishScheduler()
+	go forumHandler.StartLinkPreviewer()
+	if err := tlsCfg.serve(svr); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
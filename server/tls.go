@@ -0,0 +1,115 @@
+// server/tls.go
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsSettings controls how the server terminates HTTPS. With neither a
+// certificate nor autocert domains configured it serves plain HTTP.
+type tlsSettings struct {
+	certFile  string
+	keyFile   string
+	domains   []string
+	email     string
+	cacheDir  string
+	redirAddr string
+}
+
+func tlsSettingsFromEnv() (tlsSettings, error) {
+	s := tlsSettings{
+		certFile:  os.Getenv("FORUM_TLS_CERT_FILE"),
+		keyFile:   os.Getenv("FORUM_TLS_KEY_FILE"),
+		email:     os.Getenv("FORUM_AUTOCERT_EMAIL"),
+		cacheDir:  os.Getenv("FORUM_AUTOCERT_CACHE"),
+		redirAddr: os.Getenv("FORUM_HTTP_REDIRECT_ADDR"),
+	}
+	for _, d := range strings.Split(os.Getenv("FORUM_AUTOCERT_DOMAINS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			s.domains = append(s.domains, d)
+		}
+	}
+	if (s.certFile == "") != (s.keyFile == "") {
+		return s, errors.New("FORUM_TLS_CERT_FILE and FORUM_TLS_KEY_FILE must be set together")
+	}
+	if s.certFile != "" && len(s.domains) > 0 {
+		return s, errors.New("set either a TLS certificate or FORUM_AUTOCERT_DOMAINS, not both")
+	}
+	if s.cacheDir == "" {
+		s.cacheDir = "autocert-cache"
+	}
+	if s.redirAddr == "" {
+		s.redirAddr = ":80"
+	}
+	return s, nil
+}
+
+func (s tlsSettings) enabled() bool {
+	return s.certFile != "" || len(s.domains) > 0
+}
+
+// serve runs svr with the configured TLS mode. When TLS is on, a plain HTTP
+// listener on redirAddr redirects to HTTPS and, in autocert mode, also
+// answers Let's Encrypt HTTP-01 challenges.
+func (s tlsSettings) serve(svr *http.Server) error {
+	if !s.enabled() {
+		return svr.ListenAndServe()
+	}
+
+	_, port, _ := net.SplitHostPort(svr.Addr)
+	redirect := redirectToHTTPS(port)
+	var handler http.Handler = redirect
+	if len(s.domains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.domains...),
+			Cache:      autocert.DirCache(s.cacheDir),
+			Email:      s.email,
+		}
+		svr.TLSConfig = m.TLSConfig()
+		handler = m.HTTPHandler(redirect)
+	} else {
+		svr.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	go func() {
+		redir := &http.Server{
+			Addr:              s.redirAddr,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		log.Printf("Redirecting HTTP on %s to HTTPS", s.redirAddr)
+		if err := redir.ListenAndServe(); err != nil {
+			log.Printf("HTTP redirect listener stopped: %v", err)
+		}
+	}()
+
+	return svr.ListenAndServeTLS(s.certFile, s.keyFile)
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS on
+// port, the TLS listener's, which is left out of the URL when it's 443.
+func redirectToHTTPS(port string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
@@ -0,0 +1,84 @@
+// storetest/sessions.go
+package storetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rexlx/volconvo/forum"
+)
+
+// RunSessions runs the session lookup checks against a forum.SessionStore.
+// They pin down the cases that used to hand ValidateSessionToken a nil token:
+//
+//	func TestSessions(t *testing.T) {
+//		storetest.RunSessions(t, func(t *testing.T) forum.SessionStore { return forumtest.NewDatabase(t) })
+//	}
+func RunSessions(t *testing.T, newStore func(t *testing.T) forum.SessionStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s forum.SessionStore)
+	}{
+		{"LiveToken", testLiveToken},
+		{"MissingToken", testMissingToken},
+		{"ExpiredToken", testExpiredToken},
+		{"MalformedToken", testMalformedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func newToken(t *testing.T, s forum.SessionStore, ttl time.Duration) *forum.Token {
+	t.Helper()
+	tk, err := new(forum.Token).CreateToken(uuid.NewString(), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk.Email = "member@example.com"
+	tk.Handle = "member"
+	tk.CreatedAt = time.Now()
+	if err := s.SaveToken(tk); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+	return tk
+}
+
+func testLiveToken(t *testing.T, s forum.SessionStore) {
+	tk := newToken(t, s, time.Hour)
+	got, err := s.LookupSession(tk.Token)
+	if err != nil || got == nil {
+		t.Fatalf("LookupSession(live) = %v, %v", got, err)
+	}
+	if got.ID != tk.ID || got.UserID != tk.UserID {
+		t.Errorf("LookupSession(live) = %+v; want session %s for %s", got, tk.ID, tk.UserID)
+	}
+}
+
+func testMissingToken(t *testing.T, s forum.SessionStore) {
+	got, err := s.LookupSession(uuid.NewString())
+	if !errors.Is(err, forum.ErrNotFound) || got != nil {
+		t.Errorf("LookupSession(missing) = %v, %v; want nil, ErrNotFound", got, err)
+	}
+}
+
+func testExpiredToken(t *testing.T, s forum.SessionStore) {
+	tk := newToken(t, s, -time.Minute)
+	got, err := s.LookupSession(tk.Token)
+	if !errors.Is(err, forum.ErrUnauthorized) || got != nil {
+		t.Errorf("LookupSession(expired) = %v, %v; want nil, ErrUnauthorized", got, err)
+	}
+}
+
+func testMalformedToken(t *testing.T, s forum.SessionStore) {
+	for _, value := range []string{"", "not-a-token", "' OR 1=1 --", uuid.NewString() + "x"} {
+		got, err := s.LookupSession(value)
+		if !errors.Is(err, forum.ErrValidation) || got != nil {
+			t.Errorf("LookupSession(%q) = %v, %v; want nil, ErrValidation", value, got, err)
+		}
+	}
+}
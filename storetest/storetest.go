@@ -0,0 +1,367 @@
+// storetest/storetest.go
+
+// Package storetest is a conformance suite for forum.Store implementations.
+// Every backend runs the same checks, so they can't drift apart in the
+// details handlers depend on: pagination order, search, conflict detection
+// and what a missing record looks like. For Postgres:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) forum.Store { return forumtest.NewDatabase(t) })
+//	}
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rexlx/volconvo/forum"
+)
+
+// Run runs the suite. newStore must return an empty store for each subtest.
+func Run(t *testing.T, newStore func(t *testing.T) forum.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s forum.Store)
+	}{
+		{"NotFound", testNotFound},
+		{"TopicPagination", testTopicPagination},
+		{"TopicSearch", testTopicSearch},
+		{"TagFilter", testTagFilter},
+		{"PostPagination", testPostPagination},
+		{"SoftDelete", testSoftDelete},
+		{"TopicConflict", testTopicConflict},
+		{"PostConflict", testPostConflict},
+		{"UserConflict", testUserConflict},
+		{"ConcurrentModifyUser", testConcurrentModifyUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func newUser(t *testing.T, s forum.Store, handle string) *forum.User {
+	t.Helper()
+	u, err := forum.NewUser(handle+"@example.com", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Handle = handle
+	if err := s.SaveUser(u); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	return u
+}
+
+func newTopic(t *testing.T, s forum.Store, author *forum.User, title string, tags ...string) *forum.Topic {
+	t.Helper()
+	if tags == nil {
+		tags = []string{}
+	}
+	topic := &forum.Topic{ID: forum.NewTopicID(), Title: title, Tags: tags, AuthorID: author.ID}
+	if err := s.CreateTopic(topic); err != nil {
+		t.Fatalf("CreateTopic: %v", err)
+	}
+	return topic
+}
+
+func newPost(t *testing.T, s forum.Store, topic *forum.Topic, author *forum.User, body string) *forum.Post {
+	t.Helper()
+	p := &forum.Post{TopicID: topic.ID, Author: author.Handle, AuthorID: author.ID, Body: body}
+	if err := s.CreatePost(p); err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	return p
+}
+
+func testNotFound(t *testing.T, s forum.Store) {
+	if topic, err := s.GetTopic(uuid.New()); !errors.Is(err, forum.ErrNotFound) {
+		t.Errorf("GetTopic(missing) = %v, %v; want ErrNotFound", topic, err)
+	}
+	if post, err := s.GetPost(1 << 40); !errors.Is(err, forum.ErrNotFound) {
+		t.Errorf("GetPost(missing) = %v, %v; want ErrNotFound", post, err)
+	}
+	if user, err := s.GetUserByID(uuid.NewString()); !errors.Is(err, forum.ErrNotFound) {
+		t.Errorf("GetUserByID(missing) = %v, %v; want ErrNotFound", user, err)
+	}
+	if user, err := s.GetUserByEmail("nobody@example.com"); !errors.Is(err, forum.ErrNotFound) {
+		t.Errorf("GetUserByEmail(missing) = %v, %v; want ErrNotFound", user, err)
+	}
+	if _, err := s.ModifyUser(uuid.NewString(), func(*forum.User) error { return nil }); !errors.Is(err, forum.ErrNotFound) {
+		t.Errorf("ModifyUser(missing) = %v; want ErrNotFound", err)
+	}
+	author := newUser(t, s, "author")
+	if err := s.CreatePost(&forum.Post{TopicID: uuid.NewString(), Author: author.Handle, AuthorID: author.ID, Body: "orphan"}); err == nil {
+		t.Error("CreatePost in a missing topic succeeded")
+	}
+}
+
+func testTopicPagination(t *testing.T, s forum.Store) {
+	author := newUser(t, s, "author")
+	var ids []string
+	for i := 0; i < 7; i++ {
+		ids = append(ids, newTopic(t, s, author, fmt.Sprintf("topic %d", i)).ID)
+	}
+	var seen []string
+	for page, want := range []int{3, 3, 1, 0} {
+		topics, err := s.SearchAndListTopics(forum.TopicFilter{}, page+1, 3)
+		if err != nil {
+			t.Fatalf("SearchAndListTopics page %d: %v", page+1, err)
+		}
+		if len(topics) != want {
+			t.Fatalf("page %d has %d topics, want %d", page+1, len(topics), want)
+		}
+		for _, topic := range topics {
+			seen = append(seen, topic.ID)
+		}
+	}
+	for i, id := range seen {
+		if want := ids[len(ids)-1-i]; id != want {
+			t.Fatalf("listing position %d is %s, want %s (newest first)", i, id, want)
+		}
+	}
+	if n, err := s.CountTopics(forum.TopicFilter{}); err != nil || n != 7 {
+		t.Errorf("CountTopics = %d, %v; want 7", n, err)
+	}
+}
+
+func testTopicSearch(t *testing.T, s forum.Store) {
+	author := newUser(t, s, "author")
+	newTopic(t, s, author, "Tuning Postgres", "databases")
+	newTopic(t, s, author, "Garden notes", "postgres")
+	newTopic(t, s, author, "Unrelated")
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"postgres", 2},
+		{"TUNING", 1},
+		{"databases", 1},
+		{"data", 0}, // tags match whole, titles by word
+		{"nothing like it", 0},
+	} {
+		topics, err := s.SearchAndListTopics(forum.TopicFilter{Query: tc.query}, 1, 10)
+		if err != nil {
+			t.Fatalf("SearchAndListTopics(%q): %v", tc.query, err)
+		}
+		if len(topics) != tc.want {
+			t.Errorf("SearchAndListTopics(%q) found %d, want %d", tc.query, len(topics), tc.want)
+		}
+		if n, err := s.CountTopics(forum.TopicFilter{Query: tc.query}); err != nil || n != tc.want {
+			t.Errorf("CountTopics(%q) = %d, %v; want %d", tc.query, n, err, tc.want)
+		}
+	}
+}
+
+func testTagFilter(t *testing.T, s forum.Store) {
+	author := newUser(t, s, "author")
+	newTopic(t, s, author, "Go and Postgres", "go", "postgres")
+	newTopic(t, s, author, "Go basics", "go")
+	newTopic(t, s, author, "Postgres basics", "postgres")
+	newTopic(t, s, author, "Untagged")
+	for _, tc := range []struct {
+		filter forum.TopicFilter
+		want   int
+	}{
+		{forum.TopicFilter{Tags: []string{"go", "postgres"}, MatchAll: true}, 1},
+		{forum.TopicFilter{Tags: []string{"go", "postgres"}}, 3},
+		{forum.TopicFilter{Tags: []string{"go"}, MatchAll: true}, 2},
+		{forum.TopicFilter{Tags: []string{"rust"}}, 0},
+		{forum.TopicFilter{Query: "basics", Tags: []string{"go", "postgres"}}, 2},
+	} {
+		topics, err := s.SearchAndListTopics(tc.filter, 1, 10)
+		if err != nil {
+			t.Fatalf("SearchAndListTopics(%+v): %v", tc.filter, err)
+		}
+		if len(topics) != tc.want {
+			t.Errorf("SearchAndListTopics(%+v) found %d, want %d", tc.filter, len(topics), tc.want)
+		}
+		if n, err := s.CountTopics(tc.filter); err != nil || n != tc.want {
+			t.Errorf("CountTopics(%+v) = %d, %v; want %d", tc.filter, n, err, tc.want)
+		}
+	}
+}
+
+func testPostPagination(t *testing.T, s forum.Store) {
+	author := newUser(t, s, "author")
+	topic := newTopic(t, s, author, "thread")
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		ids = append(ids, newPost(t, s, topic, author, fmt.Sprintf("post %d", i)).ID)
+	}
+	topicID := uuid.MustParse(topic.ID)
+	var seen []int64
+	for page := 1; page <= 3; page++ {
+		posts, err := s.GetPostsByTopic(topicID, page, 2)
+		if err != nil {
+			t.Fatalf("GetPostsByTopic page %d: %v", page, err)
+		}
+		for _, p := range posts {
+			seen = append(seen, p.ID)
+		}
+	}
+	if fmt.Sprint(seen) != fmt.Sprint(ids) {
+		t.Errorf("posts listed as %v, want %v (oldest first)", seen, ids)
+	}
+	if n, err := s.CountPostsByTopic(topicID); err != nil || n != 5 {
+		t.Errorf("CountPostsByTopic = %d, %v; want 5", n, err)
+	}
+	if got, err := s.GetTopic(topicID); err != nil || got == nil || got.ReplyCount != 5 {
+		t.Errorf("GetTopic after 5 posts = %+v, %v; want ReplyCount 5", got, err)
+	}
+}
+
+func testSoftDelete(t *testing.T, s forum.Store) {
+	author := newUser(t, s, "author")
+	kept := newTopic(t, s, author, "kept")
+	gone := newTopic(t, s, author, "gone")
+	inGone := newPost(t, s, gone, author, "in a deleted topic")
+	first := newPost(t, s, kept, author, "first")
+	newPost(t, s, kept, author, "second")
+
+	if err := s.DeleteTopic(gone.ID); err != nil {
+		t.Fatalf("DeleteTopic: %v", err)
+	}
+	if err := s.DeletePost(first.ID); err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+	if topic, err := s.GetTopic(uuid.MustParse(gone.ID)); !errors.Is(err, forum.ErrNotFound) {
+		t.Errorf("GetTopic(deleted) = %v, %v; want ErrNotFound", topic, err)
+	}
+	for _, id := range []int64{first.ID, inGone.ID} {
+		if post, err := s.GetPost(id); !errors.Is(err, forum.ErrNotFound) {
+			t.Errorf("GetPost(%d) = %v, %v; want ErrNotFound", id, post, err)
+		}
+	}
+	if n, err := s.CountTopics(forum.TopicFilter{}); err != nil || n != 1 {
+		t.Errorf("CountTopics = %d, %v; want 1", n, err)
+	}
+	keptID := uuid.MustParse(kept.ID)
+	if posts, err := s.GetPostsByTopic(keptID, 1, 10); err != nil || len(posts) != 1 {
+		t.Errorf("GetPostsByTopic = %d posts, %v; want 1", len(posts), err)
+	}
+	if topic, err := s.GetTopic(keptID); err != nil || topic == nil || topic.ReplyCount != 1 {
+		t.Errorf("GetTopic after delete = %+v, %v; want ReplyCount 1", topic, err)
+	}
+	if err := s.CreatePost(&forum.Post{TopicID: gone.ID, Author: author.Handle, AuthorID: author.ID, Body: "late"}); err == nil {
+		t.Error("CreatePost in a deleted topic succeeded")
+	}
+}
+
+func testTopicConflict(t *testing.T, s forum.Store) {
+	author := newUser(t, s, "author")
+	topic := newTopic(t, s, author, "before")
+	loaded, err := s.GetTopic(uuid.MustParse(topic.ID))
+	if err != nil || loaded == nil {
+		t.Fatalf("GetTopic: %v, %v", loaded, err)
+	}
+	stale := loaded.Version
+	loaded.Title = "first edit"
+	if err := s.UpdateTopic(loaded, stale); err != nil {
+		t.Fatalf("UpdateTopic: %v", err)
+	}
+	if loaded.Version != stale+1 {
+		t.Errorf("version after update = %d, want %d", loaded.Version, stale+1)
+	}
+	loaded.Title = "second edit"
+	if err := s.UpdateTopic(loaded, stale); !errors.Is(err, forum.ErrConflict) {
+		t.Errorf("UpdateTopic with stale version = %v, want ErrConflict", err)
+	}
+	if err := s.UpdateTopic(loaded, 0); err != nil {
+		t.Errorf("unconditional UpdateTopic: %v", err)
+	}
+}
+
+func testPostConflict(t *testing.T, s forum.Store) {
+	author := newUser(t, s, "author")
+	post := newPost(t, s, newTopic(t, s, author, "thread"), author, "original")
+	loaded, err := s.GetPost(post.ID)
+	if err != nil || loaded == nil {
+		t.Fatalf("GetPost: %v, %v", loaded, err)
+	}
+	stale := loaded.Version
+	if err := s.UpdatePostBody(loaded, "edited", author, stale); err != nil {
+		t.Fatalf("UpdatePostBody: %v", err)
+	}
+	if err := s.UpdatePostBody(loaded, "edited again", author, stale); !errors.Is(err, forum.ErrConflict) {
+		t.Errorf("UpdatePostBody with stale version = %v, want ErrConflict", err)
+	}
+	if got, _ := s.GetPost(post.ID); got == nil || got.Body != "edited" {
+		t.Errorf("body after conflicting edit = %+v, want %q", got, "edited")
+	}
+}
+
+func testUserConflict(t *testing.T, s forum.Store) {
+	u := newUser(t, s, "member")
+	a, _ := s.GetUserByID(u.ID)
+	b, _ := s.GetUserByID(u.ID)
+	if a == nil || b == nil {
+		t.Fatal("GetUserByID returned nil for a saved user")
+	}
+	a.Handle = "first"
+	if err := s.SaveUser(a); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	b.Handle = "second"
+	if err := s.SaveUser(b); !errors.Is(err, forum.ErrConflict) {
+		t.Errorf("SaveUser of a stale copy = %v, want ErrConflict", err)
+	}
+	if got, _ := s.GetUserByEmail(u.Email); got == nil || got.Handle != "first" {
+		t.Errorf("handle after conflict = %+v, want %q", got, "first")
+	}
+
+	// A new user can't take over an account by signing up with its email.
+	dup, err := forum.NewUser(u.Email, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup.Handle = "impostor"
+	if err := s.SaveUser(dup); !errors.Is(err, forum.ErrConflict) {
+		t.Errorf("SaveUser of a new user with a taken email = %v, want ErrConflict", err)
+	}
+	if got, _ := s.GetUserByEmail(u.Email); got == nil || got.ID != u.ID || got.Handle != "first" || got.Admin {
+		t.Errorf("account after duplicate signup = %+v, want it unchanged", got)
+	}
+}
+
+func testConcurrentModifyUser(t *testing.T, s forum.Store) {
+	u := newUser(t, s, "member")
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.ModifyUser(u.ID, func(u *forum.User) error {
+				u.Notifications = append(u.Notifications, forum.Notification{ID: fmt.Sprint(i), UserID: u.ID})
+				return nil
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	failed := 0
+	for err := range errs {
+		if err != nil {
+			// Retries are bounded, so heavy contention may exhaust them,
+			// but only with ErrConflict.
+			if !errors.Is(err, forum.ErrConflict) {
+				t.Fatalf("ModifyUser: %v", err)
+			}
+			failed++
+		}
+	}
+	got, err := s.GetUserByID(u.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetUserByID: %v, %v", got, err)
+	}
+	if len(got.Notifications) != writers-failed {
+		t.Errorf("%d notifications after %d successful writers; updates were lost", len(got.Notifications), writers-failed)
+	}
+}